@@ -0,0 +1,285 @@
+// Package atrest はメモのタイトル・本文の保存時の暗号化 (エンベロープ暗号化) を実装します。
+//
+// マスター鍵 (設定または鍵ファイル) でユーザーごとのデータ鍵をラップして DB に保存し、
+// タイトル・本文はデータ鍵で AES-256-GCM により暗号化します。
+// 暗号化した値は "enc1:<データ鍵ID>:<base64>" の形式で、接頭辞の無い値は平文 (暗号化を有効にする前のデータ) として扱います。
+package atrest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	valuePrefix = "enc1:"
+	keySize     = 32
+)
+
+var (
+	// ErrInvalidMasterKey はマスター鍵が 32 バイトでない場合のエラーです
+	ErrInvalidMasterKey = errors.New("atrest: master key must be 32 bytes (base64 encoded)")
+	// ErrUnknownMasterKey はデータ鍵をラップしたマスター鍵が設定されていない場合のエラーです
+	ErrUnknownMasterKey = errors.New("atrest: data key is wrapped with an unknown master key")
+	// ErrDecrypt は暗号文が壊れているか鍵が違う場合のエラーです
+	ErrDecrypt = errors.New("atrest: could not decrypt value")
+)
+
+// Current はアプリ全体で使用する Cipher です (nil なら暗号化しない)
+var Current *Cipher
+
+// Enable は Cipher を有効にし、メモの保存・読み込み時に暗号化・復号するようにします (nil で無効)
+func Enable(c *Cipher) {
+	Current = c
+	if c == nil {
+		models.MemoCipher = nil
+		return
+	}
+	models.MemoCipher = c
+}
+
+// Cipher はマスター鍵とデータ鍵のキャッシュを持ち、メモのフィールドを暗号化・復号します
+type Cipher struct {
+	masterID string
+	masters  map[string][]byte // マスター鍵ID -> マスター鍵 (ローテーション中の古い鍵を含む)
+	indexKey []byte            // 検索用インデックスの HMAC 鍵 (マスター鍵から導出)
+
+	mu       sync.RWMutex
+	dataKeys map[string][]byte // データ鍵ID -> ラップを解いたデータ鍵
+}
+
+// New は Cipher を作成します。previous にはローテーション前のマスター鍵を指定します (古いデータ鍵のラップを解くため)。
+func New(master []byte, previous ...[]byte) (*Cipher, error) {
+	if len(master) != keySize {
+		return nil, ErrInvalidMasterKey
+	}
+	c := &Cipher{
+		masterID: masterKeyID(master),
+		masters:  map[string][]byte{},
+		indexKey: derive(master, "fast-memos search index"),
+		dataKeys: map[string][]byte{},
+	}
+	c.masters[c.masterID] = master
+	for _, key := range previous {
+		if len(key) != keySize {
+			return nil, ErrInvalidMasterKey
+		}
+		c.masters[masterKeyID(key)] = key
+	}
+	return c, nil
+}
+
+// LoadFromEnv は環境変数からマスター鍵を読み込みます。設定されていなければ nil を返します。
+//
+//	ENCRYPTION_MASTER_KEY / ENCRYPTION_MASTER_KEY_FILE:         マスター鍵 (base64、32バイト) またはそのファイル
+//	ENCRYPTION_OLD_MASTER_KEY / ENCRYPTION_OLD_MASTER_KEY_FILE: ローテーション前のマスター鍵 (任意)
+func LoadFromEnv() (*Cipher, error) {
+	master, err := loadKey("ENCRYPTION_MASTER_KEY")
+	if err != nil || master == nil {
+		return nil, err
+	}
+	old, err := loadKey("ENCRYPTION_OLD_MASTER_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return New(master)
+	}
+	return New(master, old)
+}
+
+// loadKey は name または name_FILE の環境変数から鍵を読み込みます。
+// ファイルには base64 の文字列か、32バイトの鍵そのものを保存します。
+func loadKey(name string) ([]byte, error) {
+	value := os.Getenv(name)
+	if path := os.Getenv(name + "_FILE"); value == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("atrest: read %s: %w", name+"_FILE", err)
+		}
+		if len(data) == keySize {
+			return data, nil
+		}
+		value = string(data)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMasterKey, name)
+	}
+	return key, nil
+}
+
+// Encrypt はユーザーの現在のデータ鍵で値を暗号化します (空文字はそのまま)
+func (c *Cipher) Encrypt(tx *gorm.DB, userID, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	keyID, key, err := c.currentDataKey(tx, userID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(key, []byte(plaintext), []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return valuePrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt は Encrypt で暗号化した値を復号します。暗号化されていない値はそのまま返します。
+func (c *Cipher) Decrypt(tx *gorm.DB, value string) (string, error) {
+	if !strings.HasPrefix(value, valuePrefix) {
+		return value, nil
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, valuePrefix), ":")
+	if !ok {
+		return "", ErrDecrypt
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	key, err := c.dataKey(tx, keyID)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(key, sealed, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// currentDataKey は現在のマスター鍵でラップされたユーザーの最新のデータ鍵を返します。無ければ作成します。
+// ローテーションを別のプロセスで実行しても新しい鍵を使うよう、現在の鍵はキャッシュせず毎回DBで確認します。
+func (c *Cipher) currentDataKey(tx *gorm.DB, userID string) (string, []byte, error) {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var row models.UserDataKey
+	err := db.Where("user_id = ? AND master_key_id = ?", userID, c.masterID).Order("created_at desc").Limit(1).Find(&row).Error
+	if err != nil {
+		return "", nil, err
+	}
+	if row.ID == "" {
+		return c.newDataKey(db, userID)
+	}
+	key, err := c.dataKey(db, row.ID)
+	return row.ID, key, err
+}
+
+// newDataKey はユーザーの新しいデータ鍵を作成し、マスター鍵でラップして保存します
+func (c *Cipher) newDataKey(db *gorm.DB, userID string) (string, []byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	row := models.UserDataKey{ID: utils.GenerateID(), UserID: userID, MasterKeyID: c.masterID}
+	wrapped, err := seal(c.masters[c.masterID], key, []byte(row.ID))
+	if err != nil {
+		return "", nil, err
+	}
+	row.WrappedKey = base64.StdEncoding.EncodeToString(wrapped)
+	if err := db.Create(&row).Error; err != nil {
+		return "", nil, err
+	}
+	c.mu.Lock()
+	c.dataKeys[row.ID] = key
+	c.mu.Unlock()
+	return row.ID, key, nil
+}
+
+// dataKey はデータ鍵のラップを解いて返します (鍵は変わらないのでキャッシュする)
+func (c *Cipher) dataKey(tx *gorm.DB, keyID string) ([]byte, error) {
+	c.mu.RLock()
+	key, ok := c.dataKeys[keyID]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	var row models.UserDataKey
+	if err := tx.Session(&gorm.Session{NewDB: true}).Where("id = ?", keyID).First(&row).Error; err != nil {
+		return nil, fmt.Errorf("atrest: data key %s: %w", keyID, err)
+	}
+	master, ok := c.masters[row.MasterKeyID]
+	if !ok {
+		return nil, ErrUnknownMasterKey
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(row.WrappedKey)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	key, err = open(master, wrapped, []byte(row.ID))
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.dataKeys[keyID] = key
+	c.mu.Unlock()
+	return key, nil
+}
+
+// masterKeyID はマスター鍵を識別するためのID (SHA-256 の先頭8バイト) です
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// derive はマスター鍵から用途別の鍵を導出します
+func derive(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// seal は AES-256-GCM で暗号化し、ノンス + 暗号文を返します
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
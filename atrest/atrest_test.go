@@ -0,0 +1,213 @@
+package atrest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func enableForTest(t *testing.T, c *Cipher) {
+	Enable(c)
+	t.Cleanup(func() { Enable(nil) })
+}
+
+// rawColumn はフックを通さずにDBに保存された値を返します
+func rawColumn(t *testing.T, db *gorm.DB, memoID, column string) string {
+	var value string
+	if err := db.Raw("SELECT "+column+" FROM memos WHERE id = ?", memoID).Scan(&value).Error; err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestMemoFieldsEncryptedAtRest(t *testing.T) {
+	db := openTestDB(t)
+	c, err := New(bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+	enableForTest(t, c)
+
+	memo := models.Memo{ID: "m1", Title: "給与明細", Content: "口座番号 1234", UserID: "u1"}
+	assert.NoError(t, db.Create(&memo).Error)
+	// 保存後の構造体は平文のまま
+	assert.Equal(t, "給与明細", memo.Title)
+
+	raw := rawColumn(t, db, "m1", "content")
+	assert.True(t, strings.HasPrefix(raw, valuePrefix))
+	assert.NotContains(t, raw, "1234")
+
+	var loaded models.Memo
+	assert.NoError(t, db.First(&loaded, "id = ?", "m1").Error)
+	assert.Equal(t, "給与明細", loaded.Title)
+	assert.Equal(t, "口座番号 1234", loaded.Content)
+
+	// 別のプロセス (キャッシュが空) でもDBのデータ鍵から復号できる
+	fresh, _ := New(bytes.Repeat([]byte{1}, 32))
+	content, err := fresh.Decrypt(db, raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "口座番号 1234", content)
+
+	// 暗号化する前の平文はそのまま読める
+	assert.NoError(t, db.Exec("UPDATE memos SET content = ? WHERE id = ?", "legacy", "m1").Error)
+	assert.NoError(t, db.First(&loaded, "id = ?", "m1").Error)
+	assert.Equal(t, "legacy", loaded.Content)
+
+	_, err = New([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidMasterKey)
+}
+
+func TestSearchTokens(t *testing.T) {
+	c, _ := New(bytes.Repeat([]byte{1}, 32))
+	text := c.SearchTokens("Go言語のメモ")
+	for _, query := range []string{"言語", "go言", "のメモ", "ノメモ", "ＧＯ"} {
+		for _, token := range c.queryTokens(query) {
+			assert.Contains(t, text, token, query)
+		}
+	}
+	assert.Empty(t, c.queryTokens("a"))
+
+	// マスター鍵が違えばトークンも異なる
+	other, _ := New(bytes.Repeat([]byte{2}, 32))
+	assert.NotEqual(t, c.SearchTokens("言語"), other.SearchTokens("言語"))
+}
+
+func TestPrepareIndex(t *testing.T) {
+	db := openTestDB(t)
+	c, _ := New(bytes.Repeat([]byte{1}, 32))
+	enableForTest(t, c)
+	memo := models.Memo{ID: "m1", Title: "会議", Content: "予算の確認", UserID: "u1"}
+	assert.NoError(t, db.Create(&memo).Error)
+	deleted := models.Memo{ID: "m2", Title: "削除済み", UserID: "u1"}
+	assert.NoError(t, db.Create(&deleted).Error)
+	assert.NoError(t, db.Delete(&deleted).Error)
+	// 以前の形式で作ったトークン
+	assert.NoError(t, db.Create(&models.MemoSearchToken{MemoID: "m1", Token: "stale"}).Error)
+
+	// 形式の記録が無ければすべて作り直す
+	indexed, err := c.PrepareIndex(db, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, indexed)
+	var tokens []string
+	db.Model(&models.MemoSearchToken{}).Where("memo_id = ?", "m1").Order("token").Pluck("token", &tokens)
+	expected := c.SearchTokens("会議\n予算の確認")
+	sort.Strings(expected)
+	assert.Equal(t, expected, tokens)
+
+	// 形式が同じなら作り直さない
+	indexed, err = c.PrepareIndex(db, 1)
+	assert.NoError(t, err)
+	assert.Zero(t, indexed)
+}
+
+func TestRotate(t *testing.T) {
+	db := openTestDB(t)
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	// 暗号化を有効にする前のメモ
+	assert.NoError(t, db.Create(&models.Memo{ID: "plain", Title: "old", Content: "plaintext memo", UserID: "u1"}).Error)
+	assert.NoError(t, db.Create(&models.Task{ID: "t1", MemoID: "plain", UserID: "u1", Text: "plaintext task"}).Error)
+
+	old, _ := New(oldKey)
+	enableForTest(t, old)
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, db.Create(&models.Memo{ID: id, Title: "title " + id, Content: "content " + id, UserID: "u" + id}).Error)
+	}
+	assert.NoError(t, db.Create(&models.MemoProperty{MemoID: "a", Key: "tags", UserID: "ua", Type: "list", Value: `["work"]`}).Error)
+	assert.NoError(t, db.Create(&models.Comment{ID: "c1", MemoID: "a", UserID: "ua", Body: "comment a"}).Error)
+	assert.NoError(t, db.Delete(&models.Memo{}, "id = ?", "c").Error)
+	before := rawColumn(t, db, "a", "content")
+
+	// マスター鍵を変更してローテーションする
+	rotated, err := New(newKey, oldKey)
+	assert.NoError(t, err)
+	Enable(rotated)
+	result, err := rotated.Rotate(db, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Memos)
+	assert.Equal(t, 3, result.Rows)
+	assert.EqualValues(t, 3, result.DeletedKeys)
+
+	assert.NotEqual(t, before, rawColumn(t, db, "a", "content"))
+	assert.True(t, strings.HasPrefix(rawColumn(t, db, "plain", "content"), valuePrefix))
+	assert.True(t, strings.HasPrefix(rawColumn(t, db, "c", "content"), valuePrefix))
+
+	// 古いマスター鍵が無くても読める
+	onlyNew, _ := New(newKey)
+	Enable(onlyNew)
+	var memos []models.Memo
+	assert.NoError(t, db.Unscoped().Order("id").Find(&memos).Error)
+	if assert.Len(t, memos, 4) {
+		assert.Equal(t, "content a", memos[0].Content)
+		assert.Equal(t, "plaintext memo", memos[3].Content)
+	}
+	var remaining int64
+	db.Model(&models.UserDataKey{}).Where("master_key_id <> ?", onlyNew.masterID).Count(&remaining)
+	assert.Zero(t, remaining)
+
+	// タスク・プロパティ・コメントも新しい鍵で暗号化され、プロパティの絞り込み用トークンも作り直されている
+	var task models.Task
+	assert.NoError(t, db.First(&task, "id = ?", "t1").Error)
+	assert.Equal(t, "plaintext task", task.Text)
+	var rawTask string
+	db.Raw("SELECT text FROM tasks WHERE id = ?", "t1").Scan(&rawTask)
+	assert.True(t, strings.HasPrefix(rawTask, valuePrefix))
+	var property models.MemoProperty
+	assert.NoError(t, db.First(&property, "memo_id = ?", "a").Error)
+	assert.Equal(t, `["work"]`, property.Value)
+	assert.Equal(t, onlyNew.PropertyTokens("list", `["work"]`), property.ValueTokens)
+	assert.Contains(t, property.ValueTokens, onlyNew.PropertyToken("work"))
+	var comment models.Comment
+	assert.NoError(t, db.First(&comment, "id = ?", "c1").Error)
+	assert.Equal(t, "comment a", comment.Body)
+
+	// 検索用インデックスも新しい鍵で作り直されている (削除済みのメモは除く)
+	condition, args, ok := onlyNew.SearchCondition("plaintext")
+	assert.True(t, ok)
+	var ids []string
+	db.Model(&models.Memo{}).Where(condition, args...).Pluck("id", &ids)
+	assert.Equal(t, []string{"plain"}, ids)
+	condition, args, _ = onlyNew.SearchCondition("content c")
+	var deletedIDs []string // 1文字の語はトークンにならないので a, b も候補になる
+	db.Model(&models.Memo{}).Unscoped().Where(condition, args...).Pluck("id", &deletedIDs)
+	assert.NotContains(t, deletedIDs, "c")
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_MASTER_KEY", "")
+	t.Setenv("ENCRYPTION_MASTER_KEY_FILE", "")
+	c, err := LoadFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	path := filepath.Join(t.TempDir(), "master.key")
+	assert.NoError(t, os.WriteFile(path, bytes.Repeat([]byte{3}, 32), 0600))
+	t.Setenv("ENCRYPTION_MASTER_KEY_FILE", path)
+	c, err = LoadFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, masterKeyID(bytes.Repeat([]byte{3}, 32)), c.masterID)
+
+	t.Setenv("ENCRYPTION_MASTER_KEY", "bm90IDMyIGJ5dGVz")
+	_, err = LoadFromEnv()
+	assert.ErrorIs(t, err, ErrInvalidMasterKey)
+}
@@ -0,0 +1,144 @@
+package atrest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"gorm.io/gorm"
+)
+
+// 検索用インデックスは正規化した文字列の2文字ずつの並び (utils.SearchGrams) を HMAC したトークンで作ります。
+// 空白で区切らない日本語でも部分一致で候補を絞れます。候補には一致しないメモも含まれうるので、
+// 呼び出し側で復号した本文を確認してください。
+
+// indexVersion は検索用インデックスの形式のバージョンです。トークンの作り方を変えたら上げてください (起動時に作り直す)。
+const indexVersion = 2
+
+// indexName は models.IndexVersion に記録する検索用インデックスの名前です
+const indexName = "memo_search_tokens"
+
+// SearchTokens は索引する文字列の検索用トークン (重複なし) を返します
+func (c *Cipher) SearchTokens(text string) []string {
+	return c.tokens(utils.SearchGrams(text))
+}
+
+// queryTokens はキーワードの検索用トークン (重複なし) を返します。1文字のキーワードなら空です。
+func (c *Cipher) queryTokens(query string) []string {
+	grams, _ := utils.SearchQueryGrams(query)
+	return c.tokens(grams)
+}
+
+func (c *Cipher) tokens(grams []string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	for _, gram := range grams {
+		token := c.token(gram)
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func (c *Cipher) token(gram string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(gram))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// PropertyToken はプロパティの値を絞り込み用に HMAC したトークンを返します (一致するかどうかだけを比べられる)
+func (c *Cipher) PropertyToken(value string) string {
+	// 検索用インデックスのトークンと区別するため、値の前に区切りを付ける
+	return c.token("property\x00" + value)
+}
+
+// PropertyTokens はプロパティの値の絞り込み用トークンを JSON 配列で返します。
+// list 型は要素ごとに、それ以外は文字列表現のトークンを作ります。
+func (c *Cipher) PropertyTokens(kind, value string) string {
+	values := []string{value}
+	if kind == utils.PropertyList {
+		values = nil
+		json.Unmarshal([]byte(value), &values)
+	}
+	tokens := make([]string, 0, len(values))
+	for _, v := range values {
+		tokens = append(tokens, c.PropertyToken(v))
+	}
+	encoded, _ := json.Marshal(tokens)
+	return string(encoded)
+}
+
+// IndexMemo はメモのタイトル・本文 (エンドツーエンド暗号化されたメモはタイトルのみ) の検索用インデックスを作り直します
+func (c *Cipher) IndexMemo(tx *gorm.DB, memo *models.Memo) error {
+	if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoSearchToken{}).Error; err != nil {
+		return err
+	}
+	text := memo.Title
+	if !memo.Encrypted {
+		// タイトルと本文をまたぐ並びが一致しないよう改行で区切る (改行は語の区切りになる)
+		text += "\n" + memo.Content
+	}
+	tokens := c.SearchTokens(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	rows := make([]models.MemoSearchToken, 0, len(tokens))
+	for _, token := range tokens {
+		rows = append(rows, models.MemoSearchToken{MemoID: memo.ID, Token: token})
+	}
+	return tx.CreateInBatches(&rows, 500).Error
+}
+
+// SearchCondition はキーワードのトークンをすべて含むメモに絞り込む memos の条件を返します。
+// キーワードが1文字の場合はトークンが無いので ok は false です (呼び出し側で全件を確認する)。
+func (c *Cipher) SearchCondition(query string) (condition string, args []interface{}, ok bool) {
+	tokens := c.queryTokens(query)
+	if len(tokens) == 0 {
+		return "", nil, false
+	}
+	return "memos.id IN (SELECT memo_id FROM memo_search_tokens WHERE token IN ? GROUP BY memo_id HAVING COUNT(*) = ?)",
+		[]interface{}{tokens, len(tokens)}, true
+}
+
+// PrepareIndex は起動時に検索用インデックスを準備します。索引の形式が古い (または記録が無い) 場合は、
+// 削除されていないすべてのメモの索引を batchSize 件ずつ作り直し、作り直したメモの数を返します。
+func (c *Cipher) PrepareIndex(db *gorm.DB, batchSize int) (int, error) {
+	var versions []models.IndexVersion
+	if err := db.Where("name = ?", indexName).Limit(1).Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) > 0 && versions[0].Version == indexVersion {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if err := db.Exec("DELETE FROM memo_search_tokens").Error; err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	var memos []models.Memo
+	err := db.FindInBatches(&memos, batchSize, func(batch *gorm.DB, _ int) error {
+		// 読み込んだ時点で AfterFind により復号されている
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range memos {
+				if err := c.IndexMemo(tx, &memos[i]); err != nil {
+					return err
+				}
+			}
+			indexed += len(memos)
+			return nil
+		})
+	}).Error
+	if err != nil {
+		return indexed, err
+	}
+	return indexed, db.Save(&models.IndexVersion{Name: indexName, Version: indexVersion}).Error
+}
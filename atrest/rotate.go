@@ -0,0 +1,179 @@
+package atrest
+
+import (
+	"strings"
+
+	"github.com/linkalls/fast-memos/models"
+
+	"gorm.io/gorm"
+)
+
+// RotateResult はローテーションの結果です
+type RotateResult struct {
+	Memos       int   // 再暗号化したメモの数 (削除済みを含む)
+	Rows        int   // 再暗号化したタスク・プロパティ・カード・コメント・通知の数
+	DeletedKeys int64 // 使われなくなって削除したデータ鍵の数
+}
+
+// encryptedTable は保存時に暗号化する列を持つテーブルです
+type encryptedTable struct {
+	table   string
+	columns []string
+}
+
+// encryptedColumns はメモ以外で保存時に暗号化する列です (models の各フックで暗号化している列)
+var encryptedColumns = []encryptedTable{
+	{"tasks", []string{"text"}},
+	{"memo_properties", []string{"value"}},
+	{"cards", []string{"front", "back"}},
+	{"comments", []string{"body"}},
+	{"notifications", []string{"message"}},
+}
+
+// encryptedRow は encryptedColumns の1行分です (列は最大2つ)
+type encryptedRow struct {
+	RowID  int64 `gorm:"column:rowid"`
+	UserID string
+	Kind   string // memo_properties の type
+	First  string
+	Second string
+}
+
+// Rotate はユーザーごとに新しいデータ鍵を作り、すべてのメモ (削除済みを含む) を batchSize 件ずつ再暗号化します。
+// 平文のまま残っているメモ (暗号化を有効にする前のデータ) も暗号化され、検索用インデックスも作り直されます。
+// 本文から作ったタスク・プロパティ・カードと、コメント・通知も同じように再暗号化します。
+// マスター鍵を変更する場合は、新しい鍵を ENCRYPTION_MASTER_KEY に、古い鍵を ENCRYPTION_OLD_MASTER_KEY に設定して実行してください。
+// 途中で失敗しても、もう一度実行すれば続きから再暗号化されます (使われている古い鍵は削除しない)。
+func (c *Cipher) Rotate(db *gorm.DB, batchSize int) (RotateResult, error) {
+	var result RotateResult
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	// 以降の書き込み (このプロセス以外も) は新しいデータ鍵を使う
+	var userIDs []string
+	if err := db.Unscoped().Model(&models.Memo{}).Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return result, err
+	}
+	current := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keyID, _, err := c.newDataKey(db, userID)
+		if err != nil {
+			return result, err
+		}
+		current = append(current, keyID)
+	}
+
+	var memos []models.Memo
+	err := db.Unscoped().FindInBatches(&memos, batchSize, func(batch *gorm.DB, _ int) error {
+		// 読み込んだ時点で AfterFind により復号されている
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range memos {
+				if err := c.reencrypt(tx, &memos[i]); err != nil {
+					return err
+				}
+			}
+			result.Memos += len(memos)
+			return nil
+		})
+	}).Error
+	if err != nil {
+		return result, err
+	}
+	for _, table := range encryptedColumns {
+		rows, err := c.reencryptTable(db, table.table, table.columns, batchSize)
+		result.Rows += rows
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// どこからも参照されなくなった古いデータ鍵を削除する
+	var unused []string
+	var args []interface{}
+	for _, table := range append([]encryptedTable{{"memos", []string{"title", "content"}}}, encryptedColumns...) {
+		for _, column := range table.columns {
+			unused = append(unused, "NOT EXISTS (SELECT 1 FROM "+table.table+" WHERE "+table.table+"."+column+" LIKE ? || user_data_keys.id || ':%')")
+			args = append(args, valuePrefix)
+		}
+	}
+	deleted := db.Where("id NOT IN ?", append(current, "")).
+		Where(strings.Join(unused, " AND "), args...).
+		Delete(&models.UserDataKey{})
+	result.DeletedKeys = deleted.RowsAffected
+	return result, deleted.Error
+}
+
+// reencryptTable は table の columns (削除済みの行を含む) を batchSize 行ずつ現在のデータ鍵で暗号化し直します。
+// memo_properties は絞り込み用のトークンも新しい鍵で作り直します。
+func (c *Cipher) reencryptTable(db *gorm.DB, table string, columns []string, batchSize int) (int, error) {
+	kind, second := "''", "''"
+	if table == "memo_properties" {
+		kind = "type"
+	}
+	if len(columns) > 1 {
+		second = columns[1]
+	}
+	query := "SELECT rowid, user_id, " + kind + " AS kind, " + columns[0] + " AS first, " + second + " AS second FROM " + table +
+		" WHERE rowid > ? ORDER BY rowid LIMIT ?"
+
+	done := 0
+	var last int64
+	for {
+		var rows []encryptedRow
+		if err := db.Raw(query, last, batchSize).Scan(&rows).Error; err != nil {
+			return done, err
+		}
+		if len(rows) == 0 {
+			return done, nil
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				values := []string{row.First, row.Second}
+				updates := map[string]interface{}{}
+				for i, column := range columns {
+					plaintext, err := c.Decrypt(tx, values[i])
+					if err != nil {
+						return err
+					}
+					if updates[column], err = c.Encrypt(tx, row.UserID, plaintext); err != nil {
+						return err
+					}
+					if table == "memo_properties" {
+						updates["value_tokens"] = c.PropertyTokens(row.Kind, plaintext)
+					}
+				}
+				if err := tx.Table(table).Where("rowid = ?", row.RowID).UpdateColumns(updates).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		done += len(rows)
+		last = rows[len(rows)-1].RowID
+	}
+}
+
+// reencrypt は復号済みのメモを現在のデータ鍵で暗号化し直します (更新日時は変えない)
+func (c *Cipher) reencrypt(tx *gorm.DB, memo *models.Memo) error {
+	title, err := c.Encrypt(tx, memo.UserID, memo.Title)
+	if err != nil {
+		return err
+	}
+	content, err := c.Encrypt(tx, memo.UserID, memo.Content)
+	if err != nil {
+		return err
+	}
+	err = tx.Unscoped().Model(&models.Memo{}).Where("id = ?", memo.ID).
+		UpdateColumns(map[string]interface{}{"title": title, "content": content}).Error
+	if err != nil {
+		return err
+	}
+	if memo.DeletedAt.Valid {
+		return nil
+	}
+	return c.IndexMemo(tx, memo)
+}
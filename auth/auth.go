@@ -50,6 +50,10 @@ func ValidateJWT(tokenString string) (string, error) { // 戻り値をstringに
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		// 再認証トークンやセッショントークンはログイン用のトークンとして受け付けない
+		if purpose, exists := claims["purpose"]; exists && purpose != "" && purpose != loginPurpose {
+			return "", errors.New("token is not a login token")
+		}
 		userID, ok := claims["user_id"].(string) // 型アサーションをstringに変更
 		if !ok {
 			return "", errors.New("user_id claim is not a string or missing") // エラーメッセージ変更
@@ -60,11 +64,92 @@ func ValidateJWT(tokenString string) (string, error) { // 戻り値をstringに
 	return "", errors.New("invalid token") // 空文字列を返す
 }
 
+// ReauthWindow は再認証後に保護されたメモを表示できる時間です
+const ReauthWindow = 5 * time.Minute
+
+// 再認証トークンの purpose クレーム (ログイン用のトークンと区別する)
+const reauthPurpose = "reauth"
+
+// ログイン用のトークンの purpose クレーム (GenerateJWT のトークンには purpose が無く、ValidateJWT はどちらも受け付ける)
+const loginPurpose = "login"
+
+// GenerateReauthToken はパスワードを再入力したことを示す、ReauthWindow の間だけ有効なJWTを生成します
+func GenerateReauthToken(userID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ReauthWindow)
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": reauthPurpose,
+		"exp":     expiresAt.Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	return token, expiresAt, err
+}
+
+// ValidateReauthToken は再認証トークンを検証し、ユーザーIDを返します。ログイン用のトークンは受け付けません。
+func ValidateReauthToken(tokenString string) (string, error) {
+	return validatePurposeToken(tokenString, reauthPurpose)
+}
+
+// SessionDuration は Web UI のログイン状態を保持する期間です
+const SessionDuration = 72 * time.Hour
+
+// Web UI のセッショントークンの purpose クレーム (API のトークンとして使えないようにする)
+const sessionPurpose = "session"
+
+// GenerateSessionToken は Web UI のセッション Cookie に保存する、SessionDuration の間だけ有効なJWTを生成します
+func GenerateSessionToken(userID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(SessionDuration)
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": sessionPurpose,
+		"exp":     expiresAt.Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+	return token, expiresAt, err
+}
+
+// ValidateSessionToken は Web UI のセッショントークンを検証し、ユーザーIDを返します
+func ValidateSessionToken(tokenString string) (string, error) {
+	return validatePurposeToken(tokenString, sessionPurpose)
+}
+
+// validatePurposeToken は purpose クレームが一致するJWTを検証し、ユーザーIDを返します
+func validatePurposeToken(tokenString, purpose string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return "", errors.New("invalid " + purpose + " token")
+	}
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return "", errors.New("user_id claim is not a string or missing")
+	}
+	return userID, nil
+}
+
 // ParseJWT はJWTを解析し、ユーザーID (subject) を返します
 func ParseJWT(tokenString string) (string, error) {
 	return ValidateJWT(tokenString)
 }
 
+// RequestLimiter は認証されたリクエストを数え、ユーザーが上限を超えていれば false を返します
+type RequestLimiter interface {
+	Allow(userID string) (bool, error)
+}
+
+// Limiter が設定されていれば AuthMiddleware でリクエスト数を制限します (nil なら無制限)
+var Limiter RequestLimiter
+
 // AuthMiddleware はJWTを検証するFiberミドルウェアです
 func AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -85,6 +170,16 @@ func AuthMiddleware() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired JWT", "details": err.Error()})
 		}
 
+		if Limiter != nil {
+			allowed, err := Limiter.Allow(userID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check request limit", "details": err.Error()})
+			}
+			if !allowed {
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Daily request limit exceeded"})
+			}
+		}
+
 		c.Locals("userID", userID) // 後続のハンドラでユーザーIDを使用できるようにする
 		return c.Next()
 	}
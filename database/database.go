@@ -6,7 +6,6 @@ import (
 	"os"
 	"time" // time パッケージをインポート
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
@@ -50,7 +49,7 @@ func ConnectDatabase() {
 	}
 
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	DB, err = Open(dbPath, &gorm.Config{
 		Logger: dbLogger,
 	})
 
@@ -61,8 +60,8 @@ func ConnectDatabase() {
 
 	fmt.Println("Database connection successfully opened")
 
-	// AutoMigrate a User and Memo table
-	err = DB.AutoMigrate(&models.User{}, &models.Memo{})
+	// AutoMigrate
+	err = Migrate(DB)
 	if err != nil {
 		fmt.Println("Failed to migrate database")
 		panic(err)
@@ -70,3 +69,45 @@ func ConnectDatabase() {
 
 	fmt.Println("Database Migrated")
 }
+
+// Migrate はアプリで使用するすべてのテーブルをマイグレーションします
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.User{},
+		&models.Memo{},
+		&models.Reminder{},
+		&models.Notification{},
+		&models.Task{},
+		&models.MemoTag{},
+		&models.Blob{},
+		&models.Attachment{},
+		&models.ImageVariant{},
+		&models.Share{},
+		&models.MemoGrant{},
+		&models.Workspace{},
+		&models.WorkspaceMember{},
+		&models.WorkspaceInvitation{},
+		&models.MemoProperty{},
+		&models.DailyNote{},
+		&models.UserKey{},
+		&models.UserDataKey{},
+		&models.MemoSearchToken{},
+		&models.Comment{},
+		&models.ReviewSource{},
+		&models.ReviewItem{},
+		&models.Card{},
+		&models.CardReview{},
+		&models.MemoFingerprint{},
+		&models.MemoFingerprintBand{},
+		&models.MemoStat{},
+		&models.ActivityDay{},
+		&models.UserQuota{},
+		&models.RequestCount{},
+		&models.MemoSearchDoc{},
+		&models.IndexVersion{},
+	)
+	if err != nil {
+		return err
+	}
+	return migrateFullTextSearch(db)
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/linkalls/fast-memos/utils"
+)
+
+// driverName は検索用の関数を登録した SQLite のドライバーの名前です
+const driverName = "sqlite3_fast_memos"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// search_normalize(text) は utils.NormalizeSearchText と同じ正規化をした文字列を返します
+			// (FTS5 の無いビルドで、キーワード検索の候補を SQL の LIKE で絞るのに使う)
+			return conn.RegisterFunc("search_normalize", utils.NormalizeSearchText, true)
+		},
+	})
+}
+
+// Open は SQLite のデータベースを検索用の関数を登録したドライバーで開きます
+func Open(dsn string, config *gorm.Config) (*gorm.DB, error) {
+	return gorm.Open(&sqlite.Dialector{DriverName: driverName, DSN: dsn}, config)
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// FullTextSearch は SQLite の FTS5 が使える (go-sqlite3 を -tags sqlite_fts5 でビルドした) 場合に true になります。
+// false の場合、キーワード検索は正規化した文字列の LIKE (search_normalize) による全件の走査になります。
+var FullTextSearch bool
+
+// memosFTSTable はメモのタイトル・本文・カテゴリの全文検索の索引です。
+// 正規化して2文字ずつの並びに分割した文字列 (utils.SearchGrams) を空白区切りで保存するので、
+// 分かち書きの無い日本語も部分一致で検索できます。行の rowid は models.MemoSearchDoc の ID です。
+const memosFTSTable = `CREATE VIRTUAL TABLE memos_fts USING fts5(memo_id UNINDEXED, title, content, category, tokenize='unicode61 remove_diacritics 0')`
+
+// migrateFullTextSearch は FTS5 が使える場合に全文検索の索引のテーブルを作成します。
+// 索引の形式が変わった場合はテーブルを作り直します (索引は起動時に作られる)。
+func migrateFullTextSearch(db *gorm.DB) error {
+	var enabled bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	FullTextSearch = enabled
+	if !enabled {
+		return nil
+	}
+	var existing []string
+	if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'memos_fts'").Scan(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		if existing[0] == memosFTSTable {
+			return nil
+		}
+		if err := db.Exec("DROP TABLE memos_fts").Error; err != nil {
+			return err
+		}
+		if err := db.Exec("DELETE FROM memo_search_docs").Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec(memosFTSTable).Error
+}
@@ -0,0 +1,192 @@
+// Package e2ee はエンドツーエンド暗号化メモのクライアント側の参考実装です。
+// サーバーは暗号文と鍵IDなどのメタデータだけを保存し、平文や鍵を扱いません。
+//
+// メモはユーザーごとのコンテンツ鍵 (AES-256-GCM) で暗号化します。
+// コンテンツ鍵はデバイスごとのパスフレーズから Argon2id で導出した鍵でラップしてサーバーに保存し、
+// 別のデバイスでもラップを解いて同じメモを復号できるようにします。
+package e2ee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// AlgorithmAES256GCM はメモ本文の暗号化アルゴリズムです
+	AlgorithmAES256GCM = "AES-256-GCM"
+	// WrapAlgorithmArgon2idAES256GCM はコンテンツ鍵をラップするアルゴリズムです
+	WrapAlgorithmArgon2idAES256GCM = "ARGON2ID-AES-256-GCM"
+
+	// KeySize はコンテンツ鍵のバイト数です
+	KeySize = 32
+
+	saltSize = 16
+	// Argon2id のパラメータ (RFC 9106 の推奨に近い、低メモリ向けの値)
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+var (
+	// ErrDecrypt は鍵 (またはパスフレーズ) が違うか、暗号文が改ざんされている場合のエラーです
+	ErrDecrypt = errors.New("e2ee: could not decrypt (wrong key or corrupted data)")
+	// ErrUnsupportedAlgorithm は対応していないアルゴリズムの場合のエラーです
+	ErrUnsupportedAlgorithm = errors.New("e2ee: unsupported algorithm")
+)
+
+// Payload は暗号化したメモ本文とメタデータです。
+// Ciphertext はメモの content に、それ以外は API の encryption に指定します。
+type Payload struct {
+	Ciphertext string `json:"-"`         // base64
+	Algorithm  string `json:"algorithm"` // AlgorithmAES256GCM
+	Nonce      string `json:"nonce"`     // base64
+	KeyID      string `json:"key_id"`
+}
+
+// WrappedKey はパスフレーズでラップしたコンテンツ鍵です (API の /keys に保存する形式)
+type WrappedKey struct {
+	KeyID         string `json:"key_id"`
+	WrapAlgorithm string `json:"wrap_algorithm"`
+	WrappedKey    string `json:"wrapped_key"` // base64
+	Salt          string `json:"salt"`        // base64
+	Nonce         string `json:"nonce"`       // base64
+}
+
+// GenerateKey は新しいコンテンツ鍵と鍵IDを生成します
+func GenerateKey() ([]byte, string, error) {
+	key, err := randomBytes(KeySize)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := randomBytes(16)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, hex.EncodeToString(id), nil
+}
+
+// Encrypt はメモ本文をコンテンツ鍵で暗号化します
+func Encrypt(key []byte, keyID, plaintext string) (*Payload, error) {
+	ciphertext, nonce, err := seal(key, []byte(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		Algorithm:  AlgorithmAES256GCM,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		KeyID:      keyID,
+	}, nil
+}
+
+// Decrypt は Encrypt で暗号化したメモ本文を復号します
+func Decrypt(key []byte, p Payload) (string, error) {
+	if p.Algorithm != AlgorithmAES256GCM {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, p.Algorithm)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(p.Ciphertext)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	nonce, err := base64.StdEncoding.DecodeString(p.Nonce)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	plaintext, err := open(key, nonce, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// WrapKey はコンテンツ鍵をデバイスのパスフレーズでラップします
+func WrapKey(key []byte, keyID, passphrase string) (*WrappedKey, error) {
+	salt, err := randomBytes(saltSize)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, nonce, err := seal(deriveKey(passphrase, salt), key)
+	if err != nil {
+		return nil, err
+	}
+	return &WrappedKey{
+		KeyID:         keyID,
+		WrapAlgorithm: WrapAlgorithmArgon2idAES256GCM,
+		WrappedKey:    base64.StdEncoding.EncodeToString(wrapped),
+		Salt:          base64.StdEncoding.EncodeToString(salt),
+		Nonce:         base64.StdEncoding.EncodeToString(nonce),
+	}, nil
+}
+
+// UnwrapKey はラップされたコンテンツ鍵をパスフレーズで取り出します
+func UnwrapKey(w WrappedKey, passphrase string) ([]byte, error) {
+	if w.WrapAlgorithm != WrapAlgorithmArgon2idAES256GCM {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, w.WrapAlgorithm)
+	}
+	var decoded [3][]byte
+	for i, s := range []string{w.WrappedKey, w.Salt, w.Nonce} {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		decoded[i] = b
+	}
+	return open(deriveKey(passphrase, decoded[1]), decoded[2], decoded[0])
+}
+
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, KeySize)
+}
+
+func seal(key, plaintext []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm.Seal(nil, nonce, plaintext, nil), nonce, nil
+}
+
+func open(key, nonce, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("e2ee: key must be %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
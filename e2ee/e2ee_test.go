@@ -0,0 +1,55 @@
+package e2ee
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, keyID, err := GenerateKey()
+	assert.NoError(t, err)
+	assert.Len(t, key, KeySize)
+
+	payload, err := Encrypt(key, keyID, "# 秘密のメモ\n本文")
+	assert.NoError(t, err)
+	assert.Equal(t, keyID, payload.KeyID)
+	assert.NotContains(t, payload.Ciphertext, "秘密")
+
+	plaintext, err := Decrypt(key, *payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "# 秘密のメモ\n本文", plaintext)
+
+	// 同じ本文でもノンスが変わるので暗号文は毎回異なる
+	again, _ := Encrypt(key, keyID, "# 秘密のメモ\n本文")
+	assert.NotEqual(t, payload.Ciphertext, again.Ciphertext)
+
+	otherKey, _, _ := GenerateKey()
+	_, err = Decrypt(otherKey, *payload)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	tampered := *payload
+	tampered.Ciphertext = "A" + tampered.Ciphertext[1:]
+	_, err = Decrypt(key, tampered)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	tampered = *payload
+	tampered.Algorithm = "ROT13"
+	_, err = Decrypt(key, tampered)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	key, keyID, _ := GenerateKey()
+
+	wrapped, err := WrapKey(key, keyID, "laptop passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, keyID, wrapped.KeyID)
+
+	unwrapped, err := UnwrapKey(*wrapped, "laptop passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+
+	_, err = UnwrapKey(*wrapped, "wrong passphrase")
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
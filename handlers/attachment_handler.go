@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/imageproc"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/storage"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// imagePool は縮小画像の生成に使うワーカープールです
+var imagePool = imageproc.NewPool(max(1, runtime.NumCPU()/2), 64)
+
+// storeBlob はアップロードされたファイルをハッシュし、未保存の内容であれば BlobStore に保存します。
+// 画像は keepMetadata が false の場合、保存前に EXIF などのメタデータを取り除きます。
+func storeBlob(ctx context.Context, fh *multipart.FileHeader, keepMetadata bool) (*models.Blob, error) {
+	src, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// ハッシュ計算と保存で2回読むため一時ファイルに書き出す
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err != nil {
+		return nil, err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	// クライアントが送った Content-Type は信用せず、内容から判定する
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var content io.Reader = tmp
+
+	width, height := 0, 0
+	if imageproc.IsSupported(contentType) {
+		data, err := io.ReadAll(tmp)
+		if err != nil {
+			return nil, err
+		}
+		// 壊れた画像や画素数が多すぎる画像は保存しない (縮小画像の生成でメモリを使い切らないように)
+		if err := imageproc.Check(data, contentType); err != nil {
+			return nil, invalidImageError(fh.Filename, err)
+		}
+		if !keepMetadata {
+			// メタデータを取り除けない画像をそのまま保存しないよう拒否する
+			sanitized, err := imageproc.Sanitize(data, contentType)
+			if err != nil {
+				return nil, invalidImageError(fh.Filename, err)
+			}
+			// メタデータを除いた内容で重複排除するためハッシュを計算し直す
+			data = sanitized
+			sum := sha256.Sum256(data)
+			hash = hex.EncodeToString(sum[:])
+			size = int64(len(data))
+		}
+		width, height, _ = imageproc.Dimensions(data, contentType)
+		content = bytes.NewReader(data)
+	}
+
+	var blob models.Blob
+	err = database.DB.Where("hash = ?", hash).First(&blob).Error
+	if err == nil {
+		return &blob, nil // 同じ内容のファイルが保存済み
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err := storage.Store.Put(ctx, hash, content, size, contentType); err != nil {
+		return nil, err
+	}
+
+	blob = models.Blob{Hash: hash, Size: size, ContentType: contentType, Width: width, Height: height}
+	if err := database.DB.Where(models.Blob{Hash: hash}).FirstOrCreate(&blob).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// invalidImageError は処理できない画像のアップロードを 422 にする memoInputError を作ります
+func invalidImageError(filename string, err error) error {
+	return &memoInputError{Status: fiber.StatusUnprocessableEntity, Message: "Could not process image", Details: filepath.Base(filename) + ": " + err.Error()}
+}
+
+// ensureImageVariant は縮小画像が未生成であれば生成して保存します
+func ensureImageVariant(ctx context.Context, sourceHash, contentType string, variant imageproc.Variant) (*models.ImageVariant, error) {
+	var existing models.ImageVariant
+	err := database.DB.Where("source_hash = ? AND variant = ?", sourceHash, variant.Name).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	reader, err := storage.Store.Get(ctx, sourceHash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	result, err := imageproc.Resize(data, contentType, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	// 縮小画像は内容のハッシュではなく元画像のハッシュから決まるキーで保存する
+	// (アップロードされた別ファイルと同じ内容になっても削除時に巻き込まないように)
+	key := sourceHash + "-" + variant.Name
+	if err := storage.Store.Put(ctx, key, bytes.NewReader(result.Data), int64(len(result.Data)), result.ContentType); err != nil {
+		return nil, err
+	}
+	record := models.ImageVariant{
+		SourceHash:  sourceHash,
+		Variant:     variant.Name,
+		Key:         key,
+		ContentType: result.ContentType,
+		Size:        int64(len(result.Data)),
+		Width:       result.Width,
+		Height:      result.Height,
+	}
+	if err := database.DB.Where(models.ImageVariant{SourceHash: sourceHash, Variant: variant.Name}).FirstOrCreate(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// scheduleImageVariants は縮小画像の生成をワーカープールに依頼します。
+// キューが一杯の場合は何もせず、初回アクセス時に生成されます。
+func scheduleImageVariants(blob *models.Blob) {
+	if !imageproc.IsSupported(blob.ContentType) {
+		return
+	}
+	hash, contentType := blob.Hash, blob.ContentType
+	imagePool.Submit(func() {
+		for _, variant := range imageproc.Variants {
+			if _, err := ensureImageVariant(context.Background(), hash, contentType, variant); err != nil {
+				log.Printf("could not generate %s variant for %s: %v", variant.Name, hash, err)
+				return
+			}
+		}
+	})
+}
+
+// removeMemoAttachments はメモの添付ファイルを削除し、参照されていた Blob のハッシュを返します
+func removeMemoAttachments(tx *gorm.DB, memoID string) ([]string, error) {
+	var hashes []string
+	if err := tx.Model(&models.Attachment{}).Where("memo_id = ?", memoID).Distinct().Pluck("blob_hash", &hashes).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// cleanupOrphanBlobs はどの添付ファイルからも参照されなくなった Blob を削除します
+func cleanupOrphanBlobs(ctx context.Context, hashes []string) {
+	for _, hash := range hashes {
+		result := database.DB.
+			Where("hash = ? AND NOT EXISTS (SELECT 1 FROM attachments WHERE attachments.blob_hash = blobs.hash)", hash).
+			Delete(&models.Blob{})
+		if result.Error != nil {
+			log.Printf("could not delete orphan blob %s: %v", hash, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue // まだ他の添付ファイルから参照されている
+		}
+		if err := storage.Store.Delete(ctx, hash); err != nil {
+			log.Printf("could not delete orphan blob %s from storage: %v", hash, err)
+		}
+
+		// 縮小画像も削除
+		var variants []models.ImageVariant
+		database.DB.Where("source_hash = ?", hash).Find(&variants)
+		for _, v := range variants {
+			if err := storage.Store.Delete(ctx, v.Key); err != nil {
+				log.Printf("could not delete image variant %s from storage: %v", v.Key, err)
+			}
+		}
+		database.DB.Where("source_hash = ?", hash).Delete(&models.ImageVariant{})
+	}
+}
+
+// inlineContentTypes はブラウザで直接表示 (Content-Disposition: inline) する添付ファイルの種類です。
+// スクリプトを実行できる種類 (HTML や SVG など) を同じオリジンで表示しないよう、それ以外はダウンロードさせます。
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// sendAttachment は添付ファイルの内容をレスポンスとして返します。
+// 画像の場合はクエリ variant (thumb / web) で縮小画像を返します。未生成ならその場で生成します。
+func sendAttachment(c *fiber.Ctx, attachment models.Attachment) error {
+	key, contentType, size := attachment.BlobHash, attachment.ContentType, attachment.Size
+	if name := c.Query("variant"); name != "" && imageproc.IsSupported(attachment.ContentType) {
+		variant, ok := imageproc.VariantByName(name)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown variant", "details": name})
+		}
+		record, err := ensureImageVariant(c.Context(), attachment.BlobHash, attachment.ContentType, variant)
+		if err != nil {
+			log.Printf("could not generate %s variant for attachment %s: %v", name, attachment.ID, err)
+		} else {
+			key, contentType, size = record.Key, record.ContentType, record.Size
+		}
+	}
+
+	reader, err := storage.Store.Get(c.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment content not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not read attachment", "details": err.Error()})
+	}
+
+	disposition := "attachment"
+	if inlineContentTypes[contentType] {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	return c.SendStream(reader, int(size))
+}
+
+// UploadAttachments はメモにファイルを添付します (multipart/form-data の file フィールド、複数可)
+func UploadAttachments(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memoID := c.Params("id")
+	var memo models.Memo
+	if err := database.DB.Where("id = ? AND user_id = ?", memoID, userID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse multipart form", "details": err.Error()})
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one file is required in field 'file'"})
+	}
+
+	var size int64
+	for _, fh := range files {
+		size += fh.Size
+	}
+	if err := checkAttachmentQuota(userID, size); err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+
+	// keep_metadata=true の場合のみ画像のEXIFなどを残す
+	keepMetadata := c.FormValue("keep_metadata") == "true"
+
+	attachments := make([]models.Attachment, 0, len(files))
+	for _, fh := range files {
+		blob, err := storeBlob(c.Context(), fh, keepMetadata)
+		var inputErr *memoInputError
+		if errors.As(err, &inputErr) {
+			return memoAccessErrorResponse(c, err)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not store file", "details": err.Error()})
+		}
+		attachment := models.Attachment{
+			ID:          utils.GenerateID(),
+			MemoID:      memo.ID,
+			UserID:      userID,
+			BlobHash:    blob.Hash,
+			Filename:    filepath.Base(fh.Filename),
+			ContentType: blob.ContentType,
+			Size:        blob.Size,
+			Width:       blob.Width,
+			Height:      blob.Height,
+		}
+		if err := database.DB.Create(&attachment).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create attachment", "details": err.Error()})
+		}
+		scheduleImageVariants(blob)
+		attachments = append(attachments, attachment)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(attachments)
+}
+
+// GetAttachments はメモの添付ファイル一覧を返します
+func GetAttachments(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	// 共有されたメモの添付ファイルも閲覧できる
+	if _, _, err := findMemoWithRole(userID, c.Params("id"), models.RoleViewer); err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	attachments := []models.Attachment{}
+	if err := database.DB.Where("memo_id = ?", c.Params("id")).Order("created_at asc").Find(&attachments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve attachments", "details": err.Error()})
+	}
+	return c.JSON(attachments)
+}
+
+// DownloadAttachment は添付ファイルをダウンロードします
+func DownloadAttachment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	attachment, err := findViewableAttachment(userID, c.Params("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve attachment", "details": err.Error()})
+	}
+	return sendAttachment(c, *attachment)
+}
+
+// DeleteAttachment は添付ファイルを削除します。参照がなくなった実体も削除されます。
+func DeleteAttachment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve attachment", "details": err.Error()})
+	}
+	if err := database.DB.Where("id = ?", attachment.ID).Delete(&models.Attachment{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete attachment", "details": err.Error()})
+	}
+	cleanupOrphanBlobs(c.Context(), []string{attachment.BlobHash})
+
+	return c.JSON(fiber.Map{"message": "Attachment deleted successfully"})
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadAttachmentRequest(t *testing.T, token, memoID, filename string, content []byte) *http.Response {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/memos/"+memoID+"/attachments", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	return resp
+}
+
+func uploadTestAttachment(t *testing.T, token, memoID, filename string, content []byte) models.Attachment {
+	resp := uploadAttachmentRequest(t, token, memoID, filename, content)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var attachments []models.Attachment
+	json.Unmarshal(respBody, &attachments)
+	assert.Len(t, attachments, 1)
+	return attachments[0]
+}
+
+func TestAttachments(t *testing.T) {
+	token := loginTestUser(t, "attachuser", "password123")
+	memo1 := createTestMemo(t, token, map[string]interface{}{"title": "With file"})
+	memo2 := createTestMemo(t, token, map[string]interface{}{"title": "Same file"})
+
+	content := []byte("hello attachment")
+	a1 := uploadTestAttachment(t, token, memo1.ID, "hello.txt", content)
+	a2 := uploadTestAttachment(t, token, memo2.ID, "copy.txt", content)
+
+	// 同じ内容は1つの Blob にまとめられる
+	assert.Equal(t, a1.BlobHash, a2.BlobHash)
+	var blobCount int64
+	testDB.Model(&models.Blob{}).Count(&blobCount)
+	assert.Equal(t, int64(1), blobCount)
+
+	// ダウンロード
+	req := httptest.NewRequest(http.MethodGet, "/api/attachments/"+a1.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	downloaded, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, content, downloaded)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "hello.txt")
+
+	// 他のユーザーはダウンロードできない
+	otherToken := loginAdditionalTestUser(t, "attachother", "password123")
+	reqOther := httptest.NewRequest(http.MethodGet, "/api/attachments/"+a1.ID, nil)
+	reqOther.Header.Set("Authorization", "Bearer "+otherToken)
+	respOther, _ := testApp.Test(reqOther, -1)
+	assert.Equal(t, http.StatusNotFound, respOther.StatusCode)
+
+	download := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/attachments/"+a1.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, _ := testApp.Test(req, -1)
+		return resp.StatusCode
+	}
+	deleteMemo := func(memoID string) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/memos/"+memoID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, _ := testApp.Test(req, -1)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	}
+	batchOp := func(op, memoID string) {
+		postBatch(t, token, map[string]interface{}{
+			"operations": []map[string]interface{}{{"op": op, "id": memoID}},
+		}, http.StatusOK)
+	}
+
+	// ゴミ箱のメモの添付ファイルは取得できないが、戻すと添付ファイルも戻る
+	deleteMemo(memo1.ID)
+	assert.Equal(t, http.StatusNotFound, download())
+	batchOp("restore", memo1.ID)
+	assert.Equal(t, http.StatusOK, download())
+
+	// 完全に削除するまで Blob は残り、どこからも参照されなくなったら削除する
+	deleteMemo(memo1.ID)
+	deleteMemo(memo2.ID)
+	testDB.Model(&models.Blob{}).Count(&blobCount)
+	assert.Equal(t, int64(1), blobCount)
+	batchOp("purge", memo1.ID)
+	testDB.Model(&models.Blob{}).Count(&blobCount)
+	assert.Equal(t, int64(1), blobCount)
+	batchOp("purge", memo2.ID)
+	testDB.Model(&models.Blob{}).Count(&blobCount)
+	assert.Equal(t, int64(0), blobCount)
+	var memoCount int64
+	testDB.Unscoped().Model(&models.Memo{}).Where("id IN ?", []string{memo1.ID, memo2.ID}).Count(&memoCount)
+	assert.Zero(t, memoCount)
+}
+
+func TestImageAttachmentVariants(t *testing.T) {
+	token := loginTestUser(t, "imageuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Photo"})
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 600, 300)))
+	attachment := uploadTestAttachment(t, token, memo.ID, "photo.png", buf.Bytes())
+	assert.Equal(t, "image/png", attachment.ContentType)
+	assert.Equal(t, 600, attachment.Width)
+	assert.Equal(t, 300, attachment.Height)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/attachments/"+attachment.ID+"?variant=thumb", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	thumb, _, err := image.DecodeConfig(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, thumb.Width)
+	assert.Equal(t, 128, thumb.Height)
+
+	reqBad := httptest.NewRequest(http.MethodGet, "/api/attachments/"+attachment.ID+"?variant=huge", nil)
+	reqBad.Header.Set("Authorization", "Bearer "+token)
+	respBad, _ := testApp.Test(reqBad, -1)
+	assert.Equal(t, http.StatusBadRequest, respBad.StatusCode)
+
+	// メタデータを取り除けない壊れた画像や、展開すると巨大になる画像は保存しない
+	var blobCount int64
+	testDB.Model(&models.Blob{}).Count(&blobCount)
+	respBroken := uploadAttachmentRequest(t, token, memo.ID, "broken.png", []byte("\x89PNG\r\n\x1a\nbroken"))
+	assert.Equal(t, http.StatusUnprocessableEntity, respBroken.StatusCode, readResponseBody(respBroken))
+
+	huge := buf.Bytes()
+	binary.BigEndian.PutUint32(huge[16:20], 100000)
+	binary.BigEndian.PutUint32(huge[20:24], 100000)
+	binary.BigEndian.PutUint32(huge[29:33], crc32.ChecksumIEEE(huge[12:29]))
+	for _, keepMetadata := range []bool{false, true} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "huge.png")
+		part.Write(huge)
+		if keepMetadata {
+			writer.WriteField("keep_metadata", "true")
+		}
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/memos/"+memo.ID+"/attachments", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, _ := testApp.Test(req, -1)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, readResponseBody(resp))
+	}
+	var blobCountAfter int64
+	testDB.Model(&models.Blob{}).Count(&blobCountAfter)
+	assert.Equal(t, blobCount, blobCountAfter)
+}
+
+func TestAttachmentContentTypeIsSniffed(t *testing.T) {
+	token := loginTestUser(t, "sniffuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Files"})
+
+	// クライアントが申告した Content-Type ではなく内容から判定する
+	upload := func(filename, contentType string, content []byte) models.Attachment {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+		header.Set("Content-Type", contentType)
+		part, _ := writer.CreatePart(header)
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/memos/"+memo.ID+"/attachments", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := testApp.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+		respBody, _ := io.ReadAll(resp.Body)
+		var attachments []models.Attachment
+		json.Unmarshal(respBody, &attachments)
+		return attachments[0]
+	}
+	download := func(attachment models.Attachment) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/api/attachments/"+attachment.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := testApp.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		return resp
+	}
+
+	// 画像と申告した HTML はダウンロードさせる
+	html := upload("evil.png", "image/png", []byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, "text/html; charset=utf-8", html.ContentType)
+	assert.Contains(t, download(html).Header.Get("Content-Disposition"), "attachment")
+
+	// SVG もスクリプトを含められるので inline では返さない
+	svg := upload("icon.svg", "image/svg+xml", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	assert.NotEqual(t, "image/svg+xml", svg.ContentType)
+	assert.Contains(t, download(svg).Header.Get("Content-Disposition"), "attachment")
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	photo := upload("photo.bin", "application/octet-stream", buf.Bytes())
+	assert.Equal(t, "image/png", photo.ContentType)
+	assert.Contains(t, download(photo).Header.Get("Content-Disposition"), "inline")
+}
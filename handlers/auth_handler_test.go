@@ -12,11 +12,13 @@ import (
 
 	"github.com/linkalls/fast-memos/auth"
 	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/markdown"
 	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/storage"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html/v2"
 	"github.com/stretchr/testify/assert" // アサーションライブラリ
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -28,7 +30,7 @@ var testDB *gorm.DB
 func setupTestApp() *fiber.App {
 	// インメモリSQLiteデータベースの設定
 	var err error
-	testDB, err = gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+	testDB, err = database.Open("file::memory:?cache=shared", &gorm.Config{
 		Logger: logger.New(
 			log.New(os.Stdout, "\r\n", log.LstdFlags),
 			logger.Config{LogLevel: logger.Silent}, // テスト中はサイレントに
@@ -39,27 +41,177 @@ func setupTestApp() *fiber.App {
 	}
 	database.DB = testDB // グローバルなDBインスタンスをテスト用DBに置き換え
 
+	// 添付ファイルは一時ディレクトリに保存
+	storageDir, err := os.MkdirTemp("", "fast-memos-test-*")
+	if err != nil {
+		log.Fatalf("Failed to create storage directory: %v", err)
+	}
+	storage.Store, err = storage.NewLocalStore(storageDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
 	// モデルのマイグレーション
-	err = testDB.AutoMigrate(&models.User{}, &models.Memo{})
+	err = database.Migrate(testDB)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	auth.Limiter = RequestQuota // 1日あたりのリクエスト数を数える (上限はテストごとに quota.Current で設定)
 
-	app := fiber.New()
+	engine := html.New("../templates", ".html")
+	engine.AddFuncMap(markdown.TemplateFuncs())
+	app := fiber.New(fiber.Config{Views: engine})
 
 	api := app.Group("/api")
 	authRoutes := api.Group("/auth")
 	authRoutes.Post("/register", RegisterUser)
 	authRoutes.Post("/login", LoginUser)
+	authRoutes.Post("/reauth", auth.AuthMiddleware(), Reauthenticate)
 
 	// メモ関連のルートもテストで必要ならここに追加
 	memoRoutes := api.Group("/memos", auth.AuthMiddleware()) // AuthMiddlewareをグローバルに適用
 	memoRoutes.Post("/", CreateMemo)
 	memoRoutes.Get("/", GetMemos)
 	memoRoutes.Get("/search", SearchMemos) 
+	memoRoutes.Get("/shared", GetSharedMemos)
+	memoRoutes.Get("/geojson", GetMemosGeoJSON)
+	memoRoutes.Post("/batch", BatchMemos)
+	memoRoutes.Post("/merge", MergeMemos)
+	memoRoutes.Get("/trash", GetTrashedMemos)
+	memoRoutes.Get("/duplicates", GetDuplicateMemos)
 	memoRoutes.Get("/:id", GetMemo)
 	memoRoutes.Put("/:id", UpdateMemo)
 	memoRoutes.Delete("/:id", DeleteMemo)
+	memoRoutes.Post("/:id/split", SplitMemo)
+	memoRoutes.Post("/:id/lock", LockMemo)
+	memoRoutes.Delete("/:id/lock", UnlockMemo)
+	memoRoutes.Post("/:id/protect", ProtectMemo)
+	memoRoutes.Delete("/:id/protect", UnprotectMemo)
+	memoRoutes.Post("/:id/reminders", CreateReminder)
+	memoRoutes.Post("/:id/attachments", UploadAttachments)
+	memoRoutes.Get("/:id/attachments", GetAttachments)
+	memoRoutes.Post("/:id/shares", CreateShare)
+	memoRoutes.Get("/:id/shares", GetShares)
+	memoRoutes.Post("/:id/grants", CreateGrant)
+	memoRoutes.Get("/:id/grants", GetGrants)
+	memoRoutes.Get("/:id/comments", GetComments)
+	memoRoutes.Post("/:id/comments", CreateComment)
+	memoRoutes.Put("/:id/comments/:commentID", UpdateComment)
+	memoRoutes.Delete("/:id/comments/:commentID", DeleteComment)
+	memoRoutes.Post("/:id/comments/:commentID/resolve", ResolveComment)
+	memoRoutes.Delete("/:id/comments/:commentID/resolve", UnresolveComment)
+
+	attachmentRoutes := api.Group("/attachments", auth.AuthMiddleware())
+	attachmentRoutes.Get("/:id", DownloadAttachment)
+	attachmentRoutes.Delete("/:id", DeleteAttachment)
+
+	shareRoutes := api.Group("/shares", auth.AuthMiddleware())
+	shareRoutes.Get("/", GetShares)
+	shareRoutes.Delete("/:id", RevokeShare)
+
+	grantRoutes := api.Group("/grants", auth.AuthMiddleware())
+	grantRoutes.Post("/", CreateGrant)
+	grantRoutes.Get("/", GetGrants)
+	grantRoutes.Delete("/:id", RevokeGrant)
+
+	app.Get("/s/:token", WebShowShare)
+	app.Post("/s/:token", WebUnlockShare)
+	app.Get("/s/:token/attachments/:id", WebShareAttachment)
+
+	publicRoutes := api.Group("/public")
+	publicRoutes.Get("/memos/:id", GetPublicMemo)
+	publicRoutes.Get("/users/:username/memos", GetPublicProfile)
+	app.Get("/p/:id", WebPublicMemo)
+	app.Get("/p/:memoID/attachments/:id", WebPublicAttachment)
+	app.Get("/u/:username", WebProfile)
+	app.Get("/memos/:id", WebShowMemo)
+	app.Get("/review", WebReview)
+	app.Get("/cards/review", WebCardReview)
+	app.Post("/cards/:id/grade", WebGradeCard)
+
+	reviewRoutes := api.Group("/review", auth.AuthMiddleware())
+	reviewRoutes.Get("/settings", GetReviewSettings)
+	reviewRoutes.Put("/settings", UpdateReviewSettings)
+	reviewRoutes.Get("/on-this-day", GetOnThisDay)
+	reviewRoutes.Get("/random", GetRandomReview)
+	reviewRoutes.Get("/queue", GetReviewQueue)
+	reviewRoutes.Post("/memos/:id/snooze", SnoozeReview)
+	reviewRoutes.Post("/memos/:id/remind", RemindReview)
+	reviewRoutes.Post("/memos/:id/reviewed", MarkReviewed)
+
+	cardRoutes := api.Group("/cards", auth.AuthMiddleware())
+	cardRoutes.Get("/", GetCards)
+	cardRoutes.Get("/due", GetDueCards)
+	cardRoutes.Post("/:id/grade", GradeCard)
+	app.Post("/memos", WebCreateMemo)
+	app.Post("/memos/batch", WebBatchMemos)
+	app.Post("/memos/:id/edit", WebUpdateMemo)
+	app.Post("/memos/:id/comments", WebCreateComment)
+	app.Post("/memos/:id/comments/:commentID/delete", WebCommentAction("delete"))
+
+	reminderRoutes := api.Group("/reminders", auth.AuthMiddleware())
+	reminderRoutes.Get("/", GetReminders)
+	reminderRoutes.Delete("/:id", DeleteReminder)
+
+	notificationRoutes := api.Group("/notifications", auth.AuthMiddleware())
+	notificationRoutes.Get("/", GetNotifications)
+	notificationRoutes.Post("/:id/read", MarkNotificationRead)
+
+	taskRoutes := api.Group("/tasks", auth.AuthMiddleware())
+	taskRoutes.Get("/", GetTasks)
+	taskRoutes.Post("/:id/toggle", ToggleTask)
+
+	workspaceRoutes := api.Group("/workspaces", auth.AuthMiddleware())
+	workspaceRoutes.Post("/", CreateWorkspace)
+	workspaceRoutes.Get("/", GetWorkspaces)
+	workspaceRoutes.Get("/:workspaceID", GetWorkspace)
+	workspaceRoutes.Put("/:workspaceID", UpdateWorkspace)
+	workspaceRoutes.Delete("/:workspaceID", DeleteWorkspace)
+	workspaceRoutes.Get("/:workspaceID/members", GetWorkspaceMembers)
+	workspaceRoutes.Put("/:workspaceID/members/:userID", UpdateWorkspaceMember)
+	workspaceRoutes.Delete("/:workspaceID/members/:userID", RemoveWorkspaceMember)
+	workspaceRoutes.Post("/:workspaceID/invitations", CreateWorkspaceInvitation)
+	workspaceRoutes.Get("/:workspaceID/invitations", GetWorkspaceInvitations)
+
+	workspaceMemoRoutes := workspaceRoutes.Group("/:workspaceID/memos", WorkspaceMemberMiddleware())
+	workspaceMemoRoutes.Post("/", CreateMemo)
+	workspaceMemoRoutes.Get("/", GetMemos)
+	workspaceMemoRoutes.Get("/search", SearchMemos)
+	workspaceMemoRoutes.Get("/geojson", GetMemosGeoJSON)
+	workspaceMemoRoutes.Post("/batch", BatchMemos)
+	workspaceMemoRoutes.Post("/merge", MergeMemos)
+	workspaceMemoRoutes.Get("/trash", GetTrashedMemos)
+	workspaceMemoRoutes.Get("/duplicates", GetDuplicateMemos)
+	workspaceMemoRoutes.Get("/:id", GetMemo)
+	workspaceMemoRoutes.Put("/:id", UpdateMemo)
+	workspaceMemoRoutes.Delete("/:id", DeleteMemo)
+	workspaceMemoRoutes.Post("/:id/split", SplitMemo)
+
+	invitationRoutes := api.Group("/invitations", auth.AuthMiddleware())
+	invitationRoutes.Get("/", GetWorkspaceInvitations)
+	invitationRoutes.Post("/:id/accept", AcceptWorkspaceInvitation)
+	invitationRoutes.Delete("/:id", DeclineWorkspaceInvitation)
+
+	keyRoutes := api.Group("/keys", auth.AuthMiddleware())
+	keyRoutes.Post("/", CreateUserKey)
+	keyRoutes.Get("/", GetUserKeys)
+	keyRoutes.Delete("/:id", DeleteUserKey)
+
+	dailyRoutes := api.Group("/daily", auth.AuthMiddleware())
+	dailyRoutes.Get("/", GetDailyNotes)
+	dailyRoutes.Get("/:date", GetDailyNote)
+
+	// 統計 (認証が必要)
+	statsRoutes := api.Group("/stats", auth.AuthMiddleware())
+	statsRoutes.Get("/", GetStats)
+
+	// 上限と使用量 (認証が必要)
+	meRoutes := api.Group("/me", auth.AuthMiddleware())
+	meRoutes.Get("/usage", GetUsage)
+
+	userRoutes := api.Group("/users", auth.AuthMiddleware())
+	userRoutes.Get("/me", GetCurrentUser)
+	userRoutes.Put("/me", UpdateUserSettings)
 
 
 	return app
@@ -79,6 +231,39 @@ func TestMain(m *testing.M) {
 func clearDatabase() {
 	testDB.Exec("DELETE FROM memos")
 	testDB.Exec("DELETE FROM users")
+	testDB.Exec("DELETE FROM reminders")
+	testDB.Exec("DELETE FROM notifications")
+	testDB.Exec("DELETE FROM tasks")
+	testDB.Exec("DELETE FROM memo_tags")
+	testDB.Exec("DELETE FROM attachments")
+	testDB.Exec("DELETE FROM blobs")
+	testDB.Exec("DELETE FROM image_variants")
+	testDB.Exec("DELETE FROM shares")
+	testDB.Exec("DELETE FROM memo_grants")
+	testDB.Exec("DELETE FROM workspaces")
+	testDB.Exec("DELETE FROM workspace_members")
+	testDB.Exec("DELETE FROM workspace_invitations")
+	testDB.Exec("DELETE FROM memo_properties")
+	testDB.Exec("DELETE FROM daily_notes")
+	testDB.Exec("DELETE FROM user_keys")
+	testDB.Exec("DELETE FROM user_data_keys")
+	testDB.Exec("DELETE FROM memo_search_tokens")
+	testDB.Exec("DELETE FROM comments")
+	testDB.Exec("DELETE FROM review_sources")
+	testDB.Exec("DELETE FROM review_items")
+	testDB.Exec("DELETE FROM cards")
+	testDB.Exec("DELETE FROM card_reviews")
+	testDB.Exec("DELETE FROM memo_fingerprints")
+	testDB.Exec("DELETE FROM memo_fingerprint_bands")
+	testDB.Exec("DELETE FROM memo_stats")
+	testDB.Exec("DELETE FROM activity_days")
+	testDB.Exec("DELETE FROM user_quotas")
+	testDB.Exec("DELETE FROM request_counts")
+	testDB.Exec("DELETE FROM memo_search_docs")
+	testDB.Exec("DELETE FROM index_versions")
+	if database.FullTextSearch {
+		testDB.Exec("DELETE FROM memos_fts")
+	}
 	// 他のテーブルも必要に応じてクリア
 }
 
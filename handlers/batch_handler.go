@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 一括操作の種類
+const (
+	batchOpCreate       = "create"
+	batchOpUpdate       = "update"
+	batchOpDelete       = "delete"
+	batchOpMoveCategory = "move_category"
+	batchOpAddTag       = "add_tag"
+	batchOpRestore      = "restore"
+	batchOpPurge        = "purge"
+)
+
+// 一括操作のモード
+const (
+	batchModeAtomic  = "atomic"  // 1件でも失敗したらすべて取り消す (既定)
+	batchModePartial = "partial" // 成功した操作だけ反映する
+)
+
+// 1回の一括操作で指定できる操作の上限
+const maxBatchOperations = 500
+
+var errBatchRolledBack = errors.New("batch rolled back")
+
+// BatchOperation は一括操作の1件です。
+// memo は create では CreateMemoInput、update では UpdateMemoInput と同じ形式です。
+type BatchOperation struct {
+	Op       string          `json:"op"`
+	ID       string          `json:"id"`
+	Memo     json.RawMessage `json:"memo"`
+	Category *string         `json:"category"` // move_category の移動先 (空文字でカテゴリなし)
+	Tag      string          `json:"tag"`      // add_tag で追加するタグ
+}
+
+// BatchInput は POST /memos/batch のリクエストボディです
+type BatchInput struct {
+	Mode       string           `json:"mode"` // atomic (既定) / partial
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult は一括操作の1件ごとの結果です。Status は個別のAPIを呼んだ場合のステータスコードです。
+type BatchResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	ID      string       `json:"id,omitempty"`
+	Status  int          `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Details string       `json:"details,omitempty"`
+	Memo    *models.Memo `json:"memo,omitempty"`
+}
+
+// batchRun は一括操作の実行中の状態です
+type batchRun struct {
+	c           *fiber.Ctx
+	userID      string
+	workspaceID string
+	roles       map[string]string // メモIDごとの権限 (一括操作の開始時点)
+	owners      []string          // 操作対象のメモの所有者
+	quota       *memoQuota        // 操作するユーザーと所有者の上限と使用量 (一括操作の開始時点)
+	blobHashes  []string
+}
+
+// batchError はエラーを一括操作の結果のステータスとメッセージに変換します
+func batchError(result *BatchResult, err error) {
+	var inputErr *memoInputError
+	switch {
+	case errors.As(err, &inputErr):
+		result.Status, result.Error, result.Details = inputErr.Status, inputErr.Message, inputErr.Details
+	case errors.Is(err, errMemoNotFound):
+		result.Status, result.Error = fiber.StatusNotFound, "Memo not found"
+	case errors.Is(err, errMemoForbidden):
+		result.Status, result.Error = fiber.StatusForbidden, "You do not have permission for this operation on the memo"
+	case errors.Is(err, errMemoLocked):
+		result.Status, result.Error = fiber.StatusLocked, "Memo is locked; unlock it before making changes"
+	default:
+		result.Status, result.Error, result.Details = fiber.StatusInternalServerError, "Could not apply operation", err.Error()
+	}
+}
+
+// loadRoles は操作対象のメモ (削除済みを含む) に対する権限を、トランザクションを始める前にまとめて求めます
+func (r *batchRun) loadRoles(operations []BatchOperation) error {
+	r.roles = map[string]string{}
+	var ids []string
+	for _, op := range operations {
+		if op.ID != "" {
+			ids = append(ids, op.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var memos []models.Memo
+	if err := database.DB.Unscoped().Where("id IN ?", ids).Find(&memos).Error; err != nil {
+		return err
+	}
+	for _, memo := range memos {
+		r.owners = append(r.owners, memo.UserID)
+		role, err := memoRole(r.userID, memo)
+		if err != nil {
+			return err
+		}
+		// ワークスペースのルート経由の場合は、そのワークスペースのメモだけを対象にする
+		if r.workspaceID != "" && memo.WorkspaceID != r.workspaceID {
+			role = ""
+		}
+		r.roles[memo.ID] = role
+	}
+	return nil
+}
+
+// findBatchMemo は操作対象のメモを tx から取得し、権限を確認します
+// (同じ一括操作の前の操作による変更を反映するため、メモは tx から読み直す)
+func (r *batchRun) findBatchMemo(tx *gorm.DB, memoID, required string) (*models.Memo, string, error) {
+	var memo models.Memo
+	if err := tx.Where("id = ?", memoID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errMemoNotFound
+		}
+		return nil, "", err
+	}
+	return r.checkBatchMemo(&memo, required)
+}
+
+// checkBatchMemo は findEditableMemo と同じく、権限とロックを確認します
+func (r *batchRun) checkBatchMemo(memo *models.Memo, required string) (*models.Memo, string, error) {
+	role := r.roles[memo.ID]
+	if role == "" {
+		// 存在を知られないよう、権限がない場合も見つからない扱いにする
+		return nil, "", errMemoNotFound
+	}
+	if roleRank[role] < roleRank[required] {
+		return nil, "", errMemoForbidden
+	}
+	if memo.Locked {
+		return nil, "", errMemoLocked
+	}
+	return memo, role, nil
+}
+
+// saveBatchMemo は変更したメモを保存し、派生データを作り直します
+func saveBatchMemo(tx *gorm.DB, memo *models.Memo) error {
+	if err := tx.Save(memo).Error; err != nil {
+		return err
+	}
+	return syncMemoDerived(tx, memo, activityEdited)
+}
+
+// apply は1件の操作を tx で実行し、成功した場合のステータスと対象のメモを返します
+func (r *batchRun) apply(tx *gorm.DB, op BatchOperation) (int, *models.Memo, error) {
+	if op.Op != batchOpCreate && op.ID == "" {
+		return 0, nil, badMemoInput("Memo ID is required")
+	}
+	switch op.Op {
+	case batchOpCreate:
+		if r.workspaceID != "" {
+			if role, _ := r.c.Locals("workspaceRole").(string); !canCreateWorkspaceMemo(role) {
+				return 0, nil, &memoInputError{Status: fiber.StatusForbidden, Message: "Guests cannot create memos in the workspace"}
+			}
+		}
+		input := new(CreateMemoInput)
+		if err := decodeBatchMemo(op.Memo, input); err != nil {
+			return 0, nil, err
+		}
+		memo, err := newMemoFromInput(r.userID, r.workspaceID, input)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := r.quota.reserve(r.userID, 1, memoBytes(memo)); err != nil {
+			return 0, nil, err
+		}
+		if err := tx.Create(memo).Error; err != nil {
+			return 0, nil, err
+		}
+		return fiber.StatusCreated, memo, syncMemoDerived(tx, memo, activityCreated)
+
+	case batchOpUpdate:
+		input := new(UpdateMemoInput)
+		if err := decodeBatchMemo(op.Memo, input); err != nil {
+			return 0, nil, err
+		}
+		memo, role, err := r.findBatchMemo(tx, op.ID, models.RoleEditor)
+		if err != nil {
+			return 0, nil, err
+		}
+		before := memoBytes(memo)
+		updated, err := applyMemoUpdate(memo, input, role)
+		if err != nil || !updated {
+			return fiber.StatusOK, memo, err
+		}
+		if err := r.quota.reserve(memo.UserID, 0, memoBytes(memo)-before); err != nil {
+			return 0, nil, err
+		}
+		return fiber.StatusOK, memo, saveBatchMemo(tx, memo)
+
+	case batchOpMoveCategory:
+		if op.Category == nil {
+			return 0, nil, badMemoInput("Category is required")
+		}
+		memo, _, err := r.findBatchMemo(tx, op.ID, models.RoleEditor)
+		if err != nil {
+			return 0, nil, err
+		}
+		if memo.Category == *op.Category {
+			return fiber.StatusOK, memo, nil
+		}
+		memo.Category = *op.Category
+		return fiber.StatusOK, memo, saveBatchMemo(tx, memo)
+
+	case batchOpAddTag:
+		tag := utils.NormalizeTag(op.Tag)
+		if tags := utils.ExtractTags("#" + tag); len(tags) != 1 || tags[0] != tag {
+			return 0, nil, badMemoInput("Invalid tag")
+		}
+		memo, _, err := r.findBatchMemo(tx, op.ID, models.RoleEditor)
+		if err != nil {
+			return 0, nil, err
+		}
+		if memo.Encrypted {
+			return 0, nil, badMemoInput("Tags cannot be added to encrypted memos")
+		}
+		for _, existing := range utils.ExtractTags(memo.Content) {
+			if existing == tag {
+				return fiber.StatusOK, memo, nil
+			}
+		}
+		// 本文の末尾にタグの行を追加する
+		before := memoBytes(memo)
+		if content := strings.TrimRight(memo.Content, "\n"); content != "" {
+			memo.Content = content + "\n\n#" + tag
+		} else {
+			memo.Content = "#" + tag
+		}
+		if err := r.quota.reserve(memo.UserID, 0, memoBytes(memo)-before); err != nil {
+			return 0, nil, err
+		}
+		return fiber.StatusOK, memo, saveBatchMemo(tx, memo)
+
+	case batchOpDelete:
+		memo, _, err := r.findBatchMemo(tx, op.ID, roleOwner)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, err := deleteMemoTx(tx, memo.ID); err != nil {
+			return 0, nil, err
+		}
+		return fiber.StatusOK, nil, nil
+
+	case batchOpRestore:
+		// 削除されたメモを添付ファイル・共有・コメントごと戻す (統合されたメモは統合先へのリダイレクトをやめる)
+		memo, err := r.findTrashedMemo(tx, op.ID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := r.quota.reserve(memo.UserID, 1, memoBytes(memo)); err != nil {
+			return 0, nil, err
+		}
+		if err := tx.Unscoped().Model(&models.Memo{}).Where("id = ?", memo.ID).Updates(map[string]interface{}{"deleted_at": nil, "merged_into": ""}).Error; err != nil {
+			return 0, nil, err
+		}
+		memo.DeletedAt, memo.MergedInto = gorm.DeletedAt{}, ""
+		return fiber.StatusOK, memo, syncMemoDerived(tx, memo, activityNone)
+
+	case batchOpPurge:
+		// ゴミ箱のメモを完全に削除する (添付ファイルの実体もどこからも参照されなくなれば削除する)
+		memo, err := r.findTrashedMemo(tx, op.ID)
+		if err != nil {
+			return 0, nil, err
+		}
+		hashes, err := purgeMemoTx(tx, memo.ID)
+		if err != nil {
+			return 0, nil, err
+		}
+		r.blobHashes = append(r.blobHashes, hashes...)
+		return fiber.StatusOK, nil, nil
+	}
+	return 0, nil, badMemoInput(fmt.Sprintf("Unknown operation: %q", op.Op))
+}
+
+// findTrashedMemo はゴミ箱 (削除・統合された) のメモを取得し、所有者かどうかを確認します
+func (r *batchRun) findTrashedMemo(tx *gorm.DB, memoID string) (*models.Memo, error) {
+	var memo models.Memo
+	if err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", memoID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errMemoNotFound
+		}
+		return nil, err
+	}
+	if _, _, err := r.checkBatchMemo(&memo, roleOwner); err != nil {
+		return nil, err
+	}
+	return &memo, nil
+}
+
+// decodeBatchMemo は操作の memo を入力の構造体に変換します
+func decodeBatchMemo(raw json.RawMessage, input interface{}) error {
+	if len(raw) == 0 {
+		return badMemoInput("Memo is required")
+	}
+	if err := json.Unmarshal(raw, input); err != nil {
+		return &memoInputError{Status: fiber.StatusBadRequest, Message: "Cannot parse memo", Details: err.Error()}
+	}
+	return nil
+}
+
+// runBatch は一括操作を1つのトランザクションで実行します。
+// atomic では最初に失敗した操作までの結果 (メモを除く) を返してすべて取り消し、partial では失敗した操作だけを取り消します (セーブポイント)。
+func runBatch(c *fiber.Ctx, userID string, input *BatchInput) ([]BatchResult, bool, error) {
+	run := &batchRun{c: c, userID: userID, workspaceID: requestWorkspaceID(c)}
+	if err := run.loadRoles(input.Operations); err != nil {
+		return nil, false, err
+	}
+	// トランザクションの中では使用量を数えられないため、上限と使用量は実行前に読み込む
+	var err error
+	if run.quota, err = loadMemoQuota(append([]string{userID}, run.owners...)...); err != nil {
+		return nil, false, err
+	}
+	results := make([]BatchResult, 0, len(input.Operations))
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for i, op := range input.Operations {
+			result := BatchResult{Index: i, Op: op.Op, ID: op.ID}
+			var memo *models.Memo
+			apply := func(tx *gorm.DB) error {
+				status, applied, err := run.apply(tx, op)
+				result.Status, memo = status, applied
+				return err
+			}
+			var err error
+			if input.Mode == batchModePartial {
+				// 失敗した操作が消した添付ファイルは残るので、ハッシュも戻す
+				hashes := len(run.blobHashes)
+				if err = tx.Transaction(apply); err != nil {
+					run.blobHashes = run.blobHashes[:hashes]
+				}
+			} else {
+				err = apply(tx)
+			}
+			if err != nil {
+				batchError(&result, err)
+			} else if memo != nil {
+				result.ID = memo.ID
+				result.Memo = memo
+			}
+			results = append(results, result)
+			if err != nil && input.Mode != batchModePartial {
+				return errBatchRolledBack
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errBatchRolledBack) {
+			// 何も反映されていないのでメモは返さない (作成したメモのIDや保護されたメモの本文も含めない)
+			for i := range results {
+				results[i].ID, results[i].Memo = input.Operations[i].ID, nil
+			}
+			return results, false, nil
+		}
+		return nil, false, err
+	}
+	cleanupOrphanBlobs(c.Context(), run.blobHashes)
+	for i := range results {
+		if results[i].Memo != nil {
+			prepareMemoResponse(c, userID, results[i].Memo)
+		}
+	}
+	return results, true, nil
+}
+
+// BatchMemos はメモの作成・更新・削除・カテゴリの移動・タグの追加・復元をまとめて実行します。
+// mode が atomic (既定) ならすべて成功した場合のみ反映し、partial なら成功した操作だけ反映します。
+func BatchMemos(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(BatchInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Mode == "" {
+		input.Mode = batchModeAtomic
+	}
+	if input.Mode != batchModeAtomic && input.Mode != batchModePartial {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be 'atomic' or 'partial'"})
+	}
+	if len(input.Operations) == 0 || len(input.Operations) > maxBatchOperations {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("operations must contain 1-%d items", maxBatchOperations)})
+	}
+
+	results, committed, err := runBatch(c, userID, input)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not apply batch", "details": err.Error()})
+	}
+	status := fiber.StatusOK
+	if !committed {
+		// atomic で失敗した場合は失敗した操作のステータスを返す
+		status = results[len(results)-1].Status
+	}
+	return c.Status(status).JSON(fiber.Map{"mode": input.Mode, "committed": committed, "results": results})
+}
+
+// GetTrashedMemos はゴミ箱 (削除・統合されたメモ) を削除日時の新しい順に返します。戻すには一括操作の restore を使います。
+func GetTrashedMemos(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memos := []models.Memo{}
+	err := database.DB.Unscoped().Scopes(MemoListScope(userID, requestWorkspaceID(c))).
+		Where("memos.deleted_at IS NOT NULL").
+		Order("memos.deleted_at desc").
+		Find(&memos).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+	}
+	for i := range memos {
+		prepareMemoResponse(c, userID, &memos[i])
+	}
+	return c.JSON(memos)
+}
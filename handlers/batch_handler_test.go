@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+func postBatch(t *testing.T, token string, payload map[string]interface{}, expected int) batchResponse {
+	resp := memoRequest(t, http.MethodPost, "/api/memos/batch", token, payload)
+	assert.Equal(t, expected, resp.StatusCode, readResponseBody(resp))
+	var result batchResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result
+}
+
+func memoExists(id string) bool {
+	var count int64
+	testDB.Model(&models.Memo{}).Where("id = ?", id).Count(&count)
+	return count == 1
+}
+
+func TestBatchOperations(t *testing.T) {
+	token := loginTestUser(t, "batchuser", "password123")
+	first := createTestMemo(t, token, map[string]interface{}{"title": "First", "content": "hello"})
+	second := createTestMemo(t, token, map[string]interface{}{"title": "Second", "content": "world"})
+	viewerToken := loginAdditionalTestUser(t, "batchviewer", "password123")
+	createTestGrant(t, token, "/api/memos/"+second.ID+"/grants", map[string]interface{}{"username": "batchviewer", "role": "viewer"})
+
+	result := postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "memo": map[string]interface{}{"title": "New", "content": "created in batch"}},
+			{"op": "update", "id": first.ID, "memo": map[string]interface{}{"title": "First (edited)"}},
+			{"op": "move_category", "id": first.ID, "category": "archive"},
+			{"op": "add_tag", "id": first.ID, "tag": "#Cleanup"},
+			{"op": "delete", "id": second.ID},
+		},
+	}, http.StatusOK)
+	assert.True(t, result.Committed)
+	assert.Equal(t, "atomic", result.Mode)
+	if assert.Len(t, result.Results, 5) {
+		assert.Equal(t, http.StatusCreated, result.Results[0].Status)
+		assert.NotEmpty(t, result.Results[0].ID)
+		// 同じ一括操作の前の操作の変更を引き継ぐ
+		edited := result.Results[3].Memo
+		assert.Equal(t, "First (edited)", edited.Title)
+		assert.Equal(t, "archive", edited.Category)
+		assert.Equal(t, "hello\n\n#cleanup", edited.Content)
+	}
+	assert.False(t, memoExists(second.ID))
+	var tags []string
+	testDB.Model(&models.MemoTag{}).Where("memo_id = ?", first.ID).Pluck("tag", &tags)
+	assert.Equal(t, []string{"cleanup"}, tags)
+
+	resp := memoRequest(t, http.MethodGet, "/api/memos/"+second.ID, viewerToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 削除したメモを戻すと共有も戻る
+	result = postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "restore", "id": second.ID}},
+	}, http.StatusOK)
+	assert.Equal(t, "world", result.Results[0].Memo.Content)
+	assert.True(t, memoExists(second.ID))
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+second.ID, viewerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// ゴミ箱にないメモは完全に削除できない
+	result = postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "purge", "id": second.ID}},
+	}, http.StatusNotFound)
+	assert.False(t, result.Committed)
+	assert.True(t, memoExists(second.ID))
+}
+
+func TestBatchAtomicRollsBack(t *testing.T) {
+	token := loginTestUser(t, "batchatomic", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Keep"})
+
+	// 1件でも失敗したらすべて取り消す
+	result := postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"op": "create", "memo": map[string]interface{}{"title": "Rolled back"}},
+			{"op": "delete", "id": memo.ID},
+			{"op": "update", "id": "missing", "memo": map[string]interface{}{"title": "x"}},
+			{"op": "create", "memo": map[string]interface{}{"title": "Never"}},
+		},
+	}, http.StatusNotFound)
+	assert.False(t, result.Committed)
+	if assert.Len(t, result.Results, 3) {
+		assert.Equal(t, http.StatusCreated, result.Results[0].Status)
+		assert.Equal(t, http.StatusOK, result.Results[1].Status)
+		assert.Equal(t, http.StatusNotFound, result.Results[2].Status)
+		// 取り消したのでメモや作成したメモのIDは返さない
+		assert.Nil(t, result.Results[0].Memo)
+		assert.Empty(t, result.Results[0].ID)
+	}
+	assert.True(t, memoExists(memo.ID))
+
+	// partial では成功した操作だけ反映する
+	result = postBatch(t, token, map[string]interface{}{
+		"mode": "partial",
+		"operations": []map[string]interface{}{
+			{"op": "update", "id": memo.ID, "memo": map[string]interface{}{"title": ""}},
+			{"op": "move_category", "id": memo.ID, "category": "done"},
+			{"op": "frobnicate", "id": memo.ID},
+		},
+	}, http.StatusOK)
+	assert.True(t, result.Committed)
+	if assert.Len(t, result.Results, 3) {
+		assert.Equal(t, http.StatusBadRequest, result.Results[0].Status)
+		assert.Equal(t, "Title cannot be empty", result.Results[0].Error)
+		assert.Equal(t, http.StatusOK, result.Results[1].Status)
+		assert.Equal(t, http.StatusBadRequest, result.Results[2].Status)
+	}
+	var saved models.Memo
+	testDB.First(&saved, "id = ?", memo.ID)
+	assert.Equal(t, "Keep", saved.Title)
+	assert.Equal(t, "done", saved.Category)
+
+	postBatch(t, token, map[string]interface{}{"operations": []map[string]interface{}{}}, http.StatusBadRequest)
+	postBatch(t, token, map[string]interface{}{"mode": "yolo", "operations": []map[string]interface{}{{"op": "delete", "id": memo.ID}}}, http.StatusBadRequest)
+}
+
+func TestBatchPermissions(t *testing.T) {
+	ownerToken := loginTestUser(t, "batchowner", "password123")
+	editorToken := loginAdditionalTestUser(t, "batcheditor", "password123")
+	memo := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Shared"})
+	createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "batcheditor", "role": "editor"})
+	private := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Private"})
+
+	result := postBatch(t, editorToken, map[string]interface{}{
+		"mode": "partial",
+		"operations": []map[string]interface{}{
+			{"op": "move_category", "id": memo.ID, "category": "team"},
+			{"op": "delete", "id": memo.ID},
+			{"op": "delete", "id": private.ID},
+		},
+	}, http.StatusOK)
+	if assert.Len(t, result.Results, 3) {
+		assert.Equal(t, http.StatusOK, result.Results[0].Status)
+		assert.Equal(t, http.StatusForbidden, result.Results[1].Status)
+		assert.Equal(t, http.StatusNotFound, result.Results[2].Status)
+	}
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/lock", ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	result = postBatch(t, ownerToken, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "add_tag", "id": memo.ID, "tag": "x"}},
+	}, http.StatusLocked)
+	assert.False(t, result.Committed)
+}
+
+func TestWebBatchMemos(t *testing.T) {
+	token := loginTestUser(t, "webbatch", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	first := createTestMemo(t, token, map[string]interface{}{"title": "A"})
+	second := createTestMemo(t, token, map[string]interface{}{"title": "B"})
+
+	post := func(form url.Values) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/memos/batch", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(webSession(t, userID))
+		resp, err := testApp.Test(req, -1)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := post(url.Values{"action": {"categorize"}, "category": {"work"}, "ids": {first.ID, second.ID}})
+	assert.Equal(t, "/", resp.Header.Get("Location"))
+	var categories []string
+	testDB.Model(&models.Memo{}).Where("id IN ?", []string{first.ID, second.ID}).Pluck("category", &categories)
+	assert.Equal(t, []string{"work", "work"}, categories)
+
+	resp = post(url.Values{"action": {"delete"}, "ids": {first.ID, second.ID}})
+	assert.Equal(t, "/", resp.Header.Get("Location"))
+	assert.False(t, memoExists(first.ID))
+	assert.False(t, memoExists(second.ID))
+
+	resp = post(url.Values{"action": {"delete"}})
+	assert.Equal(t, "/?error=no_memos_selected", resp.Header.Get("Location"))
+}
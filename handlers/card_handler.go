@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDueCardLimit = 20
+	maxDueCardLimit     = 100
+)
+
+var errCardNotFound = errors.New("card not found")
+
+// CardGradeInput はフラッシュカードの評価です (0: 全く思い出せない 〜 5: 完璧)
+type CardGradeInput struct {
+	Grade *int `json:"grade" xml:"grade" form:"grade"`
+}
+
+// userCards はユーザーのフラッシュカードに絞り込むスコープです。
+// 元のメモが閲覧できるものに限り、再認証していなければ保護されたメモのカードは除きます。
+func userCards(c *fiber.Ctx, userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Joins("JOIN memos ON memos.id = cards.memo_id AND memos.deleted_at IS NULL").
+			Where("cards.user_id = ?", userID).
+			Scopes(accessibleMemos(userID))
+		if !reauthenticated(c, userID) {
+			db = db.Where("memos.protected = ?", false)
+		}
+		return db
+	}
+}
+
+// dueCards は復習の期日を過ぎたカードを期日の古い順に最大 limit 件返します
+func dueCards(c *fiber.Ctx, userID string, now time.Time, limit int) ([]models.Card, error) {
+	cards := []models.Card{}
+	err := database.DB.Scopes(userCards(c, userID)).
+		Where("cards.due_at <= ?", now).
+		Order("cards.due_at asc, cards.line asc").
+		Limit(limit).
+		Find(&cards).Error
+	return cards, err
+}
+
+// findUserCard はユーザーのフラッシュカードを取得します
+func findUserCard(c *fiber.Ctx, userID, cardID string) (*models.Card, error) {
+	var card models.Card
+	if err := database.DB.Scopes(userCards(c, userID)).Where("cards.id = ?", cardID).First(&card).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errCardNotFound
+		}
+		return nil, err
+	}
+	return &card, nil
+}
+
+// gradeCard は SM-2 で次の復習日を求めてカードを更新し、復習の記録を残します
+func gradeCard(card *models.Card, userID string, grade int, now time.Time) error {
+	state, err := utils.ReviewSM2(utils.SM2State{
+		EaseFactor:   card.EaseFactor,
+		IntervalDays: card.IntervalDays,
+		Repetitions:  card.Repetitions,
+		Lapses:       card.Lapses,
+	}, grade)
+	if err != nil {
+		return err
+	}
+	card.EaseFactor = state.EaseFactor
+	card.IntervalDays = state.IntervalDays
+	card.Repetitions = state.Repetitions
+	card.Lapses = state.Lapses
+	card.DueAt = now.AddDate(0, 0, state.IntervalDays)
+	card.LastReviewedAt = &now
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Card{}).Where("id = ?", card.ID).Updates(map[string]interface{}{
+			"ease_factor":      card.EaseFactor,
+			"interval_days":    card.IntervalDays,
+			"repetitions":      card.Repetitions,
+			"lapses":           card.Lapses,
+			"due_at":           card.DueAt,
+			"last_reviewed_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.CardReview{
+			ID:           utils.GenerateID(),
+			CardID:       card.ID,
+			UserID:       userID,
+			Grade:        grade,
+			IntervalDays: card.IntervalDays,
+			EaseFactor:   card.EaseFactor,
+			ReviewedAt:   now,
+		}).Error
+	})
+}
+
+// GetCards はユーザーのフラッシュカードを返します (?memo_id= でメモを指定できます)
+func GetCards(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	query := database.DB.Scopes(userCards(c, userID))
+	if memoID := c.Query("memo_id"); memoID != "" {
+		query = query.Where("cards.memo_id = ?", memoID)
+	}
+	cards := []models.Card{}
+	if err := query.Order("cards.memo_id, cards.line asc").Find(&cards).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve cards", "details": err.Error()})
+	}
+	return c.JSON(cards)
+}
+
+// GetDueCards は復習の期日を過ぎたフラッシュカードを返します (?limit=N、最大100)
+func GetDueCards(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	limit := c.QueryInt("limit", defaultDueCardLimit)
+	if limit < 1 || limit > maxDueCardLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 100"})
+	}
+	cards, err := dueCards(c, userID, time.Now().UTC(), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve cards", "details": err.Error()})
+	}
+	return c.JSON(cards)
+}
+
+// GradeCard はフラッシュカードの評価 (0〜5) を記録し、次の復習日を設定します
+func GradeCard(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CardGradeInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Grade == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": utils.ErrInvalidGrade.Error()})
+	}
+	card, err := findUserCard(c, userID, c.Params("id"))
+	if err != nil {
+		if errors.Is(err, errCardNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Card not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve card", "details": err.Error()})
+	}
+	if err := gradeCard(card, userID, *input.Grade, time.Now().UTC()); err != nil {
+		if errors.Is(err, utils.ErrInvalidGrade) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not grade card", "details": err.Error()})
+	}
+	return c.JSON(card)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getCards(t *testing.T, token, path string) []models.Card {
+	resp := memoRequest(t, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var cards []models.Card
+	json.NewDecoder(resp.Body).Decode(&cards)
+	return cards
+}
+
+func TestFlashcardsFromMemo(t *testing.T) {
+	token := loginTestUser(t, "carduser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{
+		"title":   "Vocabulary",
+		"content": "- apple:: りんご\n{{c1::Tokyo}} is the capital of {{c2::Japan}}",
+	})
+
+	cards := getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	if assert.Len(t, cards, 3) {
+		assert.Equal(t, "apple", cards[0].Front)
+		assert.Equal(t, "りんご", cards[0].Back)
+		assert.Equal(t, "[...] is the capital of Japan", cards[1].Front)
+	}
+	assert.Len(t, getCards(t, token, "/api/cards/due"), 3)
+
+	// 評価すると次の復習日が先になり、期日のカードから外れる
+	resp := memoRequest(t, http.MethodPost, "/api/cards/"+cards[0].ID+"/grade", token, map[string]interface{}{"grade": 5})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var graded models.Card
+	json.NewDecoder(resp.Body).Decode(&graded)
+	assert.Equal(t, 1, graded.Repetitions)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 1), graded.DueAt, time.Minute)
+	assert.Len(t, getCards(t, token, "/api/cards/due"), 2)
+	var reviews int64
+	testDB.Model(&models.CardReview{}).Where("card_id = ?", graded.ID).Count(&reviews)
+	assert.Equal(t, int64(1), reviews)
+
+	resp = memoRequest(t, http.MethodPost, "/api/cards/"+cards[0].ID+"/grade", token, map[string]interface{}{"grade": 7})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/cards/"+cards[0].ID+"/grade", token, map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/cards/due?limit=0", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 他のユーザーのカードは評価できない
+	otherToken := loginAdditionalTestUser(t, "cardstranger", "password123")
+	resp = memoRequest(t, http.MethodPost, "/api/cards/"+cards[0].ID+"/grade", otherToken, map[string]interface{}{"grade": 3})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Empty(t, getCards(t, otherToken, "/api/cards"))
+
+	// メモを削除するとカードも消える
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, getCards(t, token, "/api/cards"))
+}
+
+func TestFlashcardsKeepHistoryOnEdit(t *testing.T) {
+	token := loginTestUser(t, "cardeditor", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Deck", "content": "capital of France:: Paris\nH2O:: water"})
+	cards := getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	assert.Len(t, cards, 2)
+	resp := memoRequest(t, http.MethodPost, "/api/cards/"+cards[0].ID+"/grade", token, map[string]interface{}{"grade": 4})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// 答えの変更・行の移動では同じカードのまま
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "# Deck\ncapital of France:: **Paris**\nH2O:: water"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	edited := getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	if assert.Len(t, edited, 2) {
+		assert.Equal(t, cards[0].ID, edited[0].ID)
+		assert.Equal(t, "**Paris**", edited[0].Back)
+		assert.Equal(t, 2, edited[0].Line)
+		assert.Equal(t, 1, edited[0].Repetitions)
+	}
+
+	// 質問文を書き換えても同じ行なら状態を引き継ぐ
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "# Deck\nFrance's capital:: Paris\nH2O:: water"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	edited = getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	if assert.Len(t, edited, 2) {
+		assert.Equal(t, cards[0].ID, edited[0].ID)
+		assert.Equal(t, "France's capital", edited[0].Front)
+		assert.Equal(t, 1, edited[0].Repetitions)
+	}
+
+	// 消したカードは元に戻すと復習の状態ごと復元する
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "H2O:: water"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, getCards(t, token, "/api/cards?memo_id="+memo.ID), 1)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "H2O:: water\nFrance's capital:: Paris"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	edited = getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	if assert.Len(t, edited, 2) {
+		assert.Equal(t, cards[0].ID, edited[1].ID)
+		assert.Equal(t, 1, edited[1].Repetitions)
+	}
+}
+
+func TestWebCardReview(t *testing.T) {
+	token := loginTestUser(t, "webcards", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	cookie := webSession(t, userID)
+	createTestMemo(t, token, map[string]interface{}{"title": "Deck", "content": "What is **Go**?:: A language"})
+
+	resp, body := getSharePage(t, "/cards/review", cookie)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<strong>Go</strong>")
+	assert.Contains(t, body, "残り 1 枚")
+
+	cards := getCards(t, token, "/api/cards/due")
+	form := url.Values{"grade": {"4"}}
+	req := httptest.NewRequest(http.MethodPost, "/cards/"+cards[0].ID+"/grade", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	resp, err = testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/cards/review", resp.Header.Get("Location"))
+
+	_, body = getSharePage(t, "/cards/review", cookie)
+	assert.Contains(t, body, "復習するカードはありません")
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CommentInput struct {
+	Body     string `json:"body" xml:"body" form:"body"`
+	ParentID string `json:"parent_id" xml:"parent_id" form:"parent_id"` // 返信先のコメント (任意)
+}
+
+var (
+	errCommentNotFound       = errors.New("comment not found")
+	errCommentParentNotFound = errors.New("parent comment not found")
+	errCommentEmpty          = errors.New("comment body is required")
+	errCommentNotAuthor      = errors.New("only the author can change the comment")
+	errCommentNotThread      = errors.New("only the first comment of a thread can be resolved")
+	errCommentReauth         = errors.New("re-authentication required")
+)
+
+// findCommentMemo はコメントを読み書きできる (viewer 以上の) メモを返します。
+// 保護されたメモのコメントは本文と同じく再認証が必要です。
+func findCommentMemo(c *fiber.Ctx, userID, memoID string) (*models.Memo, string, error) {
+	memo, role, err := findRequestMemoWithRole(c, userID, memoID, models.RoleViewer)
+	if err != nil {
+		return nil, "", err
+	}
+	if memo.Protected && !reauthenticated(c, userID) {
+		return nil, "", errCommentReauth
+	}
+	return memo, role, nil
+}
+
+// findComment はメモのコメントを取得します
+func findComment(memoID, commentID string) (*models.Comment, error) {
+	var comment models.Comment
+	if err := database.DB.Where("id = ? AND memo_id = ?", commentID, memoID).First(&comment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errCommentNotFound
+		}
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// fillCommentUsernames は投稿者のユーザー名を設定します
+func fillCommentUsernames(comments []*models.Comment) error {
+	userIDs := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		userIDs = append(userIDs, comment.UserID)
+	}
+	var users []models.User
+	if err := database.DB.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return err
+	}
+	names := make(map[string]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	for _, comment := range comments {
+		comment.Username = names[comment.UserID]
+	}
+	return nil
+}
+
+// loadCommentThreads はメモのコメントをスレッド (最初のコメントに返信をまとめたもの) の古い順で返します。
+// resolved を指定した場合は解決済み (または未解決) のスレッドのみ返します。
+func loadCommentThreads(memoID string, resolved *bool) ([]models.Comment, error) {
+	var comments []models.Comment
+	if err := database.DB.Where("memo_id = ?", memoID).Order("created_at asc").Order("id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	pointers := make([]*models.Comment, len(comments))
+	for i := range comments {
+		pointers[i] = &comments[i]
+	}
+	if err := fillCommentUsernames(pointers); err != nil {
+		return nil, err
+	}
+
+	replies := map[string][]models.Comment{}
+	for _, comment := range comments {
+		if comment.ParentID != "" {
+			replies[comment.ParentID] = append(replies[comment.ParentID], comment)
+		}
+	}
+	threads := []models.Comment{}
+	for _, comment := range comments {
+		if comment.ParentID != "" || (resolved != nil && comment.Resolved != *resolved) {
+			continue
+		}
+		comment.Replies = replies[comment.ID]
+		if comment.Replies == nil {
+			comment.Replies = []models.Comment{}
+		}
+		threads = append(threads, comment)
+	}
+	return threads, nil
+}
+
+// createComment はメモにコメントを投稿します。返信への返信はスレッドの最初のコメントへの返信にします。
+func createComment(memoID, userID string, input *CommentInput) (*models.Comment, error) {
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
+		return nil, errCommentEmpty
+	}
+	comment := models.Comment{
+		ID:     utils.GenerateID(),
+		MemoID: memoID,
+		UserID: userID,
+		Body:   body,
+	}
+	if input.ParentID != "" {
+		parent, err := findComment(memoID, input.ParentID)
+		if err != nil {
+			if errors.Is(err, errCommentNotFound) {
+				return nil, errCommentParentNotFound
+			}
+			return nil, err
+		}
+		comment.ParentID = parent.ID
+		if parent.ParentID != "" {
+			comment.ParentID = parent.ParentID
+		}
+	}
+	if err := database.DB.Create(&comment).Error; err != nil {
+		return nil, err
+	}
+	comment.Replies = []models.Comment{}
+	return &comment, fillCommentUsernames([]*models.Comment{&comment})
+}
+
+// updateCommentBody はコメントの本文を編集します (投稿者のみ)
+func updateCommentBody(comment *models.Comment, userID, body string) error {
+	if comment.UserID != userID {
+		return errCommentNotAuthor
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return errCommentEmpty
+	}
+	if body == comment.Body {
+		return nil
+	}
+	now := time.Now().UTC()
+	stored, err := models.EncryptField(database.DB, comment.UserID, body)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Model(comment).Updates(map[string]interface{}{"body": stored, "edited_at": now}).Error; err != nil {
+		return err
+	}
+	comment.Body, comment.EditedAt = body, &now
+	return nil
+}
+
+// deleteComment はコメントを削除します (投稿者のみ)。スレッドの最初のコメントを削除すると返信も削除されます。
+func deleteComment(comment *models.Comment, userID string) error {
+	if comment.UserID != userID {
+		return errCommentNotAuthor
+	}
+	return database.DB.Where("id = ? OR (memo_id = ? AND parent_id = ?)", comment.ID, comment.MemoID, comment.ID).
+		Delete(&models.Comment{}).Error
+}
+
+// setCommentResolved はスレッドを解決済み (または未解決) にします。
+// スレッドの投稿者とメモの editor 以上の権限を持つユーザーが変更できます。
+func setCommentResolved(comment *models.Comment, userID, role string, resolved bool) error {
+	if comment.ParentID != "" {
+		return errCommentNotThread
+	}
+	if comment.UserID != userID && roleRank[role] < roleRank[models.RoleEditor] {
+		return errMemoForbidden
+	}
+	updates := map[string]interface{}{"resolved": resolved, "resolved_by": "", "resolved_at": nil}
+	comment.Resolved, comment.ResolvedBy, comment.ResolvedAt = resolved, "", nil
+	if resolved {
+		now := time.Now().UTC()
+		updates["resolved_by"], updates["resolved_at"] = userID, now
+		comment.ResolvedBy, comment.ResolvedAt = userID, &now
+	}
+	return database.DB.Model(comment).Updates(updates).Error
+}
+
+// commentErrorResponse はコメント操作のエラーをレスポンスに変換します
+func commentErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errCommentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	case errors.Is(err, errCommentParentNotFound), errors.Is(err, errCommentEmpty), errors.Is(err, errCommentNotThread):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errCommentNotAuthor):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errCommentReauth):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Re-authentication required", "reauth_required": true})
+	case errors.Is(err, errMemoNotFound), errors.Is(err, errMemoForbidden):
+		return memoAccessErrorResponse(c, err)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not process comment", "details": err.Error()})
+}
+
+// findRequestComment はURLのメモ (:id) とコメント (:commentID) を取得します
+func findRequestComment(c *fiber.Ctx, userID string) (*models.Comment, string, error) {
+	memo, role, err := findCommentMemo(c, userID, c.Params("id"))
+	if err != nil {
+		return nil, "", err
+	}
+	comment, err := findComment(memo.ID, c.Params("commentID"))
+	if err != nil {
+		return nil, "", err
+	}
+	return comment, role, fillCommentUsernames([]*models.Comment{comment})
+}
+
+// GetComments はメモのコメントをスレッドごとに返します (?resolved=true / false で絞り込み)
+func GetComments(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memo, _, err := findCommentMemo(c, userID, c.Params("id"))
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	var resolved *bool
+	switch c.Query("resolved") {
+	case "":
+	case "true", "false":
+		value := c.Query("resolved") == "true"
+		resolved = &value
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "resolved must be 'true' or 'false'"})
+	}
+	threads, err := loadCommentThreads(memo.ID, resolved)
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	return c.JSON(threads)
+}
+
+// CreateComment はメモにコメント (parent_id を指定すると返信) を投稿します (viewer 以上)
+func CreateComment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CommentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	memo, _, err := findCommentMemo(c, userID, c.Params("id"))
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	comment, err := createComment(memo.ID, userID, input)
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+// UpdateComment はコメントの本文を編集します (投稿者のみ)
+func UpdateComment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CommentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	comment, _, err := findRequestComment(c, userID)
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	if err := updateCommentBody(comment, userID, input.Body); err != nil {
+		return commentErrorResponse(c, err)
+	}
+	return c.JSON(comment)
+}
+
+// DeleteComment はコメントを削除します (投稿者のみ、スレッドの最初のコメントなら返信も削除)
+func DeleteComment(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	comment, _, err := findRequestComment(c, userID)
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	if err := deleteComment(comment, userID); err != nil {
+		return commentErrorResponse(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "Comment deleted successfully"})
+}
+
+// setCommentResolvedHandler はスレッドの解決状態を変更するハンドラーの共通処理です
+func setCommentResolvedHandler(c *fiber.Ctx, resolved bool) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	comment, role, err := findRequestComment(c, userID)
+	if err != nil {
+		return commentErrorResponse(c, err)
+	}
+	if err := setCommentResolved(comment, userID, role, resolved); err != nil {
+		return commentErrorResponse(c, err)
+	}
+	return c.JSON(comment)
+}
+
+// ResolveComment はスレッドを解決済みにします (スレッドの投稿者または editor 以上)
+func ResolveComment(c *fiber.Ctx) error {
+	return setCommentResolvedHandler(c, true)
+}
+
+// UnresolveComment はスレッドを未解決に戻します (スレッドの投稿者または editor 以上)
+func UnresolveComment(c *fiber.Ctx) error {
+	return setCommentResolvedHandler(c, false)
+}
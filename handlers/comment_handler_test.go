@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestComment(t *testing.T, token, memoID string, payload map[string]interface{}) models.Comment {
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memoID+"/comments", token, payload)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	var comment models.Comment
+	json.NewDecoder(resp.Body).Decode(&comment)
+	return comment
+}
+
+func getCommentThreads(t *testing.T, token, memoID, query string) []models.Comment {
+	resp := memoRequest(t, http.MethodGet, "/api/memos/"+memoID+"/comments"+query, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var threads []models.Comment
+	json.NewDecoder(resp.Body).Decode(&threads)
+	return threads
+}
+
+func TestCommentThreads(t *testing.T) {
+	ownerToken := loginTestUser(t, "commentowner", "password123")
+	viewerToken := loginAdditionalTestUser(t, "commentviewer", "password123")
+	memo := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Design doc"})
+	createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "commentviewer", "role": "viewer"})
+
+	// 共有された viewer もコメントできる
+	root := createTestComment(t, viewerToken, memo.ID, map[string]interface{}{"body": "Looks **good**"})
+	assert.Equal(t, "commentviewer", root.Username)
+	reply := createTestComment(t, ownerToken, memo.ID, map[string]interface{}{"body": "Thanks", "parent_id": root.ID})
+	assert.Equal(t, root.ID, reply.ParentID)
+	// 返信への返信はスレッドにまとめる
+	nested := createTestComment(t, viewerToken, memo.ID, map[string]interface{}{"body": "np", "parent_id": reply.ID})
+	assert.Equal(t, root.ID, nested.ParentID)
+	createTestComment(t, ownerToken, memo.ID, map[string]interface{}{"body": "Second thread"})
+
+	threads := getCommentThreads(t, ownerToken, memo.ID, "")
+	if assert.Len(t, threads, 2) {
+		assert.Equal(t, root.ID, threads[0].ID)
+		assert.Len(t, threads[0].Replies, 2)
+		assert.Empty(t, threads[1].Replies)
+	}
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/comments", ownerToken, map[string]interface{}{"body": "  "})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/comments", ownerToken, map[string]interface{}{"body": "x", "parent_id": "missing"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// アクセスできないメモにはコメントできない
+	strangerToken := loginAdditionalTestUser(t, "commentstranger", "password123")
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID+"/comments", strangerToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 編集・削除は投稿者のみ
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID+"/comments/"+root.ID, ownerToken, map[string]interface{}{"body": "hijack"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID+"/comments/"+root.ID, viewerToken, map[string]interface{}{"body": "Looks great"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var edited models.Comment
+	json.NewDecoder(resp.Body).Decode(&edited)
+	assert.Equal(t, "Looks great", edited.Body)
+	assert.NotNil(t, edited.EditedAt)
+
+	// スレッドを削除すると返信も削除される
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/comments/"+root.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/comments/"+root.ID, viewerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var count int64
+	testDB.Model(&models.Comment{}).Where("memo_id = ?", memo.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// 削除したメモのコメントは表示できないが、ゴミ箱から戻すとコメントも戻る
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID+"/comments", ownerToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	postBatch(t, ownerToken, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "restore", "id": memo.ID}},
+	}, http.StatusOK)
+	threads = getCommentThreads(t, ownerToken, memo.ID, "")
+	if assert.Len(t, threads, 1) {
+		assert.Equal(t, "Second thread", threads[0].Body)
+	}
+}
+
+func TestResolveCommentThread(t *testing.T) {
+	ownerToken := loginTestUser(t, "resolveowner", "password123")
+	viewerToken := loginAdditionalTestUser(t, "resolveviewer", "password123")
+	memo := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Review"})
+	createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "resolveviewer", "role": "viewer"})
+	thread := createTestComment(t, ownerToken, memo.ID, map[string]interface{}{"body": "Fix typo"})
+	reply := createTestComment(t, viewerToken, memo.ID, map[string]interface{}{"body": "Done", "parent_id": thread.ID})
+
+	// viewer は他人のスレッドを解決できない
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/comments/"+thread.ID+"/resolve", viewerToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/comments/"+reply.ID+"/resolve", ownerToken, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/comments/"+thread.ID+"/resolve", ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var resolved models.Comment
+	json.NewDecoder(resp.Body).Decode(&resolved)
+	assert.True(t, resolved.Resolved)
+	assert.NotNil(t, resolved.ResolvedAt)
+
+	assert.Len(t, getCommentThreads(t, ownerToken, memo.ID, "?resolved=true"), 1)
+	assert.Empty(t, getCommentThreads(t, ownerToken, memo.ID, "?resolved=false"))
+
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/comments/"+thread.ID+"/resolve", ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, getCommentThreads(t, ownerToken, memo.ID, "?resolved=false"), 1)
+}
+
+func TestWebMemoCommentSection(t *testing.T) {
+	token := loginTestUser(t, "webcommenter", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Web memo", "content": "body"})
+	cookie := webSession(t, userID)
+
+	form := url.Values{"body": {"Hello *web*"}}
+	req := httptest.NewRequest(http.MethodPost, "/memos/"+memo.ID+"/comments", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/memos/"+memo.ID+"#comments", resp.Header.Get("Location"))
+
+	resp, body := getSharePage(t, "/memos/"+memo.ID, cookie)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `id="comments"`)
+	assert.Contains(t, body, "<em>web</em>")
+	assert.Contains(t, body, "webcommenter")
+
+	// 署名の無い Cookie (ユーザーIDそのものや API のトークン) ではログインできない
+	for _, forged := range []string{userID, token} {
+		resp, _ = getSharePage(t, "/memos/"+memo.ID, &http.Cookie{Name: "user_id", Value: forged})
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "/login", resp.Header.Get("Location"))
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const dailyDateLayout = "2006-01-02"
+
+var errInvalidDailyDate = errors.New("date must be 'today', 'yesterday', 'tomorrow' or YYYY-MM-DD")
+
+var errEncryptedTemplate = errors.New("encrypted memos cannot be used as daily templates")
+
+// errDailyNoteExists は同時に同じ日付のデイリーノートが作られた場合にトランザクションを取り消すためのエラーです
+var errDailyNoteExists = errors.New("daily note already exists")
+
+var japaneseWeekdays = [...]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"}
+
+// DailyNoteResponse はデイリーノートと前後の日付 (ノートがある日) のレスポンスです
+type DailyNoteResponse struct {
+	Date     string
+	Memo     models.Memo
+	Previous string // 前のノートの日付 (無ければ空)
+	Next     string // 次のノートの日付 (無ければ空)
+	Created  bool   // このリクエストで作成された場合 true
+}
+
+// resolveDailyDate は today / yesterday / tomorrow (ユーザーのタイムゾーンでの日付) または YYYY-MM-DD を日付に変換します
+func resolveDailyDate(value string, loc *time.Location) (string, error) {
+	now := time.Now().In(loc)
+	switch value {
+	case "today":
+		return now.Format(dailyDateLayout), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1).Format(dailyDateLayout), nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1).Format(dailyDateLayout), nil
+	}
+	date, err := time.Parse(dailyDateLayout, value)
+	if err != nil {
+		return "", errInvalidDailyDate
+	}
+	return date.Format(dailyDateLayout), nil
+}
+
+// renderDailyTemplate はテンプレートのプレースホルダー ({{date}}, {{weekday}}) を置き換えます
+func renderDailyTemplate(content, date string) string {
+	weekday := ""
+	if t, err := time.Parse(dailyDateLayout, date); err == nil {
+		weekday = japaneseWeekdays[t.Weekday()]
+	}
+	return strings.NewReplacer("{{date}}", date, "{{weekday}}", weekday).Replace(content)
+}
+
+// dailyTemplateContent はデイリーノートの初期本文を返します。
+// templateID を指定した場合は閲覧できるメモである必要があり、省略した場合はユーザー設定のテンプレート (あれば) を使います。
+func dailyTemplateContent(user models.User, templateID, date string) (string, error) {
+	explicit := templateID != ""
+	if !explicit {
+		templateID = user.DailyTemplateID
+	}
+	if templateID == "" {
+		return "", nil
+	}
+	memo, _, err := findMemoWithRole(user.ID, templateID, models.RoleViewer)
+	if err != nil {
+		if !explicit && errors.Is(err, errMemoNotFound) {
+			// 設定されたテンプレートが削除された場合は空のノートにする
+			return "", nil
+		}
+		return "", err
+	}
+	if memo.Encrypted {
+		return "", errEncryptedTemplate
+	}
+	return renderDailyTemplate(memo.Content, date), nil
+}
+
+// findDailyNoteMemo は日付のデイリーノートのメモを返します。無い (またはメモが削除された) 場合は nil です。
+func findDailyNoteMemo(userID, date string) (*models.Memo, error) {
+	var note models.DailyNote
+	if err := database.DB.Where("user_id = ? AND date = ?", userID, date).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var memo models.Memo
+	if err := database.DB.Where("id = ?", note.MemoID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &memo, nil
+}
+
+// getOrCreateDailyNote はユーザーの日付のデイリーノートを返します。無ければテンプレートから作成します。
+func getOrCreateDailyNote(user models.User, date, templateID string) (*models.Memo, bool, error) {
+	memo, err := findDailyNoteMemo(user.ID, date)
+	if err != nil || memo != nil {
+		return memo, false, err
+	}
+
+	content, err := dailyTemplateContent(user, templateID, date)
+	if err != nil {
+		return nil, false, err
+	}
+	created := models.Memo{
+		ID:      utils.GenerateID(),
+		Title:   date,
+		Content: content,
+		UserID:  user.ID,
+	}
+	if err := checkMemoQuota(user.ID, 1, memoBytes(&created)); err != nil {
+		return nil, false, err
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// メモが削除されて残った対応は作り直す
+		if err := tx.Where("user_id = ? AND date = ? AND memo_id NOT IN (SELECT id FROM memos WHERE deleted_at IS NULL)", user.ID, date).
+			Delete(&models.DailyNote{}).Error; err != nil {
+			return err
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.DailyNote{UserID: user.ID, Date: date, MemoID: created.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDailyNoteExists
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		return syncMemoDerived(tx, &created, activityCreated)
+	})
+	if errors.Is(err, errDailyNoteExists) {
+		// 同時に作成された場合は先に作られたノートを返す
+		memo, err := findDailyNoteMemo(user.ID, date)
+		return memo, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &created, true, nil
+}
+
+// adjacentDailyDates はノートがある日のうち、date の直前と直後の日付を返します
+func adjacentDailyDates(userID, date string) (string, string, error) {
+	base := database.DB.Model(&models.DailyNote{}).
+		Joins("JOIN memos ON memos.id = daily_notes.memo_id AND memos.deleted_at IS NULL").
+		Where("daily_notes.user_id = ?", userID)
+	var previous, next []string
+	if err := base.Session(&gorm.Session{}).Where("daily_notes.date < ?", date).Order("daily_notes.date desc").Limit(1).Pluck("daily_notes.date", &previous).Error; err != nil {
+		return "", "", err
+	}
+	if err := base.Session(&gorm.Session{}).Where("daily_notes.date > ?", date).Order("daily_notes.date asc").Limit(1).Pluck("daily_notes.date", &next).Error; err != nil {
+		return "", "", err
+	}
+	var prev, nxt string
+	if len(previous) > 0 {
+		prev = previous[0]
+	}
+	if len(next) > 0 {
+		nxt = next[0]
+	}
+	return prev, nxt, nil
+}
+
+// loadDailyNote はリクエストの日付 (today など) を解決し、デイリーノートを取得または作成します
+func loadDailyNote(userID, dateParam, templateID string) (*DailyNoteResponse, error) {
+	user, err := findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	date, err := resolveDailyDate(dateParam, userLocation(*user))
+	if err != nil {
+		return nil, err
+	}
+	memo, created, err := getOrCreateDailyNote(*user, date, templateID)
+	if err != nil {
+		return nil, err
+	}
+	previous, next, err := adjacentDailyDates(userID, date)
+	if err != nil {
+		return nil, err
+	}
+	return &DailyNoteResponse{Date: date, Memo: *memo, Previous: previous, Next: next, Created: created}, nil
+}
+
+// GetDailyNote は日付 (today / yesterday / tomorrow / YYYY-MM-DD) のデイリーノートを返します。
+// 無い場合はクエリパラメータ template (メモID) またはユーザー設定のテンプレートから作成します。
+func GetDailyNote(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	response, err := loadDailyNote(userID, c.Params("date"), c.Query("template"))
+	if err != nil {
+		var inputErr *memoInputError
+		switch {
+		case errors.As(err, &inputErr):
+			return memoAccessErrorResponse(c, err)
+		case errors.Is(err, errInvalidDailyDate), errors.Is(err, errEncryptedTemplate):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, errMemoNotFound), errors.Is(err, errMemoForbidden):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Template memo not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve daily note", "details": err.Error()})
+	}
+	prepareMemoResponse(c, userID, &response.Memo)
+	return c.JSON(response)
+}
+
+// GetDailyNotes はデイリーノートがある日付の一覧を返します (from / to で範囲を指定可、YYYY-MM-DD)
+func GetDailyNotes(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	db := database.DB.Model(&models.DailyNote{}).
+		Joins("JOIN memos ON memos.id = daily_notes.memo_id AND memos.deleted_at IS NULL").
+		Where("daily_notes.user_id = ?", userID)
+	for param, op := range map[string]string{"from": ">=", "to": "<="} {
+		if value := c.Query(param); value != "" {
+			if _, err := time.Parse(dailyDateLayout, value); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid '" + param + "' date (expected YYYY-MM-DD)"})
+			}
+			db = db.Where("daily_notes.date "+op+" ?", value)
+		}
+	}
+	notes := []models.DailyNote{}
+	if err := db.Select("daily_notes.*").Order("daily_notes.date desc").Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve daily notes", "details": err.Error()})
+	}
+	return c.JSON(notes)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getDailyNote(t *testing.T, token, path string) DailyNoteResponse {
+	resp := memoRequest(t, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var daily DailyNoteResponse
+	json.NewDecoder(resp.Body).Decode(&daily)
+	return daily
+}
+
+func TestDailyNotes(t *testing.T) {
+	token := loginTestUser(t, "dailyuser", "password123")
+	template := createTestMemo(t, token, map[string]interface{}{"title": "Template", "content": "# {{date}} ({{weekday}})\n- [ ] 振り返り"})
+
+	// 同じ日付は2回目以降同じメモを返す
+	first := getDailyNote(t, token, "/api/daily/2024-03-01?template="+template.ID)
+	assert.True(t, first.Created)
+	assert.Equal(t, "2024-03-01", first.Memo.Title)
+	assert.Equal(t, "# 2024-03-01 (金曜日)\n- [ ] 振り返り", first.Memo.Content)
+	again := getDailyNote(t, token, "/api/daily/2024-03-01")
+	assert.False(t, again.Created)
+	assert.Equal(t, first.Memo.ID, again.Memo.ID)
+
+	getDailyNote(t, token, "/api/daily/2024-02-27")
+	getDailyNote(t, token, "/api/daily/2024-03-05")
+	middle := getDailyNote(t, token, "/api/daily/2024-03-01")
+	assert.Equal(t, "2024-02-27", middle.Previous)
+	assert.Equal(t, "2024-03-05", middle.Next)
+
+	resp := memoRequest(t, http.MethodGet, "/api/daily/?from=2024-03-01", token, nil)
+	var notes []models.DailyNote
+	json.NewDecoder(resp.Body).Decode(&notes)
+	if assert.Len(t, notes, 2) {
+		assert.Equal(t, "2024-03-05", notes[0].Date)
+	}
+
+	// メモを削除すると次回は作り直される
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+first.Memo.ID, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	recreated := getDailyNote(t, token, "/api/daily/2024-03-01")
+	assert.True(t, recreated.Created)
+	assert.NotEqual(t, first.Memo.ID, recreated.Memo.ID)
+
+	resp = memoRequest(t, http.MethodGet, "/api/daily/2024-13-01", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/daily/2024-04-01?template=missing", token, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDailyNoteUsesUserTimeZone(t *testing.T) {
+	token := loginTestUser(t, "tzuser", "password123")
+	template := createTestMemo(t, token, map[string]interface{}{"title": "Template", "content": "{{date}}"})
+
+	resp := memoRequest(t, http.MethodPut, "/api/users/me", token, map[string]interface{}{"time_zone": "Pacific/Kiritimati", "daily_template_id": template.ID})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodPut, "/api/users/me", token, map[string]interface{}{"time_zone": "Mars/Olympus"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	loc, _ := time.LoadLocation("Pacific/Kiritimati")
+	today := getDailyNote(t, token, "/api/daily/today")
+	assert.Equal(t, time.Now().In(loc).Format("2006-01-02"), today.Date)
+	// ユーザー設定のテンプレートが使われる
+	assert.Equal(t, today.Date, today.Memo.Content)
+}
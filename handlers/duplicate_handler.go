@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ほぼ同じ内容とみなす類似度 (SimHash の一致するビットの割合) のデフォルト
+	defaultDuplicateThreshold = 0.9
+	// これより低い閾値は無関係な本文同士も一致してしまうので受け付けない
+	minDuplicateThreshold = 0.5
+	// CreateMemo のレスポンスで警告する似たメモの上限
+	maxSimilarMemos = 5
+)
+
+// DuplicateCluster は GET /memos/duplicates のレスポンスの1件で、ほぼ同じ内容のメモのまとまりです
+type DuplicateCluster struct {
+	Similarity float64       `json:"similarity"` // まとまりの中で最も似ている2件の類似度
+	Memos      []models.Memo `json:"memos"`      // 作成日時の古い順
+}
+
+// 保存する帯の分け方。デフォルトの閾値で似ているメモ同士は少なくとも1つの帯が一致する
+var similarMemoDistance = utils.SimHashMaxDistance(defaultDuplicateThreshold)
+
+// memoFingerprint はメモ本文の指紋を計算します
+func memoFingerprint(memo *models.Memo) *models.MemoFingerprint {
+	hash, shingles := utils.SimHash(memo.Content)
+	return &models.MemoFingerprint{MemoID: memo.ID, SimHash: int64(hash), Shingles: shingles}
+}
+
+// fingerprintBands は指紋を帯に分けた、保存用の行を返します
+func fingerprintBands(fingerprint *models.MemoFingerprint) []models.MemoFingerprintBand {
+	values := utils.SimHashBands(uint64(fingerprint.SimHash), similarMemoDistance)
+	bands := make([]models.MemoFingerprintBand, 0, len(values))
+	for i, value := range values {
+		bands = append(bands, models.MemoFingerprintBand{MemoID: fingerprint.MemoID, Band: i, Value: int64(value)})
+	}
+	return bands
+}
+
+// fingerprintsQuery は scope の削除されていないメモのうち、比較できる指紋を探すクエリを返します
+func fingerprintsQuery(scope func(*gorm.DB) *gorm.DB) *gorm.DB {
+	return database.DB.Model(&models.MemoFingerprint{}).
+		Select("memo_fingerprints.*").
+		Joins("JOIN memos ON memos.id = memo_fingerprints.memo_id AND memos.deleted_at IS NULL").
+		Scopes(scope).
+		Where("memo_fingerprints.shingles >= ?", utils.MinSimHashShingles)
+}
+
+// scopeFingerprints は scope のメモのうち比較できる指紋を作成日時の古い順に返します
+func scopeFingerprints(scope func(*gorm.DB) *gorm.DB) ([]models.MemoFingerprint, error) {
+	var fingerprints []models.MemoFingerprint
+	err := fingerprintsQuery(scope).Order("memos.created_at asc").Find(&fingerprints).Error
+	return fingerprints, err
+}
+
+// BackfillMemoFingerprints は指紋 (または帯) の無いメモ (重複検出の導入前に保存されたメモ) の指紋を
+// batchSize 件ずつ計算し、計算したメモの数を返します。起動時に呼び出します。
+func BackfillMemoFingerprints(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	filled, lastID := 0, ""
+	for {
+		var memos []models.Memo
+		err := database.DB.
+			Where("id > ? AND encrypted = ? AND NOT EXISTS (SELECT 1 FROM memo_fingerprint_bands WHERE memo_fingerprint_bands.memo_id = memos.id)", lastID, false).
+			Order("id asc").Limit(batchSize).Find(&memos).Error
+		if err != nil {
+			return filled, err
+		}
+		if len(memos) == 0 {
+			return filled, nil
+		}
+		ids := make([]string, 0, len(memos))
+		fingerprints := make([]models.MemoFingerprint, 0, len(memos))
+		var bands []models.MemoFingerprintBand
+		for i := range memos {
+			fingerprint := memoFingerprint(&memos[i])
+			ids = append(ids, memos[i].ID)
+			fingerprints = append(fingerprints, *fingerprint)
+			bands = append(bands, fingerprintBands(fingerprint)...)
+		}
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(&fingerprints, batchSize).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("memo_id IN ?", ids).Delete(&models.MemoFingerprintBand{}).Error; err != nil {
+				return err
+			}
+			return tx.CreateInBatches(&bands, batchSize).Error
+		})
+		if err != nil {
+			return filled, err
+		}
+		filled += len(memos)
+		lastID = memos[len(memos)-1].ID
+	}
+}
+
+// parseDuplicateThreshold は ?threshold= の類似度の閾値を返します
+func parseDuplicateThreshold(c *fiber.Ctx) (float64, bool) {
+	value := c.Query("threshold")
+	if value == "" {
+		return defaultDuplicateThreshold, true
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < minDuplicateThreshold || threshold > 1 {
+		return 0, false
+	}
+	return threshold, true
+}
+
+// duplicateClusters は類似度が threshold 以上のメモ同士をつなげたまとまりを、類似度の高い順に返します (メモは指紋の順)。
+// SimHash の帯が一致するメモ同士だけを比較するので、全件の組み合わせは比較しません。
+func duplicateClusters(fingerprints []models.MemoFingerprint, threshold float64) ([][]string, []float64) {
+	parent := make([]int, len(fingerprints))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	type bucketKey struct {
+		band  int
+		value uint64
+	}
+	maxDistance := utils.SimHashMaxDistance(threshold)
+	buckets := map[bucketKey][]int{}
+	for i, fingerprint := range fingerprints {
+		for band, value := range utils.SimHashBands(uint64(fingerprint.SimHash), maxDistance) {
+			key := bucketKey{band, value}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	best := map[int]float64{}
+	type edge struct {
+		a, b       int
+		similarity float64
+	}
+	var edges []edge
+	compared := map[[2]int]bool{}
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				i, j := members[x], members[y]
+				if compared[[2]int{i, j}] {
+					continue
+				}
+				compared[[2]int{i, j}] = true
+				similarity := utils.SimHashSimilarity(uint64(fingerprints[i].SimHash), uint64(fingerprints[j].SimHash))
+				if similarity >= threshold {
+					edges = append(edges, edge{i, j, similarity})
+					if ra, rb := find(i), find(j); ra != rb {
+						parent[rb] = ra
+					}
+				}
+			}
+		}
+	}
+	for _, e := range edges {
+		if root := find(e.a); e.similarity > best[root] {
+			best[root] = e.similarity
+		}
+	}
+
+	members := map[int][]string{}
+	var roots []int
+	for i, fingerprint := range fingerprints {
+		root := find(i)
+		if _, ok := best[root]; !ok {
+			continue
+		}
+		if len(members[root]) == 0 {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], fingerprint.MemoID)
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return best[roots[i]] > best[roots[j]] })
+
+	clusters := make([][]string, 0, len(roots))
+	similarities := make([]float64, 0, len(roots))
+	for _, root := range roots {
+		clusters = append(clusters, members[root])
+		similarities = append(similarities, best[root])
+	}
+	return clusters, similarities
+}
+
+// findSimilarMemos は memo とほぼ同じ内容の、同じ個人のメモ (またはワークスペースのメモ) を類似度の高い順に返します
+func findSimilarMemos(userID string, memo *models.Memo) ([]models.SimilarMemo, error) {
+	fingerprint := memoFingerprint(memo)
+	if memo.Encrypted || fingerprint.Shingles < utils.MinSimHashShingles {
+		return nil, nil
+	}
+	// 帯が1つでも一致するメモだけを候補として読み込む
+	bands := fingerprintBands(fingerprint)
+	conditions := make([]string, 0, len(bands))
+	args := make([]interface{}, 0, len(bands)*2)
+	for _, band := range bands {
+		conditions = append(conditions, "(band = ? AND value = ?)")
+		args = append(args, band.Band, band.Value)
+	}
+	candidates := database.DB.Model(&models.MemoFingerprintBand{}).Select("memo_id").Where(strings.Join(conditions, " OR "), args...)
+	var fingerprints []models.MemoFingerprint
+	err := fingerprintsQuery(MemoListScope(userID, memo.WorkspaceID)).
+		Where("memo_fingerprints.memo_id IN (?)", candidates).
+		Find(&fingerprints).Error
+	if err != nil {
+		return nil, err
+	}
+	similarity := map[string]float64{}
+	var ids []string
+	for _, other := range fingerprints {
+		if other.MemoID == memo.ID {
+			continue
+		}
+		if s := utils.SimHashSimilarity(uint64(fingerprint.SimHash), uint64(other.SimHash)); s >= defaultDuplicateThreshold {
+			similarity[other.MemoID] = s
+			ids = append(ids, other.MemoID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var memos []models.Memo
+	if err := database.DB.Where("id IN ?", ids).Find(&memos).Error; err != nil {
+		return nil, err
+	}
+	similar := make([]models.SimilarMemo, 0, len(memos))
+	for _, m := range memos {
+		similar = append(similar, models.SimilarMemo{ID: m.ID, Title: m.Title, Similarity: similarity[m.ID]})
+	}
+	sort.SliceStable(similar, func(i, j int) bool { return similar[i].Similarity > similar[j].Similarity })
+	if len(similar) > maxSimilarMemos {
+		similar = similar[:maxSimilarMemos]
+	}
+	return similar, nil
+}
+
+// GetDuplicateMemos はほぼ同じ内容のメモのまとまりを返します (?threshold=0.9 で類似度の閾値を指定)
+func GetDuplicateMemos(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	threshold, ok := parseDuplicateThreshold(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "threshold must be a number between 0.5 and 1"})
+	}
+
+	fingerprints, err := scopeFingerprints(MemoListScope(userID, requestWorkspaceID(c)))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not load memo fingerprints", "details": err.Error()})
+	}
+	groups, similarities := duplicateClusters(fingerprints, threshold)
+
+	var ids []string
+	for _, group := range groups {
+		ids = append(ids, group...)
+	}
+	var memos []models.Memo
+	if len(ids) > 0 {
+		if err := database.DB.Where("id IN ?", ids).Find(&memos).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+		}
+	}
+	byID := make(map[string]*models.Memo, len(memos))
+	for i := range memos {
+		prepareMemoResponse(c, userID, &memos[i])
+		byID[memos[i].ID] = &memos[i]
+	}
+
+	clusters := make([]DuplicateCluster, 0, len(groups))
+	for i, group := range groups {
+		cluster := DuplicateCluster{Similarity: similarities[i], Memos: make([]models.Memo, 0, len(group))}
+		for _, id := range group {
+			if memo, ok := byID[id]; ok {
+				cluster.Memos = append(cluster.Memos, *memo)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	return c.JSON(clusters)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getDuplicates(t *testing.T, token, path string) []DuplicateCluster {
+	resp := memoRequest(t, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var clusters []DuplicateCluster
+	json.NewDecoder(resp.Body).Decode(&clusters)
+	return clusters
+}
+
+func TestDuplicateMemos(t *testing.T) {
+	token := loginTestUser(t, "dupuser", "password123")
+	first := createTestMemo(t, token, map[string]interface{}{"title": "Shopping", "content": "Buy milk, eggs and bread on the way home from the office tomorrow"})
+	assert.Empty(t, first.SimilarMemos)
+	createTestMemo(t, token, map[string]interface{}{"title": "Planning", "content": "Quarterly planning notes: hiring, budget review and the roadmap for Q3"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Short", "content": "ok"})
+
+	// ほぼ同じ内容のメモを作ると警告が返る
+	second := createTestMemo(t, token, map[string]interface{}{"title": "Shopping (phone)", "content": "buy milk, eggs and bread on the way home from the office tomorrow!"})
+	if assert.Len(t, second.SimilarMemos, 1) {
+		assert.Equal(t, first.ID, second.SimilarMemos[0].ID)
+		assert.Equal(t, "Shopping", second.SimilarMemos[0].Title)
+		assert.Equal(t, 1.0, second.SimilarMemos[0].Similarity)
+	}
+
+	clusters := getDuplicates(t, token, "/api/memos/duplicates")
+	if assert.Len(t, clusters, 1) {
+		assert.Equal(t, 1.0, clusters[0].Similarity)
+		if assert.Len(t, clusters[0].Memos, 2) {
+			assert.Equal(t, first.ID, clusters[0].Memos[0].ID)
+			assert.Equal(t, second.ID, clusters[0].Memos[1].ID)
+		}
+	}
+
+	// 内容を変えると指紋も更新される
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+second.ID, token, map[string]interface{}{"content": "Call the dentist to move the appointment to next Friday afternoon"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, getDuplicates(t, token, "/api/memos/duplicates"))
+
+	resp = memoRequest(t, http.MethodGet, "/api/memos/duplicates?threshold=0.1", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestDuplicateMemosBackfillAndScope(t *testing.T) {
+	token := loginTestUser(t, "dupbackfill", "password123")
+	otherToken := loginAdditionalTestUser(t, "dupother", "password123")
+	content := "明日の会議の資料を準備して、部長にメールで送る"
+	first := createTestMemo(t, token, map[string]interface{}{"title": "会議", "content": content})
+	second := createTestMemo(t, token, map[string]interface{}{"title": "会議の準備", "content": content + "。"})
+	other := createTestMemo(t, otherToken, map[string]interface{}{"title": "会議", "content": content})
+	assert.Empty(t, other.SimilarMemos)
+
+	// 重複検出の導入前に保存されたメモ (指紋が無い) は起動時に指紋を計算する
+	testDB.Where("memo_id IN ?", []string{first.ID, second.ID}).Delete(&models.MemoFingerprint{})
+	testDB.Where("memo_id IN ?", []string{first.ID, second.ID}).Delete(&models.MemoFingerprintBand{})
+	assert.Empty(t, getDuplicates(t, token, "/api/memos/duplicates"))
+	filled, err := BackfillMemoFingerprints(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, filled)
+	clusters := getDuplicates(t, token, "/api/memos/duplicates")
+	if assert.Len(t, clusters, 1) {
+		assert.Len(t, clusters[0].Memos, 2)
+	}
+	var count int64
+	testDB.Model(&models.MemoFingerprint{}).Where("memo_id IN ?", []string{first.ID, second.ID}).Count(&count)
+	assert.EqualValues(t, 2, count)
+	testDB.Model(&models.MemoFingerprintBand{}).Where("memo_id IN ?", []string{first.ID, second.ID}).Count(&count)
+	assert.EqualValues(t, 2*(similarMemoDistance+1), count)
+	filled, err = BackfillMemoFingerprints(1)
+	assert.NoError(t, err)
+	assert.Zero(t, filled)
+
+	// 削除したメモは対象外
+	resp := memoRequest(t, http.MethodDelete, "/api/memos/"+second.ID, token, nil)
+	io.Copy(io.Discard, resp.Body)
+	assert.Empty(t, getDuplicates(t, token, "/api/memos/duplicates"))
+}
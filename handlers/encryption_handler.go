@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/e2ee"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EncryptionInput はエンドツーエンド暗号化されたメモのメタデータです (本文は content に暗号文を base64 で指定)
+type EncryptionInput struct {
+	Algorithm string `json:"algorithm"`
+	Nonce     string `json:"nonce"` // base64
+	KeyID     string `json:"key_id"`
+}
+
+type CreateUserKeyInput struct {
+	KeyID         string `json:"key_id" xml:"key_id" form:"key_id"`
+	Label         string `json:"label" xml:"label" form:"label"`
+	WrapAlgorithm string `json:"wrap_algorithm" xml:"wrap_algorithm" form:"wrap_algorithm"`
+	WrappedKey    string `json:"wrapped_key" xml:"wrapped_key" form:"wrapped_key"`
+	Salt          string `json:"salt" xml:"salt" form:"salt"`
+	Nonce         string `json:"nonce" xml:"nonce" form:"nonce"`
+}
+
+// サーバーは復号しないが、クライアントが対応していない形式で保存されないようにアルゴリズムを制限する
+var supportedEncryptionAlgorithms = map[string]bool{
+	e2ee.AlgorithmAES256GCM: true,
+}
+
+var errInvalidEncryption = errors.New("invalid encryption metadata")
+
+// validateEncryption は暗号化メタデータと暗号文 (base64) の形式を確認します
+func validateEncryption(input *EncryptionInput, ciphertext string) error {
+	if !supportedEncryptionAlgorithms[input.Algorithm] {
+		return fmt.Errorf("%w: unsupported algorithm %q", errInvalidEncryption, input.Algorithm)
+	}
+	if input.KeyID == "" {
+		return fmt.Errorf("%w: key_id is required", errInvalidEncryption)
+	}
+	if nonce, err := base64.StdEncoding.DecodeString(input.Nonce); err != nil || len(nonce) == 0 {
+		return fmt.Errorf("%w: nonce must be non-empty base64", errInvalidEncryption)
+	}
+	if _, err := base64.StdEncoding.DecodeString(ciphertext); err != nil || ciphertext == "" {
+		return fmt.Errorf("%w: content must be base64 ciphertext", errInvalidEncryption)
+	}
+	return nil
+}
+
+// setMemoEncryption はメモを暗号化されたメモにします (検証済みのメタデータを渡すこと)
+func setMemoEncryption(memo *models.Memo, input *EncryptionInput) {
+	memo.Encrypted = true
+	memo.EncryptionAlgorithm = input.Algorithm
+	memo.EncryptionNonce = input.Nonce
+	memo.EncryptionKeyID = input.KeyID
+}
+
+// clearMemoEncryption は暗号化のメタデータを削除します (平文のメモに戻す場合)
+func clearMemoEncryption(memo *models.Memo) {
+	memo.Encrypted = false
+	memo.EncryptionAlgorithm = ""
+	memo.EncryptionNonce = ""
+	memo.EncryptionKeyID = ""
+}
+
+// CreateUserKey はデバイスでラップしたユーザーの鍵を保存します
+func CreateUserKey(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateUserKeyInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.KeyID == "" || input.WrapAlgorithm == "" || input.WrappedKey == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "key_id, wrap_algorithm and wrapped_key are required"})
+	}
+	for name, value := range map[string]string{"wrapped_key": input.WrappedKey, "salt": input.Salt, "nonce": input.Nonce} {
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "'" + name + "' must be base64"})
+		}
+	}
+
+	key := models.UserKey{
+		ID:            utils.GenerateID(),
+		UserID:        userID,
+		KeyID:         input.KeyID,
+		Label:         input.Label,
+		WrapAlgorithm: input.WrapAlgorithm,
+		WrappedKey:    input.WrappedKey,
+		Salt:          input.Salt,
+		Nonce:         input.Nonce,
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save key", "details": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// GetUserKeys は認証ユーザーのラップされた鍵の一覧を返します (key_id で絞り込み可)
+func GetUserKeys(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	db := database.DB.Where("user_id = ?", userID)
+	if keyID := c.Query("key_id"); keyID != "" {
+		db = db.Where("key_id = ?", keyID)
+	}
+	keys := []models.UserKey{}
+	if err := db.Order("created_at asc").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve keys", "details": err.Error()})
+	}
+	return c.JSON(keys)
+}
+
+// DeleteUserKey はラップされた鍵を削除します (デバイスを手放した場合など)
+func DeleteUserKey(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).Delete(&models.UserKey{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete key", "details": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Key not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Key deleted successfully"})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/linkalls/fast-memos/e2ee"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedMemoRoundTrip(t *testing.T) {
+	token := loginTestUser(t, "e2eeuser", "password123")
+
+	// 1台目のデバイスで鍵を作り、ラップしてサーバーに保存する
+	key, keyID, err := e2ee.GenerateKey()
+	assert.NoError(t, err)
+	wrapped, err := e2ee.WrapKey(key, keyID, "device passphrase")
+	assert.NoError(t, err)
+	resp := memoRequest(t, http.MethodPost, "/api/keys/", token, map[string]interface{}{
+		"key_id": wrapped.KeyID, "label": "laptop", "wrap_algorithm": wrapped.WrapAlgorithm,
+		"wrapped_key": wrapped.WrappedKey, "salt": wrapped.Salt, "nonce": wrapped.Nonce,
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+
+	payload, err := e2ee.Encrypt(key, keyID, "- [ ] secret task #private")
+	assert.NoError(t, err)
+	memo := createTestMemo(t, token, map[string]interface{}{
+		"title":      "Diary",
+		"content":    payload.Ciphertext,
+		"encryption": payload,
+	})
+	assert.True(t, memo.Encrypted)
+	assert.Equal(t, keyID, memo.EncryptionKeyID)
+
+	// サーバーは本文を解釈しない (タスク・タグを作らず、本文は検索対象外)
+	var tasks int64
+	testDB.Model(&models.Task{}).Where("memo_id = ?", memo.ID).Count(&tasks)
+	assert.Zero(t, tasks)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/search?q="+url.QueryEscape(payload.Ciphertext[:12]), token, nil)
+	var found []models.Memo
+	json.NewDecoder(resp.Body).Decode(&found)
+	assert.Empty(t, found)
+
+	// 2台目のデバイスはサーバーからラップされた鍵を取得して復号する
+	resp = memoRequest(t, http.MethodGet, "/api/keys/?key_id="+keyID, token, nil)
+	var keys []models.UserKey
+	json.NewDecoder(resp.Body).Decode(&keys)
+	if assert.Len(t, keys, 1) {
+		deviceKey, err := e2ee.UnwrapKey(e2ee.WrappedKey{
+			KeyID: keys[0].KeyID, WrapAlgorithm: keys[0].WrapAlgorithm,
+			WrappedKey: keys[0].WrappedKey, Salt: keys[0].Salt, Nonce: keys[0].Nonce,
+		}, "device passphrase")
+		assert.NoError(t, err)
+		resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, token, nil)
+		var fetched models.Memo
+		json.NewDecoder(resp.Body).Decode(&fetched)
+		plaintext, err := e2ee.Decrypt(deviceKey, e2ee.Payload{
+			Ciphertext: fetched.Content, Algorithm: fetched.EncryptionAlgorithm,
+			Nonce: fetched.EncryptionNonce, KeyID: fetched.EncryptionKeyID,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "- [ ] secret task #private", plaintext)
+	}
+
+	// 暗号化のメタデータ無しで本文を書き換えたり、プロパティを設定したりはできない
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "plaintext"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"properties": map[string]interface{}{"status": "draft"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 閲覧者は鍵を持たないので共有リンクは作れない
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/shares", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 平文に戻すと通常のメモとして扱われる
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "- [ ] secret task", "clear_encryption": true})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	testDB.Model(&models.Task{}).Where("memo_id = ?", memo.ID).Count(&tasks)
+	assert.EqualValues(t, 1, tasks)
+
+	// 共有リンクを作った後で暗号化したメモは共有リンクで表示しない
+	share := createTestShare(t, token, memo.ID, nil)
+	shareResp, _ := getSharePage(t, share.URL)
+	assert.Equal(t, http.StatusOK, shareResp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": payload.Ciphertext, "encryption": payload})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	shareResp, body := getSharePage(t, share.URL)
+	assert.Equal(t, http.StatusNotFound, shareResp.StatusCode)
+	assert.NotContains(t, body, payload.Ciphertext)
+}
+
+func TestEncryptedMemoValidation(t *testing.T) {
+	token := loginTestUser(t, "e2eevalidation", "password123")
+
+	for _, encryption := range []map[string]interface{}{
+		{"algorithm": "ROT13", "nonce": "AAAA", "key_id": "k"},
+		{"algorithm": e2ee.AlgorithmAES256GCM, "nonce": "AAAA", "key_id": ""},
+		{"algorithm": e2ee.AlgorithmAES256GCM, "nonce": "not base64!", "key_id": "k"},
+	} {
+		resp := memoRequest(t, http.MethodPost, "/api/memos/", token, map[string]interface{}{"title": "x", "content": "AAAA", "encryption": encryption})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, encryption)
+	}
+	resp := memoRequest(t, http.MethodPost, "/api/memos/", token, map[string]interface{}{
+		"title": "x", "content": "plain text", "encryption": map[string]interface{}{"algorithm": e2ee.AlgorithmAES256GCM, "nonce": "AAAA", "key_id": "k"},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
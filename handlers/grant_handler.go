@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CreateGrantInput struct {
+	Username string `json:"username" xml:"username" form:"username"`
+	Role     string `json:"role" xml:"role" form:"role"`
+	MemoID   string `json:"memo_id" xml:"memo_id" form:"memo_id"`
+	Category string `json:"category" xml:"category" form:"category"`
+}
+
+// GrantResponse は共有設定のレスポンスです (共有相手のユーザー名を含む)
+type GrantResponse struct {
+	models.MemoGrant
+	GranteeUsername string
+}
+
+// SharedMemo は「共有されたメモ」一覧の要素です
+type SharedMemo struct {
+	models.Memo
+	Role          string
+	OwnerUsername string
+}
+
+// CreateGrant はメモ (/api/memos/:id/grants) またはカテゴリ (/api/grants) を他のユーザーと共有します。
+// 同じ相手・同じ対象への共有が既にある場合は権限を上書きします。
+func CreateGrant(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateGrantInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if memoID := c.Params("id"); memoID != "" {
+		input.MemoID = memoID
+		input.Category = ""
+	}
+	if input.Role != models.RoleViewer && input.Role != models.RoleEditor {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be 'viewer' or 'editor'"})
+	}
+	if (input.MemoID == "") == (input.Category == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Specify either memo_id or category"})
+	}
+
+	// メモ単位の共有は所有者のみ設定できる
+	if input.MemoID != "" {
+		if _, _, err := findMemoWithRole(userID, input.MemoID, roleOwner); err != nil {
+			return memoAccessErrorResponse(c, err)
+		}
+	}
+
+	var grantee models.User
+	if err := database.DB.Where("username = ?", input.Username).First(&grantee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	if grantee.ID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot share with yourself"})
+	}
+
+	grant := models.MemoGrant{
+		ID:        utils.GenerateID(),
+		OwnerID:   userID,
+		GranteeID: grantee.ID,
+		MemoID:    input.MemoID,
+		Category:  input.Category,
+		Role:      input.Role,
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "owner_id"}, {Name: "grantee_id"}, {Name: "memo_id"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(&grant).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create grant", "details": err.Error()})
+	}
+	// 上書きの場合は既存のIDを返すため取り直す
+	var saved models.MemoGrant
+	if err := database.DB.Where("owner_id = ? AND grantee_id = ? AND memo_id = ? AND category = ?",
+		grant.OwnerID, grant.GranteeID, grant.MemoID, grant.Category).First(&saved).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve grant", "details": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(GrantResponse{MemoGrant: saved, GranteeUsername: grantee.Username})
+}
+
+// GetGrants はユーザーが設定した共有の一覧を返します。/api/memos/:id/grants の場合はそのメモのもののみ
+func GetGrants(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	db := database.DB.Where("owner_id = ?", userID)
+	if memoID := c.Params("id"); memoID != "" {
+		db = db.Where("memo_id = ?", memoID)
+	}
+	var grants []models.MemoGrant
+	if err := db.Order("created_at desc").Find(&grants).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve grants", "details": err.Error()})
+	}
+
+	usernames, err := usernamesByID(grantGranteeIDs(grants))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve users", "details": err.Error()})
+	}
+	responses := make([]GrantResponse, 0, len(grants))
+	for _, grant := range grants {
+		responses = append(responses, GrantResponse{MemoGrant: grant, GranteeUsername: usernames[grant.GranteeID]})
+	}
+	return c.JSON(responses)
+}
+
+// RevokeGrant は共有を取り消します。取り消した時点から共有相手はアクセスできなくなります。
+func RevokeGrant(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	result := database.DB.Where("id = ? AND owner_id = ?", c.Params("id"), userID).Delete(&models.MemoGrant{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke grant", "details": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Grant not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Grant revoked successfully"})
+}
+
+// GetSharedMemos は他のユーザーから共有されたメモの一覧を返します
+func GetSharedMemos(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	var memos []models.Memo
+	if err := database.DB.Scopes(sharedWithMe(userID)).Order("created_at desc").Find(&memos).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve shared memos", "details": err.Error()})
+	}
+
+	ownerIDs := make([]string, 0, len(memos))
+	for _, memo := range memos {
+		ownerIDs = append(ownerIDs, memo.UserID)
+	}
+	usernames, err := usernamesByID(ownerIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve users", "details": err.Error()})
+	}
+
+	shared := make([]SharedMemo, 0, len(memos))
+	for _, memo := range memos {
+		role, err := memoRole(userID, memo)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve permissions", "details": err.Error()})
+		}
+		prepareMemoResponse(c, userID, &memo)
+		shared = append(shared, SharedMemo{Memo: memo, Role: role, OwnerUsername: usernames[memo.UserID]})
+	}
+	return c.JSON(shared)
+}
+
+func grantGranteeIDs(grants []models.MemoGrant) []string {
+	ids := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		ids = append(ids, grant.GranteeID)
+	}
+	return ids
+}
+
+// usernamesByID はユーザーIDからユーザー名への対応を返します
+func usernamesByID(ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	var users []models.User
+	if err := database.DB.Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names, nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestGrant(t *testing.T, token, url string, payload map[string]interface{}) GrantResponse {
+	payloadBytes, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewBuffer(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	body, _ := io.ReadAll(resp.Body)
+	var grant GrantResponse
+	json.Unmarshal(body, &grant)
+	return grant
+}
+
+func memoRequest(t *testing.T, method, url, token string, payload map[string]interface{}) *http.Response {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(payloadBytes)
+	}
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestMemoGrantViewerAndEditor(t *testing.T) {
+	ownerToken := loginTestUser(t, "grantowner", "password123")
+	otherToken := loginAdditionalTestUser(t, "grantee", "password123")
+	memo := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Team notes", "content": "shared keyword"})
+
+	// 共有前はアクセスできない
+	resp := memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	grant := createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "grantee", "role": "viewer"})
+	assert.Equal(t, "grantee", grant.GranteeUsername)
+
+	// viewer は閲覧・検索できるが更新・削除できない
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, otherToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/search?q=keyword", otherToken, nil)
+	var found []models.Memo
+	json.NewDecoder(resp.Body).Decode(&found)
+	assert.Len(t, found, 1)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, otherToken, map[string]interface{}{"content": "edited"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// 同じ相手への共有は権限を上書きする
+	upgraded := createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "grantee", "role": "editor"})
+	assert.Equal(t, grant.ID, upgraded.ID)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, otherToken, map[string]interface{}{"content": "edited"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// 共有されたメモ一覧
+	resp = memoRequest(t, http.MethodGet, "/api/memos/shared", otherToken, nil)
+	var shared []SharedMemo
+	json.NewDecoder(resp.Body).Decode(&shared)
+	if assert.Len(t, shared, 1) {
+		assert.Equal(t, "edited", shared[0].Content)
+		assert.Equal(t, models.RoleEditor, shared[0].Role)
+		assert.Equal(t, "grantowner", shared[0].OwnerUsername)
+	}
+
+	// 取り消し後はアクセスできない
+	resp = memoRequest(t, http.MethodDelete, "/api/grants/"+grant.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCategoryGrant(t *testing.T) {
+	ownerToken := loginTestUser(t, "catowner", "password123")
+	otherToken := loginAdditionalTestUser(t, "catviewer", "password123")
+	work := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Work", "content": "a", "category": "work"})
+	private := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Diary", "content": "b", "category": "private"})
+
+	createTestGrant(t, ownerToken, "/api/grants", map[string]interface{}{"username": "catviewer", "role": "viewer", "category": "work"})
+
+	resp := memoRequest(t, http.MethodGet, "/api/memos/"+work.ID, otherToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+private.ID, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 共有相手は他人のメモを再共有できない
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+work.ID+"/grants", otherToken, map[string]interface{}{"username": "catowner", "role": "viewer"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
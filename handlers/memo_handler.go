@@ -6,7 +6,8 @@ import (
 	"github.com/linkalls/fast-memos/database"
 	"github.com/linkalls/fast-memos/models"
 	"github.com/linkalls/fast-memos/utils" // 追加
-	"strings"                             // 追加
+	"strings"                              // 追加
+	"time"
 	// "strconv" // 不要になるのでコメントアウトまたは削除
 
 	"github.com/gofiber/fiber/v2"
@@ -44,23 +45,109 @@ func stringToRelatedIDs(s string) []string {
 	return result
 }
 
-
 type CreateMemoInput struct {
-	Title          string   `json:"title" xml:"title" form:"title" validate:"required"`
-	Content        string   `json:"content" xml:"content" form:"content"`
-	RelatedMemoIDs []string `json:"related_memo_ids" xml:"related_memo_ids" form:"related_memo_ids"`
+	Title          string                 `json:"title" xml:"title" form:"title" validate:"required"`
+	Content        string                 `json:"content" xml:"content" form:"content"`
+	Category       string                 `json:"category" xml:"category" form:"category"`
+	RelatedMemoIDs []string               `json:"related_memo_ids" xml:"related_memo_ids" form:"related_memo_ids"`
+	DueAt          *time.Time             `json:"due_at" xml:"due_at" form:"due_at"`
+	Properties     map[string]interface{} `json:"properties" xml:"-" form:"-"`             // front matter に書き込むプロパティ
+	Encryption     *EncryptionInput       `json:"encryption" xml:"-" form:"-"`             // 指定するとエンドツーエンド暗号化されたメモとして保存 (content は暗号文)
+	Latitude       *float64               `json:"latitude" xml:"latitude" form:"latitude"` // 位置情報 (任意、経度と一緒に指定)
+	Longitude      *float64               `json:"longitude" xml:"longitude" form:"longitude"`
+	PlaceName      string                 `json:"place_name" xml:"place_name" form:"place_name"`
+	Visibility     string                 `json:"visibility" xml:"visibility" form:"visibility"` // private (既定) / unlisted / public
+	PublishAt      *time.Time             `json:"publish_at" xml:"publish_at" form:"publish_at"` // 予約公開の日時 (任意)
 }
 
 type UpdateMemoInput struct {
-	Title          *string   `json:"title,omitempty" xml:"title,omitempty" form:"title,omitempty"`
-	Content        *string   `json:"content,omitempty" xml:"content,omitempty" form:"content,omitempty"`
-	RelatedMemoIDs *[]string `json:"related_memo_ids,omitempty" xml:"related_memo_ids,omitempty" form:"related_memo_ids,omitempty"` // ポインタ型に変更, omitempty を推奨
+	Title           *string                `json:"title,omitempty" xml:"title,omitempty" form:"title,omitempty"`
+	Content         *string                `json:"content,omitempty" xml:"content,omitempty" form:"content,omitempty"`
+	Category        *string                `json:"category,omitempty" xml:"category,omitempty" form:"category,omitempty"`
+	RelatedMemoIDs  *[]string              `json:"related_memo_ids,omitempty" xml:"related_memo_ids,omitempty" form:"related_memo_ids,omitempty"` // ポインタ型に変更, omitempty を推奨
+	DueAt           *time.Time             `json:"due_at,omitempty" xml:"due_at,omitempty" form:"due_at,omitempty"`
+	ClearDueAt      bool                   `json:"clear_due_at,omitempty" xml:"clear_due_at,omitempty" form:"clear_due_at,omitempty"` // trueなら期限を削除
+	Properties      map[string]interface{} `json:"properties,omitempty" xml:"-" form:"-"`                                             // front matter のプロパティを上書き (null で削除)
+	Encryption      *EncryptionInput       `json:"encryption,omitempty" xml:"-" form:"-"`                                             // 暗号文の content と一緒に指定 (暗号化・鍵の変更)
+	ClearEncryption bool                   `json:"clear_encryption,omitempty" xml:"-" form:"-"`                                       // trueなら平文の content と一緒に指定して暗号化をやめる
+	Latitude        *float64               `json:"latitude,omitempty" xml:"latitude,omitempty" form:"latitude,omitempty"`             // 経度と一緒に指定
+	Longitude       *float64               `json:"longitude,omitempty" xml:"longitude,omitempty" form:"longitude,omitempty"`
+	PlaceName       *string                `json:"place_name,omitempty" xml:"place_name,omitempty" form:"place_name,omitempty"`
+	ClearLocation   bool                   `json:"clear_location,omitempty" xml:"clear_location,omitempty" form:"clear_location,omitempty"` // trueなら位置情報を削除
+	Visibility      *string                `json:"visibility,omitempty" xml:"visibility,omitempty" form:"visibility,omitempty"`             // 公開範囲の変更 (所有者のみ)
+	PublishAt       *time.Time             `json:"publish_at,omitempty" xml:"publish_at,omitempty" form:"publish_at,omitempty"`
+	ClearPublishAt  bool                   `json:"clear_publish_at,omitempty" xml:"clear_publish_at,omitempty" form:"clear_publish_at,omitempty"` // trueなら予約公開の日時を削除 (すぐに公開)
+}
+
+// newMemoFromInput は作成の入力を検証してメモを組み立てます (保存はしません)。
+// 入力が不正な場合は *memoInputError を返します。
+func newMemoFromInput(userID, workspaceID string, input *CreateMemoInput) (*models.Memo, error) {
+	if input.Title == "" {
+		return nil, badMemoInput("Title is required")
+	}
+
+	if err := validateLocation(input.Latitude, input.Longitude); err != nil {
+		return nil, badMemoInput(err.Error())
+	}
+
+	content := input.Content
+	if input.Encryption != nil {
+		// 暗号文はサーバーで解釈できないので front matter を書き換えられない
+		if len(input.Properties) > 0 {
+			return nil, badMemoInput("Properties cannot be set on encrypted memos")
+		}
+		if err := validateEncryption(input.Encryption, content); err != nil {
+			return nil, badMemoInput(err.Error())
+		}
+	}
+	if len(input.Properties) > 0 {
+		updated, err := applyPropertyEdits(content, input.Properties)
+		if err != nil {
+			return nil, &memoInputError{Status: fiber.StatusBadRequest, Message: "Invalid properties", Details: err.Error()}
+		}
+		content = updated
+	}
+
+	memoID := utils.GenerateID() // 新しいメモIDを生成
+
+	memo := &models.Memo{
+		ID:                  memoID, // 設定
+		Title:               input.Title,
+		Content:             content,
+		Category:            input.Category,
+		UserID:              userID,                                   // string型
+		RelatedMemoIDsStore: relatedIDsToString(input.RelatedMemoIDs), // 変換して保存
+		WorkspaceID:         workspaceID,
+		Latitude:            input.Latitude,
+		Longitude:           input.Longitude,
+		PlaceName:           input.PlaceName,
+		Visibility:          models.VisibilityPrivate,
+	}
+	if input.Visibility != "" {
+		memo.Visibility = input.Visibility
+	}
+	if input.Encryption != nil {
+		setMemoEncryption(memo, input.Encryption)
+	}
+	if input.DueAt != nil {
+		dueAt := input.DueAt.UTC()
+		memo.DueAt = &dueAt
+	}
+	if input.PublishAt != nil {
+		publishAt := input.PublishAt.UTC()
+		memo.PublishAt = &publishAt
+	}
+	if err := validateVisibility(memo); err != nil {
+		return nil, badMemoInput(err.Error())
+	}
+
+	return memo, nil
 }
 
 // CreateMemo は新しいメモを作成します
 func CreateMemo(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(string) // stringに変更
-	if !ok || userID == "" { // userIDが空の場合もエラー
+	if !ok || userID == "" {                  // userIDが空の場合もエラー
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
 	}
 
@@ -69,27 +156,38 @@ func CreateMemo(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
 	}
 
-	if input.Title == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title is required"})
+	// ワークスペースのルート経由の場合はワークスペースのメモとして作成する (guest は作成できない)
+	workspaceID := requestWorkspaceID(c)
+	if workspaceID != "" {
+		if role, _ := c.Locals("workspaceRole").(string); !canCreateWorkspaceMemo(role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Guests cannot create memos in the workspace"})
+		}
 	}
 
-	memoID := utils.GenerateID() // 新しいメモIDを生成
-
-	memo := models.Memo{
-		ID:                  memoID, // 設定
-		Title:               input.Title,
-		Content:             input.Content,
-		UserID:              userID, // string型
-		RelatedMemoIDsStore: relatedIDsToString(input.RelatedMemoIDs), // 変換して保存
+	memo, err := newMemoFromInput(userID, workspaceID, input)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	if err := checkMemoQuota(userID, 1, memoBytes(memo)); err != nil {
+		return memoAccessErrorResponse(c, err)
 	}
 
-	result := database.DB.Create(&memo)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create memo", "details": result.Error.Error()})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(memo).Error; err != nil {
+			return err
+		}
+		return syncMemoDerived(tx, memo, activityCreated)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create memo", "details": err.Error()})
 	}
 
-	// レスポンスのために RelatedMemoIDs をセット
-	memo.RelatedMemoIDs = stringToRelatedIDs(memo.RelatedMemoIDsStore)
+	// レスポンス用のフィールド (RelatedMemoIDs など) を設定
+	prepareMemoResponse(c, userID, memo)
+	// ほぼ同じ内容のメモが既にあれば警告として返す (作成自体は成功しているので失敗しても無視する)
+	if similar, err := findSimilarMemos(userID, memo); err == nil {
+		memo.SimilarMemos = similar
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(memo)
 }
@@ -101,16 +199,33 @@ func GetMemos(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
 	}
 
+	propertyFilter, err := propertyFilterScope(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid property filter", "details": err.Error()})
+	}
+
+	locationFilter, err := parseLocationFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid location filter", "details": err.Error()})
+	}
+
 	var memos []models.Memo
-	// ユーザーIDでフィルタリングし、作成日時の降順で取得
-	result := database.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&memos)
+	// 個人のメモ (ワークスペースのルート経由ならワークスペースのメモ) を作成日時の降順で取得
+	db := database.DB.Scopes(MemoListScope(userID, requestWorkspaceID(c)), propertyFilter)
+	if locationFilter != nil {
+		db = db.Scopes(locationFilter.scope)
+	}
+	result := db.Order("created_at desc").Find(&memos)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": result.Error.Error()})
 	}
+	if locationFilter != nil {
+		memos = locationFilter.apply(memos)
+	}
 
-	// 各メモについて RelatedMemoIDs を設定
+	// 各メモについてレスポンス用のフィールドを設定
 	for i := range memos {
-		memos[i].RelatedMemoIDs = stringToRelatedIDs(memos[i].RelatedMemoIDsStore)
+		prepareMemoResponse(c, userID, &memos[i])
 	}
 
 	return c.JSON(memos)
@@ -124,50 +239,35 @@ func GetMemo(c *fiber.Ctx) error {
 	}
 
 	memoID := c.Params("id") // string ID
-	if memoID == "" { // パスパラメータが空かどうかのチェック
+	if memoID == "" {        // パスパラメータが空かどうかのチェック
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memo ID is required"})
 	}
 
-	var memo models.Memo
-	result := database.DB.Where("id = ? AND user_id = ?", memoID, userID).First(&memo)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+	// 所有者または共有されたユーザー (viewer 以上) のみ取得できる
+	found, _, err := findRequestMemoWithRole(c, userID, memoID, models.RoleViewer)
+	if err != nil {
+		// 統合されてゴミ箱に移ったメモは統合先にリダイレクトする
+		if errors.Is(err, errMemoNotFound) {
+			if redirected, err := mergedMemoRedirect(c, userID, memoID, c.Path()); redirected {
+				return err
+			}
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": result.Error.Error()})
+		return memoAccessErrorResponse(c, err)
 	}
+	memo := *found
 
-	// RelatedMemoIDs を設定
-	memo.RelatedMemoIDs = stringToRelatedIDs(memo.RelatedMemoIDsStore)
+	// レスポンス用のフィールド (RelatedMemoIDs など) を設定
+	prepareMemoResponse(c, userID, &memo)
 
 	return c.JSON(memo)
 }
 
-// UpdateMemo は認証されたユーザーの特定のメモを更新します
-func UpdateMemo(c *fiber.Ctx) error {
-	userID, ok := c.Locals("userID").(string) // stringに変更
-	if !ok || userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
-	}
-
-	memoID := c.Params("id") // string ID
-	if memoID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memo ID is required"})
-	}
-
-	input := new(UpdateMemoInput)
-	if err := c.BodyParser(input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
-	}
-
-	var memo models.Memo
-	// まずはIDだけで取得（UserIDによる絞り込みは所有権確認のため）
-	result := database.DB.Where("id = ? AND user_id = ?", memoID, userID).First(&memo)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found or not owned by user"})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo for update", "details": result.Error.Error()})
+// applyMemoUpdate は更新の入力をメモに適用し、変更があったかどうかを返します (保存はしません)。
+// role はメモに対する権限で、入力が不正な場合は *memoInputError を返します。
+func applyMemoUpdate(memo *models.Memo, input *UpdateMemoInput, role string) (bool, error) {
+	// 公開範囲は所有者のみ変更できる
+	if (input.Visibility != nil || input.PublishAt != nil || input.ClearPublishAt) && role != roleOwner {
+		return false, &memoInputError{Status: fiber.StatusForbidden, Message: "Only the owner can change the visibility"}
 	}
 
 	// 更新フラグ
@@ -176,13 +276,33 @@ func UpdateMemo(c *fiber.Ctx) error {
 	// 更新するフィールドのみを適用
 	if input.Title != nil {
 		if *input.Title == "" { // タイトルを空にすることは許可しない場合
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title cannot be empty"})
+			return false, badMemoInput("Title cannot be empty")
 		}
 		if memo.Title != *input.Title {
 			memo.Title = *input.Title
 			updated = true
 		}
 	}
+	// 暗号化されたメモの本文は暗号化のメタデータ (新しいノンス) と一緒にしか変更できない
+	switch {
+	case input.Encryption != nil:
+		if input.Content == nil {
+			return false, badMemoInput("Encrypted content is required with encryption")
+		}
+		if err := validateEncryption(input.Encryption, *input.Content); err != nil {
+			return false, badMemoInput(err.Error())
+		}
+		setMemoEncryption(memo, input.Encryption)
+		updated = true
+	case input.ClearEncryption && memo.Encrypted:
+		if input.Content == nil {
+			return false, badMemoInput("Plaintext content is required to clear encryption")
+		}
+		clearMemoEncryption(memo)
+		updated = true
+	case memo.Encrypted && input.Content != nil && *input.Content != memo.Content:
+		return false, badMemoInput("Encrypted memo content must be sent with encryption metadata")
+	}
 	if input.Content != nil {
 		if memo.Content != *input.Content {
 			memo.Content = *input.Content
@@ -190,6 +310,28 @@ func UpdateMemo(c *fiber.Ctx) error {
 		}
 	}
 
+	if input.Category != nil {
+		if memo.Category != *input.Category {
+			memo.Category = *input.Category
+			updated = true
+		}
+	}
+
+	// プロパティの更新は front matter を書き換える (本文の更新と同時なら新しい本文に適用)
+	if len(input.Properties) > 0 {
+		if memo.Encrypted {
+			return false, badMemoInput("Properties cannot be set on encrypted memos")
+		}
+		content, err := applyPropertyEdits(memo.Content, input.Properties)
+		if err != nil {
+			return false, &memoInputError{Status: fiber.StatusBadRequest, Message: "Invalid properties", Details: err.Error()}
+		}
+		if memo.Content != content {
+			memo.Content = content
+			updated = true
+		}
+	}
+
 	// RelatedMemoIDsの更新処理
 	if input.RelatedMemoIDs != nil { // ポインタがnilでなければ、キーが存在し、値がnullでないことを意味する
 		newRelatedStore := relatedIDsToString(*input.RelatedMemoIDs) // ポインタをデリファレンス
@@ -200,23 +342,160 @@ func UpdateMemo(c *fiber.Ctx) error {
 	}
 	// input.RelatedMemoIDs が nil の場合はキーが存在しないか値がnullだったので、何もしない (既存の値を維持)
 
+	// 期限の更新
+	if input.ClearDueAt {
+		if memo.DueAt != nil {
+			memo.DueAt = nil
+			updated = true
+		}
+	} else if input.DueAt != nil {
+		dueAt := input.DueAt.UTC()
+		if memo.DueAt == nil || !memo.DueAt.Equal(dueAt) {
+			memo.DueAt = &dueAt
+			updated = true
+		}
+	}
+
+	// 位置情報の更新
+	if input.ClearLocation {
+		if memo.Latitude != nil || memo.PlaceName != "" {
+			memo.Latitude, memo.Longitude, memo.PlaceName = nil, nil, ""
+			updated = true
+		}
+	} else {
+		if input.Latitude != nil || input.Longitude != nil {
+			if err := validateLocation(input.Latitude, input.Longitude); err != nil {
+				return false, badMemoInput(err.Error())
+			}
+			memo.Latitude, memo.Longitude = input.Latitude, input.Longitude
+			updated = true
+		}
+		if input.PlaceName != nil && memo.PlaceName != *input.PlaceName {
+			memo.PlaceName = *input.PlaceName
+			updated = true
+		}
+	}
+
+	// 公開範囲・予約公開の更新
+	if input.Visibility != nil && memo.Visibility != *input.Visibility {
+		memo.Visibility = *input.Visibility
+		updated = true
+	}
+	if input.ClearPublishAt {
+		if memo.PublishAt != nil {
+			memo.PublishAt = nil
+			updated = true
+		}
+	} else if input.PublishAt != nil {
+		publishAt := input.PublishAt.UTC()
+		if memo.PublishAt == nil || !memo.PublishAt.Equal(publishAt) {
+			memo.PublishAt = &publishAt
+			updated = true
+		}
+	}
+	// 暗号化した場合なども含め、更新後のメモが公開できる組み合わせか確認する
+	if err := validateVisibility(memo); err != nil {
+		return false, badMemoInput(err.Error())
+	}
+
+	return updated, nil
+}
+
+// UpdateMemo は認証されたユーザーの特定のメモを更新します
+func UpdateMemo(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string) // stringに変更
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memoID := c.Params("id") // string ID
+	if memoID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memo ID is required"})
+	}
+
+	input := new(UpdateMemoInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+
+	// 所有者または editor 権限で共有されたユーザーのみ更新できる (ロック中は不可)
+	found, role, err := findEditableMemo(c, userID, memoID, models.RoleEditor)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	memo := *found
+
+	updated, err := applyMemoUpdate(&memo, input, role)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+
 	if !updated {
-		 // 何も更新がない場合 (input.RelatedMemoIDsがnilで、他のフィールドも更新なしの場合)
-         memo.RelatedMemoIDs = stringToRelatedIDs(memo.RelatedMemoIDsStore)
-         return c.JSON(memo)
-    }
+		// 何も更新がない場合 (input.RelatedMemoIDsがnilで、他のフィールドも更新なしの場合)
+		prepareMemoResponse(c, userID, &memo)
+		return c.JSON(memo)
+	}
+	if err := checkMemoGrowth(found, &memo); err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
 
-	saveResult := database.DB.Save(&memo)
-	if saveResult.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update memo", "details": saveResult.Error.Error()})
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&memo).Error; err != nil {
+			return err
+		}
+		return syncMemoDerived(tx, &memo, activityEdited)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update memo", "details": err.Error()})
 	}
 
-	// レスポンスのために RelatedMemoIDs をセット
-	memo.RelatedMemoIDs = stringToRelatedIDs(memo.RelatedMemoIDsStore)
+	// レスポンス用のフィールド (RelatedMemoIDs など) を設定
+	prepareMemoResponse(c, userID, &memo)
 
 	return c.JSON(memo)
 }
 
+// deleteMemoTx はメモを (論理) 削除してゴミ箱に移し、派生データを削除した行数を返します。
+// 添付ファイル・ACL・コメントはゴミ箱から戻したときに戻るよう残します (削除したメモと同じく読み書きできません)。
+func deleteMemoTx(tx *gorm.DB, memoID string) (int64, error) {
+	result := tx.Where("id = ?", memoID).Delete(&models.Memo{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := clearMemoDerived(tx, memoID); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
+// purgeMemoTx はメモを完全に削除し、添付ファイル・ACL・共有リンク・コメントなどメモに付いたデータもすべて削除します。
+// 参照されなくなった可能性のある Blob のハッシュを返します (コミット後に cleanupOrphanBlobs に渡す)。
+func purgeMemoTx(tx *gorm.DB, memoID string) ([]string, error) {
+	hashes, err := removeMemoAttachments(tx, memoID)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeMemoGrants(tx, memoID); err != nil {
+		return nil, err
+	}
+	cards := tx.Unscoped().Model(&models.Card{}).Select("id").Where("memo_id = ?", memoID)
+	if err := tx.Where("card_id IN (?)", cards).Delete(&models.CardReview{}).Error; err != nil {
+		return nil, err
+	}
+	for _, model := range []interface{}{
+		&models.Card{}, &models.Comment{}, &models.Share{}, &models.ReviewItem{},
+		&models.DailyNote{}, &models.Reminder{}, &models.Notification{},
+	} {
+		if err := tx.Unscoped().Where("memo_id = ?", memoID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := clearMemoDerived(tx, memoID); err != nil {
+		return nil, err
+	}
+	return hashes, tx.Unscoped().Where("id = ?", memoID).Delete(&models.Memo{}).Error
+}
+
 // DeleteMemo は認証されたユーザーの特定のメモを削除します
 func DeleteMemo(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(string) // stringに変更
@@ -229,26 +508,25 @@ func DeleteMemo(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memo ID is required"})
 	}
 
-	// まずメモが存在し、かつユーザーが所有しているか確認
-	var memo models.Memo // この変数は削除確認には使うが、直接削除には使わない
-	result := database.DB.Where("id = ? AND user_id = ?", memoID, userID).First(&memo)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found or not owned by user"})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo for deletion", "details": result.Error.Error()})
+	// まずメモが存在し、かつユーザーが所有しているか確認 (共有されたユーザーは editor でも削除できない)
+	if _, _, err := findEditableMemo(c, userID, memoID, roleOwner); err != nil {
+		return memoAccessErrorResponse(c, err)
 	}
 
 	// 削除実行 (文字列IDの場合は明示的にWHERE句を指定する方が安全)
-	deleteResult := database.DB.Where("id = ?", memoID).Delete(&models.Memo{})
-	if deleteResult.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete memo", "details": deleteResult.Error.Error()})
-	}
-	if deleteResult.RowsAffected == 0 {
+	var rowsAffected int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rowsAffected, err = deleteMemoTx(tx, memoID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete memo", "details": err.Error()})
+	}
+	if rowsAffected == 0 {
 		// このケースは通常、上記のFirstチェックで捕捉されるはずだが、念のため
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found or already deleted (during delete operation)"})
 	}
-	
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": fmt.Sprintf("Memo with ID %s deleted successfully", memoID)})
 }
 
@@ -264,19 +542,38 @@ func SearchMemos(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Search query 'q' is required"})
 	}
 
-	var memos []models.Memo
-	// タイトルまたは本文にキーワードを含むメモを検索 (LIKE句、大文字小文字を区別しない)
-	// SQLiteでは ILIKE が直接サポートされていない場合があるため、lower関数で対応
-	searchTerm := "%" + query + "%"
-	result := database.DB.Where("user_id = ? AND (lower(title) LIKE lower(?) OR lower(content) LIKE lower(?))", userID, searchTerm, searchTerm).Order("created_at desc").Find(&memos)
+	propertyFilter, err := propertyFilterScope(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid property filter", "details": err.Error()})
+	}
 
+	// 自分のメモに加えて共有されたメモも検索対象 (scope=own で自分のメモのみ)
+	base := accessibleMemos(userID)
+	if workspaceID := requestWorkspaceID(c); workspaceID != "" {
+		base = workspaceMemos(workspaceID)
+	} else if c.Query("scope") == "own" {
+		base = func(db *gorm.DB) *gorm.DB { return db.Where("memos.user_id = ?", userID) }
+	}
+	// 検索クエリ (語・フレーズ・OR・-除外・フィルタ) で検索 (全角・半角、大文字小文字、カタカナとひらがなを区別しない)
+	// 暗号化されたメモの本文は暗号文なので検索対象外 (タイトルのみ)
+	search, order, err := MemoSearchScope(userID, query, base, false)
+	if err != nil {
+		var queryErr *utils.SearchQueryError
+		if errors.As(err, &queryErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid search query", "details": queryErr.Message, "position": queryErr.Position})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not search memos", "details": err.Error()})
+	}
+
+	var memos []models.Memo
+	result := database.DB.Scopes(base, search, propertyFilter).Order(order).Find(&memos)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not search memos", "details": result.Error.Error()})
 	}
 
-	// 各メモについて RelatedMemoIDs を設定
+	// 各メモについてレスポンス用のフィールドを設定
 	for i := range memos {
-		memos[i].RelatedMemoIDs = stringToRelatedIDs(memos[i].RelatedMemoIDsStore)
+		prepareMemoResponse(c, userID, &memos[i])
 	}
 
 	return c.JSON(memos)
@@ -7,7 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
-	// "strings" // 使用されていないためコメントアウト
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/linkalls/fast-memos/models" // testAppのセットアップはauth_handler_test.goのTestMainで行われる想定
@@ -33,7 +34,12 @@ func readResponseBody(resp *http.Response) string { // 名前を readResponseBod
 // この関数は auth_handler_test.go の clearDatabase と testApp が初期化されている前提です。
 func loginTestUser(t *testing.T, username, password string) string {
 	clearDatabase() // 既存のユーザーをクリア
+	return loginAdditionalTestUser(t, username, password)
+}
 
+// loginAdditionalTestUser はデータベースをクリアせずにユーザーを追加登録してログインします。
+// 複数ユーザー間のアクセス制御をテストする場合に使用します。
+func loginAdditionalTestUser(t *testing.T, username, password string) string {
 	// ユーザー登録
 	registerPayload := fmt.Sprintf(`{"username": "%s", "password": "%s"}`, username, password)
 	reqRegister := httptest.NewRequest(http.MethodPost, "/api/auth/register", bytes.NewBufferString(registerPayload))
@@ -318,3 +324,33 @@ func TestSearchMemos(t *testing.T) {
 	respSearchNoQuery, _ := testApp.Test(reqSearchNoQuery, -1) // タイムアウトを無効化
 	assert.Equal(t, http.StatusBadRequest, respSearchNoQuery.StatusCode, readResponseBody(respSearchNoQuery))
 }
+
+func TestWebUpdateMemoReportsFailure(t *testing.T) {
+	token := loginTestUser(t, "webupdateuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Before", "content": "original"})
+	var user models.User
+	testDB.First(&user, "username = ?", "webupdateuser")
+
+	postEdit := func(title string) string {
+		form := url.Values{"title": {title}, "content": {"edited"}}
+		req := httptest.NewRequest(http.MethodPost, "/memos/"+memo.ID+"/edit", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(webSession(t, user.ID))
+		resp, err := testApp.Test(req, -1)
+		assert.NoError(t, err)
+		return resp.Header.Get("Location")
+	}
+
+	// 保存に失敗したらエラーを付けてリダイレクトし、変更は反映しない
+	assert.NoError(t, testDB.Exec("CREATE TRIGGER web_update_fails BEFORE UPDATE ON memos WHEN NEW.title = 'fail' BEGIN SELECT RAISE(ABORT, 'update failed'); END").Error)
+	location := postEdit("fail")
+	assert.NoError(t, testDB.Exec("DROP TRIGGER web_update_fails").Error)
+	assert.Equal(t, "/?error=failed_to_update_memo", location)
+	var stored models.Memo
+	testDB.First(&stored, "id = ?", memo.ID)
+	assert.Equal(t, "original", stored.Content)
+
+	assert.Equal(t, "/", postEdit("After"))
+	testDB.First(&stored, "id = ?", memo.ID)
+	assert.Equal(t, "edited", stored.Content)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultNearRadiusKm = 1.0
+	maxNearRadiusKm     = 20000.0 // 地球の半周
+)
+
+var errInvalidLocation = errors.New("latitude and longitude must be set together within -90..90 and -180..180")
+
+// validateLocation は緯度・経度が両方指定され、範囲内であることを確認します (両方省略は可)
+func validateLocation(lat, lng *float64) error {
+	if lat == nil && lng == nil {
+		return nil
+	}
+	if lat == nil || lng == nil || !utils.ValidCoordinates(*lat, *lng) {
+		return errInvalidLocation
+	}
+	return nil
+}
+
+// locationFilter は位置情報による絞り込みの条件です
+type locationFilter struct {
+	bbox     *utils.BBox
+	near     bool
+	lat, lng float64
+	radiusKm float64
+}
+
+// parseLocationFilter はクエリパラメータ near=lat,lng&radius=km (radius 省略時は1km) と
+// bbox=minLng,minLat,maxLng,maxLat を解析します。どちらも無ければ nil を返します。
+func parseLocationFilter(c *fiber.Ctx) (*locationFilter, error) {
+	filter := &locationFilter{}
+	if value := c.Query("bbox"); value != "" {
+		box, err := utils.ParseBBox(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.bbox = &box
+	}
+	if value := c.Query("near"); value != "" {
+		lat, lng, err := utils.ParseLatLng(value)
+		if err != nil {
+			return nil, err
+		}
+		radius := defaultNearRadiusKm
+		if r := c.Query("radius"); r != "" {
+			radius, err = strconv.ParseFloat(r, 64)
+			if err != nil || radius <= 0 || radius > maxNearRadiusKm {
+				return nil, errors.New("radius must be a number of kilometers between 0 and 20000")
+			}
+		}
+		filter.near, filter.lat, filter.lng, filter.radiusKm = true, lat, lng, radius
+	} else if c.Query("radius") != "" {
+		return nil, errors.New("radius requires near=lat,lng")
+	}
+	if filter.bbox == nil && !filter.near {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// scope は範囲 (near の場合は円を含む範囲) に位置するメモに絞り込みます。円の内側かどうかは apply で判定します。
+func (f *locationFilter) scope(db *gorm.DB) *gorm.DB {
+	db = db.Where("memos.latitude IS NOT NULL AND memos.longitude IS NOT NULL")
+	if f.bbox != nil {
+		db = bboxScope(db, *f.bbox)
+	}
+	if f.near {
+		db = bboxScope(db, utils.BBoxAround(f.lat, f.lng, f.radiusKm))
+	}
+	return db
+}
+
+func bboxScope(db *gorm.DB, box utils.BBox) *gorm.DB {
+	db = db.Where("memos.latitude BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+	if box.MinLng <= box.MaxLng {
+		return db.Where("memos.longitude BETWEEN ? AND ?", box.MinLng, box.MaxLng)
+	}
+	// 経度180度をまたぐ範囲
+	return db.Where("(memos.longitude >= ? OR memos.longitude <= ?)", box.MinLng, box.MaxLng)
+}
+
+// apply は near の円の外にあるメモを除き、中心からの距離 (DistanceKm) を設定します
+func (f *locationFilter) apply(memos []models.Memo) []models.Memo {
+	if !f.near {
+		return memos
+	}
+	matched := memos[:0]
+	for _, memo := range memos {
+		distance := utils.DistanceKm(f.lat, f.lng, *memo.Latitude, *memo.Longitude)
+		if distance <= f.radiusKm {
+			memo.DistanceKm = &distance
+			matched = append(matched, memo)
+		}
+	}
+	return matched
+}
+
+// GeoJSONFeatureCollection は位置情報付きのメモを GeoJSON (RFC 7946) で表したものです
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // GeoJSON の順序 [経度, 緯度]
+}
+
+// memosToGeoJSON は位置情報付きのメモを GeoJSON に変換します (本文は含めない)
+func memosToGeoJSON(memos []models.Memo) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for _, memo := range memos {
+		if memo.Latitude == nil || memo.Longitude == nil {
+			continue
+		}
+		properties := map[string]interface{}{
+			"title":      memo.Title,
+			"place_name": memo.PlaceName,
+			"category":   memo.Category,
+			"created_at": memo.CreatedAt,
+		}
+		if memo.DistanceKm != nil {
+			properties["distance_km"] = *memo.DistanceKm
+		}
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:       "Feature",
+			ID:         memo.ID,
+			Geometry:   GeoJSONPoint{Type: "Point", Coordinates: [2]float64{*memo.Longitude, *memo.Latitude}},
+			Properties: properties,
+		})
+	}
+	return collection
+}
+
+// geotaggedMemos は一覧に表示するメモ (個人またはワークスペース) のうち位置情報付きのものを取得します
+func geotaggedMemos(userID, workspaceID string, filter *locationFilter) ([]models.Memo, error) {
+	if filter == nil {
+		filter = &locationFilter{}
+	}
+	var memos []models.Memo
+	err := database.DB.Scopes(MemoListScope(userID, workspaceID), filter.scope).Order("created_at desc").Find(&memos).Error
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(memos), nil
+}
+
+// GetMemosGeoJSON は位置情報付きのメモを GeoJSON でエクスポートします (near / radius / bbox で絞り込み可)
+func GetMemosGeoJSON(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	filter, err := parseLocationFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid location filter", "details": err.Error()})
+	}
+	memos, err := geotaggedMemos(userID, requestWorkspaceID(c), filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+	}
+	if err := c.JSON(memosToGeoJSON(memos)); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/geo+json")
+	return nil
+}
+
+// WebMapData - Web UIの地図表示用に、表示中のメモ (個人またはワークスペース) の位置情報を GeoJSON で返す
+func WebMapData(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Not logged in"})
+	}
+	filter, err := parseLocationFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid location filter", "details": err.Error()})
+	}
+	_, workspaceID := WebWorkspaces(c, userID)
+	memos, err := geotaggedMemos(userID, workspaceID, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos"})
+	}
+	if err := c.JSON(memosToGeoJSON(memos)); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/geo+json")
+	return nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeotaggedMemos(t *testing.T) {
+	token := loginTestUser(t, "geouser", "password123")
+	tokyo := createTestMemo(t, token, map[string]interface{}{"title": "Tokyo station", "latitude": 35.6812, "longitude": 139.7671, "place_name": "東京駅"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Shinjuku", "latitude": 35.6896, "longitude": 139.7006})
+	createTestMemo(t, token, map[string]interface{}{"title": "Osaka", "latitude": 34.7025, "longitude": 135.4959})
+	createTestMemo(t, token, map[string]interface{}{"title": "No location"})
+	assert.Equal(t, "東京駅", tokyo.PlaceName)
+
+	// 東京駅から10km以内 (新宿は約6km)
+	resp := memoRequest(t, http.MethodGet, "/api/memos/?near=35.6812,139.7671&radius=10", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var memos []models.Memo
+	json.NewDecoder(resp.Body).Decode(&memos)
+	if assert.Len(t, memos, 2) {
+		for _, memo := range memos {
+			assert.NotNil(t, memo.DistanceKm)
+			assert.Less(t, *memo.DistanceKm, 10.0)
+		}
+	}
+
+	// 範囲 (minLng,minLat,maxLng,maxLat) で絞り込む
+	resp = memoRequest(t, http.MethodGet, "/api/memos/?bbox=135,34,136,35", token, nil)
+	json.NewDecoder(resp.Body).Decode(&memos)
+	if assert.Len(t, memos, 1) {
+		assert.Equal(t, "Osaka", memos[0].Title)
+	}
+
+	for _, query := range []string{"near=91,0", "near=35,139&radius=-1", "radius=5", "bbox=1,2,3"} {
+		resp = memoRequest(t, http.MethodGet, "/api/memos/?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+	resp = memoRequest(t, http.MethodPost, "/api/memos/", token, map[string]interface{}{"title": "x", "latitude": 35.0})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// GeoJSON は位置情報付きのメモのみ ([経度, 緯度] の順)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/geojson", token, nil)
+	assert.Equal(t, "application/geo+json", resp.Header.Get("Content-Type"))
+	var collection GeoJSONFeatureCollection
+	json.NewDecoder(resp.Body).Decode(&collection)
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Len(t, collection.Features, 3)
+	for _, feature := range collection.Features {
+		if feature.ID == tokyo.ID {
+			assert.Equal(t, [2]float64{139.7671, 35.6812}, feature.Geometry.Coordinates)
+			assert.Equal(t, "東京駅", feature.Properties["place_name"])
+		}
+	}
+
+	// 位置情報を削除する
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+tokyo.ID, token, map[string]interface{}{"clear_location": true})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/geojson", token, nil)
+	json.NewDecoder(resp.Body).Decode(&collection)
+	assert.Len(t, collection.Features, 2)
+}
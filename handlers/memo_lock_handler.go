@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// 再認証トークンを渡すヘッダーとCookie (Web UI用) の名前
+const (
+	reauthHeaderName = "X-Reauth-Token"
+	reauthCookieName = "reauth_token"
+)
+
+type ReauthInput struct {
+	Password string `json:"password" xml:"password" form:"password"`
+}
+
+// reauthenticated はリクエストに userID の有効な再認証トークン (ヘッダーまたはCookie) が含まれているかを返します
+func reauthenticated(c *fiber.Ctx, userID string) bool {
+	token := c.Get(reauthHeaderName)
+	if token == "" {
+		token = c.Cookies(reauthCookieName)
+	}
+	if token == "" || userID == "" {
+		return false
+	}
+	tokenUserID, err := auth.ValidateReauthToken(token)
+	return err == nil && tokenUserID == userID
+}
+
+// prepareMemoResponse はレスポンス用のフィールド (RelatedMemoIDs・Properties) を設定します。
+// 保護されたメモは、再認証されていなければ本文とプロパティを隠します。
+func prepareMemoResponse(c *fiber.Ctx, userID string, memo *models.Memo) {
+	memo.RelatedMemoIDs = stringToRelatedIDs(memo.RelatedMemoIDsStore)
+	if memo.Protected && !reauthenticated(c, userID) {
+		memo.Content = ""
+		memo.Properties = map[string]interface{}{}
+		memo.ContentHidden = true
+		return
+	}
+	if memo.Encrypted {
+		memo.Properties = map[string]interface{}{}
+		return
+	}
+	memo.Properties = memoProperties(memo.Content)
+}
+
+// PrepareMemosForDisplay はWeb UIの一覧表示用に prepareMemoResponse を適用し、本文を隠したメモがあれば true を返します
+func PrepareMemosForDisplay(c *fiber.Ctx, userID string, memos []models.Memo) bool {
+	hidden := false
+	for i := range memos {
+		prepareMemoResponse(c, userID, &memos[i])
+		hidden = hidden || memos[i].ContentHidden
+	}
+	return hidden
+}
+
+// checkPassword は userID のパスワードが一致するかを確認します
+func checkPassword(userID, password string) (bool, error) {
+	user, err := findUser(userID)
+	if err != nil {
+		return false, err
+	}
+	return auth.CheckPasswordHash(password, user.Password), nil
+}
+
+// Reauthenticate はパスワードを再確認し、保護されたメモを auth.ReauthWindow の間表示するための再認証トークンを返します。
+// 以降のリクエストでは X-Reauth-Token ヘッダーにトークンを指定してください。
+func Reauthenticate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(ReauthInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	valid, err := checkPassword(userID, input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	if !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid password"})
+	}
+
+	token, expiresAt, err := auth.GenerateReauthToken(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token", "details": err.Error()})
+	}
+	return c.JSON(fiber.Map{"reauth_token": token, "expires_at": expiresAt})
+}
+
+// setMemoFlag はメモの locked / protected を切り替えます
+func setMemoFlag(c *fiber.Ctx, column string, value bool, required string) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memo, _, err := findRequestMemoWithRole(c, userID, c.Params("id"), required)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	// 保護の解除は本文を見られるのと同じなので再認証が必要
+	if column == "protected" && !value && memo.Protected && !reauthenticated(c, userID) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Re-authentication required", "reauth_required": true})
+	}
+	// 公開中のメモは本文を隠せないので保護できない
+	if column == "protected" && value && memo.Visibility != "" && memo.Visibility != models.VisibilityPrivate {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errVisibilityProtected.Error()})
+	}
+
+	// UpdatedAt を変えずにフラグだけ更新する
+	if err := database.DB.Model(memo).UpdateColumn(column, value).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update memo", "details": err.Error()})
+	}
+	prepareMemoResponse(c, userID, memo)
+	return c.JSON(memo)
+}
+
+// LockMemo はメモをロックし、解除するまで更新・削除できないようにします (editor 以上)
+func LockMemo(c *fiber.Ctx) error {
+	return setMemoFlag(c, "locked", true, models.RoleEditor)
+}
+
+// UnlockMemo はメモのロックを解除します (editor 以上)
+func UnlockMemo(c *fiber.Ctx) error {
+	return setMemoFlag(c, "locked", false, models.RoleEditor)
+}
+
+// ProtectMemo はメモを保護し、再認証するまで一覧・検索などで本文を隠します (所有者のみ)
+func ProtectMemo(c *fiber.Ctx) error {
+	return setMemoFlag(c, "protected", true, roleOwner)
+}
+
+// UnprotectMemo はメモの保護を解除します (所有者のみ、再認証が必要)
+func UnprotectMemo(c *fiber.Ctx) error {
+	return setMemoFlag(c, "protected", false, roleOwner)
+}
+
+// WebReauthenticate - パスワードを再入力して保護されたメモを表示できるようにする
+func WebReauthenticate(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	// 再認証後は元のページに戻る (外部へのリダイレクトは許可しない)
+	redirect := localRedirect(c.FormValue("redirect"))
+	valid, err := checkPassword(userID, c.FormValue("password"))
+	if err != nil || !valid {
+		return c.Redirect("/?error=reauth_failed")
+	}
+	token, expiresAt, err := auth.GenerateReauthToken(userID)
+	if err != nil {
+		return c.Redirect("/?error=reauth_failed")
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     reauthCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HTTPOnly: true,
+		Secure:   false, // 本番はtrue
+	})
+	return c.Redirect(redirect)
+}
+
+// WebSetMemoLock - メモのロック・ロック解除
+func WebSetMemoLock(locked bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := WebUserID(c)
+		if userID == "" {
+			return c.Redirect("/login")
+		}
+		memo, _, err := findMemoWithRole(userID, c.Params("id"), models.RoleEditor)
+		if err != nil {
+			return c.Redirect("/")
+		}
+		if err := database.DB.Model(memo).UpdateColumn("locked", locked).Error; err != nil {
+			return c.Redirect("/?error=failed_to_update_memo")
+		}
+		return c.Redirect("/")
+	}
+}
+
+// localRedirect は redirect がこのサイト内のパスならそのまま、そうでなければ "/" を返します。
+// ブラウザは "/\evil.com" の \ を / と、タブや改行を取り除いて解釈するため、"//evil.com" と同じく外部へ飛ばされないよう拒否します。
+func localRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return "/"
+	}
+	for _, r := range redirect {
+		if unicode.IsControl(r) {
+			return "/"
+		}
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "/"
+	}
+	return redirect
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// reauthRequest は X-Reauth-Token ヘッダー付きでリクエストします
+func reauthRequest(t *testing.T, method, url, token, reauthToken string) *http.Response {
+	req := httptest.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(reauthHeaderName, reauthToken)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestMemoLock(t *testing.T) {
+	token := loginTestUser(t, "lockuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Contract", "content": "- [ ] sign"})
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/lock", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// ロック中は更新・削除・タスクの切り替えができない
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "changed"})
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID, token, nil)
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	var task models.Task
+	testDB.Where("memo_id = ?", memo.ID).First(&task)
+	resp = memoRequest(t, http.MethodPost, "/api/tasks/"+task.ID+"/toggle", token, map[string]interface{}{"done": true})
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/lock", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "changed"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+}
+
+func TestProtectedMemoRequiresReauth(t *testing.T) {
+	token := loginTestUser(t, "protectuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Bank", "content": "---\npin: 1234\n---\n- [ ] call the bank\nsecret keyword"})
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/protect", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// 再認証するまで一覧・検索・取得で本文を隠す
+	resp = memoRequest(t, http.MethodGet, "/api/memos/search?q=keyword", token, nil)
+	var memos []models.Memo
+	json.NewDecoder(resp.Body).Decode(&memos)
+	if assert.Len(t, memos, 1) {
+		assert.True(t, memos[0].ContentHidden)
+		assert.Empty(t, memos[0].Content)
+		assert.Empty(t, memos[0].Properties)
+		assert.Equal(t, "Bank", memos[0].Title)
+	}
+
+	resp = memoRequest(t, http.MethodPost, "/api/auth/reauth", token, map[string]interface{}{"password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/auth/reauth", token, map[string]interface{}{"password": "password123"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var reauth struct {
+		ReauthToken string `json:"reauth_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reauth)
+	assert.NotEmpty(t, reauth.ReauthToken)
+
+	// ログイン用のトークンは再認証トークンとして使えない
+	resp = reauthRequest(t, http.MethodGet, "/api/memos/"+memo.ID, token, token)
+	var hidden models.Memo
+	json.NewDecoder(resp.Body).Decode(&hidden)
+	assert.True(t, hidden.ContentHidden)
+
+	// 再認証トークンはログイン用のトークンとして使えない
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, reauth.ReauthToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 保護されたメモのタスクは再認証するまで一覧に含めない
+	var tasks []TaskWithMemo
+	resp = memoRequest(t, http.MethodGet, "/api/tasks", token, nil)
+	json.NewDecoder(resp.Body).Decode(&tasks)
+	assert.Empty(t, tasks)
+	resp = reauthRequest(t, http.MethodGet, "/api/tasks", token, reauth.ReauthToken)
+	json.NewDecoder(resp.Body).Decode(&tasks)
+	assert.Len(t, tasks, 1)
+
+	// 保護されたメモのタスクの切り替え (本文の書き換え) にも再認証が必要
+	resp = memoRequest(t, http.MethodPost, "/api/tasks/"+tasks[0].ID+"/toggle", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = reauthRequest(t, http.MethodPost, "/api/tasks/"+tasks[0].ID+"/toggle", token, reauth.ReauthToken)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	resp = reauthRequest(t, http.MethodGet, "/api/memos/"+memo.ID, token, reauth.ReauthToken)
+	var shown models.Memo
+	json.NewDecoder(resp.Body).Decode(&shown)
+	assert.False(t, shown.ContentHidden)
+	assert.True(t, strings.HasSuffix(shown.Content, "secret keyword"))
+	assert.EqualValues(t, 1234, shown.Properties["pin"])
+
+	// 保護の解除にも再認証が必要
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/protect", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = reauthRequest(t, http.MethodDelete, "/api/memos/"+memo.ID+"/protect", token, reauth.ReauthToken)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, token, nil)
+	json.NewDecoder(resp.Body).Decode(&shown)
+	assert.False(t, shown.ContentHidden)
+}
+
+func TestLocalRedirect(t *testing.T) {
+	for _, redirect := range []string{"/", "/memos/abc", "/tasks?tag=home#top"} {
+		assert.Equal(t, redirect, localRedirect(redirect))
+	}
+	// 外部のサイトに飛ばされうるものは "/" にする
+	for _, redirect := range []string{"", "memos", "https://evil.com", "//evil.com", "/\\evil.com", "/\t/evil.com", "/\n/evil.com", "/%zz"} {
+		assert.Equal(t, "/", localRedirect(redirect), redirect)
+	}
+}
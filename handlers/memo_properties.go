@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/linkalls/fast-memos/atrest"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// syncMemoProperties はメモ本文の front matter からプロパティを再生成します。
+// front matter が YAML として不正な場合はプロパティ無しとして扱います (本文の保存は妨げない)。
+func syncMemoProperties(tx *gorm.DB, memo *models.Memo) error {
+	if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoProperty{}).Error; err != nil {
+		return err
+	}
+	parsed, err := utils.ParseFrontMatter(memo.Content)
+	if err != nil || len(parsed) == 0 {
+		return nil
+	}
+	rows := make([]models.MemoProperty, 0, len(parsed))
+	for _, p := range parsed {
+		row := models.MemoProperty{MemoID: memo.ID, Key: p.Key, UserID: memo.UserID, Type: p.Type, Value: p.Text}
+		if atrest.Current != nil {
+			// 値は暗号化して保存するので、文字列の絞り込みはトークンで行う
+			row.ValueTokens = atrest.Current.PropertyTokens(p.Type, p.Text)
+		}
+		switch p.Type {
+		case utils.PropertyNumber:
+			number := p.Number
+			row.NumberValue = &number
+		case utils.PropertyDate:
+			date := p.Date
+			row.DateValue = &date
+		case utils.PropertyBool:
+			b := p.Bool
+			row.BoolValue = &b
+		}
+		rows = append(rows, row)
+	}
+	return tx.Create(&rows).Error
+}
+
+// memoProperties はレスポンス用にメモ本文の front matter をプロパティ名から値への対応に変換します
+func memoProperties(content string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	parsed, _ := utils.ParseFrontMatter(content)
+	for _, p := range parsed {
+		properties[p.Key] = p.Value()
+	}
+	return properties
+}
+
+// applyPropertyEdits は API で指定されたプロパティを front matter に反映した本文を返します。
+// 値が null のプロパティは削除します。
+func applyPropertyEdits(content string, edits map[string]interface{}) (string, error) {
+	var set []utils.Property
+	var remove []string
+	for key, value := range edits {
+		if value == nil {
+			remove = append(remove, key)
+			continue
+		}
+		property, err := utils.PropertyFromValue(key, value)
+		if err != nil {
+			return "", err
+		}
+		set = append(set, property)
+	}
+	// map の順序に依存しないよう、追加されるプロパティはキー順にする
+	sort.Slice(set, func(i, j int) bool { return set[i].Key < set[j].Key })
+	return utils.UpdateFrontMatter(content, set, remove)
+}
+
+// propertyFilterScope はクエリパラメータ prop (複数指定可、例: ?prop=status=draft&prop=priority>=2) で
+// メモを絞り込むスコープを返します。値の形式から比較する型 (数値・日付・真偽値・文字列) を決めます。
+// list 型のプロパティに対する = / != は要素を含むかどうかで判定します。
+func propertyFilterScope(c *fiber.Ctx) (func(*gorm.DB) *gorm.DB, error) {
+	var conditions []string
+	var args [][]interface{}
+	for _, raw := range c.Context().QueryArgs().PeekMulti("prop") {
+		filter, err := utils.ParsePropertyFilter(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		condition, conditionArgs, err := propertyFilterCondition(filter)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		for i, condition := range conditions {
+			db = db.Where(condition, args[i]...)
+		}
+		return db
+	}, nil
+}
+
+const propertyExistsSQL = `EXISTS (SELECT 1 FROM memo_properties WHERE memo_properties.memo_id = memos.id AND memo_properties.key = ? AND (%s))`
+
+// list 型のプロパティの要素のいずれかが一致する条件
+const propertyListContainsSQL = `(memo_properties.type = 'list' AND EXISTS (SELECT 1 FROM json_each(memo_properties.value) WHERE json_each.value = ?))`
+
+// 保存時の暗号化が有効な場合に、文字列のプロパティか list 型の要素が一致する条件 (値のトークンで比べる)
+const propertyTokenMatchSQL = `EXISTS (SELECT 1 FROM json_each(memo_properties.value_tokens) WHERE json_each.value = ?)`
+
+// errEncryptedPropertyCompare は保存時の暗号化が有効な場合に文字列の大小を比べようとしたときのエラーです
+var errEncryptedPropertyCompare = errors.New("string properties only support = and != while encryption at rest is enabled")
+
+// propertyFilterCondition は絞り込み条件を memos に対する SQL の条件に変換します
+func propertyFilterCondition(filter utils.PropertyFilter) (string, []interface{}, error) {
+	op := filter.Op
+	negate := op == "!="
+	if negate {
+		op = "="
+	}
+
+	var match string
+	var value interface{}
+	if n, err := strconv.ParseFloat(filter.Value, 64); err == nil {
+		match, value = "memo_properties.number_value "+op+" ?", n
+	} else if t, ok := utils.ParseDateValue(filter.Value); ok {
+		match, value = "memo_properties.date_value "+op+" ?", t.UTC()
+	} else if filter.Value == "true" || filter.Value == "false" {
+		if op != "=" {
+			return "", nil, fmt.Errorf("property filter %q: booleans only support = and !=", filter.Key)
+		}
+		match, value = "memo_properties.bool_value = ?", filter.Value == "true"
+	} else if atrest.Current != nil {
+		if op != "=" {
+			return "", nil, fmt.Errorf("property filter %q: %w", filter.Key, errEncryptedPropertyCompare)
+		}
+		match, value = "memo_properties.type <> 'list' AND "+propertyTokenMatchSQL, atrest.Current.PropertyToken(filter.Value)
+	} else {
+		match, value = "memo_properties.type <> 'list' AND memo_properties.value "+op+" ?", filter.Value
+	}
+
+	args := []interface{}{filter.Key, value}
+	if op == "=" {
+		if atrest.Current != nil {
+			match = "(" + match + ") OR (memo_properties.type = 'list' AND " + propertyTokenMatchSQL + ")"
+			args = append(args, atrest.Current.PropertyToken(filter.Value))
+		} else {
+			match = "(" + match + ") OR " + propertyListContainsSQL
+			args = append(args, filter.Value)
+		}
+	}
+	condition := fmt.Sprintf(propertyExistsSQL, match)
+	if negate {
+		condition = "NOT " + condition
+	}
+	return condition, args, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMemosWithProps(t *testing.T, token, path string, filters ...string) []models.Memo {
+	query := url.Values{"prop": filters}
+	resp := memoRequest(t, http.MethodGet, path+"?"+query.Encode(), token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var memos []models.Memo
+	json.NewDecoder(resp.Body).Decode(&memos)
+	return memos
+}
+
+func TestMemoPropertiesFromFrontMatter(t *testing.T) {
+	token := loginTestUser(t, "propuser", "password123")
+	draft := createTestMemo(t, token, map[string]interface{}{"title": "Draft", "content": "---\nstatus: draft\npriority: 2\ndue: 2024-03-01\ntags: [go, fiber]\n---\nbody"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Done", "content": "---\nstatus: done\npriority: 5\ndue: 2024-05-01\n---\nbody"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Plain", "content": "no front matter"})
+
+	assert.Equal(t, "draft", draft.Properties["status"])
+	assert.Equal(t, 2.0, draft.Properties["priority"])
+	assert.Equal(t, "2024-03-01", draft.Properties["due"])
+
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "priority>=2"), 2)
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "priority>2", "due<2024-06-01"), 1)
+	found := getMemosWithProps(t, token, "/api/memos/", "status=draft")
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, draft.ID, found[0].ID)
+	}
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "tags=fiber"), 1)
+	// != はプロパティが無いメモも含む
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "status!=draft"), 2)
+
+	resp := memoRequest(t, http.MethodGet, "/api/memos/search?q=body&prop=status:done", token, nil)
+	var searched []models.Memo
+	json.NewDecoder(resp.Body).Decode(&searched)
+	if assert.Len(t, searched, 1) {
+		assert.Equal(t, "Done", searched[0].Title)
+	}
+
+	resp = memoRequest(t, http.MethodGet, "/api/memos/?prop=oops", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 同じキーが複数あっても作成でき、最後の値が使われる
+	duplicated := createTestMemo(t, token, map[string]interface{}{"title": "Dup", "content": "---\nstatus: draft\nstatus: review\n---\nbody"})
+	assert.Equal(t, "review", duplicated.Properties["status"])
+}
+
+func TestUpdateMemoProperties(t *testing.T) {
+	token := loginTestUser(t, "propeditor", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Note", "content": "---\nstatus: draft\nowner: me\n---\nbody", "properties": map[string]interface{}{"priority": 1}})
+	assert.Equal(t, "---\nstatus: draft\nowner: me\npriority: 1\n---\nbody", memo.Content)
+
+	// API での変更は front matter に書き戻され、フィルターにも反映される
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{
+		"properties": map[string]interface{}{"status": "published", "owner": nil, "reviewed": true},
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var updated models.Memo
+	json.NewDecoder(resp.Body).Decode(&updated)
+	assert.Equal(t, "---\nstatus: published\npriority: 1\nreviewed: true\n---\nbody", updated.Content)
+	assert.Equal(t, true, updated.Properties["reviewed"])
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "reviewed=true", "status=published"), 1)
+
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{
+		"properties": map[string]interface{}{"bad key": "x"},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
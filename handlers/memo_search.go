@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/linkalls/fast-memos/atrest"
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"gorm.io/gorm"
+)
+
+// fullTextSearchEnabled は全文検索の索引を使うかどうかを返します。
+// 保存時の暗号化が有効な場合は平文を索引に残さないよう使いません (atrest の検索用インデックスを使う)。
+func fullTextSearchEnabled() bool {
+	return database.FullTextSearch && atrest.Current == nil
+}
+
+// fullTextQuery はキーワード全体を1つのフレーズとして検索する FTS5 のクエリを返します (正規化した文字列の部分一致になる)。
+// 記号・空白だけのキーワードは ok が false です。
+func fullTextQuery(query string, withCategory bool) (string, bool) {
+	grams, prefix := utils.SearchQueryGrams(query)
+	phrase := `"` + strings.Join(append(grams, prefix), " ") + `"`
+	if prefix != "" {
+		phrase += " *"
+	} else if len(grams) == 0 {
+		return "", false
+	}
+	columns := "{title content}"
+	if withCategory {
+		columns = "{title content category}"
+	}
+	return columns + " : " + phrase, true
+}
+
+// fullTextDocument は全文検索の索引に保存する文字列 (正規化して2文字ずつの並びに分割したもの) です
+func fullTextDocument(text string) string {
+	return strings.Join(utils.SearchGrams(text), " ")
+}
+
+// syncMemoFullText はメモの全文検索の索引を作り直します (エンドツーエンド暗号化されたメモはタイトルとカテゴリのみ)
+func syncMemoFullText(tx *gorm.DB, memo *models.Memo) error {
+	if !fullTextSearchEnabled() {
+		return nil
+	}
+	doc := models.MemoSearchDoc{MemoID: memo.ID}
+	if err := tx.Where("memo_id = ?", memo.ID).FirstOrCreate(&doc).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM memos_fts WHERE rowid = ?", doc.ID).Error; err != nil {
+		return err
+	}
+	content := ""
+	if !memo.Encrypted {
+		content = fullTextDocument(memo.Content)
+	}
+	return tx.Exec("INSERT INTO memos_fts (rowid, memo_id, title, content, category) VALUES (?, ?, ?, ?, ?)",
+		doc.ID, memo.ID, fullTextDocument(memo.Title), content, fullTextDocument(memo.Category)).Error
+}
+
+// clearMemoFullText はメモを全文検索の索引から削除します
+func clearMemoFullText(tx *gorm.DB, memoID string) error {
+	if !database.FullTextSearch {
+		return nil
+	}
+	var docs []models.MemoSearchDoc
+	if err := tx.Where("memo_id = ?", memoID).Limit(1).Find(&docs).Error; err != nil || len(docs) == 0 {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM memos_fts WHERE rowid = ?", docs[0].ID).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&docs[0]).Error
+}
+
+// ReindexFullTextSearch は全文検索の索引をすべてのメモ (削除したものを除く) から batchSize 件ずつ作り直し、索引したメモの数を返します。
+// 保存時の暗号化が有効な場合は平文を残さないよう索引を空にするだけです。
+func ReindexFullTextSearch(batchSize int) (int, error) {
+	if !database.FullTextSearch {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM memos_fts").Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM memo_search_docs").Error
+	})
+	if err != nil || !fullTextSearchEnabled() {
+		return 0, err
+	}
+
+	indexed, lastID := 0, ""
+	for {
+		var memos []models.Memo
+		if err := database.DB.Where("id > ?", lastID).Order("id asc").Limit(batchSize).Find(&memos).Error; err != nil {
+			return indexed, err
+		}
+		if len(memos) == 0 {
+			break
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range memos {
+				if err := syncMemoFullText(tx, &memos[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return indexed, err
+		}
+		indexed += len(memos)
+		lastID = memos[len(memos)-1].ID
+	}
+	// 索引を1つにまとめて検索を速くする
+	return indexed, database.DB.Exec("INSERT INTO memos_fts (memos_fts) VALUES ('optimize')").Error
+}
+
+// PrepareFullTextSearch は起動時に全文検索の索引を準備します。
+// 索引の無いメモ (索引の導入前や FTS5 の無いビルドで保存したメモ) があれば索引を作り直し、
+// 保存時の暗号化が有効なら平文を残さないよう索引を空にします。
+func PrepareFullTextSearch() error {
+	if !database.FullTextSearch {
+		return nil
+	}
+	var count int64
+	if atrest.Current != nil {
+		if err := database.DB.Model(&models.MemoSearchDoc{}).Count(&count).Error; err != nil || count == 0 {
+			return err
+		}
+	} else {
+		err := database.DB.Model(&models.Memo{}).
+			Where("NOT EXISTS (SELECT 1 FROM memo_search_docs WHERE memo_search_docs.memo_id = memos.id)").
+			Count(&count).Error
+		if err != nil || count == 0 {
+			return err
+		}
+	}
+	_, err := ReindexFullTextSearch(0)
+	return err
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/atrest"
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchMemoTitles(t *testing.T, token, query string) []string {
+	resp := memoRequest(t, http.MethodGet, "/api/memos/search?q="+url.QueryEscape(query), token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var memos []models.Memo
+	json.NewDecoder(resp.Body).Decode(&memos)
+	titles := []string{}
+	for _, memo := range memos {
+		titles = append(titles, memo.Title)
+	}
+	return titles
+}
+
+func TestSearchWithEncryptionAtRest(t *testing.T) {
+	cipher, err := atrest.New(bytes.Repeat([]byte{7}, 32))
+	assert.NoError(t, err)
+	atrest.Enable(cipher)
+	defer atrest.Enable(nil)
+
+	token := loginTestUser(t, "atrestuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "買い物リスト", "content": "- [ ] 牛乳を買う\nMilk and Bread"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Meeting", "content": "議事録"})
+
+	// DBにはタイトル・本文が暗号化されて保存される
+	var raw struct{ Title, Content string }
+	testDB.Raw("SELECT title, content FROM memos WHERE id = ?", memo.ID).Scan(&raw)
+	assert.NotContains(t, raw.Title, "買い物")
+	assert.NotContains(t, raw.Content, "牛乳")
+
+	assert.Equal(t, []string{"買い物リスト"}, searchMemoTitles(t, token, "牛乳"))
+	assert.Equal(t, []string{"買い物リスト"}, searchMemoTitles(t, token, "bread"))
+	assert.Equal(t, []string{"Meeting"}, searchMemoTitles(t, token, "議事"))
+	// 1文字でも検索できる
+	assert.Equal(t, []string{"買い物リスト"}, searchMemoTitles(t, token, "牛"))
+	// 並びが一致しない場合は見つからない (インデックスの候補は取得後に確認する)
+	assert.Empty(t, searchMemoTitles(t, token, "乳牛"))
+
+	// 更新するとインデックスも更新される
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"content": "- [ ] 卵を買う"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	assert.Empty(t, searchMemoTitles(t, token, "牛乳"))
+	assert.Equal(t, []string{"買い物リスト"}, searchMemoTitles(t, token, "卵"))
+
+	// JOIN で取得するタスクのメモのタイトルも復号される
+	resp = memoRequest(t, http.MethodGet, "/api/tasks/", token, nil)
+	var tasks []TaskWithMemo
+	json.NewDecoder(resp.Body).Decode(&tasks)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "買い物リスト", tasks[0].MemoTitle)
+		assert.True(t, strings.Contains(tasks[0].Text, "卵"))
+	}
+}
+
+func TestDerivedDataEncryptedAtRest(t *testing.T) {
+	cipher, err := atrest.New(bytes.Repeat([]byte{8}, 32))
+	assert.NoError(t, err)
+	atrest.Enable(cipher)
+	defer atrest.Enable(nil)
+
+	token := loginTestUser(t, "atrestderived", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{
+		"title":   "秘密のメモ",
+		"content": "---\nstatus: secret-draft\ntags: [payroll, hr]\npriority: 2\n---\n- [ ] 給与を振り込む\n口座番号:: 1234",
+	})
+	createTestMemo(t, token, map[string]interface{}{"title": "Other", "content": "---\nstatus: done\n---\nbody"})
+	comment := createTestComment(t, token, memo.ID, map[string]interface{}{"body": "社外秘のコメント"})
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID+"/comments/"+comment.ID, token, map[string]interface{}{"body": "社外秘のコメント (編集)"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// 本文から作ったタスク・プロパティ・カードやコメントも平文では保存しない
+	raw := func(query string) string {
+		var value string
+		testDB.Raw(query, memo.ID).Scan(&value)
+		return value
+	}
+	assert.NotContains(t, raw("SELECT text FROM tasks WHERE memo_id = ?"), "給与")
+	assert.NotContains(t, raw("SELECT value FROM memo_properties WHERE memo_id = ? AND key = 'status'"), "secret")
+	assert.NotContains(t, raw("SELECT value FROM memo_properties WHERE memo_id = ? AND key = 'tags'"), "payroll")
+	assert.NotContains(t, raw("SELECT back FROM cards WHERE memo_id = ?"), "1234")
+	assert.NotContains(t, raw("SELECT body FROM comments WHERE memo_id = ?"), "社外秘")
+
+	// API からは平文として扱える
+	resp = memoRequest(t, http.MethodGet, "/api/tasks/", token, nil)
+	var tasks []TaskWithMemo
+	json.NewDecoder(resp.Body).Decode(&tasks)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "給与を振り込む", tasks[0].Text)
+	}
+	cards := getCards(t, token, "/api/cards?memo_id="+memo.ID)
+	if assert.Len(t, cards, 1) {
+		assert.Equal(t, "1234", cards[0].Back)
+	}
+	threads := getCommentThreads(t, token, memo.ID, "")
+	if assert.Len(t, threads, 1) {
+		assert.Equal(t, "社外秘のコメント (編集)", threads[0].Body)
+	}
+
+	// 文字列・list のプロパティは一致するかどうかで絞り込める (大小の比較はできない)
+	found := getMemosWithProps(t, token, "/api/memos/", "status=secret-draft")
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, memo.ID, found[0].ID)
+	}
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "tags=hr"), 1)
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "status!=secret-draft"), 1)
+	assert.Len(t, getMemosWithProps(t, token, "/api/memos/", "priority>=2"), 1)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/?prop="+url.QueryEscape("status>a"), token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestFullTextSearch(t *testing.T) {
+	if !database.FullTextSearch {
+		t.Skip("SQLite FTS5 is not available (run with -tags sqlite_fts5)")
+	}
+	token := loginTestUser(t, "ftsuser", "password123")
+
+	inTitle := createTestMemo(t, token, map[string]interface{}{"title": "並行処理のメモ", "content": "goroutine と channel"})
+	createTestMemo(t, token, map[string]interface{}{"title": "日記", "content": "今日は Go の並行処理を勉強した"})
+	createTestMemo(t, token, map[string]interface{}{"title": "買い物", "content": "Milk and Bread", "category": "並行処理"})
+
+	// タイトルに一致するメモが本文に一致する新しいメモより先に来る (カテゴリは検索しない)
+	assert.Equal(t, []string{"並行処理のメモ", "日記"}, searchMemoTitles(t, token, "並行処理"))
+	// 大文字小文字を区別しない部分一致
+	assert.Equal(t, []string{"買い物"}, searchMemoTitles(t, token, "MILK AND"))
+	assert.Equal(t, []string{"並行処理のメモ"}, searchMemoTitles(t, token, "routine"))
+	// 1〜2文字のキーワードも索引で検索できる
+	assert.Equal(t, []string{"日記"}, searchMemoTitles(t, token, "今日"))
+	assert.Equal(t, []string{"日記"}, searchMemoTitles(t, token, "記"))
+	// FTS5 の構文はキーワードとして扱う
+	assert.Empty(t, searchMemoTitles(t, token, `"並行 NOT 処理*" AND`))
+
+	// 更新・削除すると索引も更新される
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+inTitle.ID, token, map[string]interface{}{"title": "Concurrency"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	assert.Equal(t, []string{"日記"}, searchMemoTitles(t, token, "並行処理"))
+	assert.Equal(t, []string{"Concurrency"}, searchMemoTitles(t, token, "concurrency"))
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+inTitle.ID, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	assert.Empty(t, searchMemoTitles(t, token, "concurrency"))
+	var docs int64
+	testDB.Model(&models.MemoSearchDoc{}).Where("memo_id = ?", inTitle.ID).Count(&docs)
+	assert.Zero(t, docs)
+
+	// 索引が失われても作り直せる
+	assert.NoError(t, testDB.Exec("DELETE FROM memos_fts").Error)
+	assert.Empty(t, searchMemoTitles(t, token, "並行処理"))
+	indexed, err := ReindexFullTextSearch(1)
+	assert.NoError(t, err)
+	assert.Positive(t, indexed)
+	assert.Equal(t, []string{"日記"}, searchMemoTitles(t, token, "並行処理"))
+}
+
+func TestSearchNormalization(t *testing.T) {
+	token := loginTestUser(t, "normalizeuser", "password123")
+	createTestMemo(t, token, map[string]interface{}{"title": "サーバー設定", "content": "ＤＢのバックアップは毎日"})
+	createTestMemo(t, token, map[string]interface{}{"title": "コーヒー", "content": "ドリップ用の豆を買う"})
+
+	// 全角・半角、大文字小文字、カタカナとひらがな、長音符の有無を区別しない
+	for _, query := range []string{"サーバ", "さーばー", "ｻｰﾊﾞｰ", "db", "ﾊﾞｯｸｱｯﾌﾟ", "設", "ＤＢのバックアップ"} {
+		assert.Equal(t, []string{"サーバー設定"}, searchMemoTitles(t, token, query), query)
+	}
+	assert.Equal(t, []string{"コーヒー"}, searchMemoTitles(t, token, "こーひー"))
+	assert.Equal(t, []string{"コーヒー"}, searchMemoTitles(t, token, "どりっぷ"))
+	// 記号・空白だけのキーワードはどれにも一致しない
+	assert.Empty(t, searchMemoTitles(t, token, "!?"))
+	assert.Empty(t, searchMemoTitles(t, token, "バックアップ 毎週"))
+
+	// FTS5 が無い場合も候補は SQL で絞り、範囲内のメモをすべて読み込まない
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	compiler := &searchCompiler{userID: userID, base: MemoListScope(userID, "")}
+	candidates, err := compiler.keywordCandidates("ﾊﾞｯｸｱｯﾌﾟ")
+	assert.NoError(t, err)
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, "サーバー設定", candidates[0].Title)
+	}
+}
+
+func TestSearchQueryLanguage(t *testing.T) {
+	token := loginTestUser(t, "queryuser", "password123")
+	weekly := createTestMemo(t, token, map[string]interface{}{"title": "週次会議", "content": "next week の予定 #work", "category": "仕事"})
+	createTestMemo(t, token, map[string]interface{}{"title": "会議メモ", "content": "下書き #work #draft", "category": "個人"})
+	trip := createTestMemo(t, token, map[string]interface{}{"title": "旅行", "content": "京都", "related_memo_ids": []string{weekly.ID}})
+	pinned := createTestMemo(t, token, map[string]interface{}{"title": "買い物", "content": "---\npinned: true\n---\n牛乳"})
+	createTestMemo(t, token, map[string]interface{}{"title": "アーカイブ", "content": "---\narchived: true\n---\n古い会議の記録"})
+	uploadTestAttachment(t, token, trip.ID, "map.txt", []byte("map"))
+	testDB.Exec("UPDATE memos SET created_at = ? WHERE id = ?", "2024-01-10 12:00:00+00:00", pinned.ID)
+
+	for query, want := range map[string][]string{
+		"会議 -tag:draft":                          {"週次会議", "アーカイブ"},
+		`"next week"`:                            {"週次会議"},
+		`"week next"`:                            {},
+		"tag:work -category:仕事":                  {"会議メモ"},
+		"category:仕事 OR 京都":                      {"週次会議", "旅行"},
+		"会議 OR 牛乳 -is:archived":                  {"週次会議", "会議メモ", "買い物"},
+		"is:pinned":                              {"買い物"},
+		"is:archived":                            {"アーカイブ"},
+		"has:attachment":                         {"旅行"},
+		"related:" + weekly.ID:                   {"旅行"},
+		"related:" + trip.ID:                     {"週次会議"},
+		"before:2024-02-01":                      {"買い物"},
+		"after:2024-01-09 before:2024-01-11":     {"買い物"},
+		"after:2024-01-10 -is:archived 会議 OR 京都": {"週次会議", "会議メモ", "旅行"},
+	} {
+		assert.ElementsMatch(t, want, searchMemoTitles(t, token, query), query)
+	}
+
+	// 構文エラーは位置付きの 400
+	resp := memoRequest(t, http.MethodGet, "/api/memos/search?q="+url.QueryEscape("会議 OR"), token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var body map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "Invalid search query", body["error"])
+	assert.Equal(t, "OR must be placed between two conditions", body["details"])
+	assert.EqualValues(t, 3, body["position"])
+	resp = memoRequest(t, http.MethodGet, "/api/memos/search?q="+url.QueryEscape("before:tomorrow"), token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/linkalls/fast-memos/atrest"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"gorm.io/gorm"
+)
+
+// syncMemoDerived はメモ本文から派生するデータ (タグ・タスク・プロパティ・フラッシュカード・重複検出用の指紋・統計・検索用の索引) を再生成します。
+// メモを作成・更新したすべての経路から呼び出してください。activity は統計の活動としての数え方です。
+// 暗号化されたメモは本文を解釈できないので派生データを持ちません (検索用インデックスはタイトルのみ)。
+func syncMemoDerived(tx *gorm.DB, memo *models.Memo, activity memoActivity) error {
+	if err := syncMemoSearchIndex(tx, memo); err != nil {
+		return err
+	}
+	if err := syncMemoStats(tx, memo, activity); err != nil {
+		return err
+	}
+	if memo.Encrypted {
+		if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoProperty{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.Card{}).Error; err != nil {
+			return err
+		}
+		return clearMemoFingerprint(tx, memo.ID)
+	}
+	if err := syncMemoTags(tx, memo); err != nil {
+		return err
+	}
+	if err := syncMemoTasks(tx, memo); err != nil {
+		return err
+	}
+	if err := syncMemoProperties(tx, memo); err != nil {
+		return err
+	}
+	if err := syncMemoCards(tx, memo); err != nil {
+		return err
+	}
+	return syncMemoFingerprint(tx, memo)
+}
+
+// clearMemoDerived はメモ削除時に派生データを削除します
+func clearMemoDerived(tx *gorm.DB, memoID string) error {
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.MemoTag{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.Task{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.MemoProperty{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.Card{}).Error; err != nil {
+		return err
+	}
+	if err := clearMemoFingerprint(tx, memoID); err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.MemoStat{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.MemoSearchToken{}).Error; err != nil {
+		return err
+	}
+	return clearMemoFullText(tx, memoID)
+}
+
+// syncMemoSearchIndex は検索用の索引を作り直します。保存時の暗号化が有効な場合は
+// タイトル・本文が暗号化されていて LIKE や全文検索の索引で検索できないため、atrest の検索用インデックスを使います。
+func syncMemoSearchIndex(tx *gorm.DB, memo *models.Memo) error {
+	if atrest.Current == nil {
+		return syncMemoFullText(tx, memo)
+	}
+	return atrest.Current.IndexMemo(tx, memo)
+}
+
+func syncMemoTags(tx *gorm.DB, memo *models.Memo) error {
+	if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoTag{}).Error; err != nil {
+		return err
+	}
+	tags := utils.ExtractTags(memo.Content)
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]models.MemoTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, models.MemoTag{MemoID: memo.ID, Tag: tag, UserID: memo.UserID})
+	}
+	return tx.Create(&rows).Error
+}
+
+func syncMemoTasks(tx *gorm.DB, memo *models.Memo) error {
+	var existing []models.Task
+	if err := tx.Where("memo_id = ?", memo.ID).Order("line asc").Find(&existing).Error; err != nil {
+		return err
+	}
+
+	// 本文が同じタスクは既存のIDを引き継ぐ (行の移動やチェックの切り替えでIDが変わらないように)
+	idsByText := map[string][]string{}
+	for _, t := range existing {
+		idsByText[t.Text] = append(idsByText[t.Text], t.ID)
+	}
+
+	parsed := utils.ParseTasks(memo.Content)
+	tasks := make([]models.Task, 0, len(parsed))
+	for _, p := range parsed {
+		id := utils.GenerateID()
+		if ids := idsByText[p.Text]; len(ids) > 0 {
+			id = ids[0]
+			idsByText[p.Text] = ids[1:]
+		}
+		dueAt := p.DueAt
+		if dueAt == nil {
+			dueAt = memo.DueAt
+		}
+		tasks = append(tasks, models.Task{
+			ID:     id,
+			MemoID: memo.ID,
+			UserID: memo.UserID,
+			Line:   p.Line,
+			Text:   p.Text,
+			Done:   p.Done,
+			DueAt:  dueAt,
+		})
+	}
+
+	if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.Task{}).Error; err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+	return tx.Create(&tasks).Error
+}
+
+// syncMemoCards はメモ本文からフラッシュカードを再生成します。
+// 復習の状態を失わないよう、同じキーのカード (論理削除したものを含む)、なければ同じ行・種類のカードを更新し、
+// 本文から消えたカードは論理削除します。
+func syncMemoCards(tx *gorm.DB, memo *models.Memo) error {
+	var existing []models.Card
+	if err := tx.Unscoped().Where("memo_id = ?", memo.ID).Order("line asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byKey := make(map[string]*models.Card, len(existing))
+	for i := range existing {
+		byKey[existing[i].Key] = &existing[i]
+	}
+
+	parsed := utils.ParseCards(memo.Content)
+	used := map[string]bool{}
+	var unmatched []utils.ParsedCard
+	for _, p := range parsed {
+		if card, ok := byKey[p.Key]; ok {
+			used[card.ID] = true
+			if err := saveParsedCard(tx, card, p); err != nil {
+				return err
+			}
+			continue
+		}
+		unmatched = append(unmatched, p)
+	}
+
+	// 質問文などを書き換えたカードは、同じ行・種類の有効なカードの状態を引き継ぐ
+	now := time.Now().UTC()
+	for _, p := range unmatched {
+		var card *models.Card
+		for i := range existing {
+			candidate := &existing[i]
+			if !used[candidate.ID] && !candidate.DeletedAt.Valid && candidate.Line == p.Line && candidate.Kind == p.Kind {
+				card = candidate
+				break
+			}
+		}
+		if card != nil {
+			used[card.ID] = true
+			card.Key = p.Key
+			if err := saveParsedCard(tx, card, p); err != nil {
+				return err
+			}
+			continue
+		}
+		created := models.Card{
+			ID:         utils.GenerateID(),
+			MemoID:     memo.ID,
+			UserID:     memo.UserID,
+			Key:        p.Key,
+			Kind:       p.Kind,
+			Front:      p.Front,
+			Back:       p.Back,
+			Line:       p.Line,
+			EaseFactor: utils.InitialEaseFactor,
+			DueAt:      now,
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+	}
+
+	var stale []string
+	for _, card := range existing {
+		if !used[card.ID] && !card.DeletedAt.Valid {
+			stale = append(stale, card.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", stale).Delete(&models.Card{}).Error
+}
+
+// saveParsedCard は既存のカードの内容を本文に合わせて更新し、論理削除されていれば復元します (復習の状態はそのまま)
+func saveParsedCard(tx *gorm.DB, card *models.Card, p utils.ParsedCard) error {
+	front, err := models.EncryptField(tx, card.UserID, p.Front)
+	if err != nil {
+		return err
+	}
+	back, err := models.EncryptField(tx, card.UserID, p.Back)
+	if err != nil {
+		return err
+	}
+	return tx.Unscoped().Model(&models.Card{}).Where("id = ?", card.ID).Updates(map[string]interface{}{
+		"key":        p.Key,
+		"front":      front,
+		"back":       back,
+		"line":       p.Line,
+		"deleted_at": nil,
+	}).Error
+}
+
+// syncMemoFingerprint は重複検出用の本文の指紋と、その帯を再計算します
+func syncMemoFingerprint(tx *gorm.DB, memo *models.Memo) error {
+	fingerprint := memoFingerprint(memo)
+	if err := tx.Save(fingerprint).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("memo_id = ?", memo.ID).Delete(&models.MemoFingerprintBand{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(fingerprintBands(fingerprint)).Error
+}
+
+// clearMemoFingerprint はメモの重複検出用の指紋と帯を削除します
+func clearMemoFingerprint(tx *gorm.DB, memoID string) error {
+	if err := tx.Where("memo_id = ?", memoID).Delete(&models.MemoFingerprintBand{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("memo_id = ?", memoID).Delete(&models.MemoFingerprint{}).Error
+}
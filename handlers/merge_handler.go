@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// 1回で統合できるメモの上限
+	maxMergeMemos = 50
+	// 統合先をたどる回数の上限 (統合されたメモをさらに統合した場合)
+	maxMergeRedirects = 10
+	// 1回の分割で作れるメモの上限 (元のメモに残す部分を含む)
+	maxSplitParts = 50
+)
+
+// MergeMemosInput は POST /memos/merge のリクエストボディです
+type MergeMemosInput struct {
+	MemoIDs []string `json:"memo_ids"` // 統合する順。最初のメモに残りを統合する
+	Title   string   `json:"title"`    // 省略時は最初のメモのタイトル
+}
+
+// SplitMemoInput は POST /memos/:id/split のリクエストボディです
+type SplitMemoInput struct {
+	Level   int   `json:"level"`   // 見出しで分割する場合の見出しのレベル (0 なら本文で最も大きい見出し)
+	Offsets []int `json:"offsets"` // 指定すると見出しではなく文字 (rune) 単位の位置で分割する
+}
+
+// findRestructurableMemo は統合・分割の対象のメモを取得します。
+// 暗号化されたメモは本文を解釈できないので対象外で、保護されたメモは再認証が必要です。
+func findRestructurableMemo(c *fiber.Ctx, userID, memoID, required string) (*models.Memo, error) {
+	memo, _, err := findEditableMemo(c, userID, memoID, required)
+	if err != nil {
+		return nil, err
+	}
+	if memo.Encrypted {
+		return nil, badMemoInput("Encrypted memos cannot be merged or split")
+	}
+	if memo.Protected && !reauthenticated(c, userID) {
+		return nil, &memoInputError{Status: fiber.StatusForbidden, Message: "Re-authentication is required for protected memos"}
+	}
+	return memo, nil
+}
+
+// mergeMemoContents は memos の本文を順に連結します。2件目以降はタイトルを見出しにし、
+// front matter は最初のメモに無いプロパティだけ最初のメモの front matter に追加します。
+func mergeMemoContents(memos []*models.Memo) (string, error) {
+	content := memos[0].Content
+	existing := map[string]bool{}
+	targetProperties, targetErr := utils.ParseFrontMatter(content)
+	for _, property := range targetProperties {
+		existing[property.Key] = true
+	}
+	var added []utils.Property
+	for _, memo := range memos[1:] {
+		body := memo.Content
+		// 不正な front matter はそのまま本文として残す
+		if _, rest, ok := utils.SplitFrontMatter(body); ok && targetErr == nil {
+			if properties, err := utils.ParseFrontMatter(body); err == nil {
+				body = rest
+				for _, property := range properties {
+					if !existing[property.Key] {
+						existing[property.Key] = true
+						added = append(added, property)
+					}
+				}
+			}
+		}
+		content = strings.TrimRight(content, "\r\n") + "\n\n## " + memo.Title + "\n\n" + strings.Trim(body, "\r\n")
+	}
+	if len(added) == 0 {
+		return content, nil
+	}
+	return utils.UpdateFrontMatter(content, added, nil)
+}
+
+// mergedRelations は memos の関連メモを統合したものを返します (統合するメモ自身は除く)
+func mergedRelations(memos []*models.Memo) []string {
+	skip := map[string]bool{}
+	for _, memo := range memos {
+		skip[memo.ID] = true
+	}
+	relations := []string{}
+	for _, memo := range memos {
+		for _, id := range stringToRelatedIDs(memo.RelatedMemoIDsStore) {
+			if !skip[id] {
+				skip[id] = true
+				relations = append(relations, id)
+			}
+		}
+	}
+	return relations
+}
+
+// mergeMemoInto は統合元のメモの添付ファイル・コメント・フラッシュカードを統合先に移し、統合元をゴミ箱に移します。
+// 統合元の共有 (ACL) と派生データは削除します。
+func mergeMemoInto(tx *gorm.DB, sourceID, targetID string) error {
+	if err := tx.Model(&models.Attachment{}).Where("memo_id = ?", sourceID).Update("memo_id", targetID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Comment{}).Where("memo_id = ?", sourceID).Update("memo_id", targetID).Error; err != nil {
+		return err
+	}
+	// 復習の状態を引き継ぐため、統合先に同じカードが無ければ移す (統合先の保存時に本文と突き合わせる)
+	targetKeys := tx.Unscoped().Model(&models.Card{}).Select("key").Where("memo_id = ?", targetID)
+	if err := tx.Unscoped().Model(&models.Card{}).Where("memo_id = ? AND key NOT IN (?)", sourceID, targetKeys).Update("memo_id", targetID).Error; err != nil {
+		return err
+	}
+	if err := removeMemoGrants(tx, sourceID); err != nil {
+		return err
+	}
+	if err := clearMemoDerived(tx, sourceID); err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Memo{}).Where("id = ?", sourceID).UpdateColumn("merged_into", targetID).Error; err != nil {
+		return err
+	}
+	return tx.Where("id = ?", sourceID).Delete(&models.Memo{}).Error
+}
+
+// mergedMemoTarget は統合されてゴミ箱に移ったメモの統合先のIDを返します (統合が続いている場合はたどる)
+func mergedMemoTarget(userID, memoID string) (string, bool) {
+	target := ""
+	for i := 0; i < maxMergeRedirects; i++ {
+		var memo models.Memo
+		err := database.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL AND merged_into <> ''", memoID).First(&memo).Error
+		if err != nil {
+			break
+		}
+		if role, err := memoRole(userID, memo); err != nil || role == "" {
+			break
+		}
+		target, memoID = memo.MergedInto, memo.MergedInto
+	}
+	return target, target != ""
+}
+
+// mergedMemoRedirect は統合されたメモへのリクエストを統合先の同じパスにリダイレクトします
+func mergedMemoRedirect(c *fiber.Ctx, userID, memoID, path string) (bool, error) {
+	target, ok := mergedMemoTarget(userID, memoID)
+	if !ok {
+		return false, nil
+	}
+	return true, c.Redirect(strings.TrimSuffix(path, memoID)+target, fiber.StatusMovedPermanently)
+}
+
+// MergeMemos は指定した順にメモを最初のメモに統合します。
+// 本文を連結し、関連メモ・タグ (本文から抽出) を合わせ、残りのメモは統合先へのリダイレクトを残してゴミ箱に移します。
+func MergeMemos(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(MergeMemosInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range input.MemoIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 || len(ids) > maxMergeMemos {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("memo_ids must contain 2-%d distinct memos", maxMergeMemos)})
+	}
+
+	// 統合先は editor 以上、ゴミ箱に移る統合元は所有者のみ
+	memos := make([]*models.Memo, len(ids))
+	for i, id := range ids {
+		required := roleOwner
+		if i == 0 {
+			required = models.RoleEditor
+		}
+		memo, err := findRestructurableMemo(c, userID, id, required)
+		if err != nil {
+			return memoAccessErrorResponse(c, err)
+		}
+		if i > 0 && memo.WorkspaceID != memos[0].WorkspaceID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memos in different workspaces cannot be merged"})
+		}
+		memos[i] = memo
+	}
+
+	target := memos[0]
+	before := *target
+	content, err := mergeMemoContents(memos)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not merge properties", "details": err.Error()})
+	}
+	target.Content = content
+	if input.Title != "" {
+		target.Title = input.Title
+	}
+	target.RelatedMemoIDsStore = relatedIDsToString(mergedRelations(memos))
+	// 統合先に期限が無ければ統合元の最も早い期限を使う
+	if target.DueAt == nil {
+		for _, memo := range memos[1:] {
+			if memo.DueAt != nil && (target.DueAt == nil || memo.DueAt.Before(*target.DueAt)) {
+				target.DueAt = memo.DueAt
+			}
+		}
+	}
+
+	// 統合先の所有者の容量は、同じ所有者の統合元がゴミ箱に移って減る分を差し引いて確認する
+	growth := memoBytes(target) - memoBytes(&before)
+	for _, source := range memos[1:] {
+		if source.UserID == target.UserID {
+			growth -= memoBytes(source)
+		}
+	}
+	if err := checkMemoQuota(target.UserID, 0, growth); err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(target).Error; err != nil {
+			return err
+		}
+		for _, source := range memos[1:] {
+			if err := mergeMemoInto(tx, source.ID, target.ID); err != nil {
+				return err
+			}
+		}
+		return syncMemoDerived(tx, target, activityEdited)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not merge memos", "details": err.Error()})
+	}
+
+	prepareMemoResponse(c, userID, target)
+	return c.JSON(target)
+}
+
+// SplitMemo はメモを見出し (または指定した位置) で分割します。
+// 最初の部分は元のメモに残し、残りの部分は新しいメモとして作成して元のメモと相互に関連付けます。
+func SplitMemo(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(SplitMemoInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Level < 0 || input.Level > 6 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "level must be between 0 and 6"})
+	}
+	if len(input.Offsets) >= maxSplitParts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("offsets must contain at most %d positions", maxSplitParts-1)})
+	}
+	memo, err := findRestructurableMemo(c, userID, c.Params("id"), models.RoleEditor)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+
+	var parts []utils.MemoPart
+	if len(input.Offsets) > 0 {
+		parts, err = utils.SplitAtOffsets(memo.Content, input.Offsets)
+	} else {
+		parts, err = utils.SplitAtHeadings(memo.Content, input.Level)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(parts) > maxSplitParts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("memo would be split into more than %d memos", maxSplitParts)})
+	}
+
+	before := *memo
+	created := make([]models.Memo, 0, len(parts)-1)
+	relations := stringToRelatedIDs(memo.RelatedMemoIDsStore)
+	for i, part := range parts[1:] {
+		title := part.Title
+		if title == "" {
+			title = fmt.Sprintf("%s (%d)", memo.Title, i+2)
+		}
+		created = append(created, models.Memo{
+			ID:                  utils.GenerateID(),
+			Title:               title,
+			Content:             part.Content,
+			Category:            memo.Category,
+			UserID:              memo.UserID,
+			WorkspaceID:         memo.WorkspaceID,
+			Visibility:          models.VisibilityPrivate,
+			RelatedMemoIDsStore: memo.ID,
+		})
+		relations = append(relations, created[i].ID)
+	}
+	memo.Content = parts[0].Content
+	memo.RelatedMemoIDsStore = relatedIDsToString(relations)
+
+	// 新しいメモは元のメモの所有者のメモとして数える
+	bytes := memoBytes(memo) - memoBytes(&before)
+	for i := range created {
+		bytes += memoBytes(&created[i])
+	}
+	if err := checkMemoQuota(memo.UserID, int64(len(created)), bytes); err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(memo).Error; err != nil {
+			return err
+		}
+		var grants []models.MemoGrant
+		if err := tx.Where("memo_id = ?", memo.ID).Find(&grants).Error; err != nil {
+			return err
+		}
+		for i := range created {
+			if err := tx.Create(&created[i]).Error; err != nil {
+				return err
+			}
+			// 元のメモの共有 (メモ単位のACL) を引き継ぐ
+			for _, grant := range grants {
+				grant.ID, grant.MemoID = utils.GenerateID(), created[i].ID
+				if err := tx.Create(&grant).Error; err != nil {
+					return err
+				}
+			}
+			// 新しいメモに移ったフラッシュカードは復習の状態ごと移す
+			var keys []string
+			for _, card := range utils.ParseCards(created[i].Content) {
+				keys = append(keys, card.Key)
+			}
+			if len(keys) > 0 {
+				if err := tx.Unscoped().Model(&models.Card{}).Where("memo_id = ? AND key IN ?", memo.ID, keys).Update("memo_id", created[i].ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := syncMemoDerived(tx, &created[i], activityCreated); err != nil {
+				return err
+			}
+		}
+		return syncMemoDerived(tx, memo, activityEdited)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not split memo", "details": err.Error()})
+	}
+
+	prepareMemoResponse(c, userID, memo)
+	for i := range created {
+		prepareMemoResponse(c, userID, &created[i])
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"memo": memo, "created": created})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type splitResponse struct {
+	Memo    models.Memo   `json:"memo"`
+	Created []models.Memo `json:"created"`
+}
+
+func TestMergeMemos(t *testing.T) {
+	token := loginTestUser(t, "mergeuser", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	other := createTestMemo(t, token, map[string]interface{}{"title": "Other"})
+	target := createTestMemo(t, token, map[string]interface{}{"title": "Target", "content": "---\nstatus: draft\n---\nfirst #alpha"})
+	source := createTestMemo(t, token, map[string]interface{}{
+		"title": "Source", "content": "---\nstatus: done\nowner: me\n---\nsecond #beta",
+		"related_memo_ids": []string{other.ID, target.ID},
+	})
+	comment := createTestComment(t, token, source.ID, map[string]interface{}{"body": "keep me"})
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/merge", token, map[string]interface{}{"memo_ids": []string{target.ID, source.ID}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var merged models.Memo
+	json.NewDecoder(resp.Body).Decode(&merged)
+	assert.Equal(t, target.ID, merged.ID)
+	assert.Equal(t, "---\nstatus: draft\nowner: me\n---\nfirst #alpha\n\n## Source\n\nsecond #beta", merged.Content)
+	assert.Equal(t, []string{other.ID}, merged.RelatedMemoIDs)
+	var tags []string
+	testDB.Model(&models.MemoTag{}).Where("memo_id = ?", target.ID).Order("tag").Pluck("tag", &tags)
+	assert.Equal(t, []string{"alpha", "beta"}, tags)
+	var commentMemoID string
+	testDB.Model(&models.Comment{}).Where("id = ?", comment.ID).Pluck("memo_id", &commentMemoID)
+	assert.Equal(t, target.ID, commentMemoID)
+
+	// 統合元はゴミ箱に移り、統合先にリダイレクトされる
+	assert.False(t, memoExists(source.ID))
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+source.ID, token, nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/api/memos/"+target.ID, resp.Header.Get("Location"))
+	resp, _ = getSharePage(t, "/memos/"+source.ID, webSession(t, userID))
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/memos/"+target.ID, resp.Header.Get("Location"))
+
+	resp = memoRequest(t, http.MethodGet, "/api/memos/trash", token, nil)
+	var trashed []models.Memo
+	json.NewDecoder(resp.Body).Decode(&trashed)
+	if assert.Len(t, trashed, 1) {
+		assert.Equal(t, source.ID, trashed[0].ID)
+		assert.Equal(t, target.ID, trashed[0].MergedInto)
+	}
+
+	// ゴミ箱から戻すとリダイレクトは無くなる
+	result := postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "restore", "id": source.ID}},
+	}, http.StatusOK)
+	assert.Empty(t, result.Results[0].Memo.MergedInto)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+source.ID, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMergeMemosValidation(t *testing.T) {
+	ownerToken := loginTestUser(t, "mergeowner", "password123")
+	editorToken := loginAdditionalTestUser(t, "mergeeditor", "password123")
+	first := createTestMemo(t, ownerToken, map[string]interface{}{"title": "First"})
+	second := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Second"})
+	createTestGrant(t, ownerToken, "/api/memos/"+first.ID+"/grants", map[string]interface{}{"username": "mergeeditor", "role": "editor"})
+	createTestGrant(t, ownerToken, "/api/memos/"+second.ID+"/grants", map[string]interface{}{"username": "mergeeditor", "role": "editor"})
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/merge", ownerToken, map[string]interface{}{"memo_ids": []string{first.ID, first.ID}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 統合元をゴミ箱に移せるのは所有者だけ
+	resp = memoRequest(t, http.MethodPost, "/api/memos/merge", editorToken, map[string]interface{}{"memo_ids": []string{first.ID, second.ID}})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.True(t, memoExists(second.ID))
+}
+
+func TestSplitMemo(t *testing.T) {
+	token := loginTestUser(t, "splituser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{
+		"title": "Notes", "category": "work",
+		"content": "intro\n\n## One\n- 首都:: 東京\n\n## Two\nlast",
+	})
+
+	resp := memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	var result splitResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, "intro", result.Memo.Content)
+	if assert.Len(t, result.Created, 2) {
+		assert.Equal(t, "One", result.Created[0].Title)
+		assert.Equal(t, "work", result.Created[0].Category)
+		assert.Equal(t, []string{memo.ID}, result.Created[0].RelatedMemoIDs)
+		assert.Equal(t, []string{result.Created[0].ID, result.Created[1].ID}, result.Memo.RelatedMemoIDs)
+		// フラッシュカードは新しいメモに移る
+		cards := getCards(t, token, "/api/cards?memo_id="+result.Created[0].ID)
+		assert.Len(t, cards, 1)
+	}
+
+	// 位置 (文字単位) での分割
+	memo = createTestMemo(t, token, map[string]interface{}{"title": "Plain", "content": "あいうえおかきくけこ"})
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{"offsets": []int{5}})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, "あいうえお", result.Memo.Content)
+	if assert.Len(t, result.Created, 1) {
+		assert.Equal(t, "かきくけこ", result.Created[0].Content)
+	}
+
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// メモに対する権限。所有者 > 編集者 > 閲覧者 の順に強い
+const roleOwner = "owner"
+
+var roleRank = map[string]int{
+	models.RoleViewer: 1,
+	models.RoleEditor: 2,
+	roleOwner:         3,
+}
+
+var (
+	errMemoNotFound  = errors.New("memo not found")
+	errMemoForbidden = errors.New("insufficient permission for memo")
+	errMemoLocked    = errors.New("memo is locked")
+)
+
+// grantMatchSQL は memos の行に対して userID へのACL (メモ単位・カテゴリ単位) が存在する条件です
+const grantMatchSQL = `EXISTS (SELECT 1 FROM memo_grants WHERE memo_grants.grantee_id = ? AND (memo_grants.memo_id = memos.id OR (memo_grants.memo_id = '' AND memo_grants.owner_id = memos.user_id AND memo_grants.category = memos.category)))`
+
+// workspaceMatchSQL は memos の行が userID の所属するワークスペースのメモである条件です
+const workspaceMatchSQL = `memos.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = ?)`
+
+// accessibleMemos は userID が閲覧できる (自分の個人メモ・所属ワークスペースのメモ・共有された) メモに絞り込むスコープです
+func accessibleMemos(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((memos.workspace_id = '' AND memos.user_id = ?) OR "+workspaceMatchSQL+" OR "+grantMatchSQL+")", userID, userID, userID)
+	}
+}
+
+// personalMemos は userID の個人のメモ (ワークスペースに属さないもの) に絞り込むスコープです
+func personalMemos(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("memos.user_id = ? AND memos.workspace_id = ''", userID)
+	}
+}
+
+// workspaceMemos はワークスペースのメモに絞り込むスコープです
+func workspaceMemos(workspaceID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("memos.workspace_id = ?", workspaceID)
+	}
+}
+
+// sharedWithMe は他のユーザーから共有されたメモに絞り込むスコープです
+func sharedWithMe(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("memos.user_id <> ? AND "+grantMatchSQL, userID, userID)
+	}
+}
+
+// memoRole は userID のメモに対する権限を返します。アクセスできない場合は空文字です。
+func memoRole(userID string, memo models.Memo) (string, error) {
+	best := ""
+	if memo.WorkspaceID == "" {
+		if memo.UserID == userID {
+			return roleOwner, nil
+		}
+	} else {
+		// ワークスペースのメモはメンバーの役割から権限が決まる
+		wsRole, err := workspaceRole(userID, memo.WorkspaceID)
+		if err != nil {
+			return "", err
+		}
+		best = memoRoleInWorkspace(wsRole, memo.UserID == userID)
+		if best == roleOwner {
+			return best, nil
+		}
+	}
+	var roles []string
+	err := database.DB.Model(&models.MemoGrant{}).
+		Where("grantee_id = ? AND (memo_id = ? OR (memo_id = '' AND owner_id = ? AND category = ?))", userID, memo.ID, memo.UserID, memo.Category).
+		Pluck("role", &roles).Error
+	if err != nil {
+		return "", err
+	}
+	for _, role := range roles {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best, nil
+}
+
+// memoRoleInWorkspace はワークスペースでの役割をメモに対する権限に変換します
+func memoRoleInWorkspace(wsRole string, isAuthor bool) string {
+	switch wsRole {
+	case models.WorkspaceRoleOwner, models.WorkspaceRoleAdmin:
+		return roleOwner
+	case models.WorkspaceRoleMember:
+		if isAuthor {
+			return roleOwner
+		}
+		return models.RoleEditor
+	case models.WorkspaceRoleGuest:
+		return models.RoleViewer
+	}
+	return ""
+}
+
+// findMemoWithRole は userID が required 以上の権限を持つメモを取得します。
+// アクセスできない場合は errMemoNotFound、権限が足りない場合は errMemoForbidden を返します。
+func findMemoWithRole(userID, memoID, required string) (*models.Memo, string, error) {
+	var memo models.Memo
+	if err := database.DB.Where("id = ?", memoID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errMemoNotFound
+		}
+		return nil, "", err
+	}
+	role, err := memoRole(userID, memo)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		// 存在を知られないよう、権限がない場合も見つからない扱いにする
+		return nil, "", errMemoNotFound
+	}
+	if roleRank[role] < roleRank[required] {
+		return &memo, role, errMemoForbidden
+	}
+	return &memo, role, nil
+}
+
+// findRequestMemoWithRole は findMemoWithRole に加えて、ワークスペースのルート経由の場合は
+// そのワークスペースのメモであることを確認します
+func findRequestMemoWithRole(c *fiber.Ctx, userID, memoID, required string) (*models.Memo, string, error) {
+	memo, role, err := findMemoWithRole(userID, memoID, required)
+	if memo != nil {
+		if workspaceID := requestWorkspaceID(c); workspaceID != "" && memo.WorkspaceID != workspaceID {
+			return nil, "", errMemoNotFound
+		}
+	}
+	return memo, role, err
+}
+
+// findEditableMemo は findRequestMemoWithRole に加えて、ロックされたメモの場合は errMemoLocked を返します
+// (更新・削除など本文を変更する操作の前に使う)
+func findEditableMemo(c *fiber.Ctx, userID, memoID, required string) (*models.Memo, string, error) {
+	memo, role, err := findRequestMemoWithRole(c, userID, memoID, required)
+	if err == nil && memo.Locked {
+		return memo, role, errMemoLocked
+	}
+	return memo, role, err
+}
+
+// memoInputError はメモの作成・更新の入力が不正な場合のエラーです (Status はレスポンスのステータスコード)
+type memoInputError struct {
+	Status  int
+	Message string
+	Details string
+}
+
+func (e *memoInputError) Error() string {
+	return e.Message
+}
+
+// badMemoInput は 400 を返す memoInputError を作ります
+func badMemoInput(message string) error {
+	return &memoInputError{Status: fiber.StatusBadRequest, Message: message}
+}
+
+// memoAccessErrorResponse は findMemoWithRole のエラー (と memoInputError) をレスポンスに変換します
+func memoAccessErrorResponse(c *fiber.Ctx, err error) error {
+	var inputErr *memoInputError
+	switch {
+	case errors.As(err, &inputErr):
+		body := fiber.Map{"error": inputErr.Message}
+		if inputErr.Details != "" {
+			body["details"] = inputErr.Details
+		}
+		return c.Status(inputErr.Status).JSON(body)
+	case errors.Is(err, errMemoNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+	case errors.Is(err, errMemoForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You do not have permission for this operation on the memo"})
+	case errors.Is(err, errMemoLocked):
+		return c.Status(fiber.StatusLocked).JSON(fiber.Map{"error": "Memo is locked; unlock it before making changes"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+}
+
+// removeMemoGrants はメモ単位のACLを削除します (メモを完全に削除するとき)
+func removeMemoGrants(tx *gorm.DB, memoID string) error {
+	return tx.Where("memo_id = ?", memoID).Delete(&models.MemoGrant{}).Error
+}
+
+// findViewableAttachment は userID が閲覧できるメモ (共有されたメモを含む) の添付ファイルを取得します
+func findViewableAttachment(userID, attachmentID string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ?", attachmentID).First(&attachment).Error; err != nil {
+		return nil, err
+	}
+	if attachment.UserID != userID {
+		if _, _, err := findMemoWithRole(userID, attachment.MemoID, models.RoleViewer); err != nil {
+			if errors.Is(err, errMemoNotFound) {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return nil, err
+		}
+		return &attachment, nil
+	}
+	// ゴミ箱のメモの添付ファイルは (戻すまで) 投稿者も取得できない
+	var count int64
+	if err := database.DB.Model(&models.Memo{}).Where("id = ?", attachment.MemoID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &attachment, nil
+}
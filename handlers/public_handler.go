@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// プロフィールページ・公開APIの1ページあたりのメモ数
+const publicPageSize = 20
+
+var (
+	errInvalidVisibility   = errors.New("visibility must be 'private', 'unlisted' or 'public'")
+	errVisibilityWorkspace = errors.New("workspace memos cannot be published")
+	errVisibilityEncrypted = errors.New("encrypted memos cannot be published")
+	errVisibilityProtected = errors.New("protected memos cannot be published")
+	errPublicMemoNotFound  = errors.New("public memo not found")
+)
+
+// validateVisibility はメモの公開範囲が設定できる組み合わせかどうかを確認します。
+// 公開できるのは個人のメモだけで、暗号化・保護されたメモは公開できません。
+func validateVisibility(memo *models.Memo) error {
+	if memo.Visibility == "" || memo.Visibility == models.VisibilityPrivate {
+		return nil
+	}
+	if !models.ValidVisibility(memo.Visibility) {
+		return errInvalidVisibility
+	}
+	switch {
+	case memo.WorkspaceID != "":
+		return errVisibilityWorkspace
+	case memo.Encrypted:
+		return errVisibilityEncrypted
+	case memo.Protected:
+		return errVisibilityProtected
+	}
+	return nil
+}
+
+// publishedMemos は now の時点で公開されているメモ (visibilities のいずれかで、予約公開の日時を過ぎたもの) に絞り込むスコープです
+func publishedMemos(now time.Time, visibilities ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("memos.visibility IN ? AND (memos.publish_at IS NULL OR memos.publish_at <= ?)", visibilities, now).
+			Where("memos.workspace_id = '' AND memos.encrypted = ? AND memos.protected = ?", false, false)
+	}
+}
+
+// findPublishedMemo は URL で閲覧できる (unlisted または public の) メモを返します
+func findPublishedMemo(memoID string) (*models.Memo, error) {
+	var memo models.Memo
+	err := database.DB.Scopes(publishedMemos(time.Now().UTC(), models.VisibilityUnlisted, models.VisibilityPublic)).
+		Where("id = ?", memoID).First(&memo).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errPublicMemoNotFound
+		}
+		return nil, err
+	}
+	return &memo, nil
+}
+
+// PublicMemo は認証なしで返す公開メモです。
+// 所有者のユーザーIDや関連メモ・ロック・暗号化などの内部の情報は含めません (フィールド名は models.Memo と同じ)。
+type PublicMemo struct {
+	ID        string
+	Title     string
+	Content   string
+	Category  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PublishAt *time.Time
+	Username  string
+}
+
+func newPublicMemo(memo models.Memo, username string) PublicMemo {
+	return PublicMemo{
+		ID:        memo.ID,
+		Title:     memo.Title,
+		Content:   memo.Content,
+		Category:  memo.Category,
+		CreatedAt: memo.CreatedAt,
+		UpdatedAt: memo.UpdatedAt,
+		PublishAt: memo.PublishAt,
+		Username:  username,
+	}
+}
+
+// PublicProfile はユーザーの公開メモの一覧 (1ページ分) です
+type PublicProfile struct {
+	Username string       `json:"username"`
+	Memos    []PublicMemo `json:"memos"`
+	Page     int          `json:"page"`
+	HasNext  bool         `json:"has_next"`
+}
+
+// loadPublicProfile はユーザー名のユーザーが public にしたメモを公開日時の新しい順に1ページ分取得します
+func loadPublicProfile(username string, page int) (*PublicProfile, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	var memos []models.Memo
+	err := database.DB.Scopes(publishedMemos(time.Now().UTC(), models.VisibilityPublic)).
+		Where("user_id = ?", user.ID).
+		Order("COALESCE(publish_at, created_at) desc").Order("id").
+		Offset((page - 1) * publicPageSize).Limit(publicPageSize + 1).
+		Find(&memos).Error
+	if err != nil {
+		return nil, err
+	}
+	profile := &PublicProfile{Username: user.Username, Page: page, Memos: []PublicMemo{}}
+	if len(memos) > publicPageSize {
+		memos, profile.HasNext = memos[:publicPageSize], true
+	}
+	for _, memo := range memos {
+		profile.Memos = append(profile.Memos, newPublicMemo(memo, user.Username))
+	}
+	return profile, nil
+}
+
+// queryPage はクエリパラメータ page (1始まり) を返します。不正な値は1ページ目として扱います。
+func queryPage(c *fiber.Ctx) int {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// GetPublicMemo は unlisted または public のメモを返します (認証不要)
+func GetPublicMemo(c *fiber.Ctx) error {
+	memo, err := findPublishedMemo(c.Params("id"))
+	if err != nil {
+		if errors.Is(err, errPublicMemoNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+	}
+	var owner models.User
+	if err := database.DB.Select("username").Where("id = ?", memo.UserID).First(&owner).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+	}
+	return c.JSON(newPublicMemo(*memo, owner.Username))
+}
+
+// GetPublicProfile はユーザーの public なメモの一覧を返します (認証不要、?page=N でページ指定)
+func GetPublicProfile(c *fiber.Ctx) error {
+	profile, err := loadPublicProfile(c.Params("username"), queryPage(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve public memos", "details": err.Error()})
+	}
+	return c.JSON(profile)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getPublicProfile(t *testing.T, path string) PublicProfile {
+	resp := memoRequest(t, http.MethodGet, path, "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var profile PublicProfile
+	json.NewDecoder(resp.Body).Decode(&profile)
+	return profile
+}
+
+func TestMemoVisibilityAndPublicPages(t *testing.T) {
+	token := loginTestUser(t, "publicuser", "password123")
+	private := createTestMemo(t, token, map[string]interface{}{"title": "Private", "content": "secret"})
+	unlisted := createTestMemo(t, token, map[string]interface{}{"title": "Unlisted", "content": "by **link**", "visibility": "unlisted"})
+	public := createTestMemo(t, token, map[string]interface{}{"title": "Public", "content": "hello **world**", "visibility": "public"})
+	assert.Equal(t, models.VisibilityPrivate, private.Visibility)
+	assert.Equal(t, models.VisibilityPublic, public.Visibility)
+
+	// URL で閲覧できるのは unlisted と public のみ
+	resp, body := getSharePage(t, "/p/"+unlisted.ID)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<strong>link</strong>")
+	assert.Contains(t, body, "noindex")
+	resp, body = getSharePage(t, "/p/"+public.ID)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, body, "noindex")
+	resp, _ = getSharePage(t, "/p/"+private.ID)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/public/memos/"+private.ID, "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 公開APIは所有者のユーザーIDなどの内部の情報を返さない
+	resp = memoRequest(t, http.MethodGet, "/api/public/memos/"+public.ID, "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	publicBody := readResponseBody(resp)
+	var publicMemo map[string]interface{}
+	json.Unmarshal([]byte(publicBody), &publicMemo)
+	assert.Equal(t, "Public", publicMemo["Title"])
+	assert.Equal(t, "publicuser", publicMemo["Username"])
+	for _, field := range []string{"UserID", "RelatedMemoIDs", "Locked", "Encrypted", "EncryptionKeyID", "WorkspaceID"} {
+		assert.NotContains(t, publicMemo, field)
+	}
+	assert.NotContains(t, publicBody, public.UserID)
+
+	// プロフィールには public のメモのみ表示する
+	profile := getPublicProfile(t, "/api/public/users/publicuser/memos")
+	if assert.Len(t, profile.Memos, 1) {
+		assert.Equal(t, public.ID, profile.Memos[0].ID)
+	}
+	resp, body = getSharePage(t, "/u/publicuser")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<strong>world</strong>")
+	assert.NotContains(t, body, "Unlisted")
+	resp, _ = getSharePage(t, "/u/nobody")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 非公開に戻す
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+unlisted.ID, token, map[string]interface{}{"visibility": "private"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp, _ = getSharePage(t, "/p/"+unlisted.ID)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+private.ID, token, map[string]interface{}{"visibility": "everyone"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	// 公開中のメモは保護できず、保護されたメモは公開できない
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+public.ID+"/protect", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+private.ID+"/protect", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+private.ID, token, map[string]interface{}{"visibility": "public"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestScheduledPublishing(t *testing.T) {
+	token := loginTestUser(t, "scheduleuser", "password123")
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Later", "visibility": "public", "publish_at": future})
+
+	// 公開日時までは非公開として扱う
+	resp, _ := getSharePage(t, "/p/"+memo.ID)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Empty(t, getPublicProfile(t, "/api/public/users/scheduleuser/memos").Memos)
+
+	// 公開日時を過ぎたら表示される
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, token, map[string]interface{}{"publish_at": past})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp, _ = getSharePage(t, "/p/"+memo.ID)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, getPublicProfile(t, "/api/public/users/scheduleuser/memos").Memos, 1)
+}
+
+func TestPublicProfilePagination(t *testing.T) {
+	token := loginTestUser(t, "pageuser", "password123")
+	for i := 0; i < publicPageSize+3; i++ {
+		createTestMemo(t, token, map[string]interface{}{"title": fmt.Sprintf("Post %d", i), "visibility": "public"})
+	}
+
+	first := getPublicProfile(t, "/api/public/users/pageuser/memos")
+	assert.Len(t, first.Memos, publicPageSize)
+	assert.True(t, first.HasNext)
+	second := getPublicProfile(t, "/api/public/users/pageuser/memos?page=2")
+	assert.Len(t, second.Memos, 3)
+	assert.False(t, second.HasNext)
+	assert.Equal(t, 2, second.Page)
+
+	_, body := getSharePage(t, "/u/pageuser")
+	assert.Contains(t, body, "?page=2")
+}
+
+func TestVisibilityOwnerOnly(t *testing.T) {
+	ownerToken := loginTestUser(t, "visowner", "password123")
+	editorToken := loginAdditionalTestUser(t, "viseditor", "password123")
+	memo := createTestMemo(t, ownerToken, map[string]interface{}{"title": "Shared draft"})
+	createTestGrant(t, ownerToken, "/api/memos/"+memo.ID+"/grants", map[string]interface{}{"username": "viseditor", "role": "editor"})
+
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, editorToken, map[string]interface{}{"visibility": "public"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+memo.ID, ownerToken, map[string]interface{}{"visibility": "public"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/quota"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuotaUsage はユーザーの現在の使用量です
+type QuotaUsage struct {
+	Memos           int64 `json:"memos"`
+	ContentBytes    int64 `json:"content_bytes"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	RequestsToday   int64 `json:"requests_today"` // UTC の今日の API のリクエスト数
+}
+
+// UsageResponse は GET /me/usage のレスポンスです
+type UsageResponse struct {
+	Role   string       `json:"role"`
+	Limits quota.Limits `json:"limits"` // 0 は無制限
+	Usage  QuotaUsage   `json:"usage"`
+}
+
+// memoBytes は容量の上限で数えるメモのタイトル・本文のバイト数です
+func memoBytes(memo *models.Memo) int64 {
+	return int64(len(memo.Title) + len(memo.Content))
+}
+
+// requestCountDate はリクエスト数を数える日付 (UTC) です
+func requestCountDate(now time.Time) string {
+	return now.UTC().Format(dailyDateLayout)
+}
+
+// userQuotaLimits はユーザーのロールの上限にユーザーごとの上書きを適用した上限を返します
+func userQuotaLimits(user *models.User) (quota.Limits, error) {
+	limits := quota.Current.ForRole(user.Role)
+	var overrides []models.UserQuota
+	if err := database.DB.Where("user_id = ?", user.ID).Limit(1).Find(&overrides).Error; err != nil {
+		return limits, err
+	}
+	if len(overrides) > 0 {
+		limits = limits.Apply(overrides[0])
+	}
+	return limits, nil
+}
+
+// userQuotaUsage はユーザーの現在の使用量を返します (メモ数と容量は作成したメモ、個人・ワークスペースの両方を数える)
+func userQuotaUsage(user *models.User) (QuotaUsage, error) {
+	var usage QuotaUsage
+	if err := backfillMemoStats(user.ID, userLocation(*user)); err != nil {
+		return usage, err
+	}
+	err := database.DB.Model(&models.MemoStat{}).
+		Select("COUNT(*) AS memos, COALESCE(SUM(bytes), 0) AS content_bytes").
+		Where("user_id = ?", user.ID).
+		Scan(&usage).Error
+	if err != nil {
+		return usage, err
+	}
+	err = database.DB.Model(&models.Attachment{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ?", user.ID).
+		Scan(&usage.AttachmentBytes).Error
+	if err != nil {
+		return usage, err
+	}
+	var counts []models.RequestCount
+	err = database.DB.Where("user_id = ? AND date = ?", user.ID, requestCountDate(time.Now())).Limit(1).Find(&counts).Error
+	if len(counts) > 0 {
+		usage.RequestsToday = counts[0].Count
+	}
+	return usage, err
+}
+
+// quotaExceeded は上限を超える場合の 413 のエラーです
+func quotaExceeded(message string, limit int64) error {
+	return &memoInputError{Status: fiber.StatusRequestEntityTooLarge, Message: message, Details: fmt.Sprintf("limit is %d", limit)}
+}
+
+// memoQuota はメモの作成・変更でユーザーの上限を超えないか確認するための、ユーザーごとの上限と使用量です。
+// トランザクションの中では使用量を数えられないため、開始前に loadMemoQuota で読み込み、変更のたびに reserve で確認します。
+type memoQuota struct {
+	limits map[string]quota.Limits
+	usage  map[string]QuotaUsage
+}
+
+// loadMemoQuota は userIDs のユーザーの上限と使用量を読み込みます
+func loadMemoQuota(userIDs ...string) (*memoQuota, error) {
+	q := &memoQuota{limits: map[string]quota.Limits{}, usage: map[string]QuotaUsage{}}
+	for _, userID := range userIDs {
+		if _, loaded := q.limits[userID]; loaded || userID == "" {
+			continue
+		}
+		user, err := findUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		limits, err := userQuotaLimits(user)
+		if err != nil {
+			return nil, err
+		}
+		q.limits[userID] = limits
+		if limits.Memos == 0 && limits.ContentBytes == 0 {
+			continue
+		}
+		if q.usage[userID], err = userQuotaUsage(user); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// reserve は userID のメモを memos 件・bytes バイト増やしても上限を超えないか確認し、超えなければ使用量に加えます。
+// 減る場合 (0 以下) は確認しません。超える場合は 413 の *memoInputError を返します。
+func (q *memoQuota) reserve(userID string, memos, bytes int64) error {
+	limits, usage := q.limits[userID], q.usage[userID]
+	if limits.Memos > 0 && memos > 0 && usage.Memos+memos > limits.Memos {
+		return quotaExceeded("Memo count quota exceeded", limits.Memos)
+	}
+	if limits.ContentBytes > 0 && bytes > 0 && usage.ContentBytes+bytes > limits.ContentBytes {
+		return quotaExceeded("Memo content quota exceeded", limits.ContentBytes)
+	}
+	usage.Memos += memos
+	usage.ContentBytes += bytes
+	q.usage[userID] = usage
+	return nil
+}
+
+// checkMemoQuota はメモを memos 件 (合計 bytes バイト) 増やしてもユーザーの上限を超えないか確認します。
+// 超える場合は 413 の *memoInputError を返します。
+func checkMemoQuota(userID string, memos, bytes int64) error {
+	if memos <= 0 && bytes <= 0 {
+		return nil
+	}
+	q, err := loadMemoQuota(userID)
+	if err != nil {
+		return err
+	}
+	return q.reserve(userID, memos, bytes)
+}
+
+// checkMemoGrowth はメモを before から after に変更しても所有者の容量の上限を超えないか確認します (増えた分だけ数える)
+func checkMemoGrowth(before, after *models.Memo) error {
+	return checkMemoQuota(after.UserID, 0, memoBytes(after)-memoBytes(before))
+}
+
+// checkAttachmentQuota は bytes バイトのファイルを添付してもユーザーの上限を超えないか確認します
+func checkAttachmentQuota(userID string, bytes int64) error {
+	user, err := findUser(userID)
+	if err != nil {
+		return err
+	}
+	limits, err := userQuotaLimits(user)
+	if err != nil || limits.AttachmentBytes == 0 {
+		return err
+	}
+	usage, err := userQuotaUsage(user)
+	if err != nil {
+		return err
+	}
+	if usage.AttachmentBytes+bytes > limits.AttachmentBytes {
+		return quotaExceeded("Attachment quota exceeded", limits.AttachmentBytes)
+	}
+	return nil
+}
+
+// requestQuota は auth.RequestLimiter の実装で、ユーザーの1日あたりの API のリクエスト数を数えて制限します
+type requestQuota struct{}
+
+// RequestQuota は auth.Limiter に設定する1日あたりのリクエスト数の制限です
+var RequestQuota requestQuota
+
+// Allow はリクエストを数え、今日のリクエスト数が上限以下なら true を返します
+func (requestQuota) Allow(userID string) (bool, error) {
+	date := requestCountDate(time.Now())
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("count + 1")}),
+	}).Create(&models.RequestCount{UserID: userID, Date: date, Count: 1}).Error
+	if err != nil {
+		return false, err
+	}
+	if quota.Current == nil {
+		return true, nil
+	}
+	var users []models.User
+	if err := database.DB.Where("id = ?", userID).Limit(1).Find(&users).Error; err != nil {
+		return false, err
+	}
+	if len(users) == 0 {
+		// 存在しないユーザーは後続のハンドラで扱う
+		return true, nil
+	}
+	limits, err := userQuotaLimits(&users[0])
+	if err != nil {
+		return false, err
+	}
+	if limits.RequestsPerDay == 0 {
+		return true, nil
+	}
+	var count models.RequestCount
+	if err := database.DB.Where("user_id = ? AND date = ?", userID, date).First(&count).Error; err != nil {
+		return false, err
+	}
+	return count.Count <= limits.RequestsPerDay, nil
+}
+
+// GetUsage は認証されたユーザーの上限と現在の使用量を返します
+func GetUsage(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	user, err := findUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	limits, err := userQuotaLimits(user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve quota", "details": err.Error()})
+	}
+	usage, err := userQuotaUsage(user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not compute usage", "details": err.Error()})
+	}
+	return c.JSON(UsageResponse{Role: user.Role, Limits: limits, Usage: usage})
+}
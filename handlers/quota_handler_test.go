@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/quota"
+	"github.com/stretchr/testify/assert"
+)
+
+func enableQuotaForTest(t *testing.T, config *quota.Config) {
+	quota.Enable(config)
+	t.Cleanup(func() { quota.Enable(nil) })
+}
+
+func getUsage(t *testing.T, token string) UsageResponse {
+	resp := memoRequest(t, http.MethodGet, "/api/me/usage", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var usage UsageResponse
+	json.NewDecoder(resp.Body).Decode(&usage)
+	return usage
+}
+
+func TestMemoQuota(t *testing.T) {
+	token := loginTestUser(t, "quotauser", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	enableQuotaForTest(t, &quota.Config{Roles: map[string]quota.Limits{models.RoleUser: {Memos: 2}}})
+
+	createTestMemo(t, token, map[string]interface{}{"title": "One", "content": "hello"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Two", "content": "world"})
+	resp := memoRequest(t, http.MethodPost, "/api/memos/", token, map[string]interface{}{"title": "Three"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Contains(t, readResponseBody(resp), "Memo count quota exceeded")
+
+	resp = memoRequest(t, http.MethodPost, "/api/memos/batch", token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "create", "memo": map[string]interface{}{"title": "Batch"}}},
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	form := url.Values{"content": {"from the web"}}
+	req := httptest.NewRequest(http.MethodPost, "/memos", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(webSession(t, userID))
+	resp, err = testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "/?error=quota_exceeded", resp.Header.Get("Location"))
+
+	usage := getUsage(t, token)
+	assert.Equal(t, models.RoleUser, usage.Role)
+	assert.Equal(t, quota.Limits{Memos: 2}, usage.Limits)
+	assert.Equal(t, int64(2), usage.Usage.Memos)
+	assert.Equal(t, int64(len("One")+len("hello")+len("Two")+len("world")), usage.Usage.ContentBytes)
+
+	// ユーザーごとの上書き (0 は無制限) で作成できるようになる
+	unlimited, contentBytes := int64(0), int64(40)
+	testDB.Create(&models.UserQuota{UserID: userID, Memos: &unlimited, ContentBytes: &contentBytes})
+	createTestMemo(t, token, map[string]interface{}{"title": "Three", "content": "ok"})
+	resp = memoRequest(t, http.MethodPost, "/api/memos/", token, map[string]interface{}{"title": "Four", "content": strings.Repeat("x", 30)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Contains(t, readResponseBody(resp), "Memo content quota exceeded")
+}
+
+func TestMemoQuotaCoversChanges(t *testing.T) {
+	token := loginTestUser(t, "quotachanges", "password123")
+	enableQuotaForTest(t, &quota.Config{Roles: map[string]quota.Limits{models.RoleUser: {Memos: 3, ContentBytes: 40}}})
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "One", "content": "# A\nfirst\n# B\nsecond"})
+	other := createTestMemo(t, token, map[string]interface{}{"title": "Two", "content": "x"})
+
+	// 本文を増やす更新は容量の上限で拒否する (減らす更新はできる)
+	big := strings.Repeat("y", 40)
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+other.ID, token, map[string]interface{}{"content": big})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, "/api/memos/"+other.ID, token, map[string]interface{}{"content": ""})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	for _, op := range []map[string]interface{}{
+		{"op": "update", "id": other.ID, "memo": map[string]interface{}{"content": big}},
+		{"op": "add_tag", "id": other.ID, "tag": strings.Repeat("t", 30)},
+	} {
+		resp = memoRequest(t, http.MethodPost, "/api/memos/batch", token, map[string]interface{}{"operations": []map[string]interface{}{op}})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, op["op"])
+	}
+
+	// 同じ所有者のメモの統合は容量が増えないのでできる
+	resp = memoRequest(t, http.MethodPost, "/api/memos/merge", token, map[string]interface{}{"memo_ids": []string{memo.ID, other.ID}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// メモ数: 統合元はゴミ箱に移って1件。分割・デイリーノート・ゴミ箱からの復元で上限を超えない
+	createTestMemo(t, token, map[string]interface{}{"title": "Three"})
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodGet, "/api/daily/today", token, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/memos/batch", token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "restore", "id": other.ID}},
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{"offsets": []int{1}})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, int64(3), getUsage(t, token).Usage.Memos)
+
+	offsets := make([]int, maxSplitParts)
+	for i := range offsets {
+		offsets[i] = i + 1
+	}
+	resp = memoRequest(t, http.MethodPost, "/api/memos/"+memo.ID+"/split", token, map[string]interface{}{"offsets": offsets})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAttachmentQuota(t *testing.T) {
+	token := loginTestUser(t, "quotaupload", "password123")
+	enableQuotaForTest(t, &quota.Config{Roles: map[string]quota.Limits{models.RoleUser: {AttachmentBytes: 16}}})
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Files"})
+
+	uploadTestAttachment(t, token, memo.ID, "a.txt", []byte("0123456789"))
+	resp := uploadAttachmentRequest(t, token, memo.ID, "b.txt", []byte("0123456789"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Contains(t, readResponseBody(resp), "Attachment quota exceeded")
+	assert.Equal(t, int64(10), getUsage(t, token).Usage.AttachmentBytes)
+}
+
+func TestRequestQuota(t *testing.T) {
+	token := loginTestUser(t, "quotarequests", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	enableQuotaForTest(t, &quota.Config{})
+	limit := getUsage(t, token).Usage.RequestsToday + 2
+	testDB.Create(&models.UserQuota{UserID: userID, RequestsPerDay: &limit})
+
+	assert.Equal(t, limit-1, getUsage(t, token).Usage.RequestsToday)
+	assert.Equal(t, limit, getUsage(t, token).Usage.RequestsToday)
+	resp := memoRequest(t, http.MethodGet, "/api/memos/", token, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, readResponseBody(resp), "Daily request limit exceeded")
+}
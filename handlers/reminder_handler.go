@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/reminders"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CreateReminderInput struct {
+	RemindAt time.Time `json:"remind_at" xml:"remind_at" form:"remind_at"`
+	RRule    string    `json:"rrule" xml:"rrule" form:"rrule"`
+	Channel  string    `json:"channel" xml:"channel" form:"channel"`
+	Target   string    `json:"target" xml:"target" form:"target"`
+}
+
+// ReminderItem は /api/reminders の一覧に含まれる1件分です
+type ReminderItem struct {
+	Type       string    `json:"type"` // "reminder" または "due"
+	MemoID     string    `json:"memo_id"`
+	Title      string    `json:"title"`
+	ReminderID string    `json:"reminder_id,omitempty"`
+	At         time.Time `json:"at"`
+	RRule      string    `json:"rrule,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+}
+
+// CreateReminder はメモにリマインダーを追加します
+func CreateReminder(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memoID := c.Params("id")
+	if memoID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Memo ID is required"})
+	}
+
+	input := new(CreateReminderInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.RemindAt.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "remind_at is required"})
+	}
+	if input.Channel == "" {
+		input.Channel = models.ReminderChannelInApp
+	}
+	switch input.Channel {
+	case models.ReminderChannelInApp:
+	case models.ReminderChannelWebhook:
+		if err := reminders.ValidateWebhookTarget(input.Target); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A valid http(s) target URL is required for webhook reminders", "details": err.Error()})
+		}
+	case models.ReminderChannelEmail:
+		address, err := reminders.ValidateEmailTarget(input.Target)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A valid target email address is required for email reminders", "details": err.Error()})
+		}
+		input.Target = address
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown channel", "details": input.Channel})
+	}
+	if input.RRule != "" {
+		if _, err := reminders.ParseRRule(input.RRule); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rrule", "details": err.Error()})
+		}
+	}
+
+	var memo models.Memo
+	if err := database.DB.Where("id = ? AND user_id = ?", memoID, userID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+	}
+
+	reminder := models.Reminder{
+		ID:       utils.GenerateID(),
+		MemoID:   memo.ID,
+		UserID:   userID,
+		RemindAt: input.RemindAt.UTC(),
+		RRule:    input.RRule,
+		Channel:  input.Channel,
+		Target:   input.Target,
+	}
+	next, err := reminders.FirstFireAt(reminder, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rrule", "details": err.Error()})
+	}
+	reminder.NextFireAt = next
+
+	if err := database.DB.Create(&reminder).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create reminder", "details": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(reminder)
+}
+
+// GetReminders は期限切れ (overdue) と今後 (upcoming) のリマインダー・期限付きメモを返します
+// クエリ days で upcoming の範囲 (日数、デフォルト7日) を指定できます
+func GetReminders(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	days := c.QueryInt("days", 7)
+	if days < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "days must be a positive integer"})
+	}
+	now := time.Now().UTC()
+	horizon := now.AddDate(0, 0, days)
+
+	var reminderRows []models.Reminder
+	if err := database.DB.Where("user_id = ? AND next_fire_at IS NOT NULL AND next_fire_at <= ?", userID, horizon).
+		Find(&reminderRows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve reminders", "details": err.Error()})
+	}
+
+	var dueMemos []models.Memo
+	if err := database.DB.Where("user_id = ? AND due_at IS NOT NULL AND due_at <= ?", userID, horizon).
+		Find(&dueMemos).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+	}
+
+	// リマインダーのタイトル表示用にメモを引いておく
+	memoIDs := make([]string, 0, len(reminderRows))
+	for _, r := range reminderRows {
+		memoIDs = append(memoIDs, r.MemoID)
+	}
+	titles := map[string]string{}
+	if len(memoIDs) > 0 {
+		var memos []models.Memo
+		database.DB.Select("id", "title").Where("id IN ?", memoIDs).Find(&memos)
+		for _, m := range memos {
+			titles[m.ID] = m.Title
+		}
+	}
+
+	overdue := []ReminderItem{}
+	upcoming := []ReminderItem{}
+	add := func(item ReminderItem) {
+		if item.At.Before(now) {
+			overdue = append(overdue, item)
+		} else {
+			upcoming = append(upcoming, item)
+		}
+	}
+	for _, r := range reminderRows {
+		title, exists := titles[r.MemoID]
+		if !exists {
+			continue // 削除済みメモのリマインダー
+		}
+		add(ReminderItem{Type: "reminder", MemoID: r.MemoID, Title: title, ReminderID: r.ID, At: *r.NextFireAt, RRule: r.RRule, Channel: r.Channel})
+	}
+	for _, m := range dueMemos {
+		add(ReminderItem{Type: "due", MemoID: m.ID, Title: m.Title, At: *m.DueAt})
+	}
+	sort.Slice(overdue, func(i, j int) bool { return overdue[i].At.Before(overdue[j].At) })
+	sort.Slice(upcoming, func(i, j int) bool { return upcoming[i].At.Before(upcoming[j].At) })
+
+	return c.JSON(fiber.Map{"overdue": overdue, "upcoming": upcoming})
+}
+
+// DeleteReminder はリマインダーを削除します
+func DeleteReminder(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).Delete(&models.Reminder{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete reminder", "details": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Reminder not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Reminder deleted successfully"})
+}
+
+// GetNotifications はアプリ内通知を新しい順に返します。?unread=true で未読のみ
+func GetNotifications(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	var notifications []models.Notification
+	db := database.DB.Where("user_id = ?", userID)
+	if c.QueryBool("unread") {
+		db = db.Where("read_at IS NULL")
+	}
+	if err := db.Order("created_at desc").Limit(100).Find(&notifications).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve notifications", "details": err.Error()})
+	}
+	return c.JSON(notifications)
+}
+
+// MarkNotificationRead は通知を既読にします
+func MarkNotificationRead(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Params("id"), userID).
+		Update("read_at", time.Now().UTC())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update notification", "details": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found or already read"})
+	}
+	return c.JSON(fiber.Map{"message": "Notification marked as read"})
+}
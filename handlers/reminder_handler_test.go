@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestMemo はAPI経由でメモを作成し、作成されたメモを返します
+func createTestMemo(t *testing.T, token string, payload map[string]interface{}) models.Memo {
+	payloadBytes, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/memos/", bytes.NewBuffer(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+
+	body, _ := io.ReadAll(resp.Body)
+	var memo models.Memo
+	json.Unmarshal(body, &memo)
+	return memo
+}
+
+func TestReminders(t *testing.T) {
+	token := loginTestUser(t, "reminderuser", "password123")
+
+	past := time.Now().Add(-time.Hour).UTC()
+	future := time.Now().Add(24 * time.Hour).UTC()
+	overdueMemo := createTestMemo(t, token, map[string]interface{}{"title": "Overdue", "due_at": past})
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Weekly review"})
+
+	// 不正なRRULE
+	reqBad := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/memos/%s/reminders", memo.ID),
+		bytes.NewBufferString(fmt.Sprintf(`{"remind_at": "%s", "rrule": "FREQ=SOMETIMES"}`, future.Format(time.RFC3339))))
+	reqBad.Header.Set("Content-Type", "application/json")
+	reqBad.Header.Set("Authorization", "Bearer "+token)
+	respBad, _ := testApp.Test(reqBad, -1)
+	assert.Equal(t, http.StatusBadRequest, respBad.StatusCode, readResponseBody(respBad))
+
+	// ヘッダーを注入できるメールアドレスや内部アドレスへの Webhook は作成できない
+	for _, target := range []string{
+		`{"channel": "email", "target": "a@example.com\r\nBcc: b@example.com"}`,
+		`{"channel": "email", "target": "not-an-address"}`,
+		`{"channel": "webhook", "target": "http://169.254.169.254/latest/meta-data/"}`,
+		`{"channel": "webhook", "target": "http://127.0.0.1:8080/"}`,
+	} {
+		payload := map[string]interface{}{}
+		json.Unmarshal([]byte(target), &payload)
+		payload["remind_at"] = future.Format(time.RFC3339)
+		payloadBytes, _ := json.Marshal(payload)
+		reqTarget := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/memos/%s/reminders", memo.ID), bytes.NewBuffer(payloadBytes))
+		reqTarget.Header.Set("Content-Type", "application/json")
+		reqTarget.Header.Set("Authorization", "Bearer "+token)
+		respTarget, _ := testApp.Test(reqTarget, -1)
+		assert.Equal(t, http.StatusBadRequest, respTarget.StatusCode, target)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/memos/%s/reminders", memo.ID),
+		bytes.NewBufferString(fmt.Sprintf(`{"remind_at": "%s", "rrule": "FREQ=WEEKLY"}`, future.Format(time.RFC3339))))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+
+	reqList := httptest.NewRequest(http.MethodGet, "/api/reminders?days=3", nil)
+	reqList.Header.Set("Authorization", "Bearer "+token)
+	respList, _ := testApp.Test(reqList, -1)
+	assert.Equal(t, http.StatusOK, respList.StatusCode, readResponseBody(respList))
+
+	body, _ := io.ReadAll(respList.Body)
+	var result map[string][]ReminderItem
+	json.Unmarshal(body, &result)
+	assert.Len(t, result["overdue"], 1)
+	assert.Equal(t, overdueMemo.ID, result["overdue"][0].MemoID)
+	assert.Equal(t, "due", result["overdue"][0].Type)
+	assert.Len(t, result["upcoming"], 1)
+	assert.Equal(t, memo.ID, result["upcoming"][0].MemoID)
+	assert.Equal(t, "FREQ=WEEKLY", result["upcoming"][0].RRule)
+}
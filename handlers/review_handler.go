@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxRandomReviewCount = 20
+	// この日数以内に振り返ったメモはランダム表示で選ばれにくくする
+	reviewCooldownDays = 30
+	// 振り返りの予定日時を指定する場合の上限
+	maxReviewDelayDays = 3650
+)
+
+var errInvalidReviewDelay = errors.New("specify days (1-3650) or a future 'until'")
+
+// ReviewSourceInput は振り返りの対象 (ノートブックまたはタグ) と重みです
+type ReviewSourceInput struct {
+	Value  string  `json:"value"`
+	Weight float64 `json:"weight"` // 省略時は 1
+}
+
+// ReviewSettings は振り返りの対象にするノートブック (カテゴリ) とタグです。両方空ならすべての個人のメモが対象です。
+type ReviewSettings struct {
+	Categories []ReviewSourceInput `json:"categories"`
+	Tags       []ReviewSourceInput `json:"tags"`
+}
+
+// ReviewScheduleInput はスヌーズ・リマインドの日時です (days または until)
+type ReviewScheduleInput struct {
+	Days  int        `json:"days" xml:"days" form:"days"`
+	Until *time.Time `json:"until" xml:"until" form:"until"`
+}
+
+// ReviewEntry は振り返りキューの要素です
+type ReviewEntry struct {
+	models.Memo
+	ReviewDueAt  *time.Time
+	ReviewReason string
+}
+
+// reviewCandidate はランダム表示の重みの計算に使うメモの情報です
+type reviewCandidate struct {
+	ID        string
+	CreatedAt time.Time
+	Category  string
+}
+
+// loadReviewSettings はユーザーの振り返りの対象を返します
+func loadReviewSettings(userID string) (ReviewSettings, []models.ReviewSource, error) {
+	settings := ReviewSettings{Categories: []ReviewSourceInput{}, Tags: []ReviewSourceInput{}}
+	var sources []models.ReviewSource
+	if err := database.DB.Where("user_id = ?", userID).Order("kind, value").Find(&sources).Error; err != nil {
+		return settings, nil, err
+	}
+	for _, source := range sources {
+		input := ReviewSourceInput{Value: source.Value, Weight: source.Weight}
+		if source.Kind == models.ReviewSourceCategory {
+			settings.Categories = append(settings.Categories, input)
+		} else {
+			settings.Tags = append(settings.Tags, input)
+		}
+	}
+	return settings, sources, nil
+}
+
+// reviewSourceScope は振り返りの対象のノートブック・タグのいずれかに属するメモに絞り込むスコープです
+func reviewSourceScope(sources []models.ReviewSource) func(*gorm.DB) *gorm.DB {
+	var categories, tags []string
+	for _, source := range sources {
+		if source.Kind == models.ReviewSourceCategory {
+			categories = append(categories, source.Value)
+		} else {
+			tags = append(tags, source.Value)
+		}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		if len(sources) == 0 {
+			return db
+		}
+		// IN () にならないよう、空のリストは一致しない値にする
+		return db.Where("(memos.category IN ? OR EXISTS (SELECT 1 FROM memo_tags WHERE memo_tags.memo_id = memos.id AND memo_tags.tag IN ?))",
+			append(categories, "\x00"), append(tags, "\x00"))
+	}
+}
+
+// notScheduledForLater はスヌーズ中 (振り返りの予定日時が先) のメモを除くスコープです
+func notScheduledForLater(userID string, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM review_items WHERE review_items.memo_id = memos.id AND review_items.user_id = ? AND review_items.due_at > ?)", userID, now)
+	}
+}
+
+// onThisDayMemos は date (ユーザーのタイムゾーンでの日付) と同じ月日に、前の年までに作成されたメモを新しい順に返します
+func onThisDayMemos(userID, date string, loc *time.Location, sources []models.ReviewSource) ([]models.Memo, error) {
+	day, err := time.ParseInLocation(dailyDateLayout, date, loc)
+	if err != nil {
+		return nil, errInvalidDailyDate
+	}
+	base := database.DB.Scopes(personalMemos(userID), reviewSourceScope(sources))
+
+	var oldest models.Memo
+	if err := base.Session(&gorm.Session{}).Select("memos.id, memos.created_at").Order("memos.created_at asc").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, err
+	}
+	memos := []models.Memo{}
+	if oldest.ID == "" {
+		return memos, nil
+	}
+
+	// 年ごとに、その日のユーザーのタイムゾーンでの範囲を条件にする (うるう日は無い年を飛ばす)
+	query := database.DB.Where("1 = 0")
+	for year := oldest.CreatedAt.In(loc).Year(); year < day.Year(); year++ {
+		start := time.Date(year, day.Month(), day.Day(), 0, 0, 0, 0, loc)
+		if start.Month() != day.Month() {
+			continue
+		}
+		query = query.Or("memos.created_at >= ? AND memos.created_at < ?", start.UTC(), start.AddDate(0, 0, 1).UTC())
+	}
+	err = base.Session(&gorm.Session{}).Where(query).Order("memos.created_at desc").Find(&memos).Error
+	return memos, err
+}
+
+// reviewWeight はランダム表示でメモが選ばれる重みです。
+// 古いメモほど重く (作成からの日数の対数)、最近振り返ったメモは軽くなります。
+func reviewWeight(now, createdAt time.Time, sourceWeight float64, lastReviewedAt *time.Time) float64 {
+	ageDays := math.Max(now.Sub(createdAt).Hours()/24, 0)
+	weight := (1 + math.Log1p(ageDays)) * sourceWeight
+	if lastReviewedAt != nil {
+		sinceDays := now.Sub(*lastReviewedAt).Hours() / 24
+		if sinceDays < reviewCooldownDays {
+			weight *= math.Max(sinceDays/reviewCooldownDays, 0.05)
+		}
+	}
+	return weight
+}
+
+// randomReviewMemos は振り返りの対象のメモから、重みに応じて最大 count 件を重複なしで選びます
+func randomReviewMemos(userID string, count int, now time.Time, sources []models.ReviewSource, rng *rand.Rand) ([]models.Memo, error) {
+	var candidates []reviewCandidate
+	err := database.DB.Model(&models.Memo{}).
+		Scopes(personalMemos(userID), reviewSourceScope(sources), notScheduledForLater(userID, now)).
+		Select("memos.id, memos.created_at, memos.category").
+		Scan(&candidates).Error
+	if err != nil || len(candidates) == 0 {
+		return []models.Memo{}, err
+	}
+
+	// ノートブック・タグごとの重み (メモが複数に一致する場合は最大の重みを使う)
+	categoryWeights := map[string]float64{}
+	tagWeights := map[string]float64{}
+	var tags []string
+	for _, source := range sources {
+		if source.Kind == models.ReviewSourceCategory {
+			categoryWeights[source.Value] = source.Weight
+		} else {
+			tagWeights[source.Value] = source.Weight
+			tags = append(tags, source.Value)
+		}
+	}
+	memoTags := map[string][]string{}
+	if len(tags) > 0 {
+		var rows []models.MemoTag
+		if err := database.DB.Where("user_id = ? AND tag IN ?", userID, tags).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			memoTags[row.MemoID] = append(memoTags[row.MemoID], row.Tag)
+		}
+	}
+	var items []models.ReviewItem
+	if err := database.DB.Where("user_id = ? AND last_reviewed_at IS NOT NULL", userID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	lastReviewed := map[string]*time.Time{}
+	for _, item := range items {
+		lastReviewed[item.MemoID] = item.LastReviewedAt
+	}
+
+	// 重み付きの非復元抽出 (Efraimidis-Spirakis): u^(1/w) の大きい順に選ぶ
+	type keyed struct {
+		id  string
+		key float64
+	}
+	keys := make([]keyed, 0, len(candidates))
+	for _, candidate := range candidates {
+		sourceWeight := 1.0
+		if len(sources) > 0 {
+			sourceWeight = categoryWeights[candidate.Category]
+			for _, tag := range memoTags[candidate.ID] {
+				sourceWeight = math.Max(sourceWeight, tagWeights[tag])
+			}
+		}
+		weight := reviewWeight(now, candidate.CreatedAt, sourceWeight, lastReviewed[candidate.ID])
+		if weight <= 0 {
+			continue
+		}
+		keys = append(keys, keyed{id: candidate.ID, key: math.Pow(rng.Float64(), 1/weight)})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key > keys[j].key })
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.id
+	}
+
+	var found []models.Memo
+	if err := database.DB.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Memo, len(found))
+	for _, memo := range found {
+		byID[memo.ID] = memo
+	}
+	memos := make([]models.Memo, 0, len(ids))
+	for _, id := range ids {
+		if memo, ok := byID[id]; ok {
+			memos = append(memos, memo)
+		}
+	}
+	return memos, nil
+}
+
+// reviewQueue は振り返りの予定日時を過ぎたメモを予定日時の古い順に返します
+func reviewQueue(userID string, now time.Time) ([]ReviewEntry, error) {
+	var items []models.ReviewItem
+	if err := database.DB.Where("user_id = ? AND due_at IS NOT NULL AND due_at <= ?", userID, now).Order("due_at asc").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	entries := []ReviewEntry{}
+	if len(items) == 0 {
+		return entries, nil
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.MemoID
+	}
+	// 共有が解除されたメモなど、閲覧できなくなったメモは除く
+	var memos []models.Memo
+	if err := database.DB.Scopes(accessibleMemos(userID)).Where("memos.id IN ?", ids).Find(&memos).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Memo, len(memos))
+	for _, memo := range memos {
+		byID[memo.ID] = memo
+	}
+	for _, item := range items {
+		if memo, ok := byID[item.MemoID]; ok {
+			entries = append(entries, ReviewEntry{Memo: memo, ReviewDueAt: item.DueAt, ReviewReason: item.Reason})
+		}
+	}
+	return entries, nil
+}
+
+// reviewDueAt はスヌーズ・リマインドの入力から振り返りの予定日時を求めます (days の省略時は defaultDays)
+func reviewDueAt(input *ReviewScheduleInput, now time.Time, defaultDays int) (time.Time, error) {
+	if input.Until != nil {
+		if !input.Until.After(now) || input.Until.After(now.AddDate(0, 0, maxReviewDelayDays)) {
+			return time.Time{}, errInvalidReviewDelay
+		}
+		return input.Until.UTC(), nil
+	}
+	days := input.Days
+	if days == 0 {
+		days = defaultDays
+	}
+	if days < 1 || days > maxReviewDelayDays {
+		return time.Time{}, errInvalidReviewDelay
+	}
+	return now.AddDate(0, 0, days), nil
+}
+
+// updateReviewItem はユーザーのメモの振り返りの状態を作成または更新します
+func updateReviewItem(userID, memoID string, updates map[string]interface{}) (*models.ReviewItem, error) {
+	var item models.ReviewItem
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		created := models.ReviewItem{ID: utils.GenerateID(), UserID: userID, MemoID: memoID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&created).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ReviewItem{}).Where("user_id = ? AND memo_id = ?", userID, memoID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND memo_id = ?", userID, memoID).First(&item).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// scheduleReview はメモを予定日時に振り返りキューに入れます (それまではランダム表示の対象外)
+func scheduleReview(userID, memoID string, dueAt time.Time, reason string) (*models.ReviewItem, error) {
+	return updateReviewItem(userID, memoID, map[string]interface{}{"due_at": dueAt, "reason": reason})
+}
+
+// markReviewed はメモを振り返り済みにし、キューから外します
+func markReviewed(userID, memoID string, now time.Time) (*models.ReviewItem, error) {
+	return updateReviewItem(userID, memoID, map[string]interface{}{"due_at": nil, "reason": "", "last_reviewed_at": now})
+}
+
+// GetReviewSettings は振り返りの対象にするノートブック (カテゴリ) とタグを返します
+func GetReviewSettings(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	settings, _, err := loadReviewSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve review settings", "details": err.Error()})
+	}
+	return c.JSON(settings)
+}
+
+// UpdateReviewSettings は振り返りの対象を置き換えます (両方空にするとすべての個人のメモが対象)
+func UpdateReviewSettings(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(ReviewSettings)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	rows := map[[2]string]models.ReviewSource{}
+	for kind, sources := range map[string][]ReviewSourceInput{models.ReviewSourceCategory: input.Categories, models.ReviewSourceTag: input.Tags} {
+		for _, source := range sources {
+			value := source.Value
+			if kind == models.ReviewSourceTag {
+				value = utils.NormalizeTag(value)
+			}
+			if value == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Review " + kind + " value is required"})
+			}
+			weight := source.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			if weight < 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Review weight must be positive"})
+			}
+			rows[[2]string{kind, value}] = models.ReviewSource{UserID: userID, Kind: kind, Value: value, Weight: weight}
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ReviewSource{}).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update review settings", "details": err.Error()})
+	}
+	settings, _, err := loadReviewSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve review settings", "details": err.Error()})
+	}
+	return c.JSON(settings)
+}
+
+// GetOnThisDay は過去の同じ日 (?date=today / YYYY-MM-DD、ユーザーのタイムゾーン) に作成したメモを返します
+func GetOnThisDay(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	user, err := findUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	loc := userLocation(*user)
+	date, err := resolveDailyDate(c.Query("date", "today"), loc)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	_, sources, err := loadReviewSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve review settings", "details": err.Error()})
+	}
+	memos, err := onThisDayMemos(userID, date, loc, sources)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+	}
+	for i := range memos {
+		prepareMemoResponse(c, userID, &memos[i])
+	}
+	return c.JSON(fiber.Map{"date": date, "memos": memos})
+}
+
+// GetRandomReview は振り返りの対象から古いメモほど選ばれやすい重みでランダムにメモを返します (?count=N、最大20)
+func GetRandomReview(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	count, err := strconv.Atoi(c.Query("count", "1"))
+	if err != nil || count < 1 || count > maxRandomReviewCount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "count must be between 1 and " + strconv.Itoa(maxRandomReviewCount)})
+	}
+	_, sources, err := loadReviewSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve review settings", "details": err.Error()})
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	memos, err := randomReviewMemos(userID, count, time.Now().UTC(), sources, rng)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memos", "details": err.Error()})
+	}
+	for i := range memos {
+		prepareMemoResponse(c, userID, &memos[i])
+	}
+	return c.JSON(memos)
+}
+
+// GetReviewQueue はスヌーズ・リマインドの予定日時を過ぎたメモを返します
+func GetReviewQueue(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	entries, err := reviewQueue(userID, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve review queue", "details": err.Error()})
+	}
+	for i := range entries {
+		prepareMemoResponse(c, userID, &entries[i].Memo)
+	}
+	return c.JSON(entries)
+}
+
+// scheduleReviewHandler はスヌーズ・リマインドのハンドラーの共通処理です
+func scheduleReviewHandler(c *fiber.Ctx, reason string, defaultDays int) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(ReviewScheduleInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+		}
+	}
+	memo, _, err := findMemoWithRole(userID, c.Params("id"), models.RoleViewer)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	dueAt, err := reviewDueAt(input, time.Now().UTC(), defaultDays)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	item, err := scheduleReview(userID, memo.ID, dueAt, reason)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not schedule review", "details": err.Error()})
+	}
+	return c.JSON(item)
+}
+
+// SnoozeReview はメモをスヌーズし、指定した日数 (デフォルト1日) 後に振り返りキューに入れます
+func SnoozeReview(c *fiber.Ctx) error {
+	return scheduleReviewHandler(c, "snooze", 1)
+}
+
+// RemindReview は「N日後に通知」として、指定した日数後にメモを振り返りキューに入れます (days または until が必要)
+func RemindReview(c *fiber.Ctx) error {
+	return scheduleReviewHandler(c, "remind", 0)
+}
+
+// MarkReviewed はメモを振り返り済みにし、キューから外します
+func MarkReviewed(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	memo, _, err := findMemoWithRole(userID, c.Params("id"), models.RoleViewer)
+	if err != nil {
+		return memoAccessErrorResponse(c, err)
+	}
+	item, err := markReviewed(userID, memo.ID, time.Now().UTC())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update review", "details": err.Error()})
+	}
+	return c.JSON(item)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func backdateMemo(memoID string, createdAt time.Time) {
+	testDB.Model(&models.Memo{}).Where("id = ?", memoID).UpdateColumn("created_at", createdAt)
+}
+
+func getReviewMemos(t *testing.T, token, path string) []models.Memo {
+	resp := memoRequest(t, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var memos []models.Memo
+	json.NewDecoder(resp.Body).Decode(&memos)
+	return memos
+}
+
+func TestOnThisDay(t *testing.T) {
+	token := loginTestUser(t, "onthisday", "password123")
+	lastYear := createTestMemo(t, token, map[string]interface{}{"title": "Last year"})
+	twoYears := createTestMemo(t, token, map[string]interface{}{"title": "Two years ago"})
+	otherDay := createTestMemo(t, token, map[string]interface{}{"title": "Other day"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Today"})
+	backdateMemo(lastYear.ID, time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC))
+	backdateMemo(twoYears.ID, time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC))
+	backdateMemo(otherDay.ID, time.Date(2025, 3, 11, 8, 0, 0, 0, time.UTC))
+
+	resp := memoRequest(t, http.MethodGet, "/api/review/on-this-day?date=2026-03-10", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var result struct {
+		Date  string        `json:"date"`
+		Memos []models.Memo `json:"memos"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Equal(t, "2026-03-10", result.Date)
+	if assert.Len(t, result.Memos, 2) {
+		assert.Equal(t, lastYear.ID, result.Memos[0].ID)
+		assert.Equal(t, twoYears.ID, result.Memos[1].ID)
+	}
+
+	// ユーザーのタイムゾーンで日付を判定する (UTC 23:00 は東京では翌日)
+	resp = memoRequest(t, http.MethodPut, "/api/users/me", token, map[string]interface{}{"time_zone": "Asia/Tokyo"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/review/on-this-day?date=2026-03-11", token, nil)
+	json.NewDecoder(resp.Body).Decode(&result)
+	assert.Len(t, result.Memos, 2)
+
+	resp = memoRequest(t, http.MethodGet, "/api/review/on-this-day?date=march", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestReviewSnoozeRemindAndQueue(t *testing.T) {
+	token := loginTestUser(t, "reviewqueue", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Old idea"})
+	other := createTestMemo(t, token, map[string]interface{}{"title": "Another"})
+
+	// スヌーズ中のメモはランダム表示に出ない
+	resp := memoRequest(t, http.MethodPost, "/api/review/memos/"+memo.ID+"/snooze", token, map[string]interface{}{"days": 3})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	for i := 0; i < 5; i++ {
+		random := getReviewMemos(t, token, "/api/review/random?count=5")
+		if assert.Len(t, random, 1) {
+			assert.Equal(t, other.ID, random[0].ID)
+		}
+	}
+	assert.Empty(t, getReviewMemos(t, token, "/api/review/queue"))
+
+	// 予定日時を過ぎるとキューに入る
+	testDB.Model(&models.ReviewItem{}).Where("memo_id = ?", memo.ID).UpdateColumn("due_at", time.Now().Add(-time.Minute).UTC())
+	resp = memoRequest(t, http.MethodGet, "/api/review/queue", token, nil)
+	var queue []ReviewEntry
+	json.NewDecoder(resp.Body).Decode(&queue)
+	if assert.Len(t, queue, 1) {
+		assert.Equal(t, memo.ID, queue[0].ID)
+		assert.Equal(t, "snooze", queue[0].ReviewReason)
+	}
+
+	// 振り返り済みにするとキューから外れる
+	resp = memoRequest(t, http.MethodPost, "/api/review/memos/"+memo.ID+"/reviewed", token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	assert.Empty(t, getReviewMemos(t, token, "/api/review/queue"))
+
+	// N日後に通知は日数が必要
+	resp = memoRequest(t, http.MethodPost, "/api/review/memos/"+other.ID+"/remind", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, "/api/review/memos/"+other.ID+"/remind", token, map[string]interface{}{"days": 30})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var item models.ReviewItem
+	json.NewDecoder(resp.Body).Decode(&item)
+	assert.Equal(t, "remind", item.Reason)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 30), *item.DueAt, time.Minute)
+
+	// 振り返りページ
+	userID, _ := auth.ParseJWT(token)
+	resp, body := getSharePage(t, "/review", webSession(t, userID))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "振り返りキュー")
+
+	otherToken := loginAdditionalTestUser(t, "reviewstranger", "password123")
+	resp = memoRequest(t, http.MethodPost, "/api/review/memos/"+memo.ID+"/snooze", otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestReviewSettingsLimitSources(t *testing.T) {
+	token := loginTestUser(t, "reviewsettings", "password123")
+	work := createTestMemo(t, token, map[string]interface{}{"title": "Work", "category": "work"})
+	idea := createTestMemo(t, token, map[string]interface{}{"title": "Idea", "content": "#Idea for later"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Diary", "category": "diary"})
+
+	resp := memoRequest(t, http.MethodPut, "/api/review/settings", token, map[string]interface{}{
+		"categories": []map[string]interface{}{{"value": "work", "weight": 2}},
+		"tags":       []map[string]interface{}{{"value": "#idea"}},
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var settings ReviewSettings
+	json.NewDecoder(resp.Body).Decode(&settings)
+	if assert.Len(t, settings.Tags, 1) {
+		assert.Equal(t, "idea", settings.Tags[0].Value)
+		assert.Equal(t, 1.0, settings.Tags[0].Weight)
+	}
+
+	random := getReviewMemos(t, token, "/api/review/random?count=10")
+	ids := []string{}
+	for _, memo := range random {
+		ids = append(ids, memo.ID)
+	}
+	assert.ElementsMatch(t, []string{work.ID, idea.ID}, ids)
+
+	resp = memoRequest(t, http.MethodGet, "/api/review/random?count=0", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestReviewWeightPrefersOldMemos(t *testing.T) {
+	now := time.Now()
+	recent := reviewWeight(now, now.AddDate(0, 0, -1), 1, nil)
+	old := reviewWeight(now, now.AddDate(-1, 0, 0), 1, nil)
+	assert.Greater(t, old, recent)
+	assert.Greater(t, reviewWeight(now, now.AddDate(-1, 0, 0), 3, nil), old)
+
+	reviewedYesterday := now.AddDate(0, 0, -1)
+	assert.Less(t, reviewWeight(now, now.AddDate(-1, 0, 0), 1, &reviewedYesterday), old)
+
+	// 重みの大きいメモの方が多く選ばれる
+	token := loginTestUser(t, "reviewweight", "password123")
+	oldMemo := createTestMemo(t, token, map[string]interface{}{"title": "Old"})
+	createTestMemo(t, token, map[string]interface{}{"title": "New"})
+	backdateMemo(oldMemo.ID, now.AddDate(-3, 0, 0))
+	userID := oldMemo.UserID
+	rng := rand.New(rand.NewSource(1))
+	picks := 0
+	for i := 0; i < 200; i++ {
+		memos, err := randomReviewMemos(userID, 1, now.UTC(), nil, rng)
+		assert.NoError(t, err)
+		if len(memos) == 1 && memos[0].ID == oldMemo.ID {
+			picks++
+		}
+	}
+	assert.Greater(t, picks, 120)
+}
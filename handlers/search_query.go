@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/linkalls/fast-memos/atrest"
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"gorm.io/gorm"
+)
+
+// 全文検索の索引を使う場合の並び順 (bm25、タイトル・カテゴリの一致を本文より重視)
+const fullTextRankOrder = "bm25(memos_fts, 0.0, 10.0, 1.0, 2.0), memos.created_at desc"
+
+// related:<id> の条件 (<id> のメモが関連付けたメモ、または <id> を関連付けたメモ)
+const relatedMemoSQL = `((',' || (SELECT related.related_memo_ids FROM memos AS related WHERE related.id = ? AND related.deleted_at IS NULL) || ',') LIKE ('%,' || memos.id || ',%') OR (',' || memos.related_memo_ids || ',') LIKE ?)`
+
+// searchCompiler は検索クエリ (utils.SearchQuery) を memos に対する SQL の条件に変換します
+type searchCompiler struct {
+	userID       string
+	base         func(*gorm.DB) *gorm.DB // 検索できるメモの範囲
+	withCategory bool
+	location     *time.Location
+	candidates   []models.Memo // 保存時の暗号化が有効で検索用インデックスで絞れない語を確認するメモ (範囲内のすべて)
+	loaded       bool
+}
+
+// searchCondition は SQL の条件とその引数です
+type searchCondition struct {
+	sql  string
+	args []interface{}
+}
+
+// MemoSearchScope は検索クエリ q (構文は utils.ParseSearchQuery) に一致するメモに絞り込むスコープと並び順を返します。
+// base は検索できるメモの範囲のスコープで、返すスコープと一緒に適用してください。withCategory なら語でカテゴリも検索します。
+// 語は全角・半角、大文字小文字、カタカナとひらがな、長音符の有無の違いを区別しません (utils.NormalizeSearchText)。
+// FTS5 が使える場合は全文検索の索引 (memos_fts) で検索し、OR や - を含まない語があれば関連度の高い順、それ以外は新しい順に並べます。
+// FTS5 が使えない場合は、語に一致するメモを SQL で絞った候補 (保存時の暗号化が有効なら検索用インデックスで絞った候補) を確認して求めます。
+// 構文が正しくなければ *utils.SearchQueryError を返します。
+func MemoSearchScope(userID, q string, base func(*gorm.DB) *gorm.DB, withCategory bool) (func(*gorm.DB) *gorm.DB, string, error) {
+	query, err := utils.ParseSearchQuery(q)
+	if err != nil {
+		return nil, "", err
+	}
+	compiler := &searchCompiler{userID: userID, base: base, withCategory: withCategory}
+
+	var conditions []searchCondition
+	var ranked []string // 全文検索の索引で絞り込んで関連度に使う条件 (否定を含まない語だけの OR)
+	for _, clause := range query.Clauses {
+		if fullTextSearchEnabled() && positiveKeywords(clause) {
+			var matches []string
+			for _, term := range clause {
+				if match, ok := fullTextQuery(term.Value, withCategory); ok {
+					matches = append(matches, match)
+				}
+			}
+			if len(matches) == 0 {
+				conditions = append(conditions, searchCondition{sql: "1 = 0"})
+				continue
+			}
+			ranked = append(ranked, "("+strings.Join(matches, " OR ")+")")
+			continue
+		}
+
+		var sqls []string
+		var args []interface{}
+		for _, term := range clause {
+			condition, err := compiler.termCondition(term)
+			if err != nil {
+				return nil, "", err
+			}
+			sqls = append(sqls, condition.sql)
+			args = append(args, condition.args...)
+		}
+		conditions = append(conditions, searchCondition{sql: "(" + strings.Join(sqls, " OR ") + ")", args: args})
+	}
+
+	order := "memos.created_at desc"
+	if len(ranked) > 0 {
+		order = fullTextRankOrder
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		if len(ranked) > 0 {
+			db = db.Joins("JOIN memos_fts ON memos_fts.memo_id = memos.id").Where("memos_fts MATCH ?", strings.Join(ranked, " AND "))
+		}
+		for _, condition := range conditions {
+			db = db.Where(condition.sql, condition.args...)
+		}
+		return db
+	}, order, nil
+}
+
+// positiveKeywords は条件がすべて否定の無い語かどうかを返します
+func positiveKeywords(clause []utils.SearchTerm) bool {
+	for _, term := range clause {
+		if term.Field != "" || term.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+// termCondition は1つの条件を SQL の条件に変換します
+func (c *searchCompiler) termCondition(term utils.SearchTerm) (searchCondition, error) {
+	condition, err := c.fieldCondition(term)
+	if err != nil {
+		return condition, err
+	}
+	if term.Negated {
+		condition.sql = "NOT (" + condition.sql + ")"
+	}
+	return condition, nil
+}
+
+func (c *searchCompiler) fieldCondition(term utils.SearchTerm) (searchCondition, error) {
+	switch term.Field {
+	case utils.SearchFieldCategory:
+		return searchCondition{sql: "lower(memos.category) = lower(?)", args: []interface{}{term.Value}}, nil
+	case utils.SearchFieldTag:
+		return searchCondition{
+			sql:  "EXISTS (SELECT 1 FROM memo_tags WHERE memo_tags.memo_id = memos.id AND memo_tags.tag = ?)",
+			args: []interface{}{term.Value},
+		}, nil
+	case utils.SearchFieldBefore, utils.SearchFieldAfter:
+		loc, err := c.userLocation()
+		if err != nil {
+			return searchCondition{}, err
+		}
+		// 日付はユーザーのタイムゾーンで数え、その日を含めない
+		day, _ := time.ParseInLocation(utils.SearchDateLayout, term.Value, loc)
+		if term.Field == utils.SearchFieldBefore {
+			return searchCondition{sql: "memos.created_at < ?", args: []interface{}{day.UTC()}}, nil
+		}
+		return searchCondition{sql: "memos.created_at >= ?", args: []interface{}{day.AddDate(0, 0, 1).UTC()}}, nil
+	case utils.SearchFieldIs:
+		// ピン留め・アーカイブは front matter のプロパティ (pinned: true / archived: true) で表す
+		sql, args, err := propertyFilterCondition(utils.PropertyFilter{Key: term.Value, Op: "=", Value: "true"})
+		return searchCondition{sql: sql, args: args}, err
+	case utils.SearchFieldHas:
+		return searchCondition{sql: "EXISTS (SELECT 1 FROM attachments WHERE attachments.memo_id = memos.id)"}, nil
+	case utils.SearchFieldRelated:
+		return searchCondition{sql: relatedMemoSQL, args: []interface{}{term.Value, "%," + term.Value + ",%"}}, nil
+	}
+	return c.keywordCondition(term.Value)
+}
+
+// keywordCondition は語を含むメモの条件です
+func (c *searchCompiler) keywordCondition(keyword string) (searchCondition, error) {
+	if fullTextSearchEnabled() {
+		match, ok := fullTextQuery(keyword, c.withCategory)
+		if !ok {
+			return searchCondition{sql: "1 = 0"}, nil
+		}
+		return searchCondition{sql: "memos.id IN (SELECT memo_id FROM memos_fts WHERE memos_fts MATCH ?)", args: []interface{}{match}}, nil
+	}
+	ids, err := c.keywordMatches(keyword)
+	if err != nil {
+		return searchCondition{}, err
+	}
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return searchCondition{}, err
+	}
+	return searchCondition{sql: "memos.id IN (SELECT value FROM json_each(?))", args: []interface{}{string(encoded)}}, nil
+}
+
+// keywordMatches は範囲内のメモのうち、(復号した) タイトル・本文・カテゴリを正規化したものが語を含むメモのIDを返します。
+// 候補は SQL で正規化した文字列の LIKE で絞ります。保存時の暗号化が有効な場合は検索用インデックスで絞ります
+// (1文字の語は絞れないのですべて確認する)。
+func (c *searchCompiler) keywordMatches(keyword string) ([]string, error) {
+	memos, err := c.keywordCandidates(keyword)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, memo := range memos {
+		if utils.MatchSearchText(memo.Title, keyword) ||
+			(!memo.Encrypted && utils.MatchSearchText(memo.Content, keyword)) ||
+			(c.withCategory && utils.MatchSearchText(memo.Category, keyword)) {
+			ids = append(ids, memo.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (c *searchCompiler) keywordCandidates(keyword string) ([]models.Memo, error) {
+	db := database.DB.Model(&models.Memo{}).
+		Select("memos.id", "memos.title", "memos.content", "memos.category", "memos.encrypted").
+		Scopes(c.base)
+	if atrest.Current == nil {
+		// 正規化した語は文字と数字と空白だけなので LIKE のワイルドカードを含まない
+		normalized := utils.NormalizeSearchText(keyword)
+		if normalized == "" {
+			return nil, nil
+		}
+		pattern := "%" + normalized + "%"
+		condition := "search_normalize(memos.title) LIKE ? OR (memos.encrypted = ? AND search_normalize(memos.content) LIKE ?)"
+		args := []interface{}{pattern, false, pattern}
+		if c.withCategory {
+			condition, args = condition+" OR search_normalize(memos.category) LIKE ?", append(args, pattern)
+		}
+		var memos []models.Memo
+		err := db.Where("("+condition+")", args...).Find(&memos).Error
+		return memos, err
+	}
+	if condition, args, ok := atrest.Current.SearchCondition(keyword); ok {
+		if c.withCategory {
+			// カテゴリは平文なので LIKE で候補に含める
+			condition, args = "("+condition+" OR lower(memos.category) LIKE lower(?))", append(args, "%"+keyword+"%")
+		}
+		var memos []models.Memo
+		err := db.Where(condition, args...).Find(&memos).Error
+		return memos, err
+	}
+	if !c.loaded {
+		if err := db.Find(&c.candidates).Error; err != nil {
+			return nil, err
+		}
+		c.loaded = true
+	}
+	return c.candidates, nil
+}
+
+// userLocation は before: / after: の日付を数える検索したユーザーのタイムゾーンです
+func (c *searchCompiler) userLocation() (*time.Location, error) {
+	if c.location == nil {
+		user, err := findUser(c.userID)
+		if err != nil {
+			return nil, err
+		}
+		c.location = userLocation(*user)
+	}
+	return c.location, nil
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CreateShareInput struct {
+	ExpiresAt *time.Time `json:"expires_at" xml:"expires_at" form:"expires_at"`
+	Password  string     `json:"password" xml:"password" form:"password"`
+	MaxViews  int        `json:"max_views" xml:"max_views" form:"max_views"`
+}
+
+// ShareResponse は共有リンクのレスポンスです (URL とパスワード有無を含む)
+type ShareResponse struct {
+	models.Share
+	URL         string
+	HasPassword bool
+	Active      bool
+}
+
+func newShareResponse(share models.Share) ShareResponse {
+	return ShareResponse{
+		Share:       share,
+		URL:         "/s/" + share.Token,
+		HasPassword: share.HasPassword(),
+		Active:      shareUnavailableReason(share, time.Now()) == nil,
+	}
+}
+
+var (
+	errShareNotFound  = errors.New("share link not found")
+	errShareRevoked   = errors.New("share link has been revoked")
+	errShareExpired   = errors.New("share link has expired")
+	errShareViewLimit = errors.New("share link has reached its view limit")
+	errShareEncrypted = errors.New("encrypted memos cannot be shared by link")
+)
+
+// shareUnavailableReason は共有リンクが使えない理由を返します。使える場合は nil です。
+func shareUnavailableReason(share models.Share, now time.Time) error {
+	if share.RevokedAt != nil {
+		return errShareRevoked
+	}
+	if share.ExpiresAt != nil && !now.Before(*share.ExpiresAt) {
+		return errShareExpired
+	}
+	if share.MaxViews > 0 && share.ViewCount >= share.MaxViews {
+		return errShareViewLimit
+	}
+	return nil
+}
+
+// findActiveShare はトークンから有効な共有リンクと対象のメモを取得します
+func findActiveShare(token string) (*models.Share, *models.Memo, error) {
+	var share models.Share
+	if err := database.DB.Where("token = ?", token).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errShareNotFound
+		}
+		return nil, nil, err
+	}
+	if err := shareUnavailableReason(share, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	var memo models.Memo
+	if err := database.DB.Where("id = ? AND user_id = ?", share.MemoID, share.UserID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errShareNotFound
+		}
+		return nil, nil, err
+	}
+	// 共有リンクを作った後で暗号化されたメモは、暗号文を見せないよう無いものとして扱う
+	if memo.Encrypted {
+		return nil, nil, errShareNotFound
+	}
+	return &share, &memo, nil
+}
+
+// recordShareView は閲覧数を1増やします。閲覧数の上限に達している場合は errShareViewLimit を返します。
+// 同時アクセスでも上限を超えないよう、条件付きの UPDATE で加算します。
+func recordShareView(share *models.Share) error {
+	now := time.Now()
+	result := database.DB.Model(&models.Share{}).
+		Where("id = ? AND (max_views = 0 OR view_count < max_views)", share.ID).
+		Updates(map[string]interface{}{
+			"view_count":       gorm.Expr("view_count + 1"),
+			"last_accessed_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errShareViewLimit
+	}
+	share.ViewCount++
+	share.LastAccessedAt = &now
+	return nil
+}
+
+// shareUnlockValue はパスワード付き共有リンクの解除済みCookieの値です。
+// トークンとパスワードハッシュの両方から作るため、パスワードを知らない人は作れません。
+func shareUnlockValue(share models.Share) string {
+	sum := sha256.Sum256([]byte(share.Token + ":" + share.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+func shareUnlockCookieName(share models.Share) string {
+	return "share_" + share.ID
+}
+
+// CreateShare はメモの共有リンクを作成します
+func CreateShare(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateShareInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+		}
+	}
+	if input.MaxViews < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_views must not be negative"})
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_at must be in the future"})
+	}
+
+	var memo models.Memo
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&memo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Memo not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve memo", "details": err.Error()})
+	}
+	// 閲覧者は鍵を持たないので、エンドツーエンド暗号化されたメモは共有リンクで見せられない
+	if memo.Encrypted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errShareEncrypted.Error()})
+	}
+
+	share := models.Share{
+		ID:        utils.GenerateID(),
+		MemoID:    memo.ID,
+		UserID:    userID,
+		Token:     utils.GenerateToken(),
+		ExpiresAt: input.ExpiresAt,
+		MaxViews:  input.MaxViews,
+	}
+	if input.Password != "" {
+		hash, err := auth.HashPassword(input.Password)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not hash password", "details": err.Error()})
+		}
+		share.PasswordHash = hash
+	}
+
+	if err := database.DB.Create(&share).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create share link", "details": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(newShareResponse(share))
+}
+
+// GetShares はユーザーの共有リンク一覧を返します。/api/memos/:id/shares の場合はそのメモのもののみ
+func GetShares(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	db := database.DB.Where("user_id = ?", userID)
+	if memoID := c.Params("id"); memoID != "" {
+		db = db.Where("memo_id = ?", memoID)
+	}
+	var shares []models.Share
+	if err := db.Order("created_at desc").Find(&shares).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve share links", "details": err.Error()})
+	}
+
+	responses := make([]ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		responses = append(responses, newShareResponse(share))
+	}
+	return c.JSON(responses)
+}
+
+// RevokeShare は共有リンクを無効にします
+func RevokeShare(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	result := database.DB.Model(&models.Share{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke share link", "details": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share link not found or already revoked"})
+	}
+	return c.JSON(fiber.Map{"message": "Share link revoked successfully"})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestShare(t *testing.T, token, memoID string, payload map[string]interface{}) ShareResponse {
+	payloadBytes, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/api/memos/"+memoID+"/shares", bytes.NewBuffer(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	body, _ := io.ReadAll(resp.Body)
+	var share ShareResponse
+	json.Unmarshal(body, &share)
+	return share
+}
+
+// webSession は userID でログインした Web UI のセッション Cookie を返します
+func webSession(t *testing.T, userID string) *http.Cookie {
+	token, _, err := auth.GenerateSessionToken(userID)
+	assert.NoError(t, err)
+	return &http.Cookie{Name: "user_id", Value: token}
+}
+
+func getSharePage(t *testing.T, shareURL string, cookies ...*http.Cookie) (*http.Response, string) {
+	req := httptest.NewRequest(http.MethodGet, shareURL, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestShareLinkViewLimitAndRevoke(t *testing.T) {
+	token := loginTestUser(t, "shareuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Shared", "content": "**public** content"})
+
+	share := createTestShare(t, token, memo.ID, map[string]interface{}{"max_views": 1})
+	assert.True(t, strings.HasPrefix(share.URL, "/s/"))
+	assert.GreaterOrEqual(t, len(share.Token), 40)
+	assert.False(t, share.HasPassword)
+
+	resp, body := getSharePage(t, share.URL)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "<strong>public</strong>")
+	assert.NotContains(t, body, "/edit") // 読み取り専用
+
+	// 閲覧回数の上限
+	resp, _ = getSharePage(t, share.URL)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	// 一覧に閲覧回数が記録されている
+	reqList := httptest.NewRequest(http.MethodGet, "/api/memos/"+memo.ID+"/shares", nil)
+	reqList.Header.Set("Authorization", "Bearer "+token)
+	respList, _ := testApp.Test(reqList, -1)
+	listBody, _ := io.ReadAll(respList.Body)
+	var shares []ShareResponse
+	json.Unmarshal(listBody, &shares)
+	assert.Len(t, shares, 1)
+	assert.Equal(t, 1, shares[0].ViewCount)
+	assert.False(t, shares[0].Active)
+
+	// 取り消し
+	other := createTestShare(t, token, memo.ID, map[string]interface{}{"expires_at": time.Now().Add(time.Hour)})
+	reqRevoke := httptest.NewRequest(http.MethodDelete, "/api/shares/"+other.ID, nil)
+	reqRevoke.Header.Set("Authorization", "Bearer "+token)
+	respRevoke, _ := testApp.Test(reqRevoke, -1)
+	assert.Equal(t, http.StatusOK, respRevoke.StatusCode, readResponseBody(respRevoke))
+	resp, _ = getSharePage(t, other.URL)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp, _ = getSharePage(t, "/s/does-not-exist")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestShareLinkPassword(t *testing.T) {
+	token := loginTestUser(t, "sharepwuser", "password123")
+	memo := createTestMemo(t, token, map[string]interface{}{"title": "Secret", "content": "secret content"})
+	share := createTestShare(t, token, memo.ID, map[string]interface{}{"password": "letmein"})
+	assert.True(t, share.HasPassword)
+
+	resp, body := getSharePage(t, share.URL)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, body, "secret content")
+	assert.Contains(t, body, `type="password"`)
+
+	postPassword := func(password string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, share.URL, strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := testApp.Test(req, -1)
+		assert.NoError(t, err)
+		return resp
+	}
+	assert.Equal(t, http.StatusUnauthorized, postPassword("wrong").StatusCode)
+
+	respOK := postPassword("letmein")
+	assert.Equal(t, http.StatusFound, respOK.StatusCode)
+	resp, body = getSharePage(t, share.URL, respOK.Cookies()...)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "secret content")
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// 活動のヒートマップのデフォルトの日数 (今日を含む)
+	defaultActivityDays = 365
+	// 1回で取得できる活動の日数の上限
+	maxActivityDays = 366 * 3
+)
+
+// StatsTotals はメモの合計です
+type StatsTotals struct {
+	Memos      int64 `json:"memos"`
+	Words      int64 `json:"words"`
+	Characters int64 `json:"characters"`
+	Tags       int64 `json:"tags"`        // タグの種類の数
+	ActiveDays int64 `json:"active_days"` // メモを作成・編集した日数
+}
+
+// NamedCount はカテゴリ・タグごとのメモの数です
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// Streak は連続してメモを作成 (または編集) した日数です
+type Streak struct {
+	Current  int    `json:"current"`   // 今日 (今日がまだなら昨日) まで続いている日数
+	Longest  int    `json:"longest"`   // これまでで最長の日数
+	LastDate string `json:"last_date"` // 最後に作成 (編集) した日
+}
+
+// StatsStreaks は作成と編集の連続記録です
+type StatsStreaks struct {
+	Creation Streak `json:"creation"`
+	Edit     Streak `json:"edit"`
+}
+
+// ActivityPoint は活動のヒートマップの1日分です
+type ActivityPoint struct {
+	Date    string `json:"date"`
+	Created int    `json:"created"`
+	Edited  int    `json:"edited"`
+}
+
+// StatsResponse は GET /stats のレスポンスです
+type StatsResponse struct {
+	Totals     StatsTotals     `json:"totals"`
+	Categories []NamedCount    `json:"categories"`
+	Tags       []NamedCount    `json:"tags"`
+	Streaks    StatsStreaks    `json:"streaks"`
+	Activity   []ActivityPoint `json:"activity"` // from から to までの毎日 (活動が無い日も 0 で含む)
+}
+
+// memoStat はメモの語数・文字数・容量を数えます。暗号化されたメモは本文を解釈できないので語数・文字数は 0 です。
+func memoStat(memo *models.Memo) *models.MemoStat {
+	stat := &models.MemoStat{MemoID: memo.ID, UserID: memo.UserID, Bytes: memoBytes(memo)}
+	if !memo.Encrypted {
+		stat.Words, stat.Characters = utils.CountText(memo.Content)
+	}
+	return stat
+}
+
+// recordActivity はユーザーの date の作成 (created が true の場合) または編集の回数を1増やします
+func recordActivity(tx *gorm.DB, userID, date string, created bool) error {
+	column, row := "edited", models.ActivityDay{UserID: userID, Date: date, Edited: 1}
+	if created {
+		column, row = "created", models.ActivityDay{UserID: userID, Date: date, Created: 1}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{column: gorm.Expr(column + " + 1")}),
+	}).Create(&row).Error
+}
+
+// activityLocation は作成者のタイムゾーンを返します (活動の日付はユーザーのタイムゾーンで数える)
+func activityLocation(tx *gorm.DB, userID string) (*time.Location, error) {
+	var users []models.User
+	if err := tx.Select("id", "time_zone").Where("id = ?", userID).Limit(1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return time.UTC, nil
+	}
+	return userLocation(users[0]), nil
+}
+
+// memoActivity はメモの保存をその日の活動としてどう数えるかです
+type memoActivity int
+
+const (
+	activityNone    memoActivity = iota // 数えない (ゴミ箱から戻した場合など)
+	activityCreated                     // 作成
+	activityEdited                      // 編集
+)
+
+// syncMemoStats はメモの語数・文字数・容量を更新し、activity に応じて作成者のその日の活動として記録します
+func syncMemoStats(tx *gorm.DB, memo *models.Memo, activity memoActivity) error {
+	if err := tx.Save(memoStat(memo)).Error; err != nil {
+		return err
+	}
+	if activity == activityNone {
+		return nil
+	}
+	loc, err := activityLocation(tx, memo.UserID)
+	if err != nil {
+		return err
+	}
+	at := memo.UpdatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return recordActivity(tx, memo.UserID, at.In(loc).Format(dailyDateLayout), activity == activityCreated)
+}
+
+// backfillMemoStats は統計の導入前に保存されたメモの語数・文字数を数え、作成日時・更新日時を活動として記録します
+func backfillMemoStats(userID string, loc *time.Location) error {
+	var missing []models.Memo
+	err := database.DB.Where("user_id = ? AND NOT EXISTS (SELECT 1 FROM memo_stats WHERE memo_stats.memo_id = memos.id)", userID).
+		Find(&missing).Error
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range missing {
+			memo := &missing[i]
+			if err := tx.Create(memoStat(memo)).Error; err != nil {
+				return err
+			}
+			if err := recordActivity(tx, userID, memo.CreatedAt.In(loc).Format(dailyDateLayout), true); err != nil {
+				return err
+			}
+			if memo.UpdatedAt.After(memo.CreatedAt) {
+				if err := recordActivity(tx, userID, memo.UpdatedAt.In(loc).Format(dailyDateLayout), false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// computeStreak は活動のあった日付 (昇順) から連続記録を求めます
+func computeStreak(dates []string, today string) Streak {
+	streak := Streak{}
+	run := 0
+	var previous time.Time
+	for _, value := range dates {
+		day, err := time.Parse(dailyDateLayout, value)
+		if err != nil {
+			continue
+		}
+		if run > 0 && day.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = day
+		if run > streak.Longest {
+			streak.Longest = run
+		}
+		streak.LastDate = value
+	}
+	// 最後の活動が今日か昨日なら続いている
+	if todayDate, err := time.Parse(dailyDateLayout, today); err == nil && run > 0 {
+		if previous.Equal(todayDate) || previous.Equal(todayDate.AddDate(0, 0, -1)) {
+			streak.Current = run
+		}
+	}
+	return streak
+}
+
+// activityStreak は column (created / edited) が1以上の日の連続記録を返します
+func activityStreak(userID, column, today string) (Streak, error) {
+	var dates []string
+	err := database.DB.Model(&models.ActivityDay{}).
+		Where("user_id = ? AND "+column+" > 0", userID).
+		Order("date asc").
+		Pluck("date", &dates).Error
+	return computeStreak(dates, today), err
+}
+
+// activitySeries は from から to までの毎日の活動を返します
+func activitySeries(userID string, from, to time.Time) ([]ActivityPoint, error) {
+	var days []models.ActivityDay
+	err := database.DB.Where("user_id = ? AND date BETWEEN ? AND ?", userID, from.Format(dailyDateLayout), to.Format(dailyDateLayout)).
+		Find(&days).Error
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]models.ActivityDay, len(days))
+	for _, day := range days {
+		byDate[day.Date] = day
+	}
+	series := []ActivityPoint{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dailyDateLayout)
+		series = append(series, ActivityPoint{Date: date, Created: byDate[date].Created, Edited: byDate[date].Edited})
+	}
+	return series, nil
+}
+
+// parseActivityRange は ?from=&to= (YYYY-MM-DD) を返します。省略時は今日までの1年間です。
+func parseActivityRange(c *fiber.Ctx, today string) (time.Time, time.Time, bool) {
+	to, err := time.Parse(dailyDateLayout, c.Query("to", today))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	from := to.AddDate(0, 0, -(defaultActivityDays - 1))
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(dailyDateLayout, value); err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if from.After(to) || to.Sub(from) >= maxActivityDays*24*time.Hour {
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// GetStats はユーザーが作成したメモ (個人・ワークスペース) の統計と活動のヒートマップ用のデータを返します。
+// 語数・文字数と日ごとの活動はメモの保存時に集計済みのものを使います。
+func GetStats(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	user, err := findUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	loc := userLocation(*user)
+	today := time.Now().In(loc).Format(dailyDateLayout)
+	from, to, ok := parseActivityRange(c, today)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from and to must be YYYY-MM-DD dates within 3 years"})
+	}
+	if err := backfillMemoStats(userID, loc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update statistics", "details": err.Error()})
+	}
+
+	stats := StatsResponse{Categories: []NamedCount{}, Tags: []NamedCount{}}
+	err = database.DB.Model(&models.MemoStat{}).
+		Select("COUNT(*) AS memos, COALESCE(SUM(words), 0) AS words, COALESCE(SUM(characters), 0) AS characters").
+		Where("user_id = ?", userID).
+		Scan(&stats.Totals).Error
+	if err == nil {
+		err = database.DB.Model(&models.MemoTag{}).Where("user_id = ?", userID).Distinct("tag").Count(&stats.Totals.Tags).Error
+	}
+	if err == nil {
+		err = database.DB.Model(&models.ActivityDay{}).Where("user_id = ?", userID).Count(&stats.Totals.ActiveDays).Error
+	}
+	if err == nil {
+		err = database.DB.Model(&models.Memo{}).
+			Select("category AS name, COUNT(*) AS count").
+			Where("user_id = ?", userID).
+			Group("category").Order("count desc, name asc").
+			Scan(&stats.Categories).Error
+	}
+	if err == nil {
+		err = database.DB.Model(&models.MemoTag{}).
+			Select("tag AS name, COUNT(*) AS count").
+			Where("user_id = ?", userID).
+			Group("tag").Order("count desc, name asc").
+			Scan(&stats.Tags).Error
+	}
+	if err == nil {
+		stats.Streaks.Creation, err = activityStreak(userID, "created", today)
+	}
+	if err == nil {
+		stats.Streaks.Edit, err = activityStreak(userID, "edited", today)
+	}
+	if err == nil {
+		stats.Activity, err = activitySeries(userID, from, to)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not compute statistics", "details": err.Error()})
+	}
+	return c.JSON(stats)
+}
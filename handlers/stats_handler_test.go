@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/auth"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getStats(t *testing.T, token, path string) StatsResponse {
+	resp := memoRequest(t, http.MethodGet, path, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	var stats StatsResponse
+	json.NewDecoder(resp.Body).Decode(&stats)
+	return stats
+}
+
+func TestStats(t *testing.T) {
+	token := loginTestUser(t, "statsuser", "password123")
+	first := createTestMemo(t, token, map[string]interface{}{"title": "A", "content": "Hello world #go", "category": "work"})
+	createTestMemo(t, token, map[string]interface{}{"title": "B", "content": "日本語のメモ #go #jp"})
+	resp := memoRequest(t, http.MethodPut, "/api/memos/"+first.ID, token, map[string]interface{}{"title": "A (edited)"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stats := getStats(t, token, "/api/stats")
+	assert.Equal(t, StatsTotals{Memos: 2, Words: 11, Characters: 25, Tags: 2, ActiveDays: 1}, stats.Totals)
+	assert.Equal(t, []NamedCount{{Name: "", Count: 1}, {Name: "work", Count: 1}}, stats.Categories)
+	assert.Equal(t, []NamedCount{{Name: "go", Count: 2}, {Name: "jp", Count: 1}}, stats.Tags)
+	today := time.Now().UTC().Format(dailyDateLayout)
+	assert.Equal(t, Streak{Current: 1, Longest: 1, LastDate: today}, stats.Streaks.Creation)
+	assert.Equal(t, Streak{Current: 1, Longest: 1, LastDate: today}, stats.Streaks.Edit)
+	if assert.Len(t, stats.Activity, defaultActivityDays) {
+		assert.Equal(t, ActivityPoint{Date: today, Created: 2, Edited: 1}, stats.Activity[defaultActivityDays-1])
+		assert.Equal(t, ActivityPoint{Date: time.Now().UTC().AddDate(0, 0, -1).Format(dailyDateLayout)}, stats.Activity[defaultActivityDays-2])
+	}
+
+	// 削除したメモは合計に含めない (活動の記録は残る)
+	resp = memoRequest(t, http.MethodDelete, "/api/memos/"+first.ID, token, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	stats = getStats(t, token, "/api/stats?from=2024-02-27&to=2024-03-01")
+	assert.Equal(t, int64(1), stats.Totals.Memos)
+	assert.Equal(t, int64(8), stats.Totals.Words)
+	assert.Equal(t, []string{"2024-02-27", "2024-02-28", "2024-02-29", "2024-03-01"}, []string{
+		stats.Activity[0].Date, stats.Activity[1].Date, stats.Activity[2].Date, stats.Activity[3].Date,
+	})
+
+	// ゴミ箱から戻しても作成・編集の回数は増えない
+	postBatch(t, token, map[string]interface{}{
+		"operations": []map[string]interface{}{{"op": "restore", "id": first.ID}},
+	}, http.StatusOK)
+	stats = getStats(t, token, "/api/stats")
+	assert.Equal(t, int64(2), stats.Totals.Memos)
+	if assert.Len(t, stats.Activity, defaultActivityDays) {
+		assert.Equal(t, ActivityPoint{Date: today, Created: 2, Edited: 1}, stats.Activity[defaultActivityDays-1])
+	}
+
+	resp = memoRequest(t, http.MethodGet, "/api/stats?from=2024-03-02&to=2024-03-01", token, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestStatsBackfill(t *testing.T) {
+	token := loginTestUser(t, "statsbackfill", "password123")
+	userID, err := auth.ParseJWT(token)
+	assert.NoError(t, err)
+	first := createTestMemo(t, token, map[string]interface{}{"title": "A", "content": "one two"})
+	second := createTestMemo(t, token, map[string]interface{}{"title": "B", "content": "three"})
+
+	// 統計の導入前に作成されたメモとして、集計済みのデータを消して作成日時をずらす
+	testDB.Where("user_id = ?", userID).Delete(&models.MemoStat{})
+	testDB.Where("user_id = ?", userID).Delete(&models.ActivityDay{})
+	now := time.Now().UTC()
+	for id, created := range map[string]time.Time{first.ID: now.AddDate(0, 0, -3), second.ID: now.AddDate(0, 0, -2)} {
+		testDB.Model(&models.Memo{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{"created_at": created, "updated_at": created})
+	}
+	stats := getStats(t, token, "/api/stats")
+	assert.Equal(t, int64(3), stats.Totals.Words)
+	assert.Equal(t, int64(2), stats.Totals.ActiveDays)
+	// 最後に作成したのが一昨日なので連続記録は途切れている
+	assert.Equal(t, Streak{Current: 0, Longest: 2, LastDate: now.AddDate(0, 0, -2).Format(dailyDateLayout)}, stats.Streaks.Creation)
+	assert.Equal(t, Streak{}, stats.Streaks.Edit)
+
+	// 今日作成すると連続記録が始まり直す
+	createTestMemo(t, token, map[string]interface{}{"title": "C", "content": "four"})
+	stats = getStats(t, token, "/api/stats")
+	assert.Equal(t, 1, stats.Streaks.Creation.Current)
+	assert.Equal(t, 2, stats.Streaks.Creation.Longest)
+}
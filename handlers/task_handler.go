@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TaskWithMemo はタスクと元メモの情報をまとめたレスポンスです
+type TaskWithMemo struct {
+	models.Task
+	MemoTitle    string
+	MemoCategory string
+}
+
+type ToggleTaskInput struct {
+	Done *bool `json:"done,omitempty" xml:"done,omitempty" form:"done,omitempty"` // 省略時は反転
+}
+
+// parseDateParam は YYYY-MM-DD または RFC3339 形式の日付を解析します
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// queryTasks は条件に一致するタスクを元メモの情報付きで取得します。
+// 保護されたメモのタスク (本文の一部) は再認証したリクエストにだけ返します。
+func queryTasks(c *fiber.Ctx, userID, status, category, tag string, dueBefore, dueAfter *time.Time) ([]TaskWithMemo, error) {
+	db := database.DB.Table("tasks").
+		Select("tasks.*, memos.title AS memo_title, memos.category AS memo_category").
+		Joins("JOIN memos ON memos.id = tasks.memo_id AND memos.deleted_at IS NULL").
+		Where("tasks.user_id = ?", userID)
+	if !reauthenticated(c, userID) {
+		db = db.Where("memos.protected = ?", false)
+	}
+
+	switch status {
+	case "open":
+		db = db.Where("tasks.done = ?", false)
+	case "done":
+		db = db.Where("tasks.done = ?", true)
+	}
+	if category != "" {
+		db = db.Where("memos.category = ?", category)
+	}
+	if tag != "" {
+		db = db.Where("EXISTS (SELECT 1 FROM memo_tags WHERE memo_tags.memo_id = tasks.memo_id AND memo_tags.tag = ?)", utils.NormalizeTag(tag))
+	}
+	if dueBefore != nil {
+		db = db.Where("tasks.due_at IS NOT NULL AND tasks.due_at < ?", *dueBefore)
+	}
+	if dueAfter != nil {
+		db = db.Where("tasks.due_at IS NOT NULL AND tasks.due_at >= ?", *dueAfter)
+	}
+
+	tasks := []TaskWithMemo{}
+	if err := db.Order("tasks.due_at IS NULL, tasks.due_at asc, memos.created_at desc, tasks.line asc").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	// JOIN で取得したタイトルはフックで復号されないので、保存時の暗号化が有効ならここで復号する
+	for i := range tasks {
+		title, err := models.DecryptMemoField(database.DB, tasks[i].MemoTitle)
+		if err != nil {
+			return nil, err
+		}
+		tasks[i].MemoTitle = title
+	}
+	return tasks, nil
+}
+
+var (
+	// errTaskNotFound はタスクが存在しないか、ユーザーが所有していない場合のエラーです
+	errTaskNotFound = errors.New("task not found")
+	// errTaskReauth は保護されたメモのタスクを再認証せずに切り替えようとした場合のエラーです
+	errTaskReauth = errors.New("re-authentication required")
+)
+
+// toggleTask はタスクの完了状態を変更し、元メモのチェックボックスを書き換えます。
+// 保護されたメモのタスクは reauthed (再認証済み) の場合のみ切り替えられます。
+func toggleTask(userID, taskID string, done *bool, reauthed bool) (*models.Task, error) {
+	var updated models.Task
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var task models.Task
+		if err := tx.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errTaskNotFound
+			}
+			return err
+		}
+		var memo models.Memo
+		if err := tx.Where("id = ? AND user_id = ?", task.MemoID, userID).First(&memo).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errTaskNotFound
+			}
+			return err
+		}
+		if memo.Locked {
+			return errMemoLocked
+		}
+		if memo.Protected && !reauthed {
+			return errTaskReauth
+		}
+
+		newDone := !task.Done
+		if done != nil {
+			newDone = *done
+		}
+		content, err := utils.SetTaskDone(memo.Content, task.Line, task.Text, newDone)
+		if err != nil {
+			return err
+		}
+		memo.Content = content
+		if err := tx.Save(&memo).Error; err != nil {
+			return err
+		}
+		if err := syncMemoDerived(tx, &memo, activityEdited); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", task.ID).First(&updated).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetTasks はメモから抽出したタスクを取得します
+// クエリ: status (open/done/all, デフォルト open), category, tag, due_before, due_after
+func GetTasks(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	status := c.Query("status", "open")
+	if status != "open" && status != "done" && status != "all" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status must be one of open, done, all"})
+	}
+
+	var dueBefore, dueAfter *time.Time
+	if v := c.Query("due_before"); v != "" {
+		t, err := parseDateParam(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid due_before", "details": err.Error()})
+		}
+		dueBefore = &t
+	}
+	if v := c.Query("due_after"); v != "" {
+		t, err := parseDateParam(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid due_after", "details": err.Error()})
+		}
+		dueAfter = &t
+	}
+
+	tasks, err := queryTasks(c, userID, status, c.Query("category"), c.Query("tag"), dueBefore, dueAfter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve tasks", "details": err.Error()})
+	}
+	return c.JSON(tasks)
+}
+
+// ToggleTask はタスクの完了状態を切り替え、元メモの本文を書き換えます
+func ToggleTask(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(ToggleTaskInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+		}
+	}
+
+	task, err := toggleTask(userID, c.Params("id"), input.Done, reauthenticated(c, userID))
+	if err != nil {
+		if errors.Is(err, errTaskNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+		}
+		if errors.Is(err, utils.ErrTaskLineMismatch) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Memo content has changed; reload tasks and try again"})
+		}
+		if errors.Is(err, errMemoLocked) {
+			return memoAccessErrorResponse(c, err)
+		}
+		if errors.Is(err, errTaskReauth) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Re-authentication required", "reauth_required": true})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not toggle task", "details": err.Error()})
+	}
+	return c.JSON(task)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTasks(t *testing.T, token, query string) []TaskWithMemo {
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	body, _ := io.ReadAll(resp.Body)
+	var tasks []TaskWithMemo
+	json.Unmarshal(body, &tasks)
+	return tasks
+}
+
+func TestTasks(t *testing.T) {
+	token := loginTestUser(t, "taskuser", "password123")
+
+	createTestMemo(t, token, map[string]interface{}{"title": "Shopping", "content": "#home\n- [ ] milk\n- [x] bread"})
+	createTestMemo(t, token, map[string]interface{}{"title": "Work", "content": "- [ ] report due:2024-03-01"})
+
+	assert.Len(t, getTasks(t, token, ""), 2)
+	assert.Len(t, getTasks(t, token, "?status=all"), 3)
+	assert.Len(t, getTasks(t, token, "?status=done"), 1)
+	homeTasks := getTasks(t, token, "?tag=home")
+	assert.Len(t, homeTasks, 1)
+	assert.Equal(t, "milk", homeTasks[0].Text)
+	assert.Equal(t, "Shopping", homeTasks[0].MemoTitle)
+	dueTasks := getTasks(t, token, "?due_before=2024-04-01")
+	assert.Len(t, dueTasks, 1)
+	assert.Equal(t, "report due:2024-03-01", dueTasks[0].Text)
+
+	// チェックを切り替えるとメモ本文も書き換わる
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/"+homeTasks[0].ID+"/toggle", bytes.NewBufferString(`{"done": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := testApp.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	body, _ := io.ReadAll(resp.Body)
+	var toggled models.Task
+	json.Unmarshal(body, &toggled)
+	assert.Equal(t, homeTasks[0].ID, toggled.ID)
+	assert.True(t, toggled.Done)
+
+	var memo models.Memo
+	testDB.First(&memo, "id = ?", toggled.MemoID)
+	assert.Equal(t, "#home\n- [x] milk\n- [x] bread", memo.Content)
+	assert.Len(t, getTasks(t, token, ""), 1)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+	_ "time/tzdata" // タイムゾーンのデータが無い環境 (Dockerのscratchイメージなど) でも LoadLocation できるように
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type UpdateUserSettingsInput struct {
+	TimeZone        *string `json:"time_zone,omitempty" xml:"time_zone,omitempty" form:"time_zone,omitempty"`
+	DailyTemplateID *string `json:"daily_template_id,omitempty" xml:"daily_template_id,omitempty" form:"daily_template_id,omitempty"` // 空文字でテンプレートなし
+}
+
+// userSettingsResponse はパスワードを含まないユーザー情報と設定を返します
+func userSettingsResponse(user models.User) fiber.Map {
+	return fiber.Map{
+		"id":                user.ID,
+		"username":          user.Username,
+		"time_zone":         user.TimeZone,
+		"daily_template_id": user.DailyTemplateID,
+	}
+}
+
+// userLocation はユーザーの設定したタイムゾーンを返します。未設定または不正な場合はUTCです。
+func userLocation(user models.User) *time.Location {
+	if user.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// findUser はIDでユーザーを取得します
+func findUser(userID string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetCurrentUser は認証されたユーザーの情報と設定を返します
+func GetCurrentUser(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	user, err := findUser(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	return c.JSON(userSettingsResponse(*user))
+}
+
+// UpdateUserSettings はタイムゾーンやデイリーノートのテンプレートなどのユーザー設定を更新します
+func UpdateUserSettings(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(UpdateUserSettingsInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+
+	user, err := findUser(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+
+	if input.TimeZone != nil {
+		if _, err := time.LoadLocation(*input.TimeZone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone", "details": err.Error()})
+		}
+		user.TimeZone = *input.TimeZone
+	}
+	if input.DailyTemplateID != nil {
+		if *input.DailyTemplateID != "" {
+			template, _, err := findMemoWithRole(userID, *input.DailyTemplateID, models.RoleViewer)
+			if err != nil {
+				return memoAccessErrorResponse(c, err)
+			}
+			if template.Encrypted {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errEncryptedTemplate.Error()})
+			}
+		}
+		user.DailyTemplateID = *input.DailyTemplateID
+	}
+
+	err = database.DB.Model(user).Updates(map[string]interface{}{
+		"time_zone":         user.TimeZone,
+		"daily_template_id": user.DailyTemplateID,
+	}).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update settings", "details": err.Error()})
+	}
+	return c.JSON(userSettingsResponse(*user))
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/linkalls/fast-memos/auth"
 	"github.com/linkalls/fast-memos/database"
 	"github.com/linkalls/fast-memos/models"
 	"github.com/linkalls/fast-memos/utils"
+	"gorm.io/gorm"
 )
 
 // WebLoginUser - Web UI用のログインハンドラー
@@ -38,17 +44,43 @@ func WebLoginUser(c *fiber.Ctx) error {
 		})
 	}
 
-	// ログイン成功時はuser_idをCookieにセット
+	// ログイン成功時は署名付きのセッショントークンをCookieにセット
+	token, expiresAt, err := auth.GenerateSessionToken(existingUser.ID)
+	if err != nil {
+		return c.Render("login", fiber.Map{
+			"Title": "Login",
+			"Error": "ログインに失敗しました",
+		})
+	}
 	c.Cookie(&fiber.Cookie{
-		Name:     "user_id",
-		Value:    existingUser.ID,
+		Name:     webSessionCookie,
+		Value:    token,
 		Path:     "/",
+		Expires:  expiresAt,
 		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
 		Secure:   false, // 本番はtrue
 	})
 	return c.Redirect("/")
 }
 
+// webSessionCookie は Web UI のログイン状態を保持する Cookie の名前です (値は auth.GenerateSessionToken の署名付きトークン)
+const webSessionCookie = "user_id"
+
+// WebUserID は Web UI のセッション Cookie からログイン中のユーザーIDを返します。
+// Cookie が無い・署名を検証できない・期限切れの場合は空文字列です。
+func WebUserID(c *fiber.Ctx) string {
+	token := c.Cookies(webSessionCookie)
+	if token == "" {
+		return ""
+	}
+	userID, err := auth.ValidateSessionToken(token)
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
 // WebRegisterUser - Web UI用の登録ハンドラー
 func WebRegisterUser(c *fiber.Ctx) error {
 	username := c.FormValue("username")
@@ -106,38 +138,113 @@ func WebCreateMemo(c *fiber.Ctx) error {
 		return c.Redirect("/?error=content_required")
 	}
 
-	userID := c.Cookies("user_id")
+	userID := WebUserID(c)
 	if userID == "" {
 		return c.Redirect("/login")
 	}
 
+	// ワークスペースを選択中ならワークスペースのメモとして作成する
+	workspaces, workspaceID := WebWorkspaces(c, userID)
+	if workspaceID != "" {
+		for _, workspace := range workspaces {
+			if workspace.ID == workspaceID && !canCreateWorkspaceMemo(workspace.Role) {
+				return c.Redirect("/?error=workspace_read_only")
+			}
+		}
+	}
+
 	memo := models.Memo{
-		ID:       utils.GenerateID(),
-		Title:    "", // タイトルは空でOK
-		Content:  content,
-		Category: category,
-		UserID:   userID,
+		ID:          utils.GenerateID(),
+		Title:       "", // タイトルは空でOK
+		Content:     content,
+		Category:    category,
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+	}
+	// 「現在地」ボタンで記録した位置情報 (任意)
+	if lat, err := strconv.ParseFloat(c.FormValue("latitude"), 64); err == nil {
+		if lng, err := strconv.ParseFloat(c.FormValue("longitude"), 64); err == nil && utils.ValidCoordinates(lat, lng) {
+			memo.Latitude, memo.Longitude = &lat, &lng
+		}
+	}
+	memo.PlaceName = c.FormValue("place_name")
+	if err := checkMemoQuota(userID, 1, memoBytes(&memo)); err != nil {
+		return c.Redirect("/?error=quota_exceeded")
 	}
 
-	if err := database.DB.Create(&memo).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&memo).Error; err != nil {
+			return err
+		}
+		return syncMemoDerived(tx, &memo, activityCreated)
+	})
+	if err != nil {
 		return c.Redirect("/?error=failed_to_create_memo")
 	}
 
 	accept := c.Get("Accept")
 	if accept == "text/vnd.turbo-stream.html" {
+		prepareMemoResponse(c, userID, &memo)
 		return c.Render("memo.turbo-stream", memo, "text/vnd.turbo-stream.html")
 	}
 
 	return c.Redirect("/")
 }
 
+// WebWorkspaces はWeb UIのワークスペース切り替え用に、所属するワークスペースと選択中のワークスペースIDを返します。
+// 選択中のワークスペースが無い (または既に所属していない) 場合は個人のメモを表示するため空文字を返します。
+func WebWorkspaces(c *fiber.Ctx, userID string) ([]WorkspaceSummary, string) {
+	workspaces, err := userWorkspaces(userID)
+	if err != nil {
+		return nil, ""
+	}
+	current := c.Cookies("workspace_id")
+	for _, workspace := range workspaces {
+		if workspace.ID == current {
+			return workspaces, current
+		}
+	}
+	return workspaces, ""
+}
+
+// WebSwitchWorkspace - 表示するワークスペースを切り替え (空なら個人のメモ)
+func WebSwitchWorkspace(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	workspaceID := c.FormValue("workspace_id")
+	if workspaceID != "" {
+		if role, err := workspaceRole(userID, workspaceID); err != nil || role == "" {
+			return c.Redirect("/?error=workspace_not_found")
+		}
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "workspace_id",
+		Value:    workspaceID,
+		Path:     "/",
+		HTTPOnly: true,
+		Secure:   false, // 本番はtrue
+	})
+	return c.Redirect("/")
+}
+
 // WebDeleteMemo - Web UI用のメモ削除ハンドラー
 func WebDeleteMemo(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if id == "" {
 		return c.Redirect("/")
 	}
-	database.DB.Delete(&models.Memo{}, "id = ?", id)
+	if _, _, err := findEditableMemo(c, WebUserID(c), id, roleOwner); err != nil {
+		return c.Redirect("/")
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := deleteMemoTx(tx, id)
+		return err
+	})
+	if err != nil {
+		return c.Redirect("/?error=failed_to_delete_memo")
+	}
 	// Turbo Stream対応
 	accept := c.Get("Accept")
 	if accept == "text/vnd.turbo-stream.html" {
@@ -150,10 +257,19 @@ func WebDeleteMemo(c *fiber.Ctx) error {
 // WebEditMemo - 編集フォーム表示
 func WebEditMemo(c *fiber.Ctx) error {
 	id := c.Params("id")
-	var memo models.Memo
-	if err := database.DB.First(&memo, "id = ?", id).Error; err != nil {
+	userID := WebUserID(c)
+	memo, _, err := findEditableMemo(c, userID, id, models.RoleEditor)
+	if err != nil {
 		return c.Redirect("/")
 	}
+	// 保護されたメモは再認証するまで編集フォームに本文を出さない
+	if memo.Protected && !reauthenticated(c, userID) {
+		return c.Redirect("/?error=reauth_required")
+	}
+	// 暗号化されたメモはクライアントでしか編集できない
+	if memo.Encrypted {
+		return c.Redirect("/?error=encrypted_memo")
+	}
 	return c.Render("edit_memo", fiber.Map{
 		"Memo": memo,
 	})
@@ -168,10 +284,481 @@ func WebUpdateMemo(c *fiber.Ctx) error {
 	if id == "" || title == "" || content == "" {
 		return c.Redirect("/")
 	}
-	database.DB.Model(&models.Memo{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"title":    title,
-		"content":  content,
-		"category": category,
+	memo, role, err := findEditableMemo(c, WebUserID(c), id, models.RoleEditor)
+	if err != nil {
+		return c.Redirect("/")
+	}
+	if memo.Encrypted {
+		return c.Redirect("/?error=encrypted_memo")
+	}
+	before := *memo
+	// 保存時の暗号化 (モデルのフック) を通すため、構造体で保存する
+	memo.Title = title
+	memo.Content = content
+	memo.Category = category
+	// 公開範囲は所有者のみ変更できる
+	if visibility := c.FormValue("visibility"); visibility != "" && role == roleOwner {
+		memo.Visibility = visibility
+		if err := validateVisibility(memo); err != nil {
+			return c.Redirect("/?error=invalid_visibility")
+		}
+	}
+	if err := checkMemoGrowth(&before, memo); err != nil {
+		return c.Redirect("/?error=quota_exceeded")
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(memo).Error; err != nil {
+			return err
+		}
+		return syncMemoDerived(tx, memo, activityEdited)
+	})
+	if err != nil {
+		return c.Redirect("/?error=failed_to_update_memo")
+	}
+	return c.Redirect("/")
+}
+
+// WebTasks - 未完了タスク一覧ページ
+func WebTasks(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	tasks, err := queryTasks(c, userID, "open", c.Query("category"), c.Query("tag"), nil, nil)
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_tasks")
+	}
+	return c.Render("tasks", fiber.Map{
+		"Title":    "未完了タスク",
+		"Tasks":    tasks,
+		"Category": c.Query("category"),
+		"Tag":      c.Query("tag"),
+	})
+}
+
+// WebToggleTask - タスクの完了状態を切り替え
+func WebToggleTask(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	if _, err := toggleTask(userID, c.Params("id"), nil, reauthenticated(c, userID)); errors.Is(err, errTaskReauth) {
+		return c.Redirect("/?error=reauth_required")
+	}
+	accept := c.Get("Accept")
+	if accept == "text/vnd.turbo-stream.html" {
+		return c.SendString(`<turbo-stream action="remove" target="task-` + c.Params("id") + `"></turbo-stream>`)
+	}
+	return c.Redirect("/tasks")
+}
+
+// WebDailyNote - デイリーノートを表示 (無ければ作成)。/daily/today で今日のノートを開く
+func WebDailyNote(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	daily, err := loadDailyNote(userID, c.Params("date"), c.Query("template"))
+	var inputErr *memoInputError
+	if errors.As(err, &inputErr) && inputErr.Status == fiber.StatusRequestEntityTooLarge {
+		return c.Redirect("/?error=quota_exceeded")
+	}
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_daily_note")
+	}
+	prepareMemoResponse(c, userID, &daily.Memo)
+	return c.Render("show_memo", fiber.Map{
+		"Memo":  &daily.Memo,
+		"Daily": daily,
+	})
+}
+
+// WebDownloadAttachment - 添付ファイルの表示・ダウンロード (Markdown内の画像表示にも使用)
+func WebDownloadAttachment(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	attachment, err := findViewableAttachment(userID, c.Params("id"))
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return sendAttachment(c, *attachment)
+}
+
+// renderShareError - 共有リンクが使えない場合のページ
+func renderShareError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusGone
+	message := "この共有リンクは無効です"
+	switch {
+	case errors.Is(err, errShareNotFound):
+		status = fiber.StatusNotFound
+		message = "共有リンクが見つかりません"
+	case errors.Is(err, errShareExpired):
+		message = "この共有リンクは有効期限が切れています"
+	case errors.Is(err, errShareViewLimit):
+		message = "この共有リンクは閲覧回数の上限に達しました"
+	case errors.Is(err, errShareRevoked):
+		message = "この共有リンクは無効になりました"
+	default:
+		status = fiber.StatusInternalServerError
+		message = "共有リンクを表示できませんでした"
+	}
+	return c.Status(status).Render("show_memo", fiber.Map{
+		"ReadOnly": true,
+		"Error":    message,
+	})
+}
+
+// WebShowShare - 共有リンクで公開されたメモを読み取り専用で表示
+func WebShowShare(c *fiber.Ctx) error {
+	token := c.Params("token")
+	share, memo, err := findActiveShare(token)
+	if err != nil {
+		return renderShareError(c, err)
+	}
+	if share.HasPassword() && c.Cookies(shareUnlockCookieName(*share)) != shareUnlockValue(*share) {
+		return c.Render("show_memo", fiber.Map{
+			"ReadOnly":     true,
+			"NeedPassword": true,
+			"ShareToken":   token,
+		})
+	}
+	if err := recordShareView(share); err != nil {
+		return renderShareError(c, err)
+	}
+	return c.Render("show_memo", fiber.Map{
+		"Memo":       memo,
+		"ReadOnly":   true,
+		"ShareToken": token,
+	})
+}
+
+// WebUnlockShare - パスワード付き共有リンクのパスワードを確認
+func WebUnlockShare(c *fiber.Ctx) error {
+	token := c.Params("token")
+	share, _, err := findActiveShare(token)
+	if err != nil {
+		return renderShareError(c, err)
+	}
+	if !share.HasPassword() {
+		return c.Redirect("/s/" + token)
+	}
+	if !auth.CheckPasswordHash(c.FormValue("password"), share.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).Render("show_memo", fiber.Map{
+			"ReadOnly":     true,
+			"NeedPassword": true,
+			"ShareToken":   token,
+			"Error":        "パスワードが正しくありません",
+		})
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     shareUnlockCookieName(*share),
+		Value:    shareUnlockValue(*share),
+		Path:     "/s/" + token,
+		HTTPOnly: true,
+		Secure:   false, // 本番はtrue
+	})
+	return c.Redirect("/s/" + token)
+}
+
+// WebShareAttachment - 共有リンクで公開されたメモの添付ファイルを配信
+func WebShareAttachment(c *fiber.Ctx) error {
+	share, memo, err := findActiveShare(c.Params("token"))
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if share.HasPassword() && c.Cookies(shareUnlockCookieName(*share)) != shareUnlockValue(*share) {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND memo_id = ?", c.Params("id"), memo.ID).First(&attachment).Error; err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return sendAttachment(c, attachment)
+}
+
+// WebPublicMemo - unlisted / public のメモを表示 (認証不要)
+func WebPublicMemo(c *fiber.Ctx) error {
+	memo, err := findPublishedMemo(c.Params("id"))
+	if err != nil {
+		status, message := fiber.StatusInternalServerError, "メモを表示できませんでした"
+		if errors.Is(err, errPublicMemoNotFound) {
+			status, message = fiber.StatusNotFound, "メモが見つかりません"
+		}
+		return c.Status(status).Render("show_memo", fiber.Map{
+			"ReadOnly": true,
+			"Error":    message,
+		})
+	}
+	return c.Render("show_memo", fiber.Map{
+		"Memo":       memo,
+		"ReadOnly":   true,
+		"PublicMemo": true,
+		// unlisted はURLを知っている人だけに見せるため検索エンジンに載せない
+		"Indexable": memo.Visibility == models.VisibilityPublic,
+	})
+}
+
+// WebPublicAttachment - unlisted / public のメモの添付ファイルを配信
+func WebPublicAttachment(c *fiber.Ctx) error {
+	memo, err := findPublishedMemo(c.Params("memoID"))
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND memo_id = ?", c.Params("id"), memo.ID).First(&attachment).Error; err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return sendAttachment(c, attachment)
+}
+
+// WebProfile - ユーザーの public なメモを新しい順に表示するプロフィールページ (認証不要、?page=N)
+func WebProfile(c *fiber.Ctx) error {
+	profile, err := loadPublicProfile(c.Params("username"), queryPage(c))
+	if err != nil {
+		status, message := fiber.StatusInternalServerError, "プロフィールを表示できませんでした"
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status, message = fiber.StatusNotFound, "ユーザーが見つかりません"
+		}
+		return c.Status(status).Render("profile", fiber.Map{
+			"Title": "プロフィール",
+			"Error": message,
+		})
+	}
+	return c.Render("profile", fiber.Map{
+		"Title":    profile.Username,
+		"Profile":  profile,
+		"NextPage": profile.Page + 1,
+		"PrevPage": profile.Page - 1,
+	})
+}
+
+// WebShowMemo - メモの詳細ページ (コメント欄付き)
+func WebShowMemo(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	memo, _, err := findRequestMemoWithRole(c, userID, c.Params("id"), models.RoleViewer)
+	if err != nil {
+		if redirected, err := mergedMemoRedirect(c, userID, c.Params("id"), c.Path()); redirected {
+			return err
+		}
+		return c.Redirect("/?error=memo_not_found")
+	}
+	prepareMemoResponse(c, userID, memo)
+	data := fiber.Map{
+		"Memo":   memo,
+		"UserID": userID,
+	}
+	// 保護されたメモのコメントは本文と同じく再認証するまで表示しない
+	if !memo.ContentHidden {
+		comments, err := loadCommentThreads(memo.ID, nil)
+		if err != nil {
+			return c.Redirect("/?error=failed_to_load_comments")
+		}
+		data["Comments"] = comments
+		data["ShowComments"] = true
+	}
+	return c.Render("show_memo", data)
+}
+
+// webCommentRedirect はメモの詳細ページのコメント欄に戻ります
+func webCommentRedirect(c *fiber.Ctx, errorCode string) error {
+	target := "/memos/" + c.Params("id")
+	if errorCode != "" {
+		target += "?error=" + errorCode
+	}
+	return c.Redirect(target + "#comments")
+}
+
+// WebCreateComment - コメント (parent_id を指定すると返信) を投稿
+func WebCreateComment(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	memo, _, err := findCommentMemo(c, userID, c.Params("id"))
+	if err != nil {
+		return c.Redirect("/?error=memo_not_found")
+	}
+	input := &CommentInput{Body: c.FormValue("body"), ParentID: c.FormValue("parent_id")}
+	if _, err := createComment(memo.ID, userID, input); err != nil {
+		return webCommentRedirect(c, "failed_to_create_comment")
+	}
+	return webCommentRedirect(c, "")
+}
+
+// WebCommentAction - コメントの編集 (edit)・削除 (delete)・解決 (resolve)・未解決に戻す (unresolve)
+func WebCommentAction(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := WebUserID(c)
+		if userID == "" {
+			return c.Redirect("/login")
+		}
+		comment, role, err := findRequestComment(c, userID)
+		if err != nil {
+			return webCommentRedirect(c, "comment_not_found")
+		}
+		switch action {
+		case "edit":
+			err = updateCommentBody(comment, userID, c.FormValue("body"))
+		case "delete":
+			err = deleteComment(comment, userID)
+		case "resolve", "unresolve":
+			err = setCommentResolved(comment, userID, role, action == "resolve")
+		}
+		if err != nil {
+			return webCommentRedirect(c, "failed_to_"+action+"_comment")
+		}
+		return webCommentRedirect(c, "")
+	}
+}
+
+// WebReview - 振り返りページ (過去の同じ日のメモ・ランダムに選んだメモ・振り返りキュー)
+func WebReview(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	user, err := findUser(userID)
+	if err != nil {
+		return c.Redirect("/login")
+	}
+	loc := userLocation(*user)
+	now := time.Now()
+	date := now.In(loc).Format(dailyDateLayout)
+	_, sources, err := loadReviewSettings(userID)
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_review")
+	}
+	onThisDay, err := onThisDayMemos(userID, date, loc, sources)
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_review")
+	}
+	random, err := randomReviewMemos(userID, 3, now.UTC(), sources, rand.New(rand.NewSource(now.UnixNano())))
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_review")
+	}
+	queue, err := reviewQueue(userID, now.UTC())
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_review")
+	}
+	PrepareMemosForDisplay(c, userID, onThisDay)
+	PrepareMemosForDisplay(c, userID, random)
+	for i := range queue {
+		prepareMemoResponse(c, userID, &queue[i].Memo)
+	}
+	return c.Render("review", fiber.Map{
+		"Title":     "振り返り",
+		"Date":      date,
+		"OnThisDay": onThisDay,
+		"Random":    random,
+		"Queue":     queue,
 	})
+}
+
+// WebReviewAction - 振り返りページからのスヌーズ (snooze)・N日後に通知 (remind)・振り返り済み (reviewed)
+func WebReviewAction(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := WebUserID(c)
+		if userID == "" {
+			return c.Redirect("/login")
+		}
+		memo, _, err := findMemoWithRole(userID, c.Params("id"), models.RoleViewer)
+		if err != nil {
+			return c.Redirect("/review?error=memo_not_found")
+		}
+		now := time.Now().UTC()
+		if action == "reviewed" {
+			_, err = markReviewed(userID, memo.ID, now)
+		} else {
+			days, _ := strconv.Atoi(c.FormValue("days"))
+			var dueAt time.Time
+			if dueAt, err = reviewDueAt(&ReviewScheduleInput{Days: days}, now, 1); err == nil {
+				_, err = scheduleReview(userID, memo.ID, dueAt, action)
+			}
+		}
+		if err != nil {
+			return c.Redirect("/review?error=failed_to_update_review")
+		}
+		return c.Redirect("/review")
+	}
+}
+
+// WebCardReview - フラッシュカードの復習ページ (期日を過ぎたカードを1枚ずつ表示)
+func WebCardReview(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	cards, err := dueCards(c, userID, time.Now().UTC(), maxDueCardLimit)
+	if err != nil {
+		return c.Redirect("/?error=failed_to_load_cards")
+	}
+	data := fiber.Map{
+		"Title":    "フラッシュカード",
+		"DueCount": len(cards),
+		"Card":     nil,
+	}
+	if len(cards) > 0 {
+		data["Card"] = cards[0]
+	}
+	return c.Render("cards", data)
+}
+
+// WebGradeCard - 復習ページからのフラッシュカードの評価
+func WebGradeCard(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	card, err := findUserCard(c, userID, c.Params("id"))
+	if err != nil {
+		return c.Redirect("/cards/review?error=card_not_found")
+	}
+	grade, err := strconv.Atoi(c.FormValue("grade"))
+	if err != nil {
+		return c.Redirect("/cards/review?error=invalid_grade")
+	}
+	if err := gradeCard(card, userID, grade, time.Now().UTC()); err != nil {
+		return c.Redirect("/cards/review?error=failed_to_grade_card")
+	}
+	return c.Redirect("/cards/review")
+}
+
+// WebBatchMemos - メモ一覧で選択したメモの一括削除 (action=delete)・カテゴリの変更 (action=categorize)
+func WebBatchMemos(c *fiber.Ctx) error {
+	userID := WebUserID(c)
+	if userID == "" {
+		return c.Redirect("/login")
+	}
+	action := c.FormValue("action")
+	category := c.FormValue("category")
+	input := &BatchInput{Mode: batchModeAtomic}
+	for _, id := range c.Request().PostArgs().PeekMulti("ids") {
+		op := BatchOperation{ID: string(id)}
+		switch action {
+		case "delete":
+			op.Op = batchOpDelete
+		case "categorize":
+			op.Op = batchOpMoveCategory
+			op.Category = &category
+		default:
+			return c.Redirect("/?error=invalid_batch_action")
+		}
+		input.Operations = append(input.Operations, op)
+	}
+	if len(input.Operations) == 0 {
+		return c.Redirect("/?error=no_memos_selected")
+	}
+	if len(input.Operations) > maxBatchOperations {
+		return c.Redirect("/?error=too_many_memos_selected")
+	}
+	_, committed, err := runBatch(c, userID, input)
+	if err != nil || !committed {
+		return c.Redirect("/?error=batch_failed")
+	}
 	return c.Redirect("/")
 }
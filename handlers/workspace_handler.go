@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/linkalls/fast-memos/database"
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ワークスペースでの役割。owner > admin > member > guest の順に強い
+var workspaceRoleRank = map[string]int{
+	models.WorkspaceRoleGuest:  1,
+	models.WorkspaceRoleMember: 2,
+	models.WorkspaceRoleAdmin:  3,
+	models.WorkspaceRoleOwner:  4,
+}
+
+var (
+	errWorkspaceNotFound  = errors.New("workspace not found")
+	errWorkspaceForbidden = errors.New("insufficient permission for workspace")
+)
+
+type CreateWorkspaceInput struct {
+	Name string `json:"name" xml:"name" form:"name"`
+}
+
+type CreateWorkspaceInvitationInput struct {
+	Username string `json:"username" xml:"username" form:"username"`
+	Role     string `json:"role" xml:"role" form:"role"`
+}
+
+type UpdateWorkspaceMemberInput struct {
+	Role string `json:"role" xml:"role" form:"role"`
+}
+
+// WorkspaceSummary はワークスペース一覧の要素です (自分の役割を含む)
+type WorkspaceSummary struct {
+	models.Workspace
+	Role string
+}
+
+// WorkspaceMemberResponse はメンバー一覧の要素です (ユーザー名を含む)
+type WorkspaceMemberResponse struct {
+	models.WorkspaceMember
+	Username string
+}
+
+// WorkspaceInvitationResponse は招待のレスポンスです (ワークスペース名と招待相手のユーザー名を含む)
+type WorkspaceInvitationResponse struct {
+	models.WorkspaceInvitation
+	WorkspaceName   string
+	InviteeUsername string
+}
+
+// workspaceRole は userID のワークスペースでの役割を返します。メンバーでない場合は空文字です。
+func workspaceRole(userID, workspaceID string) (string, error) {
+	var member models.WorkspaceMember
+	err := database.DB.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// findWorkspaceWithRole は userID が required 以上の役割を持つワークスペースを取得します。
+// メンバーでない場合は errWorkspaceNotFound、役割が足りない場合は errWorkspaceForbidden を返します。
+func findWorkspaceWithRole(userID, workspaceID, required string) (*models.Workspace, string, error) {
+	var workspace models.Workspace
+	if err := database.DB.Where("id = ?", workspaceID).First(&workspace).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errWorkspaceNotFound
+		}
+		return nil, "", err
+	}
+	role, err := workspaceRole(userID, workspaceID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		// メモと同様、メンバー以外には存在を知られないようにする
+		return nil, "", errWorkspaceNotFound
+	}
+	if workspaceRoleRank[role] < workspaceRoleRank[required] {
+		return &workspace, role, errWorkspaceForbidden
+	}
+	return &workspace, role, nil
+}
+
+// workspaceAccessErrorResponse は findWorkspaceWithRole のエラーをレスポンスに変換します
+func workspaceAccessErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errWorkspaceNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Workspace not found"})
+	case errors.Is(err, errWorkspaceForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You do not have permission for this operation on the workspace"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve workspace", "details": err.Error()})
+}
+
+// WorkspaceMemberMiddleware は /api/workspaces/:workspaceID/memos 以下のリクエストで、
+// ユーザーがワークスペースのメンバーであることを確認し、既存のメモハンドラーをワークスペース単位で動作させます。
+func WorkspaceMemberMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(string)
+		if !ok || userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+		}
+		workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleGuest)
+		if err != nil {
+			return workspaceAccessErrorResponse(c, err)
+		}
+		c.Locals("workspaceID", workspace.ID)
+		c.Locals("workspaceRole", role)
+		return c.Next()
+	}
+}
+
+// requestWorkspaceID はワークスペースのルート経由のリクエストの場合にワークスペースIDを返します。個人のメモの場合は空文字です。
+func requestWorkspaceID(c *fiber.Ctx) string {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	return workspaceID
+}
+
+// canCreateWorkspaceMemo はワークスペースでの役割がメモを作成できるかを返します (guest は閲覧のみ)
+func canCreateWorkspaceMemo(role string) bool {
+	return workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleMember]
+}
+
+// MemoListScope はメモ一覧の対象を絞り込むスコープです。workspaceID が空なら userID の個人のメモ、そうでなければワークスペースのメモです。
+func MemoListScope(userID, workspaceID string) func(*gorm.DB) *gorm.DB {
+	if workspaceID != "" {
+		return workspaceMemos(workspaceID)
+	}
+	return personalMemos(userID)
+}
+
+// userWorkspaces は userID が所属するワークスペースの一覧を返します
+func userWorkspaces(userID string) ([]WorkspaceSummary, error) {
+	var summaries []WorkspaceSummary
+	err := database.DB.Model(&models.Workspace{}).
+		Select("workspaces.*, workspace_members.role AS role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.name").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	if summaries == nil {
+		summaries = []WorkspaceSummary{}
+	}
+	return summaries, nil
+}
+
+// CreateWorkspace は新しいワークスペースを作成します。作成したユーザーが owner になります。
+func CreateWorkspace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateWorkspaceInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	workspace := models.Workspace{
+		ID:      utils.GenerateID(),
+		Name:    input.Name,
+		OwnerID: userID,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: models.WorkspaceRoleOwner}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create workspace", "details": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(WorkspaceSummary{Workspace: workspace, Role: models.WorkspaceRoleOwner})
+}
+
+// GetWorkspaces はユーザーが所属するワークスペースの一覧を返します
+func GetWorkspaces(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	summaries, err := userWorkspaces(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve workspaces", "details": err.Error()})
+	}
+	return c.JSON(summaries)
+}
+
+// GetWorkspace はワークスペースの情報を返します (メンバーのみ)
+func GetWorkspace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleGuest)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	return c.JSON(WorkspaceSummary{Workspace: *workspace, Role: role})
+}
+
+// UpdateWorkspace はワークスペースの名前を変更します (admin 以上)
+func UpdateWorkspace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateWorkspaceInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name is required"})
+	}
+
+	workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleAdmin)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	workspace.Name = input.Name
+	if err := database.DB.Save(workspace).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update workspace", "details": err.Error()})
+	}
+	return c.JSON(WorkspaceSummary{Workspace: *workspace, Role: role})
+}
+
+// DeleteWorkspace はワークスペースとそのメモをすべて削除します (owner のみ)。
+// メンバーがいなくなりゴミ箱から戻せないので、メモ (ゴミ箱のものを含む) は添付ファイルなどと一緒に完全に削除します。
+func DeleteWorkspace(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	workspace, _, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleOwner)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+
+	var blobHashes []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var memoIDs []string
+		if err := tx.Unscoped().Model(&models.Memo{}).Where("workspace_id = ?", workspace.ID).Pluck("id", &memoIDs).Error; err != nil {
+			return err
+		}
+		for _, memoID := range memoIDs {
+			hashes, err := purgeMemoTx(tx, memoID)
+			if err != nil {
+				return err
+			}
+			blobHashes = append(blobHashes, hashes...)
+		}
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(workspace).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete workspace", "details": err.Error()})
+	}
+	cleanupOrphanBlobs(c.Context(), blobHashes)
+
+	return c.JSON(fiber.Map{"message": "Workspace deleted successfully"})
+}
+
+// GetWorkspaceMembers はワークスペースのメンバー一覧を返します (メンバーのみ)
+func GetWorkspaceMembers(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	workspace, _, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleGuest)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	var members []models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ?", workspace.ID).Order("created_at").Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve members", "details": err.Error()})
+	}
+
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+	usernames, err := usernamesByID(userIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve users", "details": err.Error()})
+	}
+	responses := make([]WorkspaceMemberResponse, 0, len(members))
+	for _, member := range members {
+		responses = append(responses, WorkspaceMemberResponse{WorkspaceMember: member, Username: usernames[member.UserID]})
+	}
+	return c.JSON(responses)
+}
+
+// UpdateWorkspaceMember はメンバーの役割を変更します。
+// admin 以上が変更でき、admin の任命・解任は owner のみです。owner の役割は変更できません。
+func UpdateWorkspaceMember(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(UpdateWorkspaceMemberInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if !isAssignableWorkspaceRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be 'admin', 'member' or 'guest'"})
+	}
+
+	workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleAdmin)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	var member models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, c.Params("userID")).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve member", "details": err.Error()})
+	}
+	if member.Role == models.WorkspaceRoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The owner's role cannot be changed"})
+	}
+	if role != models.WorkspaceRoleOwner && (member.Role == models.WorkspaceRoleAdmin || input.Role == models.WorkspaceRoleAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the owner can appoint or dismiss admins"})
+	}
+
+	member.Role = input.Role
+	if err := database.DB.Save(&member).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update member", "details": err.Error()})
+	}
+	return c.JSON(member)
+}
+
+// RemoveWorkspaceMember はメンバーをワークスペースから外します。
+// 自分自身が抜ける場合は誰でも可能 (owner を除く)、他のメンバーを外すには admin 以上が必要です。
+func RemoveWorkspaceMember(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	targetID := c.Params("userID")
+	required := models.WorkspaceRoleAdmin
+	if targetID == userID {
+		required = models.WorkspaceRoleGuest
+	}
+	workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), required)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	var member models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, targetID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve member", "details": err.Error()})
+	}
+	if member.Role == models.WorkspaceRoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The owner cannot leave the workspace"})
+	}
+	if targetID != userID && member.Role == models.WorkspaceRoleAdmin && role != models.WorkspaceRoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the owner can remove admins"})
+	}
+
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", workspace.ID, targetID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not remove member", "details": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Member removed successfully"})
+}
+
+// isAssignableWorkspaceRole は招待・役割変更で指定できる役割かを返します (owner は作成者のみ)
+func isAssignableWorkspaceRole(role string) bool {
+	switch role {
+	case models.WorkspaceRoleAdmin, models.WorkspaceRoleMember, models.WorkspaceRoleGuest:
+		return true
+	}
+	return false
+}
+
+// CreateWorkspaceInvitation はユーザーをワークスペースに招待します (admin 以上、admin としての招待は owner のみ)
+func CreateWorkspaceInvitation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	input := new(CreateWorkspaceInvitationInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON", "details": err.Error()})
+	}
+	if input.Role == "" {
+		input.Role = models.WorkspaceRoleMember
+	}
+	if !isAssignableWorkspaceRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be 'admin', 'member' or 'guest'"})
+	}
+
+	workspace, role, err := findWorkspaceWithRole(userID, c.Params("workspaceID"), models.WorkspaceRoleAdmin)
+	if err != nil {
+		return workspaceAccessErrorResponse(c, err)
+	}
+	if input.Role == models.WorkspaceRoleAdmin && role != models.WorkspaceRoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the owner can appoint admins"})
+	}
+
+	var invitee models.User
+	if err := database.DB.Where("username = ?", input.Username).First(&invitee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve user", "details": err.Error()})
+	}
+	inviteeRole, err := workspaceRole(invitee.ID, workspace.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve member", "details": err.Error()})
+	}
+	if inviteeRole != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User is already a member of the workspace"})
+	}
+
+	// 同じユーザーへの招待が残っている場合は役割を上書きする
+	var invitation models.WorkspaceInvitation
+	err = database.DB.Where("workspace_id = ? AND invitee_id = ?", workspace.ID, invitee.ID).First(&invitation).Error
+	switch {
+	case err == nil:
+		invitation.InviterID = userID
+		invitation.Role = input.Role
+		err = database.DB.Save(&invitation).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		invitation = models.WorkspaceInvitation{
+			ID:          utils.GenerateID(),
+			WorkspaceID: workspace.ID,
+			InviterID:   userID,
+			InviteeID:   invitee.ID,
+			Role:        input.Role,
+		}
+		err = database.DB.Create(&invitation).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create invitation", "details": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(WorkspaceInvitationResponse{
+		WorkspaceInvitation: invitation,
+		WorkspaceName:       workspace.Name,
+		InviteeUsername:     invitee.Username,
+	})
+}
+
+// GetWorkspaceInvitations は /api/workspaces/:workspaceID/invitations ではワークスペースの未承諾の招待 (admin 以上)、
+// /api/invitations では自分宛ての招待の一覧を返します
+func GetWorkspaceInvitations(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	db := database.DB.Model(&models.WorkspaceInvitation{})
+	if workspaceID := c.Params("workspaceID"); workspaceID != "" {
+		if _, _, err := findWorkspaceWithRole(userID, workspaceID, models.WorkspaceRoleAdmin); err != nil {
+			return workspaceAccessErrorResponse(c, err)
+		}
+		db = db.Where("workspace_id = ?", workspaceID)
+	} else {
+		db = db.Where("invitee_id = ?", userID)
+	}
+	var invitations []models.WorkspaceInvitation
+	if err := db.Order("created_at desc").Find(&invitations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve invitations", "details": err.Error()})
+	}
+
+	userIDs := make([]string, 0, len(invitations))
+	workspaceIDs := make([]string, 0, len(invitations))
+	for _, invitation := range invitations {
+		userIDs = append(userIDs, invitation.InviteeID)
+		workspaceIDs = append(workspaceIDs, invitation.WorkspaceID)
+	}
+	usernames, err := usernamesByID(userIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve users", "details": err.Error()})
+	}
+	var workspaces []models.Workspace
+	if len(workspaceIDs) > 0 {
+		if err := database.DB.Where("id IN ?", workspaceIDs).Find(&workspaces).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve workspaces", "details": err.Error()})
+		}
+	}
+	names := make(map[string]string, len(workspaces))
+	for _, workspace := range workspaces {
+		names[workspace.ID] = workspace.Name
+	}
+
+	responses := make([]WorkspaceInvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		responses = append(responses, WorkspaceInvitationResponse{
+			WorkspaceInvitation: invitation,
+			WorkspaceName:       names[invitation.WorkspaceID],
+			InviteeUsername:     usernames[invitation.InviteeID],
+		})
+	}
+	return c.JSON(responses)
+}
+
+// AcceptWorkspaceInvitation は自分宛ての招待を承諾し、ワークスペースのメンバーになります
+func AcceptWorkspaceInvitation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	var invitation models.WorkspaceInvitation
+	if err := database.DB.Where("id = ? AND invitee_id = ?", c.Params("id"), userID).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve invitation", "details": err.Error()})
+	}
+
+	var workspace models.Workspace
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", invitation.WorkspaceID).First(&workspace).Error; err != nil {
+			return err
+		}
+		member := models.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: userID, Role: invitation.Role}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&invitation).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Workspace not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not accept invitation", "details": err.Error()})
+	}
+	return c.JSON(WorkspaceSummary{Workspace: workspace, Role: invitation.Role})
+}
+
+// DeclineWorkspaceInvitation は招待を辞退します。招待したワークスペースの admin 以上は取り消しにも使えます。
+func DeclineWorkspaceInvitation(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID not found or invalid in context"})
+	}
+
+	var invitation models.WorkspaceInvitation
+	if err := database.DB.Where("id = ?", c.Params("id")).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve invitation", "details": err.Error()})
+	}
+	if invitation.InviteeID != userID {
+		if _, _, err := findWorkspaceWithRole(userID, invitation.WorkspaceID, models.WorkspaceRoleAdmin); err != nil {
+			if errors.Is(err, errWorkspaceNotFound) || errors.Is(err, errWorkspaceForbidden) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+			}
+			return workspaceAccessErrorResponse(c, err)
+		}
+	}
+
+	if err := database.DB.Delete(&invitation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete invitation", "details": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Invitation deleted successfully"})
+}
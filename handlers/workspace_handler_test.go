@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaceMemosAndRoles(t *testing.T) {
+	ownerToken := loginTestUser(t, "wsowner", "password123")
+	memberToken := loginAdditionalTestUser(t, "wsmember", "password123")
+	guestToken := loginAdditionalTestUser(t, "wsguest", "password123")
+	outsiderToken := loginAdditionalTestUser(t, "wsoutsider", "password123")
+
+	resp := memoRequest(t, http.MethodPost, "/api/workspaces/", ownerToken, map[string]interface{}{"name": "Team"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	var workspace WorkspaceSummary
+	json.NewDecoder(resp.Body).Decode(&workspace)
+	assert.Equal(t, models.WorkspaceRoleOwner, workspace.Role)
+	base := "/api/workspaces/" + workspace.ID
+
+	// 招待を承諾するとメンバーになる
+	for username, role := range map[string]string{"wsmember": models.WorkspaceRoleMember, "wsguest": models.WorkspaceRoleGuest} {
+		resp = memoRequest(t, http.MethodPost, base+"/invitations", ownerToken, map[string]interface{}{"username": username, "role": role})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	}
+	for _, token := range []string{memberToken, guestToken} {
+		resp = memoRequest(t, http.MethodGet, "/api/invitations/", token, nil)
+		var invitations []WorkspaceInvitationResponse
+		json.NewDecoder(resp.Body).Decode(&invitations)
+		if assert.Len(t, invitations, 1) {
+			assert.Equal(t, "Team", invitations[0].WorkspaceName)
+			resp = memoRequest(t, http.MethodPost, "/api/invitations/"+invitations[0].ID+"/accept", token, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+		}
+	}
+
+	// ワークスペースのメモは個人のメモ一覧には含まれない
+	resp = memoRequest(t, http.MethodPost, base+"/memos/", ownerToken, map[string]interface{}{"title": "Plan", "content": "roadmap"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+	var memo models.Memo
+	json.NewDecoder(resp.Body).Decode(&memo)
+	assert.Equal(t, workspace.ID, memo.WorkspaceID)
+	createTestMemo(t, ownerToken, map[string]interface{}{"title": "Diary", "content": "personal"})
+
+	resp = memoRequest(t, http.MethodGet, "/api/memos/", ownerToken, nil)
+	var personal []models.Memo
+	json.NewDecoder(resp.Body).Decode(&personal)
+	if assert.Len(t, personal, 1) {
+		assert.Equal(t, "Diary", personal[0].Title)
+	}
+	resp = memoRequest(t, http.MethodGet, base+"/memos/", memberToken, nil)
+	var shared []models.Memo
+	json.NewDecoder(resp.Body).Decode(&shared)
+	if assert.Len(t, shared, 1) {
+		assert.Equal(t, "Plan", shared[0].Title)
+	}
+
+	// member は編集できるが他人のメモは削除できない
+	resp = memoRequest(t, http.MethodPut, base+"/memos/"+memo.ID, memberToken, map[string]interface{}{"content": "edited"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodDelete, base+"/memos/"+memo.ID, memberToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// guest は閲覧のみ
+	resp = memoRequest(t, http.MethodGet, base+"/memos/"+memo.ID, guestToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPut, base+"/memos/"+memo.ID, guestToken, map[string]interface{}{"content": "guest edit"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, base+"/memos/", guestToken, map[string]interface{}{"title": "Nope"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// メンバー以外はワークスペースもメモも見えない
+	resp = memoRequest(t, http.MethodGet, base+"/memos/", outsiderToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = memoRequest(t, http.MethodGet, "/api/memos/"+memo.ID, outsiderToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 個人のメモはワークスペースのルートからは見えない
+	resp = memoRequest(t, http.MethodGet, base+"/memos/"+personal[0].ID, ownerToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// メンバーから外すとアクセスできなくなる
+	var member models.User
+	testDB.Where("username = ?", "wsmember").First(&member)
+	resp = memoRequest(t, http.MethodDelete, base+"/members/"+member.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+	resp = memoRequest(t, http.MethodGet, base+"/memos/"+memo.ID, memberToken, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWorkspaceAdminRestrictions(t *testing.T) {
+	ownerToken := loginTestUser(t, "adminowner", "password123")
+	adminToken := loginAdditionalTestUser(t, "adminuser", "password123")
+	loginAdditionalTestUser(t, "adminother", "password123")
+
+	resp := memoRequest(t, http.MethodPost, "/api/workspaces/", ownerToken, map[string]interface{}{"name": "Ops"})
+	var workspace WorkspaceSummary
+	json.NewDecoder(resp.Body).Decode(&workspace)
+	base := "/api/workspaces/" + workspace.ID
+
+	resp = memoRequest(t, http.MethodPost, base+"/invitations", ownerToken, map[string]interface{}{"username": "adminuser", "role": "admin"})
+	var invitation WorkspaceInvitationResponse
+	json.NewDecoder(resp.Body).Decode(&invitation)
+	resp = memoRequest(t, http.MethodPost, "/api/invitations/"+invitation.ID+"/accept", adminToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	// admin は member を招待できるが admin は任命できない
+	resp = memoRequest(t, http.MethodPost, base+"/invitations", adminToken, map[string]interface{}{"username": "adminother", "role": "admin"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodPost, base+"/invitations", adminToken, map[string]interface{}{"username": "adminother"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, readResponseBody(resp))
+
+	// owner は抜けられず、ワークスペースの削除は owner のみ
+	var owner models.User
+	testDB.Where("username = ?", "adminowner").First(&owner)
+	resp = memoRequest(t, http.MethodDelete, base+"/members/"+owner.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodDelete, base, adminToken, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = memoRequest(t, http.MethodDelete, base, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, readResponseBody(resp))
+
+	resp = memoRequest(t, http.MethodGet, "/api/workspaces/", adminToken, nil)
+	var workspaces []WorkspaceSummary
+	json.NewDecoder(resp.Body).Decode(&workspaces)
+	assert.Empty(t, workspaces)
+}
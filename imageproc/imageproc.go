@@ -0,0 +1,155 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Variant は生成する縮小画像の種類です
+type Variant struct {
+	Name    string
+	MaxSize int // 長辺の最大ピクセル数
+}
+
+var (
+	Thumbnail = Variant{Name: "thumb", MaxSize: 256}
+	Web       = Variant{Name: "web", MaxSize: 1280}
+
+	// Variants は添付画像ごとに生成する縮小画像の一覧です
+	Variants = []Variant{Thumbnail, Web}
+)
+
+// VariantByName は名前から Variant を探します
+func VariantByName(name string) (Variant, bool) {
+	for _, v := range Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// ErrUnsupported は処理対象外の画像形式の場合のエラーです
+var ErrUnsupported = errors.New("unsupported image type")
+
+// ErrTooLarge は画素数が MaxPixels を超える画像の場合のエラーです
+var ErrTooLarge = errors.New("image is too large")
+
+// MaxPixels はデコードする画像の最大画素数 (幅×高さ) です。
+// 小さなファイルでも展開すると巨大になる画像でメモリを使い切らないよう、デコード前に確認します。
+var MaxPixels = 40_000_000
+
+// IsSupported は縮小画像を生成できる形式かどうかを返します
+func IsSupported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Check は画像をデコードせずにヘッダーを読み取り、壊れていないことと画素数が MaxPixels 以下であることを確認します
+func Check(data []byte, contentType string) error {
+	_, err := decodeConfig(data, contentType)
+	return err
+}
+
+func decodeConfig(data []byte, contentType string) (image.Config, error) {
+	if !IsSupported(contentType) {
+		return image.Config{}, ErrUnsupported
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > int64(MaxPixels) {
+		return image.Config{}, ErrTooLarge
+	}
+	return cfg, nil
+}
+
+// Dimensions は画像をデコードせずに幅と高さを読み取ります (EXIF の向きを考慮)
+func Dimensions(data []byte, contentType string) (int, int, error) {
+	cfg, err := decodeConfig(data, contentType)
+	if err != nil {
+		return 0, 0, err
+	}
+	if contentType == "image/jpeg" && JPEGOrientation(data) >= 5 {
+		return cfg.Height, cfg.Width, nil
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Sanitize はアップロードされた画像からメタデータを取り除きます。
+// JPEG の向きが EXIF で指定されている場合は、向きを画素に反映してから再エンコードします。
+func Sanitize(data []byte, contentType string) ([]byte, error) {
+	if err := Check(data, contentType); err != nil {
+		return nil, err
+	}
+	if contentType == "image/jpeg" {
+		if orientation := JPEGOrientation(data); orientation > 1 {
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, ApplyOrientation(img, orientation), &jpeg.Options{Quality: 92}); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+	}
+	return StripMetadata(data, contentType)
+}
+
+// Result は生成した縮小画像です
+type Result struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Resize は元画像から指定した Variant の縮小画像を生成します。
+// 透明部分のある画像は PNG、それ以外は JPEG で出力します。
+func Resize(data []byte, contentType string, variant Variant) (*Result, error) {
+	if err := Check(data, contentType); err != nil {
+		return nil, err
+	}
+	var img image.Image
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err == nil {
+			img = ApplyOrientation(img, JPEGOrientation(data))
+		}
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		img, err = gif.Decode(bytes.NewReader(data)) // アニメーションGIFは1フレーム目のみ
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resized := Fit(img, variant.MaxSize)
+	var buf bytes.Buffer
+	result := &Result{Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy()}
+	if hasAlpha(resized) {
+		result.ContentType = "image/png"
+		err = png.Encode(&buf, resized)
+	} else {
+		result.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Data = buf.Bytes()
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifSegment は Orientation と GPS 情報らしきデータを含む APP1 セグメントを作ります
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = append(tiff, 0x00, 0x01) // エントリ数
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:2], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:4], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:8], 1)
+	binary.BigEndian.PutUint16(entry[8:10], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPS 35.6812N 139.7671E")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:4], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func testJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	data := buf.Bytes()
+	// SOI の直後に EXIF を差し込む
+	return append(append([]byte{0xFF, 0xD8}, exifSegment(orientation)...), data[2:]...)
+}
+
+func TestSanitizeJPEG(t *testing.T) {
+	data := testJPEG(t, 40, 20, 1)
+	assert.Equal(t, 1, JPEGOrientation(data))
+	assert.True(t, bytes.Contains(data, []byte("GPS")))
+
+	stripped, err := Sanitize(data, "image/jpeg")
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(stripped, []byte("Exif")))
+	assert.False(t, bytes.Contains(stripped, []byte("GPS")))
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+}
+
+func TestSanitizeJPEGAppliesOrientation(t *testing.T) {
+	data := testJPEG(t, 40, 20, 6) // 時計回りに90度回転して表示する画像
+	assert.Equal(t, 6, JPEGOrientation(data))
+	w, h, err := Dimensions(data, "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{20, 40}, []int{w, h})
+
+	sanitized, err := Sanitize(data, "image/jpeg")
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(sanitized, []byte("GPS")))
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(sanitized))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{20, 40}, []int{cfg.Width, cfg.Height})
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img)) // 全面透明
+
+	result, err := Resize(buf.Bytes(), "image/png", Thumbnail)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, result.Width)
+	assert.Equal(t, 128, result.Height)
+	assert.Equal(t, "image/png", result.ContentType)
+
+	// 元画像より大きい Variant では拡大しない
+	small := testJPEG(t, 100, 50, 1)
+	result, err = Resize(small, "image/jpeg", Web)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, result.Width)
+	assert.Equal(t, "image/jpeg", result.ContentType)
+
+	_, err = Resize([]byte("%PDF"), "application/pdf", Web)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+// withPNGSize は PNG の IHDR の幅と高さを書き換えます (画素データはそのまま)
+func withPNGSize(data []byte, w, h uint32) []byte {
+	patched := append([]byte(nil), data...)
+	// シグネチャ (8) + 長さ (4) + "IHDR" (4) の後に幅と高さがある
+	binary.BigEndian.PutUint32(patched[16:20], w)
+	binary.BigEndian.PutUint32(patched[20:24], h)
+	binary.BigEndian.PutUint32(patched[29:33], crc32.ChecksumIEEE(patched[12:29]))
+	return patched
+}
+
+func TestCheckRejectsLargeImages(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8))))
+	assert.NoError(t, Check(buf.Bytes(), "image/png"))
+
+	// ファイルは小さくても展開すると巨大な画像はデコードしない
+	huge := withPNGSize(buf.Bytes(), 100000, 100000)
+	assert.ErrorIs(t, Check(huge, "image/png"), ErrTooLarge)
+	_, err := Sanitize(huge, "image/png")
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = Resize(huge, "image/png", Thumbnail)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = Sanitize([]byte("\x89PNG\r\n\x1a\nbroken"), "image/png")
+	assert.Error(t, err)
+}
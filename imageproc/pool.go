@@ -0,0 +1,53 @@
+package imageproc
+
+import (
+	"log"
+	"sync"
+)
+
+// Pool は画像処理を一定数のワーカーで実行するワーカープールです。
+// キューが一杯の場合は投入を諦め、縮小画像は初回アクセス時に生成されます。
+type Pool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+// NewPool は workers 個のワーカーと queueSize のキューを持つ Pool を起動します
+func NewPool(workers, queueSize int) *Pool {
+	p := &Pool{jobs: make(chan func(), queueSize)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("image worker: recovered from panic: %v", r)
+				}
+			}()
+			job()
+		}()
+	}
+}
+
+// Submit はジョブをキューに入れます。キューが一杯の場合はブロックせず false を返します。
+func (p *Pool) Submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close は新しいジョブの受付を止め、実行中のジョブの完了を待ちます
+func (p *Pool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
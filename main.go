@@ -1,41 +1,101 @@
 package main
 
 import (
-	"html/template"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
 
+	"github.com/linkalls/fast-memos/atrest"
 	"github.com/linkalls/fast-memos/auth"
 	"github.com/linkalls/fast-memos/database"
 	"github.com/linkalls/fast-memos/handlers"
+	"github.com/linkalls/fast-memos/markdown"
 	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/quota"
+	"github.com/linkalls/fast-memos/reminders"
+	"github.com/linkalls/fast-memos/storage"
+	"github.com/linkalls/fast-memos/utils"
 
-<<<<<<< HEAD
-=======
-	"github.com/gofiber/fiber/v2/middleware/cors" // 正しいCORSミドルウェアのインポートパス
->>>>>>> cf8f4a8a98aa49fa5312b8025b09858654ed5f54
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors" // CORSミドルウェアをインポート
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
-	"github.com/russross/blackfriday/v2"
 )
 
 func main() {
 	// データベースに接続
 	database.ConnectDatabase()
 
+	// メモのタイトル・本文の保存時の暗号化 (マスター鍵が設定されている場合のみ)
+	cipher, err := atrest.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	atrest.Enable(cipher)
+
+	// ユーザーごとの使用量の上限 (QUOTA_CONFIG または QUOTA_CONFIG_FILE が設定されている場合のみ)
+	quotaConfig, err := quota.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load quota config: %v", err)
+	}
+	quota.Enable(quotaConfig)
+	auth.Limiter = handlers.RequestQuota
+
+	// 全文検索の索引の無いメモがあれば索引を作る
+	if err := handlers.PrepareFullTextSearch(); err != nil {
+		log.Fatalf("Failed to prepare full-text search index: %v", err)
+	}
+
+	// 保存時の暗号化の検索用インデックスの形式が変わっていれば作り直す
+	if cipher != nil {
+		if _, err := cipher.PrepareIndex(database.DB, 0); err != nil {
+			log.Fatalf("Failed to prepare search index: %v", err)
+		}
+	}
+
+	// 重複検出の指紋の無いメモがあれば指紋を計算する
+	if _, err := handlers.BackfillMemoFingerprints(0); err != nil {
+		log.Fatalf("Failed to backfill memo fingerprints: %v", err)
+	}
+
+	// go run . reindex [-batch 100]: 全文検索の索引をすべてのメモから作り直す
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		reindex(os.Args[2:])
+		return
+	}
+
+	// go run . set-quota -user alice [-role trusted] [-memos 10000] ...: ユーザーのロールと上限の上書きを設定する
+	if len(os.Args) > 1 && os.Args[1] == "set-quota" {
+		setQuota(os.Args[2:])
+		return
+	}
+
+	// go run . rotate-keys [-batch 100]: データ鍵をローテーションしてメモを再暗号化する
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(cipher, os.Args[2:])
+		return
+	}
+
+	// 添付ファイルの保存先を初期化
+	storage.ConnectStorage()
+
+	// リマインダーのスケジューラーを起動
+	scheduler := reminders.NewScheduler(database.DB)
+	scheduler.Start(context.Background())
+
 	// HTMLテンプレートエンジンを設定
 	engine := html.New("./templates", ".html")
-	engine.AddFunc("markdown", func(text string) template.HTML {
-		// MarkdownをHTMLに変換
-		output := blackfriday.Run([]byte(text))
-		return template.HTML(output)
-	})
+	engine.AddFuncMap(markdown.TemplateFuncs()) // MarkdownをHTMLに変換する関数など
 
 	// Fiberアプリのインスタンスを作成
 	app := fiber.New(fiber.Config{
-		Views: engine,
+		Views:     engine,
+		BodyLimit: 32 * 1024 * 1024, // 添付ファイルのアップロード用に32MBまで許可
 	})
 
 	// ミドルウェアの設定
@@ -44,8 +104,8 @@ func main() {
 
 	// CORSミドルウェアの設定
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",                                           // 全てのオリジンを許可
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization", // Authorizationヘッダーも許可
+		AllowOrigins: "*",                                                           // 全てのオリジンを許可
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Reauth-Token", // Authorization・再認証トークンのヘッダーも許可
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
 	}))
 
@@ -56,22 +116,166 @@ func main() {
 	authRoutes := api.Group("/auth")
 	authRoutes.Post("/register", handlers.RegisterUser)
 	authRoutes.Post("/login", handlers.LoginUser)
+	authRoutes.Post("/reauth", auth.AuthMiddleware(), handlers.Reauthenticate) // 保護されたメモを表示するための再認証
 
 	// メモ関連のルート (認証が必要)
 	memoRoutes := api.Group("/memos", auth.AuthMiddleware()) // AuthMiddlewareを適用
 	memoRoutes.Post("/", handlers.CreateMemo)
 	memoRoutes.Get("/", handlers.GetMemos)
-	memoRoutes.Get("/search", handlers.SearchMemos) // 検索エンドポイント
+	memoRoutes.Get("/search", handlers.SearchMemos)      // 検索エンドポイント
+	memoRoutes.Get("/shared", handlers.GetSharedMemos)   // 共有されたメモ
+	memoRoutes.Get("/geojson", handlers.GetMemosGeoJSON) // 位置情報付きのメモの GeoJSON エクスポート
+	memoRoutes.Post("/batch", handlers.BatchMemos)       // 一括操作
+	memoRoutes.Post("/merge", handlers.MergeMemos)
+	memoRoutes.Get("/trash", handlers.GetTrashedMemos)
+	memoRoutes.Get("/duplicates", handlers.GetDuplicateMemos)
 	memoRoutes.Get("/:id", handlers.GetMemo)
 	memoRoutes.Put("/:id", handlers.UpdateMemo)
 	memoRoutes.Delete("/:id", handlers.DeleteMemo)
+	memoRoutes.Post("/:id/split", handlers.SplitMemo)
+	memoRoutes.Post("/:id/lock", handlers.LockMemo)
+	memoRoutes.Delete("/:id/lock", handlers.UnlockMemo)
+	memoRoutes.Post("/:id/protect", handlers.ProtectMemo)
+	memoRoutes.Delete("/:id/protect", handlers.UnprotectMemo)
+	memoRoutes.Post("/:id/reminders", handlers.CreateReminder)
+	memoRoutes.Post("/:id/attachments", handlers.UploadAttachments)
+	memoRoutes.Get("/:id/attachments", handlers.GetAttachments)
+	memoRoutes.Post("/:id/shares", handlers.CreateShare)
+	memoRoutes.Get("/:id/shares", handlers.GetShares)
+	memoRoutes.Post("/:id/grants", handlers.CreateGrant)
+	memoRoutes.Get("/:id/comments", handlers.GetComments)
+	memoRoutes.Post("/:id/comments", handlers.CreateComment)
+	memoRoutes.Put("/:id/comments/:commentID", handlers.UpdateComment)
+	memoRoutes.Delete("/:id/comments/:commentID", handlers.DeleteComment)
+	memoRoutes.Post("/:id/comments/:commentID/resolve", handlers.ResolveComment)
+	memoRoutes.Delete("/:id/comments/:commentID/resolve", handlers.UnresolveComment)
+	memoRoutes.Get("/:id/grants", handlers.GetGrants)
+
+	// ワークスペース関連のルート (認証が必要)
+	workspaceRoutes := api.Group("/workspaces", auth.AuthMiddleware())
+	workspaceRoutes.Post("/", handlers.CreateWorkspace)
+	workspaceRoutes.Get("/", handlers.GetWorkspaces)
+	workspaceRoutes.Get("/:workspaceID", handlers.GetWorkspace)
+	workspaceRoutes.Put("/:workspaceID", handlers.UpdateWorkspace)
+	workspaceRoutes.Delete("/:workspaceID", handlers.DeleteWorkspace)
+	workspaceRoutes.Get("/:workspaceID/members", handlers.GetWorkspaceMembers)
+	workspaceRoutes.Put("/:workspaceID/members/:userID", handlers.UpdateWorkspaceMember)
+	workspaceRoutes.Delete("/:workspaceID/members/:userID", handlers.RemoveWorkspaceMember)
+	workspaceRoutes.Post("/:workspaceID/invitations", handlers.CreateWorkspaceInvitation)
+	workspaceRoutes.Get("/:workspaceID/invitations", handlers.GetWorkspaceInvitations)
+
+	// ワークスペースのメモ (既存のメモハンドラーをワークスペース単位で使う)
+	workspaceMemoRoutes := workspaceRoutes.Group("/:workspaceID/memos", handlers.WorkspaceMemberMiddleware())
+	workspaceMemoRoutes.Post("/", handlers.CreateMemo)
+	workspaceMemoRoutes.Get("/", handlers.GetMemos)
+	workspaceMemoRoutes.Get("/search", handlers.SearchMemos)
+	workspaceMemoRoutes.Get("/geojson", handlers.GetMemosGeoJSON)
+	workspaceMemoRoutes.Post("/batch", handlers.BatchMemos)
+	workspaceMemoRoutes.Post("/merge", handlers.MergeMemos)
+	workspaceMemoRoutes.Get("/trash", handlers.GetTrashedMemos)
+	workspaceMemoRoutes.Get("/duplicates", handlers.GetDuplicateMemos)
+	workspaceMemoRoutes.Get("/:id", handlers.GetMemo)
+	workspaceMemoRoutes.Put("/:id", handlers.UpdateMemo)
+	workspaceMemoRoutes.Delete("/:id", handlers.DeleteMemo)
+	workspaceMemoRoutes.Post("/:id/split", handlers.SplitMemo)
+	workspaceMemoRoutes.Post("/:id/lock", handlers.LockMemo)
+	workspaceMemoRoutes.Delete("/:id/lock", handlers.UnlockMemo)
+	workspaceMemoRoutes.Post("/:id/protect", handlers.ProtectMemo)
+	workspaceMemoRoutes.Delete("/:id/protect", handlers.UnprotectMemo)
+	workspaceMemoRoutes.Get("/:id/comments", handlers.GetComments)
+	workspaceMemoRoutes.Post("/:id/comments", handlers.CreateComment)
+	workspaceMemoRoutes.Put("/:id/comments/:commentID", handlers.UpdateComment)
+	workspaceMemoRoutes.Delete("/:id/comments/:commentID", handlers.DeleteComment)
+	workspaceMemoRoutes.Post("/:id/comments/:commentID/resolve", handlers.ResolveComment)
+	workspaceMemoRoutes.Delete("/:id/comments/:commentID/resolve", handlers.UnresolveComment)
+
+	// 自分宛てのワークスペース招待 (認証が必要)
+	invitationRoutes := api.Group("/invitations", auth.AuthMiddleware())
+	invitationRoutes.Get("/", handlers.GetWorkspaceInvitations)
+	invitationRoutes.Post("/:id/accept", handlers.AcceptWorkspaceInvitation)
+	invitationRoutes.Delete("/:id", handlers.DeclineWorkspaceInvitation)
+
+	// 添付ファイル関連のルート (認証が必要)
+	attachmentRoutes := api.Group("/attachments", auth.AuthMiddleware())
+	attachmentRoutes.Get("/:id", handlers.DownloadAttachment)
+	attachmentRoutes.Delete("/:id", handlers.DeleteAttachment)
+
+	// 共有リンク関連のルート (認証が必要)
+	shareRoutes := api.Group("/shares", auth.AuthMiddleware())
+	shareRoutes.Get("/", handlers.GetShares)
+	shareRoutes.Delete("/:id", handlers.RevokeShare)
+
+	// ユーザー間の共有 (ACL) 関連のルート (認証が必要)
+	grantRoutes := api.Group("/grants", auth.AuthMiddleware())
+	grantRoutes.Post("/", handlers.CreateGrant)
+	grantRoutes.Get("/", handlers.GetGrants)
+	grantRoutes.Delete("/:id", handlers.RevokeGrant)
+
+	// リマインダー・通知関連のルート (認証が必要)
+	reminderRoutes := api.Group("/reminders", auth.AuthMiddleware())
+	reminderRoutes.Get("/", handlers.GetReminders)
+	reminderRoutes.Delete("/:id", handlers.DeleteReminder)
+
+	notificationRoutes := api.Group("/notifications", auth.AuthMiddleware())
+	notificationRoutes.Get("/", handlers.GetNotifications)
+	notificationRoutes.Post("/:id/read", handlers.MarkNotificationRead)
+
+	// タスク関連のルート (認証が必要)
+	taskRoutes := api.Group("/tasks", auth.AuthMiddleware())
+	taskRoutes.Get("/", handlers.GetTasks)
+	taskRoutes.Post("/:id/toggle", handlers.ToggleTask)
+
+	// エンドツーエンド暗号化の鍵 (デバイスごとにラップされたもの)
+	keyRoutes := api.Group("/keys", auth.AuthMiddleware())
+	keyRoutes.Post("/", handlers.CreateUserKey)
+	keyRoutes.Get("/", handlers.GetUserKeys)
+	keyRoutes.Delete("/:id", handlers.DeleteUserKey)
+
+	// デイリーノート関連のルート (認証が必要)
+	dailyRoutes := api.Group("/daily", auth.AuthMiddleware())
+	dailyRoutes.Get("/", handlers.GetDailyNotes)
+	dailyRoutes.Get("/:date", handlers.GetDailyNote)
+
+	// 統計 (認証が必要)
+	statsRoutes := api.Group("/stats", auth.AuthMiddleware())
+	statsRoutes.Get("/", handlers.GetStats)
+
+	// 上限と使用量 (認証が必要)
+	meRoutes := api.Group("/me", auth.AuthMiddleware())
+	meRoutes.Get("/usage", handlers.GetUsage)
+
+	// 公開メモ関連のルート (認証不要)
+	publicRoutes := api.Group("/public")
+	publicRoutes.Get("/memos/:id", handlers.GetPublicMemo)
+	publicRoutes.Get("/users/:username/memos", handlers.GetPublicProfile)
+
+	// 振り返り関連のルート (認証が必要)
+	reviewRoutes := api.Group("/review", auth.AuthMiddleware())
+	reviewRoutes.Get("/settings", handlers.GetReviewSettings)
+	reviewRoutes.Put("/settings", handlers.UpdateReviewSettings)
+	reviewRoutes.Get("/on-this-day", handlers.GetOnThisDay)
+	reviewRoutes.Get("/random", handlers.GetRandomReview)
+	reviewRoutes.Get("/queue", handlers.GetReviewQueue)
+	reviewRoutes.Post("/memos/:id/snooze", handlers.SnoozeReview)
+	reviewRoutes.Post("/memos/:id/remind", handlers.RemindReview)
+	reviewRoutes.Post("/memos/:id/reviewed", handlers.MarkReviewed)
+
+	cardRoutes := api.Group("/cards", auth.AuthMiddleware())
+	cardRoutes.Get("/", handlers.GetCards)
+	cardRoutes.Get("/due", handlers.GetDueCards)
+	cardRoutes.Post("/:id/grade", handlers.GradeCard)
+
+	// ユーザー設定関連のルート (認証が必要)
+	userRoutes := api.Group("/users", auth.AuthMiddleware())
+	userRoutes.Get("/me", handlers.GetCurrentUser)
+	userRoutes.Put("/me", handlers.UpdateUserSettings)
 
 	// 静的ファイル配信 (publicディレクトリ)
 	app.Static("/public", "./public")
 
 	// Web UIルート
 	app.Get("/", func(c *fiber.Ctx) error {
-		userID := c.Cookies("user_id")
+		userID := handlers.WebUserID(c)
 		if userID == "" {
 			authHeader := c.Get("Authorization")
 			if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
@@ -86,17 +290,35 @@ func main() {
 			return c.Redirect("/login")
 		}
 		q := c.Query("q")
+		workspaces, workspaceID := handlers.WebWorkspaces(c, userID)
 		var memos []models.Memo
-		db := database.DB.Where("user_id = ?", userID)
+		base := handlers.MemoListScope(userID, workspaceID)
+		db := database.DB.Scopes(base)
+		order, searchError, status := "created_at desc", "", fiber.StatusOK
 		if q != "" {
-			like := "%" + q + "%"
-			db = db.Where("title LIKE ? OR content LIKE ? OR category LIKE ?", like, like, like)
+			// 暗号化されたメモの本文 (暗号文) は検索しない
+			search, searchOrder, err := handlers.MemoSearchScope(userID, q, base, true)
+			var queryErr *utils.SearchQueryError
+			switch {
+			case errors.As(err, &queryErr):
+				searchError, status = queryErr.Error(), fiber.StatusBadRequest
+				db = db.Where("1 = 0")
+			case err != nil:
+				return c.Status(fiber.StatusInternalServerError).SendString("Could not search memos")
+			default:
+				db, order = db.Scopes(search), searchOrder
+			}
 		}
-		db.Order("created_at desc").Find(&memos)
-		return c.Render("index", fiber.Map{
-			"Title": "Fast Memos",
-			"Memos": memos,
-			"Query": q,
+		db.Order(order).Find(&memos)
+		hasHidden := handlers.PrepareMemosForDisplay(c, userID, memos)
+		return c.Status(status).Render("index", fiber.Map{
+			"HasHidden":   hasHidden,
+			"Title":       "Fast Memos",
+			"Memos":       memos,
+			"Query":       q,
+			"SearchError": searchError,
+			"Workspaces":  workspaces,
+			"WorkspaceID": workspaceID,
 		})
 	})
 
@@ -116,16 +338,137 @@ func main() {
 	app.Post("/login", handlers.WebLoginUser)
 	app.Post("/register", handlers.WebRegisterUser)
 	app.Post("/memos", handlers.WebCreateMemo)
+	app.Post("/memos/batch", handlers.WebBatchMemos)
 	app.Post("/memos/:id/delete", handlers.WebDeleteMemo)
+	app.Get("/memos/:id", handlers.WebShowMemo)
 	app.Get("/memos/:id/edit", handlers.WebEditMemo)
 	app.Post("/memos/:id/edit", handlers.WebUpdateMemo)
+	app.Post("/memos/:id/lock", handlers.WebSetMemoLock(true))
+	app.Post("/memos/:id/unlock", handlers.WebSetMemoLock(false))
+	app.Post("/memos/:id/comments", handlers.WebCreateComment)
+	app.Post("/memos/:id/comments/:commentID/edit", handlers.WebCommentAction("edit"))
+	app.Post("/memos/:id/comments/:commentID/delete", handlers.WebCommentAction("delete"))
+	app.Post("/memos/:id/comments/:commentID/resolve", handlers.WebCommentAction("resolve"))
+	app.Post("/memos/:id/comments/:commentID/unresolve", handlers.WebCommentAction("unresolve"))
+	app.Post("/reauth", handlers.WebReauthenticate)
+	app.Post("/workspace", handlers.WebSwitchWorkspace)
+	app.Get("/daily/:date", handlers.WebDailyNote)
+	app.Get("/map/data", handlers.WebMapData) // 地図表示用の位置情報 (GeoJSON)
+	app.Get("/tasks", handlers.WebTasks)
+	app.Get("/review", handlers.WebReview)
+	app.Post("/review/:id/snooze", handlers.WebReviewAction("snooze"))
+	app.Post("/review/:id/remind", handlers.WebReviewAction("remind"))
+	app.Post("/review/:id/reviewed", handlers.WebReviewAction("reviewed"))
+	app.Get("/cards/review", handlers.WebCardReview)
+	app.Post("/cards/:id/grade", handlers.WebGradeCard)
+	app.Get("/attachments/:id", handlers.WebDownloadAttachment)
+
+	// 共有リンク (認証不要)
+	app.Get("/s/:token", handlers.WebShowShare)
+	app.Post("/s/:token", handlers.WebUnlockShare)
+	app.Get("/s/:token/attachments/:id", handlers.WebShareAttachment)
+
+	// 公開メモ・プロフィールページ (認証不要)
+	app.Get("/p/:id", handlers.WebPublicMemo)
+	app.Get("/p/:memoID/attachments/:id", handlers.WebPublicAttachment)
+	app.Get("/u/:username", handlers.WebProfile)
+	app.Post("/tasks/:id/toggle", handlers.WebToggleTask)
 
 	// サーバーを指定ポートで起動 (例: 3000)
 	// ポートは環境変数などから取得するのが望ましい
 	port := "3000"
 	log.Printf("Server is starting on port %s\n", port)
-	err := app.Listen(":" + port)
+	err = app.Listen(":" + port)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
 }
+
+// rotateKeys はデータ鍵のローテーション (暗号化を有効にする前のメモの暗号化を含む) を実行します
+func rotateKeys(cipher *atrest.Cipher, args []string) {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	batchSize := flags.Int("batch", 100, "number of memos to re-encrypt per transaction")
+	flags.Parse(args)
+	if cipher == nil {
+		log.Fatal("ENCRYPTION_MASTER_KEY (or ENCRYPTION_MASTER_KEY_FILE) is not set")
+	}
+	result, err := cipher.Rotate(database.DB, *batchSize)
+	if err != nil {
+		log.Fatalf("Key rotation failed after %d memos: %v", result.Memos, err)
+	}
+	fmt.Printf("Re-encrypted %d memos and %d derived rows, deleted %d unused data keys\n", result.Memos, result.Rows, result.DeletedKeys)
+}
+
+// reindex は全文検索の索引を作り直します
+func reindex(args []string) {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	batchSize := flags.Int("batch", 100, "number of memos to index per transaction")
+	flags.Parse(args)
+	if !database.FullTextSearch {
+		log.Fatal("SQLite FTS5 is not available (build with -tags sqlite_fts5)")
+	}
+	if atrest.Current != nil {
+		log.Fatal("Full-text search index is not used while encryption at rest is enabled")
+	}
+	indexed, err := handlers.ReindexFullTextSearch(*batchSize)
+	if err != nil {
+		log.Fatalf("Reindex failed after %d memos: %v", indexed, err)
+	}
+	fmt.Printf("Indexed %d memos\n", indexed)
+}
+
+// setQuota はユーザーのロールと上限の上書きを設定します。
+// 上限は数値 (0 は無制限) で指定し、"default" を指定するとロールの上限に戻します。省略した項目は変更しません。
+func setQuota(args []string) {
+	flags := flag.NewFlagSet("set-quota", flag.ExitOnError)
+	username := flags.String("user", "", "username to update (required)")
+	role := flags.String("role", "", "role whose limits apply to the user (e.g. user)")
+	memos := flags.String("memos", "", `max number of memos, or "default"`)
+	contentBytes := flags.String("content-bytes", "", `max total bytes of memo titles and contents, or "default"`)
+	attachmentBytes := flags.String("attachment-bytes", "", `max total bytes of attachments, or "default"`)
+	requestsPerDay := flags.String("requests-per-day", "", `max API requests per day (UTC), or "default"`)
+	flags.Parse(args)
+	if *username == "" {
+		log.Fatal("-user is required")
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", *username).First(&user).Error; err != nil {
+		log.Fatalf("User %q not found: %v", *username, err)
+	}
+	if *role != "" {
+		if err := database.DB.Model(&user).UpdateColumn("role", *role).Error; err != nil {
+			log.Fatalf("Could not update role: %v", err)
+		}
+	}
+
+	var override models.UserQuota
+	if err := database.DB.Where("user_id = ?", user.ID).FirstOrInit(&override, models.UserQuota{UserID: user.ID}).Error; err != nil {
+		log.Fatalf("Could not load quota: %v", err)
+	}
+	for name, field := range map[string]struct {
+		value  string
+		target **int64
+	}{
+		"memos":            {*memos, &override.Memos},
+		"content-bytes":    {*contentBytes, &override.ContentBytes},
+		"attachment-bytes": {*attachmentBytes, &override.AttachmentBytes},
+		"requests-per-day": {*requestsPerDay, &override.RequestsPerDay},
+	} {
+		switch field.value {
+		case "":
+		case "default":
+			*field.target = nil
+		default:
+			limit, err := strconv.ParseInt(field.value, 10, 64)
+			if err != nil || limit < 0 {
+				log.Fatalf("-%s must be a non-negative number or \"default\"", name)
+			}
+			*field.target = &limit
+		}
+	}
+	if err := database.DB.Save(&override).Error; err != nil {
+		log.Fatalf("Could not save quota: %v", err)
+	}
+	fmt.Printf("Updated quota for %s\n", user.Username)
+}
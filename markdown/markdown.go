@@ -0,0 +1,141 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// メモ本文で添付ファイルを参照するときのスキーム (例: ![](attachment:ID))
+const attachmentScheme = "attachment:"
+
+// 添付ファイルの配信URLのデフォルトのプレフィックス
+const defaultAttachmentBase = "/attachments/"
+
+// policy は変換したHTMLから script やイベントハンドラ属性、javascript: のURLなどを取り除くポリシーです。
+// メモ本文やコメントは他のユーザー (共有・公開ページの閲覧者) にも表示されるため、生のHTMLをそのまま出力しません。
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(false)
+	// writeAttachmentImage が出力する縮小画像の属性
+	p.AllowAttrs("srcset", "sizes").OnElements("img")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("img")
+	return p
+}
+
+// renderer は添付ファイル参照を解決する blackfriday のレンダラーです
+type renderer struct {
+	*blackfriday.HTMLRenderer
+	attachmentBase string
+}
+
+func newRenderer(attachmentBase string, flags blackfriday.HTMLFlags) *renderer {
+	return &renderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: flags,
+		}),
+		attachmentBase: attachmentBase,
+	}
+}
+
+func (r *renderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Image:
+		if id, ok := attachmentID(node.LinkData.Destination); ok {
+			if entering {
+				writeAttachmentImage(w, r.attachmentBase+id, altText(node), string(node.LinkData.Title))
+			}
+			return blackfriday.SkipChildren
+		}
+	case blackfriday.Link:
+		if id, ok := attachmentID(node.LinkData.Destination); ok {
+			node.LinkData.Destination = []byte(r.attachmentBase + id)
+		}
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+func attachmentID(destination []byte) (string, bool) {
+	dest := string(destination)
+	if !strings.HasPrefix(dest, attachmentScheme) {
+		return "", false
+	}
+	id := strings.TrimPrefix(dest, attachmentScheme)
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return "", false
+		}
+	}
+	return id, id != ""
+}
+
+// writeAttachmentImage は縮小画像を使い分ける srcset 付きの img タグを書き出します
+func writeAttachmentImage(w io.Writer, src, alt, title string) {
+	io.WriteString(w, `<a href="`+src+`"><img src="`+src+`?variant=web"`+
+		` srcset="`+src+`?variant=thumb 256w, `+src+`?variant=web 1280w"`+
+		` sizes="(max-width: 768px) 100vw, 768px" loading="lazy" alt="`+html.EscapeString(alt)+`"`)
+	if title != "" {
+		io.WriteString(w, ` title="`+html.EscapeString(title)+`"`)
+	}
+	io.WriteString(w, ` /></a>`)
+}
+
+// altText は画像ノードの子ノードから代替テキストを組み立てます
+func altText(node *blackfriday.Node) string {
+	var buf bytes.Buffer
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (n.Type == blackfriday.Text || n.Type == blackfriday.Code) {
+			buf.Write(n.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return buf.String()
+}
+
+// Render はメモ本文のMarkdownをHTMLに変換します (テンプレート関数 markdown)
+func Render(text string) template.HTML {
+	return RenderWithAttachmentBase(text, defaultAttachmentBase)
+}
+
+// RenderWithAttachmentBase は添付ファイルのURLのプレフィックスを指定して変換します。
+// 共有リンクのページなど、/attachments/ 以外から添付ファイルを配信する場合に使います。
+// 出力は policy で無害化します。
+func RenderWithAttachmentBase(text, attachmentBase string) template.HTML {
+	output := blackfriday.Run([]byte(text), blackfriday.WithRenderer(newRenderer(attachmentBase, blackfriday.CommonHTMLFlags)))
+	return template.HTML(policy.SanitizeBytes(output))
+}
+
+// RenderComment はコメントのMarkdownをHTMLに変換します (テンプレート関数 commentMarkdown)。
+// コメントはメモを閲覧できる他のユーザーも書けるため、本文中の生のHTMLは出力しません。
+func RenderComment(text string) template.HTML {
+	flags := blackfriday.CommonHTMLFlags | blackfriday.SkipHTML
+	output := blackfriday.Run([]byte(text), blackfriday.WithRenderer(newRenderer(defaultAttachmentBase, flags)))
+	return template.HTML(policy.SanitizeBytes(output))
+}
+
+// TemplateFuncs はテンプレートエンジンに登録する関数です
+//
+//	markdown:        メモ本文をHTMLに変換
+//	commentMarkdown: コメントをHTMLに変換 (生のHTMLは出力しない)
+//	sharedMarkdown:  共有リンクのページ用 (添付ファイルを /s/:token/attachments/ から配信)
+//	publicMarkdown:  公開メモ・プロフィールのページ用 (添付ファイルを /p/:id/attachments/ から配信)
+func TemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"markdown":        Render,
+		"commentMarkdown": RenderComment,
+		"sharedMarkdown": func(text, shareToken string) template.HTML {
+			return RenderWithAttachmentBase(text, "/s/"+shareToken+"/attachments/")
+		},
+		"publicMarkdown": func(text, memoID string) template.HTML {
+			return RenderWithAttachmentBase(text, "/p/"+memoID+"/attachments/")
+		},
+	}
+}
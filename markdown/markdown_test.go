@@ -0,0 +1,37 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderAttachments(t *testing.T) {
+	out := string(Render("![写真](attachment:abc123)\n\n[資料](attachment:def456)\n\n![外部](https://example.com/a.png)"))
+	assert.Contains(t, out, `src="/attachments/abc123?variant=web"`)
+	assert.Contains(t, out, `srcset="/attachments/abc123?variant=thumb 256w, /attachments/abc123?variant=web 1280w"`)
+	assert.Contains(t, out, `alt="写真"`)
+	assert.Contains(t, out, `<a href="/attachments/def456">資料</a>`)
+	assert.Contains(t, out, `<img src="https://example.com/a.png" alt="外部"/>`)
+}
+
+func TestRenderSanitizesHTML(t *testing.T) {
+	out := string(Render("こんにちは<script>alert(1)</script>\n\n<img src=x onerror=\"alert(1)\">\n\n[link](javascript:alert(1))\n\n<iframe src=\"https://example.com\"></iframe>"))
+	assert.NotContains(t, out, "<script")
+	assert.NotContains(t, out, "onerror")
+	assert.NotContains(t, out, "javascript:")
+	assert.NotContains(t, out, "<iframe")
+	assert.Contains(t, out, "こんにちは")
+
+	shared := string(RenderWithAttachmentBase("<script>alert(1)</script>**太字**", "/s/token/attachments/"))
+	assert.NotContains(t, shared, "<script")
+	assert.Contains(t, shared, "<strong>太字</strong>")
+}
+
+func TestRenderCommentSkipsHTML(t *testing.T) {
+	out := string(RenderComment("**了解**です<b onclick=\"alert(1)\">太字</b><script>alert(1)</script>"))
+	assert.Contains(t, out, "<strong>了解</strong>")
+	assert.NotContains(t, out, "<b")
+	assert.NotContains(t, out, "<script")
+	assert.NotContains(t, out, "onclick")
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Blob は保存済みファイルの実体です。同じ内容のファイルは1つの Blob を共有します。
+type Blob struct {
+	Hash        string `gorm:"primaryKey"` // SHA-256 (16進)、BlobStore のキー
+	CreatedAt   time.Time
+	Size        int64
+	ContentType string
+	Width       int // 画像の場合のみ
+	Height      int
+}
+
+// ImageVariant は画像の Blob から生成したサムネイルなどの縮小画像です
+type ImageVariant struct {
+	SourceHash  string `gorm:"primaryKey"` // 元画像の Blob.Hash
+	Variant     string `gorm:"primaryKey"` // thumb / web
+	CreatedAt   time.Time
+	Key         string // BlobStore のキー
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+}
+
+// Attachment はメモに添付されたファイルです
+type Attachment struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	MemoID      string `gorm:"index;not null"`
+	UserID      string `gorm:"index;not null"`
+	BlobHash    string `gorm:"index;not null"`
+	Filename    string
+	ContentType string
+	Size        int64
+	Width       int // 画像の場合のみ
+	Height      int
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Card はメモ本文の "質問:: 答え" の行や {{c1::穴埋め}} から作られたフラッシュカードです。
+// メモ保存時に再生成されますが、同じキーのカードは復習の状態を引き継ぎます。
+// 本文から消えたカードは論理削除し、元に戻したときに復習の状態を復元します。
+type Card struct {
+	ID             string `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	MemoID         string         `gorm:"uniqueIndex:idx_card_key;not null"`
+	UserID         string         `gorm:"index;not null"`
+	Key            string         `gorm:"uniqueIndex:idx_card_key;not null"` // 質問文・穴埋めの行と番号から求めたキー
+	Kind           string         `gorm:"not null"`                          // basic / cloze
+	Front          string         // 表 (Markdown)
+	Back           string         // 裏 (Markdown)
+	Line           int            // メモ本文での行番号 (1始まり)
+	EaseFactor     float64        `gorm:"not null;default:2.5"`
+	IntervalDays   int            // 現在の復習間隔 (日)
+	Repetitions    int            // 連続して正解した回数
+	Lapses         int            // 忘れた回数
+	DueAt          time.Time      `gorm:"index"`
+	LastReviewedAt *time.Time
+}
+
+// BeforeSave は保存時の暗号化が有効ならカードの表・裏を暗号化します
+func (c *Card) BeforeSave(tx *gorm.DB) error {
+	return encryptValues(tx, c.UserID, &c.Front, &c.Back)
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (c *Card) AfterSave(tx *gorm.DB) error {
+	return decryptValues(tx, &c.Front, &c.Back)
+}
+
+// AfterFind は読み込んだカードの表・裏を復号します
+func (c *Card) AfterFind(tx *gorm.DB) error {
+	return decryptValues(tx, &c.Front, &c.Back)
+}
+
+// CardReview はフラッシュカードの復習の記録です
+type CardReview struct {
+	ID           string `gorm:"primaryKey"`
+	CardID       string `gorm:"index;not null"`
+	UserID       string `gorm:"index;not null"`
+	Grade        int    // 0 (全く思い出せない) 〜 5 (完璧)
+	IntervalDays int    // 評価後の復習間隔 (日)
+	EaseFactor   float64
+	ReviewedAt   time.Time
+}
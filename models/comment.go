@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment はメモに付けられたコメントです。
+// ParentID が空ならスレッドの最初のコメント、そうでなければそのスレッドへの返信です (返信への返信もスレッドにまとめる)。
+type Comment struct {
+	ID         string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	MemoID     string     `gorm:"index;not null"`
+	UserID     string     `gorm:"index;not null"`            // 投稿者
+	ParentID   string     `gorm:"index;not null;default:''"` // 返信先のスレッド (最初のコメントのID)
+	Body       string     `gorm:"not null"`                  // 本文 (Markdown)
+	EditedAt   *time.Time // 投稿者が本文を編集した日時
+	Resolved   bool       `gorm:"not null;default:false"` // スレッドが解決済みなら true (最初のコメントのみ)
+	ResolvedBy string     // 解決済みにしたユーザー
+	ResolvedAt *time.Time
+	Username   string    `gorm:"-"` // 投稿者のユーザー名 (レスポンス用)
+	Replies    []Comment `gorm:"-"` // スレッドの返信 (レスポンス用、古い順)
+}
+
+// BeforeSave は保存時の暗号化が有効ならコメントの本文を暗号化します
+func (c *Comment) BeforeSave(tx *gorm.DB) error {
+	return encryptValues(tx, c.UserID, &c.Body)
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (c *Comment) AfterSave(tx *gorm.DB) error {
+	return decryptValues(tx, &c.Body)
+}
+
+// AfterFind は読み込んだコメントの本文を復号します
+func (c *Comment) AfterFind(tx *gorm.DB) error {
+	return decryptValues(tx, &c.Body)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// DailyNote はユーザーの日付ごとのデイリーノート (メモ) の対応です
+type DailyNote struct {
+	UserID    string `gorm:"primaryKey"`
+	Date      string `gorm:"primaryKey"` // YYYY-MM-DD (ユーザーのタイムゾーンでの日付)
+	CreatedAt time.Time
+	MemoID    string `gorm:"index;not null"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserKey はエンドツーエンド暗号化に使うユーザーの鍵を、デバイスごとにラップ (暗号化) したものです。
+// サーバーはラップを解く手段を持たず、クライアント間で受け渡すためだけに保存します。
+type UserKey struct {
+	ID            string `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	UserID        string `gorm:"index;not null"`
+	KeyID         string `gorm:"index;not null"` // Memo.EncryptionKeyID に対応
+	Label         string // デバイス名など (任意)
+	WrapAlgorithm string `gorm:"not null"` // ラップに使ったアルゴリズム (例: ARGON2ID-AES-256-GCM)
+	WrappedKey    string `gorm:"not null"` // base64
+	Salt          string // base64
+	Nonce         string // base64
+}
+
+// UserDataKey は保存時の暗号化 (atrest パッケージ) に使うユーザーごとのデータ鍵です。
+// 鍵はマスター鍵でラップして保存し、MasterKeyID でどのマスター鍵でラップしたかを示します。
+type UserDataKey struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UserID      string `gorm:"index;not null"`
+	MasterKeyID string `gorm:"index;not null"`
+	WrappedKey  string `gorm:"not null"` // base64 (ノンス + 暗号文)
+}
+
+// MemoSearchToken は保存時の暗号化が有効な場合の検索用インデックスです。
+// タイトル・本文の2文字ずつの並びをマスター鍵から導出した鍵で HMAC したものを保存します (平文は保存しない)。
+type MemoSearchToken struct {
+	MemoID string `gorm:"primaryKey"`
+	Token  string `gorm:"primaryKey;index"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// MemoFingerprint はほぼ同じ内容のメモを見つけるための本文の指紋 (SimHash) です。メモの保存時に再計算します。
+type MemoFingerprint struct {
+	MemoID   string `gorm:"primaryKey"`
+	SimHash  int64  // utils.SimHash の値 (SQLite の整数に収めるため int64 として保存)
+	Shingles int    // 計算に使った shingle の数 (utils.MinSimHashShingles 未満なら比較しない)
+}
+
+// MemoFingerprintBand は SimHash を帯に分けた値の1つです。帯が一致するメモだけを比較して、似たメモを全件比較せずに探します。
+type MemoFingerprintBand struct {
+	MemoID string `gorm:"primaryKey"`
+	Band   int    `gorm:"primaryKey;index:idx_memo_fingerprint_bands_value,priority:1"`
+	Value  int64  `gorm:"index:idx_memo_fingerprint_bands_value,priority:2"`
+}
+
+// SimilarMemo は内容の似たメモです (CreateMemo のレスポンスの警告用)
+type SimilarMemo struct {
+	ID         string
+	Title      string
+	Similarity float64 // 0〜1
+}
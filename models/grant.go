@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 共有相手の権限
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// MemoGrant は他のユーザーにメモへのアクセスを許可するACLです。
+// MemoID を指定した場合はそのメモのみ、空の場合は所有者の Category に属するすべてのメモが対象になります。
+type MemoGrant struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	OwnerID   string `gorm:"index;not null;uniqueIndex:idx_memo_grant_target"`
+	GranteeID string `gorm:"index;not null;uniqueIndex:idx_memo_grant_target"`
+	MemoID    string `gorm:"index;uniqueIndex:idx_memo_grant_target"`
+	Category  string `gorm:"uniqueIndex:idx_memo_grant_target"`
+	Role      string `gorm:"not null"` // viewer / editor
+}
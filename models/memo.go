@@ -13,8 +13,143 @@ type Memo struct {
 	DeletedAt           gorm.DeletedAt `gorm:"index"`
 	Title               string         `gorm:"not null"`
 	Content             string
-	Category            string   `gorm:"index"`                             // カテゴリを追加
-	UserID              string   `gorm:"index"`                             // UserIDをstringに変更
-	RelatedMemoIDs      []string `gorm:"-"`                                 // DBには保存しない
-	RelatedMemoIDsStore string   `gorm:"type:text;column:related_memo_ids"` // DB保存用
+	Category            string                 `gorm:"index"`                             // カテゴリを追加
+	UserID              string                 `gorm:"index"`                             // UserIDをstringに変更
+	RelatedMemoIDs      []string               `gorm:"-"`                                 // DBには保存しない
+	RelatedMemoIDsStore string                 `gorm:"type:text;column:related_memo_ids"` // DB保存用
+	DueAt               *time.Time             `gorm:"index"`                             // 期限 (任意)
+	WorkspaceID         string                 `gorm:"index;not null;default:''"`         // 空なら個人のメモ
+	Properties          map[string]interface{} `gorm:"-"`                                 // front matter のプロパティ (レスポンス用、DBには保存しない)
+	Locked              bool                   `gorm:"not null;default:false"`            // trueなら解除するまで更新・削除できない
+	Protected           bool                   `gorm:"not null;default:false"`            // trueなら再認証するまで本文を表示しない
+	ContentHidden       bool                   `gorm:"-"`                                 // 保護されたメモの本文を隠した場合 true (レスポンス用)
+	Encrypted           bool                   `gorm:"not null;default:false"`            // trueなら Content はクライアントで暗号化された暗号文 (base64)
+	EncryptionAlgorithm string                 // 暗号化アルゴリズム (例: AES-256-GCM)
+	EncryptionNonce     string                 // base64
+	EncryptionKeyID     string                 `gorm:"index"` // 暗号化に使った鍵 (UserKey.KeyID)
+	Latitude            *float64               `gorm:"index"` // 緯度 (任意、位置情報が無ければ nil)
+	Longitude           *float64               `gorm:"index"` // 経度
+	PlaceName           string                 // 場所の名前 (任意)
+	DistanceKm          *float64               `gorm:"-"`                                // near で絞り込んだ場合の中心からの距離 (レスポンス用)
+	Visibility          string                 `gorm:"not null;default:'private';index"` // private / unlisted / public
+	PublishAt           *time.Time             `gorm:"index"`                            // 予約公開の日時 (任意、この日時までは非公開として扱う)
+	MergedInto          string                 `gorm:"index;not null;default:''"`        // 統合先のメモID (他のメモに統合されてゴミ箱に移ったメモのみ)
+	SimilarMemos        []SimilarMemo          `gorm:"-" json:",omitempty"`              // 作成したメモとほぼ同じ内容の既存のメモ (CreateMemo のレスポンス用)
+}
+
+// メモの公開範囲
+const (
+	VisibilityPrivate  = "private"  // 本人 (と共有されたユーザー) のみ
+	VisibilityUnlisted = "unlisted" // URL (/p/:id) を知っていれば誰でも閲覧できる
+	VisibilityPublic   = "public"   // プロフィールページ (/u/:username) にも表示する
+)
+
+// ValidVisibility は公開範囲として有効な値かどうかを返します
+func ValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// Published はメモが now の時点で公開されている (unlisted / public で、予約公開の日時を過ぎている) かどうかを返します
+func (m *Memo) Published(now time.Time) bool {
+	if m.Visibility != VisibilityUnlisted && m.Visibility != VisibilityPublic {
+		return false
+	}
+	return m.PublishAt == nil || !m.PublishAt.After(now)
+}
+
+// FieldCipher はメモのタイトル・本文と、本文から作るタスク・カードなどを保存時に暗号化します (atrest パッケージが実装)
+type FieldCipher interface {
+	Encrypt(tx *gorm.DB, userID, plaintext string) (string, error)
+	Decrypt(tx *gorm.DB, value string) (string, error)
+}
+
+// MemoCipher が設定されていれば、メモのタイトル・本文 (とタスク・プロパティ・カード・コメント・通知の本文) を暗号化して保存し、
+// 読み込み時に復号します (nil なら平文のまま)
+var MemoCipher FieldCipher
+
+// BeforeSave は保存時の暗号化が有効ならタイトル・本文を暗号化します
+func (m *Memo) BeforeSave(tx *gorm.DB) error {
+	if MemoCipher == nil {
+		return nil
+	}
+	title, err := MemoCipher.Encrypt(tx, m.UserID, m.Title)
+	if err != nil {
+		return err
+	}
+	content, err := MemoCipher.Encrypt(tx, m.UserID, m.Content)
+	if err != nil {
+		return err
+	}
+	m.Title, m.Content = title, content
+	return nil
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (m *Memo) AfterSave(tx *gorm.DB) error {
+	return m.decryptFields(tx)
+}
+
+// AfterFind は読み込んだタイトル・本文を復号します
+func (m *Memo) AfterFind(tx *gorm.DB) error {
+	return m.decryptFields(tx)
+}
+
+func (m *Memo) decryptFields(tx *gorm.DB) error {
+	title, err := DecryptMemoField(tx, m.Title)
+	if err != nil {
+		return err
+	}
+	content, err := DecryptMemoField(tx, m.Content)
+	if err != nil {
+		return err
+	}
+	m.Title, m.Content = title, content
+	return nil
+}
+
+// DecryptMemoField は JOIN などで直接取得したメモのタイトル・本文を復号します
+func DecryptMemoField(tx *gorm.DB, value string) (string, error) {
+	if MemoCipher == nil {
+		return value, nil
+	}
+	return MemoCipher.Decrypt(tx, value)
+}
+
+// EncryptField は map で直接更新する列の値を、保存時の暗号化が有効なら暗号化します (フックを通らないため)
+func EncryptField(tx *gorm.DB, userID, value string) (string, error) {
+	if MemoCipher == nil {
+		return value, nil
+	}
+	return MemoCipher.Encrypt(tx, userID, value)
+}
+
+// encryptValues は保存時の暗号化が有効なら fields を userID のデータ鍵で暗号化します (フック用)
+func encryptValues(tx *gorm.DB, userID string, fields ...*string) error {
+	if MemoCipher == nil {
+		return nil
+	}
+	for _, field := range fields {
+		value, err := MemoCipher.Encrypt(tx, userID, *field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// decryptValues は encryptValues で暗号化した fields を復号します (フック用)
+func decryptValues(tx *gorm.DB, fields ...*string) error {
+	for _, field := range fields {
+		value, err := DecryptMemoField(tx, *field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoProperty はメモ本文の YAML front matter から抽出した型付きのプロパティです。
+// メモ保存時に再生成されるため、直接編集せずメモ本文 (または API の properties) を書き換えてください。
+type MemoProperty struct {
+	MemoID      string     `gorm:"primaryKey"`
+	Key         string     `gorm:"primaryKey;index"`
+	UserID      string     `gorm:"index;not null"`
+	Type        string     `gorm:"not null"` // string / number / date / bool / list
+	Value       string     // 文字列表現 (list は JSON 配列)。保存時の暗号化が有効なら暗号化する
+	ValueTokens string     // 保存時の暗号化が有効な場合の絞り込み用トークン (JSON 配列、list は要素ごと)
+	NumberValue *float64   `gorm:"index"`
+	DateValue   *time.Time `gorm:"index"`
+	BoolValue   *bool
+}
+
+// BeforeSave は保存時の暗号化が有効ならプロパティの値を暗号化します
+func (p *MemoProperty) BeforeSave(tx *gorm.DB) error {
+	return encryptValues(tx, p.UserID, &p.Value)
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (p *MemoProperty) AfterSave(tx *gorm.DB) error {
+	return decryptValues(tx, &p.Value)
+}
+
+// AfterFind は読み込んだプロパティの値を復号します
+func (p *MemoProperty) AfterFind(tx *gorm.DB) error {
+	return decryptValues(tx, &p.Value)
+}
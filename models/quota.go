@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RoleUser はユーザーのデフォルトのロールです (上限の設定に使う)
+const RoleUser = "user"
+
+// UserQuota はユーザーごとの上限の上書きです。nil の項目はロールの上限を使い、0 は無制限です。
+type UserQuota struct {
+	UserID          string `gorm:"primaryKey"`
+	UpdatedAt       time.Time
+	Memos           *int64
+	ContentBytes    *int64
+	AttachmentBytes *int64
+	RequestsPerDay  *int64
+}
+
+// RequestCount はユーザーの日ごとの API のリクエスト数です (1日あたりのリクエスト数の上限用)
+type RequestCount struct {
+	UserID string `gorm:"primaryKey"`
+	Date   string `gorm:"primaryKey"` // YYYY-MM-DD (UTC)
+	Count  int64  `gorm:"not null;default:0"`
+}
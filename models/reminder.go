@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 通知チャネル
+const (
+	ReminderChannelInApp   = "inapp"
+	ReminderChannelWebhook = "webhook"
+	ReminderChannelEmail   = "email"
+)
+
+type Reminder struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	MemoID      string         `gorm:"index;not null"`
+	UserID      string         `gorm:"index;not null"`
+	RemindAt    time.Time      `gorm:"not null"`     // 初回（RRULEの起点）
+	RRule       string         `gorm:"column:rrule"` // 例: FREQ=WEEKLY;BYDAY=MO,WE
+	Channel     string         `gorm:"not null"`     // inapp / webhook / email
+	Target      string         // webhookのURLまたはメールアドレス
+	NextFireAt  *time.Time     `gorm:"index"` // nilなら発火済み（繰り返しなし）
+	LastFiredAt *time.Time
+	FireCount   int
+	FailCount   int    // 直近の発火で通知に失敗した回数 (再送のたびに増え、成功するか諦めると0に戻る)
+	LastError   string // 最後に通知に失敗したときのエラー
+}
+
+// Notification はアプリ内通知です
+type Notification struct {
+	ID         string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+	UserID     string `gorm:"index;not null"`
+	MemoID     string `gorm:"index"`
+	ReminderID string `gorm:"index"`
+	Message    string
+	ReadAt     *time.Time
+}
+
+// BeforeSave は保存時の暗号化が有効なら通知の本文 (メモのタイトルを含む) を暗号化します
+func (n *Notification) BeforeSave(tx *gorm.DB) error {
+	return encryptValues(tx, n.UserID, &n.Message)
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (n *Notification) AfterSave(tx *gorm.DB) error {
+	return decryptValues(tx, &n.Message)
+}
+
+// AfterFind は読み込んだ通知の本文を復号します
+func (n *Notification) AfterFind(tx *gorm.DB) error {
+	return decryptValues(tx, &n.Message)
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// 振り返りの対象の種類
+const (
+	ReviewSourceCategory = "category" // ノートブック (カテゴリ)
+	ReviewSourceTag      = "tag"
+)
+
+// ReviewSource は振り返り (on this day・ランダム表示) の対象にするノートブック (カテゴリ) またはタグです。
+// ユーザーに1件も無ければすべての個人のメモが対象になります。
+type ReviewSource struct {
+	UserID string  `gorm:"primaryKey"`
+	Kind   string  `gorm:"primaryKey"` // category / tag
+	Value  string  `gorm:"primaryKey"`
+	Weight float64 `gorm:"not null;default:1"` // ランダム表示での重み (大きいほど選ばれやすい)
+}
+
+// ReviewItem はユーザーごとのメモの振り返りの状態です。
+// DueAt を過ぎると振り返りキューに入り、それまではランダム表示の対象から外れます (スヌーズ・N日後に通知)。
+type ReviewItem struct {
+	ID             string `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UserID         string     `gorm:"uniqueIndex:idx_review_item;not null"`
+	MemoID         string     `gorm:"uniqueIndex:idx_review_item;not null"`
+	DueAt          *time.Time `gorm:"index"` // nil ならキューに入っていない
+	Reason         string     // snooze / remind
+	LastReviewedAt *time.Time // 最後に振り返った日時 (最近振り返ったメモはランダム表示で選ばれにくい)
+}
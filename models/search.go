@@ -0,0 +1,14 @@
+package models
+
+// MemoSearchDoc は全文検索の索引 (FTS5 の memos_fts) の行とメモの対応です。
+// FTS5 の行は整数の rowid で扱うため、メモごとに採番した ID を rowid として使います。
+type MemoSearchDoc struct {
+	ID     int64  `gorm:"primaryKey;autoIncrement"`
+	MemoID string `gorm:"uniqueIndex"`
+}
+
+// IndexVersion は索引の形式のバージョンです。形式が変わった索引は起動時に作り直します。
+type IndexVersion struct {
+	Name    string `gorm:"primaryKey"` // 索引のテーブル名
+	Version int    `gorm:"not null"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Share はアカウントを持たない人にメモを公開するための共有リンクです
+type Share struct {
+	ID             string `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	MemoID         string     `gorm:"index;not null"`
+	UserID         string     `gorm:"index;not null"`
+	Token          string     `gorm:"uniqueIndex;not null"` // URL に含めるランダムなトークン
+	ExpiresAt      *time.Time // nil なら無期限
+	PasswordHash   string     `json:"-"`
+	MaxViews       int        // 0 なら無制限
+	ViewCount      int
+	LastAccessedAt *time.Time
+	RevokedAt      *time.Time
+}
+
+// HasPassword はパスワード付きの共有リンクかどうかを返します
+func (s Share) HasPassword() bool {
+	return s.PasswordHash != ""
+}
@@ -0,0 +1,18 @@
+package models
+
+// MemoStat はメモ本文の語数・文字数・容量です。統計を毎回全メモから数え直さないよう、メモの保存時に更新します。
+type MemoStat struct {
+	MemoID     string `gorm:"primaryKey"`
+	UserID     string `gorm:"index;not null"` // メモの作成者
+	Words      int    `gorm:"not null;default:0"`
+	Characters int    `gorm:"not null;default:0"`
+	Bytes      int64  `gorm:"not null;default:0"` // タイトル・本文のバイト数 (暗号化されたメモも含む、容量の上限用)
+}
+
+// ActivityDay はユーザーの日ごとのメモの作成・編集の回数です (活動のヒートマップ・連続記録用)
+type ActivityDay struct {
+	UserID  string `gorm:"primaryKey"`
+	Date    string `gorm:"primaryKey"` // YYYY-MM-DD (ユーザーのタイムゾーンでの日付)
+	Created int    `gorm:"not null;default:0"`
+	Edited  int    `gorm:"not null;default:0"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Task はメモ本文のチェックボックス (- [ ] / - [x]) から抽出されたタスクです。
+// メモ保存時に再生成されるため、直接編集せずメモ本文を書き換えてください。
+type Task struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MemoID    string `gorm:"index;not null"`
+	UserID    string `gorm:"index;not null"`
+	Line      int    // メモ本文での行番号 (1始まり)
+	Text      string
+	Done      bool       `gorm:"index"`
+	DueAt     *time.Time `gorm:"index"` // タスク本文の due:YYYY-MM-DD、なければメモの期限
+}
+
+// BeforeSave は保存時の暗号化が有効ならタスクの本文を暗号化します
+func (t *Task) BeforeSave(tx *gorm.DB) error {
+	return encryptValues(tx, t.UserID, &t.Text)
+}
+
+// AfterSave は保存後も同じ構造体を平文で使えるように復号し直します
+func (t *Task) AfterSave(tx *gorm.DB) error {
+	return decryptValues(tx, &t.Text)
+}
+
+// AfterFind は読み込んだタスクの本文を復号します
+func (t *Task) AfterFind(tx *gorm.DB) error {
+	return decryptValues(tx, &t.Text)
+}
+
+// MemoTag はメモ本文の #タグ を検索用に保存したものです
+type MemoTag struct {
+	MemoID string `gorm:"primaryKey"`
+	Tag    string `gorm:"primaryKey;index"`
+	UserID string `gorm:"index;not null"`
+}
@@ -7,11 +7,14 @@ import (
 )
 
 type User struct {
-	ID        string `gorm:"primaryKey"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
-	Username  string         `gorm:"uniqueIndex;not null"`
-	Password  string         `gorm:"not null"`
-	Memos     []Memo         // ユーザーが所有するメモ (リレーション)
+	ID              string `gorm:"primaryKey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
+	Username        string         `gorm:"uniqueIndex;not null"`
+	Password        string         `gorm:"not null"`
+	Memos           []Memo         // ユーザーが所有するメモ (リレーション)
+	TimeZone        string         // IANAのタイムゾーン名 (例: Asia/Tokyo)。空ならUTC
+	DailyTemplateID string         // デイリーノートのデフォルトのテンプレート (メモID、任意)
+	Role            string         `gorm:"not null;default:'user'"` // 上限の設定に使うロール (RoleUser など)
 }
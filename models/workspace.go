@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ワークスペースのメンバーの役割
+const (
+	WorkspaceRoleOwner  = "owner"  // ワークスペースの削除・管理者の任命ができる
+	WorkspaceRoleAdmin  = "admin"  // メンバーの招待・管理とすべてのメモの編集・削除ができる
+	WorkspaceRoleMember = "member" // メモの作成とすべてのメモの編集ができる (削除は自分のメモのみ)
+	WorkspaceRoleGuest  = "guest"  // 閲覧のみ
+)
+
+// Workspace はチームでメモを共有するための空間です。
+// Memo.WorkspaceID が空のメモは個人のメモ、設定されているメモはワークスペースのメモになります。
+type Workspace struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"not null"`
+	OwnerID   string         `gorm:"index;not null"`
+}
+
+// WorkspaceMember はワークスペースのメンバーと役割です
+type WorkspaceMember struct {
+	WorkspaceID string `gorm:"primaryKey"`
+	UserID      string `gorm:"primaryKey;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Role        string `gorm:"not null"`
+}
+
+// WorkspaceInvitation はワークスペースへの招待です。招待されたユーザーが承諾するとメンバーになります。
+type WorkspaceInvitation struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	WorkspaceID string `gorm:"index;not null"`
+	InviterID   string `gorm:"not null"`
+	InviteeID   string `gorm:"index;not null"`
+	Role        string `gorm:"not null"`
+}
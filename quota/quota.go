@@ -0,0 +1,103 @@
+// Package quota はユーザーごとの使用量の上限 (メモ数・本文の容量・添付ファイルの容量・1日あたりのリクエスト数) の設定を扱います。
+// 上限はロールごとに設定し、ユーザーごとに上書きできます (models.UserQuota)。
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/linkalls/fast-memos/models"
+)
+
+// ErrInvalidConfig は上限の設定が不正な場合のエラーです
+var ErrInvalidConfig = errors.New("quota: invalid config")
+
+// Limits はユーザーの上限です。0 は無制限です。
+type Limits struct {
+	Memos           int64 `json:"memos"`
+	ContentBytes    int64 `json:"content_bytes"`    // メモのタイトル・本文の合計 (バイト)
+	AttachmentBytes int64 `json:"attachment_bytes"` // 添付ファイルの合計 (バイト)
+	RequestsPerDay  int64 `json:"requests_per_day"` // API のリクエスト数 (UTC の日付ごと)
+}
+
+// Config はロールごとの上限です
+type Config struct {
+	Roles map[string]Limits `json:"roles"`
+}
+
+// Current が設定されていれば上限を適用します (nil なら無制限)
+var Current *Config
+
+// Enable は上限の設定を有効にします (nil で無効)
+func Enable(c *Config) {
+	Current = c
+}
+
+// ForRole はロールの上限を返します。設定の無いロールは models.RoleUser の上限、それも無ければ無制限です。
+func (c *Config) ForRole(role string) Limits {
+	if c == nil {
+		return Limits{}
+	}
+	if limits, ok := c.Roles[role]; ok {
+		return limits
+	}
+	return c.Roles[models.RoleUser]
+}
+
+// Apply はユーザーごとの上書き (nil の項目はロールの上限のまま) を適用した上限を返します
+func (l Limits) Apply(override models.UserQuota) Limits {
+	if override.Memos != nil {
+		l.Memos = *override.Memos
+	}
+	if override.ContentBytes != nil {
+		l.ContentBytes = *override.ContentBytes
+	}
+	if override.AttachmentBytes != nil {
+		l.AttachmentBytes = *override.AttachmentBytes
+	}
+	if override.RequestsPerDay != nil {
+		l.RequestsPerDay = *override.RequestsPerDay
+	}
+	return l
+}
+
+func (l Limits) validate() error {
+	if l.Memos < 0 || l.ContentBytes < 0 || l.AttachmentBytes < 0 || l.RequestsPerDay < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Parse は JSON の設定 ({"roles": {"user": {"memos": 10000, ...}, ...}}) を読み込みます
+func Parse(data []byte) (*Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	for role, limits := range config.Roles {
+		if err := limits.validate(); err != nil {
+			return nil, fmt.Errorf("%w (role %q)", err, role)
+		}
+	}
+	return &config, nil
+}
+
+// LoadFromEnv は QUOTA_CONFIG (JSON) または QUOTA_CONFIG_FILE (JSON ファイルのパス) から設定を読み込みます。
+// どちらも無ければ nil (無制限) です。
+func LoadFromEnv() (*Config, error) {
+	value := os.Getenv("QUOTA_CONFIG")
+	if path := os.Getenv("QUOTA_CONFIG_FILE"); value == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("quota: read QUOTA_CONFIG_FILE: %w", err)
+		}
+		value = string(data)
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return Parse([]byte(value))
+}
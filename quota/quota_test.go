@@ -0,0 +1,47 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAndLimits(t *testing.T) {
+	config, err := Parse([]byte(`{"roles": {"user": {"memos": 100, "requests_per_day": 1000}, "trusted": {"memos": 10000}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{Memos: 100, RequestsPerDay: 1000}, config.ForRole(models.RoleUser))
+	assert.Equal(t, Limits{Memos: 10000}, config.ForRole("trusted"))
+	// 設定の無いロールは user の上限
+	assert.Equal(t, Limits{Memos: 100, RequestsPerDay: 1000}, config.ForRole("guest"))
+
+	// ユーザーごとの上書き (0 は無制限)
+	unlimited, bytes := int64(0), int64(2048)
+	limits := config.ForRole(models.RoleUser).Apply(models.UserQuota{Memos: &unlimited, ContentBytes: &bytes})
+	assert.Equal(t, Limits{ContentBytes: 2048, RequestsPerDay: 1000}, limits)
+
+	var none *Config
+	assert.Equal(t, Limits{}, none.ForRole(models.RoleUser))
+
+	_, err = Parse([]byte(`{"roles": {"user": {"memos": -1}}}`))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = Parse([]byte(`{"roles": `))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_CONFIG", "")
+	t.Setenv("QUOTA_CONFIG_FILE", "")
+	config, err := LoadFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	path := filepath.Join(t.TempDir(), "quota.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"roles": {"user": {"attachment_bytes": 1048576}}}`), 0o600))
+	t.Setenv("QUOTA_CONFIG_FILE", path)
+	config, err = LoadFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1048576), config.ForRole(models.RoleUser).AttachmentBytes)
+}
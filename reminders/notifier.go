@@ -0,0 +1,140 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/linkalls/fast-memos/utils"
+	"gorm.io/gorm"
+)
+
+// Event は通知1件分の内容です
+type Event struct {
+	Reminder models.Reminder
+	Memo     models.Memo
+	FiredAt  time.Time
+}
+
+// Message は通知本文を組み立てます
+func (e Event) Message() string {
+	title := e.Memo.Title
+	if title == "" {
+		title = "(無題のメモ)"
+	}
+	return fmt.Sprintf("リマインダー: %s", title)
+}
+
+// Notifier はリマインダーの通知先を抽象化したインターフェースです
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// InAppNotifier は notifications テーブルに通知を保存します
+type InAppNotifier struct {
+	DB *gorm.DB
+}
+
+func (n *InAppNotifier) Notify(ctx context.Context, event Event) error {
+	notification := models.Notification{
+		ID:         utils.GenerateID(),
+		UserID:     event.Reminder.UserID,
+		MemoID:     event.Reminder.MemoID,
+		ReminderID: event.Reminder.ID,
+		Message:    event.Message(),
+	}
+	return n.DB.WithContext(ctx).Create(&notification).Error
+}
+
+// WebhookNotifier はリマインダーの Target (URL) に JSON を POST します。
+// Client が nil なら、ループバック・プライベート・リンクローカルなどのアドレスには送信しないクライアントを使います。
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	if err := ValidateWebhookTarget(event.Reminder.Target); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"reminder_id": event.Reminder.ID,
+		"memo_id":     event.Memo.ID,
+		"title":       event.Memo.Title,
+		"message":     event.Message(),
+		"fired_at":    event.FiredAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, event.Reminder.Target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = newWebhookClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailNotifier はローカルのSMTPサーバー経由でメールを送信します。
+// 保護されたメモや暗号化されたメモもあるため、本文は送らずタイトルとメモへのリンクだけを送ります。
+type EmailNotifier struct {
+	Addr    string // 例: localhost:25
+	From    string
+	BaseURL string // メモへのリンクに使うURL (例: https://memos.example.com)。空ならメモのIDだけを書く
+}
+
+// NewEmailNotifierFromEnv は SMTP_ADDR / SMTP_FROM / APP_BASE_URL 環境変数から EmailNotifier を作成します
+func NewEmailNotifierFromEnv() *EmailNotifier {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		addr = "localhost:25"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "fast-memos@localhost"
+	}
+	return &EmailNotifier{Addr: addr, From: from, BaseURL: strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	// 検証前に保存されたリマインダーもあるので送信時にも確認する (ヘッダーの注入を防ぐ)
+	to, err := ValidateEmailTarget(event.Reminder.Target)
+	if err != nil {
+		return err
+	}
+	subject := mime.QEncoding.Encode("UTF-8", event.Message())
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.From, to, subject, n.text(event))
+	// ローカルSMTPを想定しているため認証は行わない
+	return smtp.SendMail(n.Addr, nil, n.From, []string{to}, []byte(body))
+}
+
+// text はメール本文を組み立てます
+func (n *EmailNotifier) text(event Event) string {
+	if n.BaseURL == "" {
+		return fmt.Sprintf("%s\r\nメモID: %s", event.Message(), event.Memo.ID)
+	}
+	return fmt.Sprintf("%s\r\n%s/memos/%s", event.Message(), n.BaseURL, url.PathEscape(event.Memo.ID))
+}
@@ -0,0 +1,25 @@
+package reminders
+
+import (
+	"testing"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailTextOmitsMemoContent(t *testing.T) {
+	event := Event{
+		Reminder: models.Reminder{ID: "r1", Channel: models.ReminderChannelEmail, Target: "alice@example.com"},
+		Memo:     models.Memo{ID: "m1", Title: "Secret plan", Content: "do not mail this", Protected: true},
+	}
+
+	// 本文は送らず、タイトルとメモへのリンクだけを書く
+	text := (&EmailNotifier{BaseURL: "https://memos.example.com"}).text(event)
+	assert.Contains(t, text, "リマインダー: Secret plan")
+	assert.Contains(t, text, "https://memos.example.com/memos/m1")
+	assert.NotContains(t, text, "do not mail this")
+
+	text = (&EmailNotifier{}).text(event)
+	assert.Contains(t, text, "メモID: m1")
+	assert.NotContains(t, text, "do not mail this")
+}
@@ -0,0 +1,160 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 次回発生時刻の探索で回す最大ステップ数 (不正なルールで無限ループしないように)
+const maxRRuleIterations = 100000
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// RRule は RFC 5545 の RRULE のサブセット (FREQ, INTERVAL, COUNT, UNTIL, BYDAY) です
+type RRule struct {
+	Freq     string // DAILY / WEEKLY / MONTHLY / YEARLY
+	Interval int
+	Count    int // 0 は無制限
+	Until    *time.Time
+	ByDay    []time.Weekday // WEEKLY のときのみ有効
+}
+
+// ParseRRule は "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE" 形式の文字列を解析します
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("rrule is empty")
+	}
+
+	r := &RRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				wd, ok := weekdayCodes[code]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", code)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+// Next は dtstart を起点とした発生時刻のうち、after より後で最初のものを返します。
+// それ以上発生しない場合は false を返します。
+func (r *RRule) Next(dtstart, after time.Time) (time.Time, bool) {
+	occurrences := 0
+	for i := 0; i < maxRRuleIterations; i++ {
+		t, ok := r.candidate(dtstart, i)
+		if !ok {
+			continue
+		}
+		if r.Until != nil && t.After(*r.Until) {
+			return time.Time{}, false
+		}
+		occurrences++
+		if r.Count > 0 && occurrences > r.Count {
+			return time.Time{}, false
+		}
+		if t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// candidate は i 番目の候補時刻を返します。ルールに一致しない候補は false になります。
+func (r *RRule) candidate(dtstart time.Time, i int) (time.Time, bool) {
+	switch r.Freq {
+	case "DAILY":
+		return dtstart.AddDate(0, 0, i*r.Interval), true
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return dtstart.AddDate(0, 0, 7*i*r.Interval), true
+		}
+		// 1日ずつ進め、対象の週かつ指定曜日のものだけを採用する (週の始まりは月曜日)
+		t := dtstart.AddDate(0, 0, i)
+		week := ((int(dtstart.Weekday())+6)%7 + i) / 7
+		if week%r.Interval != 0 {
+			return time.Time{}, false
+		}
+		for _, wd := range r.ByDay {
+			if t.Weekday() == wd {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	case "MONTHLY":
+		t := dtstart.AddDate(0, i*r.Interval, 0)
+		// 31日起点で30日までの月などは存在しないのでスキップ (RFC 5545 と同じ挙動)
+		return t, t.Day() == dtstart.Day()
+	case "YEARLY":
+		t := dtstart.AddDate(i*r.Interval, 0, 0)
+		return t, t.Day() == dtstart.Day()
+	}
+	return time.Time{}, false
+}
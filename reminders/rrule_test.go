@@ -0,0 +1,51 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRRule_Invalid(t *testing.T) {
+	for _, s := range []string{"", "INTERVAL=2", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;BYDAY=XX", "FREQ=DAILY;COUNT=0"} {
+		_, err := ParseRRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	// 2024-01-01 は月曜日
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		rule  string
+		after time.Time
+		want  time.Time
+		ok    bool
+	}{
+		{"FREQ=DAILY", start, start.AddDate(0, 0, 1), true},
+		{"FREQ=DAILY;INTERVAL=3", start.AddDate(0, 0, 4), start.AddDate(0, 0, 6), true},
+		{"FREQ=DAILY;COUNT=2", start.AddDate(0, 0, 1), time.Time{}, false},
+		{"FREQ=WEEKLY;BYDAY=WE,FR", start, time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), true},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", start, time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC), true},
+		{"FREQ=MONTHLY", start, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC), true},
+		{"FREQ=DAILY;UNTIL=20240102", start, time.Time{}, false},
+	}
+	for _, tc := range cases {
+		rule, err := ParseRRule(tc.rule)
+		assert.NoError(t, err, tc.rule)
+		got, ok := rule.Next(start, tc.after)
+		assert.Equal(t, tc.ok, ok, tc.rule)
+		if tc.ok {
+			assert.True(t, tc.want.Equal(got), "%s: want %v got %v", tc.rule, tc.want, got)
+		}
+	}
+
+	// 31日起点の月次は31日のない月をスキップする
+	rule, _ := ParseRRule("FREQ=MONTHLY")
+	jan31 := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	got, ok := rule.Next(jan31, jan31)
+	assert.True(t, ok)
+	assert.Equal(t, time.March, got.Month())
+}
@@ -0,0 +1,200 @@
+package reminders
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"gorm.io/gorm"
+)
+
+// 通知に失敗したときの再送設定。失敗するたびに待ち時間を倍にし、MaxNotifyAttempts 回失敗したら諦めます。
+const (
+	MaxNotifyAttempts = 5
+	RetryDelay        = time.Minute
+)
+
+// Scheduler は期限の来たリマインダーを定期的に発火させます。
+// 状態はすべてDBに保存されるため、再起動しても続きから処理されます。
+// 通知に失敗した場合は失敗を記録し、間隔を空けて再送します。
+type Scheduler struct {
+	DB        *gorm.DB
+	Notifiers map[string]Notifier // チャネル名 -> Notifier
+	Interval  time.Duration       // ポーリング間隔
+	BatchSize int
+	Now       func() time.Time // テスト用に差し替え可能
+}
+
+// NewScheduler は標準の通知チャネル (アプリ内・Webhook・メール) を登録した Scheduler を作成します
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{
+		DB: db,
+		Notifiers: map[string]Notifier{
+			models.ReminderChannelInApp:   &InAppNotifier{DB: db},
+			models.ReminderChannelWebhook: &WebhookNotifier{},
+			models.ReminderChannelEmail:   NewEmailNotifierFromEnv(),
+		},
+		Interval:  30 * time.Second,
+		BatchSize: 100,
+		Now:       time.Now,
+	}
+}
+
+// Start はバックグラウンドでポーリングを開始します。ctx がキャンセルされると停止します。
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.RunOnce(ctx); err != nil {
+				log.Printf("reminder scheduler: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce は期限の来たリマインダーを1回分処理し、発火させた件数を返します
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	now := s.Now().UTC()
+
+	var due []models.Reminder
+	err := s.DB.WithContext(ctx).
+		Where("next_fire_at IS NOT NULL AND next_fire_at <= ?", now).
+		Order("next_fire_at asc").
+		Limit(s.BatchSize).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	for _, reminder := range due {
+		claimed, err := s.claim(ctx, &reminder, now)
+		if err != nil {
+			log.Printf("reminder scheduler: could not claim reminder %s: %v", reminder.ID, err)
+			continue
+		}
+		if !claimed {
+			// 他のインスタンスが先に処理した
+			continue
+		}
+
+		var memo models.Memo
+		if err := s.DB.WithContext(ctx).Where("id = ?", reminder.MemoID).First(&memo).Error; err != nil {
+			// メモが削除されている場合は通知しない
+			continue
+		}
+
+		notifier, ok := s.Notifiers[reminder.Channel]
+		if !ok {
+			log.Printf("reminder scheduler: unknown channel %q for reminder %s", reminder.Channel, reminder.ID)
+			continue
+		}
+		if err := notifier.Notify(ctx, Event{Reminder: reminder, Memo: memo, FiredAt: now}); err != nil {
+			log.Printf("reminder scheduler: notify failed for reminder %s: %v", reminder.ID, err)
+			if err := s.recordFailure(ctx, &reminder, now, err); err != nil {
+				log.Printf("reminder scheduler: could not record failure for reminder %s: %v", reminder.ID, err)
+			}
+			continue
+		}
+		if reminder.FailCount > 0 {
+			if err := s.DB.WithContext(ctx).Model(&models.Reminder{}).
+				Where("id = ? AND fire_count = ?", reminder.ID, reminder.FireCount).
+				Update("fail_count", 0).Error; err != nil {
+				log.Printf("reminder scheduler: could not reset failures for reminder %s: %v", reminder.ID, err)
+			}
+		}
+		fired++
+	}
+	return fired, nil
+}
+
+// recordFailure は通知の失敗を記録し、再送のために次回発火時刻を早めます。
+// 再送の方が次の繰り返しより後になる場合は、次の繰り返しで通知します。
+func (s *Scheduler) recordFailure(ctx context.Context, reminder *models.Reminder, now time.Time, notifyErr error) error {
+	updates := map[string]interface{}{
+		"fail_count": reminder.FailCount + 1,
+		"last_error": notifyErr.Error(),
+	}
+	if reminder.FailCount+1 >= MaxNotifyAttempts {
+		log.Printf("reminder scheduler: giving up on reminder %s after %d attempts", reminder.ID, MaxNotifyAttempts)
+		updates["fail_count"] = 0
+	} else {
+		retryAt := now.Add(RetryDelay << reminder.FailCount)
+		if reminder.NextFireAt == nil || retryAt.Before(*reminder.NextFireAt) {
+			updates["next_fire_at"] = retryAt
+		}
+	}
+	// 発火権を取得したときの fire_count で更新し、他のインスタンスの発火を上書きしない
+	return s.DB.WithContext(ctx).Model(&models.Reminder{}).
+		Where("id = ? AND fire_count = ?", reminder.ID, reminder.FireCount).
+		Updates(updates).Error
+}
+
+// claim は次回発火時刻を進めることでリマインダーの発火権を取得します。
+// fire_count を楽観ロックとして使うため、複数インスタンスが同時に実行しても二重発火しません。
+func (s *Scheduler) claim(ctx context.Context, reminder *models.Reminder, now time.Time) (bool, error) {
+	next, err := NextFireAfter(*reminder, now)
+	if err != nil {
+		return false, err
+	}
+
+	result := s.DB.WithContext(ctx).Model(&models.Reminder{}).
+		Where("id = ? AND fire_count = ?", reminder.ID, reminder.FireCount).
+		Updates(map[string]interface{}{
+			"next_fire_at":  next,
+			"last_fired_at": now,
+			"fire_count":    reminder.FireCount + 1,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	reminder.NextFireAt = next
+	reminder.LastFiredAt = &now
+	reminder.FireCount++
+	return true, nil
+}
+
+// NextFireAfter は after より後の次回発火時刻を返します。もう発火しない場合は nil です。
+func NextFireAfter(reminder models.Reminder, after time.Time) (*time.Time, error) {
+	if reminder.RRule == "" {
+		if reminder.RemindAt.After(after) {
+			next := reminder.RemindAt
+			return &next, nil
+		}
+		return nil, nil
+	}
+
+	rule, err := ParseRRule(reminder.RRule)
+	if err != nil {
+		return nil, err
+	}
+	next, ok := rule.Next(reminder.RemindAt, after)
+	if !ok {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// FirstFireAt は新規作成時の最初の発火時刻を返します。
+// 繰り返しなしで過去の時刻が指定された場合は、次のポーリングですぐに発火させます。
+func FirstFireAt(reminder models.Reminder, now time.Time) (*time.Time, error) {
+	if reminder.RRule == "" {
+		first := reminder.RemindAt
+		return &first, nil
+	}
+	after := reminder.RemindAt.Add(-time.Nanosecond)
+	if now.After(after) {
+		after = now
+	}
+	return NextFireAfter(reminder, after)
+}
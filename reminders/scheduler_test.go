@@ -0,0 +1,138 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestSchedulerFiresOnceAcrossInstances(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:scheduler_test?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Memo{}, &models.Reminder{}))
+
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	assert.NoError(t, db.Create(&models.Memo{ID: "m1", Title: "Daily", UserID: "u1"}).Error)
+	reminder := models.Reminder{ID: "r1", MemoID: "m1", UserID: "u1", RemindAt: now.Add(-time.Minute), RRule: "FREQ=DAILY", Channel: "test"}
+	reminder.NextFireAt, _ = FirstFireAt(reminder, now.Add(-2*time.Minute))
+	assert.NoError(t, db.Create(&reminder).Error)
+
+	notifier := &recordingNotifier{}
+	newInstance := func() *Scheduler {
+		return &Scheduler{DB: db, Notifiers: map[string]Notifier{"test": notifier}, BatchSize: 10, Now: func() time.Time { return now }}
+	}
+
+	// 2インスタンスが同じ時刻に処理しても発火は1回だけ
+	a, b := newInstance(), newInstance()
+	_, err = a.RunOnce(context.Background())
+	assert.NoError(t, err)
+	_, err = b.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, notifier.events, 1)
+
+	// 古い状態を読んだインスタンスは発火権を取得できない
+	stale := reminder
+	claimed, err := b.claim(context.Background(), &stale, now)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	var stored models.Reminder
+	db.First(&stored, "id = ?", "r1")
+	assert.Equal(t, 1, stored.FireCount)
+	assert.True(t, stored.NextFireAt.Equal(reminder.RemindAt.AddDate(0, 0, 1)))
+}
+
+type failingNotifier struct {
+	failures int
+	calls    int
+}
+
+func (n *failingNotifier) Notify(ctx context.Context, event Event) error {
+	n.calls++
+	if n.calls <= n.failures {
+		return errors.New("smtp unavailable")
+	}
+	return nil
+}
+
+func TestSchedulerRetriesFailedNotifications(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:scheduler_retry_test?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Memo{}, &models.Reminder{}))
+
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	assert.NoError(t, db.Create(&models.Memo{ID: "m1", Title: "Once", UserID: "u1"}).Error)
+	reminder := models.Reminder{ID: "r1", MemoID: "m1", UserID: "u1", RemindAt: now.Add(-time.Minute), Channel: "test"}
+	reminder.NextFireAt, _ = FirstFireAt(reminder, now)
+	assert.NoError(t, db.Create(&reminder).Error)
+
+	notifier := &failingNotifier{failures: 2}
+	scheduler := &Scheduler{DB: db, Notifiers: map[string]Notifier{"test": notifier}, BatchSize: 10, Now: func() time.Time { return now }}
+	stored := func() models.Reminder {
+		var r models.Reminder
+		db.First(&r, "id = ?", "r1")
+		return r
+	}
+
+	// 失敗を記録し、待ち時間を倍にしながら再送する
+	fired, err := scheduler.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, fired)
+	r := stored()
+	assert.Equal(t, 1, r.FailCount)
+	assert.Equal(t, "smtp unavailable", r.LastError)
+	if assert.NotNil(t, r.NextFireAt) {
+		assert.True(t, r.NextFireAt.Equal(now.Add(RetryDelay)))
+	}
+
+	now = now.Add(RetryDelay)
+	fired, _ = scheduler.RunOnce(context.Background())
+	assert.Zero(t, fired)
+	r = stored()
+	assert.Equal(t, 2, r.FailCount)
+	if assert.NotNil(t, r.NextFireAt) {
+		assert.True(t, r.NextFireAt.Equal(now.Add(2*RetryDelay)))
+	}
+
+	// 成功したら失敗回数を戻し、繰り返しのないリマインダーはもう発火しない
+	now = now.Add(2 * RetryDelay)
+	fired, _ = scheduler.RunOnce(context.Background())
+	assert.Equal(t, 1, fired)
+	r = stored()
+	assert.Zero(t, r.FailCount)
+	assert.Nil(t, r.NextFireAt)
+	assert.Equal(t, 3, notifier.calls)
+
+	// 失敗し続けたら MaxNotifyAttempts 回で諦める
+	assert.NoError(t, db.Model(&models.Reminder{}).Where("id = ?", "r1").Update("next_fire_at", now).Error)
+	notifier.failures = notifier.calls + MaxNotifyAttempts + 1
+	for i := 0; i < MaxNotifyAttempts+1; i++ {
+		now = now.Add(time.Hour)
+		scheduler.RunOnce(context.Background())
+	}
+	assert.Equal(t, 3+MaxNotifyAttempts, notifier.calls)
+	r = stored()
+	assert.Zero(t, r.FailCount)
+	assert.Nil(t, r.NextFireAt)
+	assert.Equal(t, "smtp unavailable", r.LastError)
+}
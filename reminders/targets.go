@@ -0,0 +1,78 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInvalidTarget はリマインダーの通知先が不正な場合のエラーです
+var ErrInvalidTarget = errors.New("reminders: invalid target")
+
+// ErrBlockedDestination は Webhook の送信先がループバック・プライベート・リンクローカルなどのアドレスの場合のエラーです
+var ErrBlockedDestination = errors.New("reminders: webhook destination is not allowed")
+
+// ValidateEmailTarget はメールの通知先を確認し、アドレス部分 (例: alice@example.com) を返します。
+// ヘッダーの注入を防ぐため、改行を含むものや表示名付きのものは受け付けません。
+func ValidateEmailTarget(target string) (string, error) {
+	if strings.ContainsAny(target, "\r\n") {
+		return "", fmt.Errorf("%w: email address must not contain line breaks", ErrInvalidTarget)
+	}
+	address, err := mail.ParseAddress(target)
+	if err != nil || address.Name != "" || address.Address != strings.TrimSpace(target) {
+		return "", fmt.Errorf("%w: %q is not a valid email address", ErrInvalidTarget, target)
+	}
+	return address.Address, nil
+}
+
+// ValidateWebhookTarget は Webhook の通知先が http(s) の URL で、IPアドレスで指定する場合は許可された送信先であることを確認します。
+// ホスト名の名前解決後の送信先は送信時 (SafeDialContext) に確認します。
+func ValidateWebhookTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: a valid http(s) URL is required", ErrInvalidTarget)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && blockedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedDestination, ip)
+	}
+	return nil
+}
+
+// blockedIP はサーバー内部やローカルネットワークを指すアドレス (Webhook で送信しない) かどうかを返します
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// SafeDialContext は名前解決後の接続先が blockedIP なら接続しない DialContext です (リダイレクト先も含めて確認される)
+func SafeDialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedDestination, host)
+			}
+			return nil
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// newWebhookClient は SafeDialContext で接続する Webhook 送信用の HTTP クライアントです
+func newWebhookClient() *http.Client {
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: SafeDialContext, Proxy: nil},
+	}
+}
@@ -0,0 +1,64 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkalls/fast-memos/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEmailTarget(t *testing.T) {
+	address, err := ValidateEmailTarget("alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@example.com", address)
+
+	for _, target := range []string{
+		"",
+		"not-an-address",
+		"alice@example.com\r\nBcc: victim@example.com",
+		"alice@example.com\nSubject: spam",
+		"Alice <alice@example.com>",
+	} {
+		_, err := ValidateEmailTarget(target)
+		assert.ErrorIs(t, err, ErrInvalidTarget, target)
+	}
+}
+
+func TestValidateWebhookTarget(t *testing.T) {
+	assert.NoError(t, ValidateWebhookTarget("https://hooks.example.com/notify"))
+	assert.ErrorIs(t, ValidateWebhookTarget("ftp://example.com"), ErrInvalidTarget)
+	assert.ErrorIs(t, ValidateWebhookTarget("https://"), ErrInvalidTarget)
+	for _, target := range []string{
+		"http://127.0.0.1:8080/",
+		"http://[::1]/",
+		"http://10.0.0.5/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://0.0.0.0/",
+	} {
+		assert.ErrorIs(t, ValidateWebhookTarget(target), ErrBlockedDestination, target)
+	}
+}
+
+func TestWebhookNotifierBlocksPrivateDestinations(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	// localhost は名前解決後のアドレス (ループバック) で接続時に拒否される
+	event := Event{
+		Reminder: models.Reminder{Target: "http://localhost" + server.URL[len("http://127.0.0.1"):]},
+		FiredAt:  time.Now(),
+	}
+	err := (&WebhookNotifier{}).Notify(context.Background(), event)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrBlockedDestination), err)
+	assert.False(t, called)
+}
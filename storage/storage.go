@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound は指定したキーのオブジェクトが存在しない場合のエラーです
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore は添付ファイルの保存先を抽象化したインターフェースです。
+// キーにはコンテンツのSHA-256ハッシュ (16進) を使用します。
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Store はアプリ全体で使用する BlobStore です
+var Store BlobStore
+
+// ConnectStorage は環境変数に応じて Store を初期化します
+//
+//	STORAGE_BACKEND: local (デフォルト) または s3
+//	STORAGE_PATH:    local の保存先ディレクトリ (デフォルト ./uploads)
+//	S3_ENDPOINT, S3_BUCKET, S3_REGION, S3_ACCESS_KEY, S3_SECRET_KEY: s3 の接続情報
+func ConnectStorage() {
+	backend := os.Getenv("STORAGE_BACKEND")
+	switch backend {
+	case "", "local":
+		path := os.Getenv("STORAGE_PATH")
+		if path == "" {
+			path = "uploads"
+		}
+		store, err := NewLocalStore(path)
+		if err != nil {
+			panic("Failed to initialize local storage: " + err.Error())
+		}
+		Store = store
+	case "s3":
+		store, err := NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+		if err != nil {
+			panic("Failed to initialize S3 storage: " + err.Error())
+		}
+		Store = store
+	default:
+		panic(fmt.Sprintf("Unknown STORAGE_BACKEND %q", backend))
+	}
+	fmt.Printf("Storage backend initialized (%s)\n", backendName(backend))
+}
+
+func backendName(backend string) string {
+	if backend == "" {
+		return "local"
+	}
+	return backend
+}
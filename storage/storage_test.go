@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBlobStore は BlobStore 実装に共通の振る舞いを確認します
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	content := []byte("test blob content")
+
+	_, err := store.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"))
+	r, err := store.Get(ctx, key)
+	assert.NoError(t, err)
+	got, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, content, got)
+
+	assert.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, key)) // 存在しなくてもエラーにしない
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	testBlobStore(t, store)
+
+	assert.Error(t, store.Put(context.Background(), "../escape", bytes.NewReader(nil), 0, ""))
+}
+
+// TestS3Store はローカルの MinIO などに対して実行します。
+// 例: S3_TEST_ENDPOINT=http://localhost:9000 S3_TEST_BUCKET=test S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./storage
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	store, err := NewS3Store(S3Config{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		Region:    os.Getenv("S3_TEST_REGION"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+	})
+	assert.NoError(t, err)
+	testBlobStore(t, store)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// フラッシュカードの種類
+const (
+	CardBasic = "basic" // "質問:: 答え" の行
+	CardCloze = "cloze" // {{c1::穴埋め}} を含む行 (番号ごとに1枚)
+)
+
+// "質問:: 答え" の行 (先頭のリスト記号は除く)。"::" の直後に空白が必要なので std::vector などは対象外
+var basicCardPattern = regexp.MustCompile(`^\s*(?:[-*+]\s+)?(\S.*?\S|\S)::\s+(\S.*)$`)
+
+// 穴埋め ({{c1::答え}} または {{c1::答え::ヒント}})
+var clozePattern = regexp.MustCompile(`\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ParsedCard はメモ本文から抽出したフラッシュカード1枚分です
+type ParsedCard struct {
+	Key   string // 同じカードを識別するキー (質問文・穴埋めの行と番号から求める)
+	Kind  string // basic / cloze
+	Front string // 表 (Markdown)
+	Back  string // 裏 (Markdown)
+	Line  int    // 1始まりの行番号
+}
+
+// ParseCards はメモ本文からフラッシュカードを抽出します。コードブロック内は無視し、同じキーのカードは最初のものだけ使います。
+func ParseCards(content string) []ParsedCard {
+	cards := []ParsedCard{}
+	seen := map[string]bool{}
+	add := func(card ParsedCard) {
+		if !seen[card.Key] {
+			seen[card.Key] = true
+			cards = append(cards, card)
+		}
+	}
+	inCodeBlock := false
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+		if clozePattern.MatchString(line) {
+			for _, card := range parseClozeLine(line) {
+				card.Line = i + 1
+				add(card)
+			}
+			continue
+		}
+		if m := basicCardPattern.FindStringSubmatch(line); m != nil {
+			front, back := strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+			add(ParsedCard{Key: cardKey(CardBasic, front), Kind: CardBasic, Front: front, Back: back, Line: i + 1})
+		}
+	}
+	return cards
+}
+
+// parseClozeLine は穴埋めの行から番号ごとにカードを作ります
+func parseClozeLine(line string) []ParsedCard {
+	line = strings.TrimSpace(line)
+	var numbers []string
+	seen := map[string]bool{}
+	for _, m := range clozePattern.FindAllStringSubmatch(line, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			numbers = append(numbers, m[1])
+		}
+	}
+	// 答えを埋めた行 (キーに使う)
+	plain := clozePattern.ReplaceAllString(line, "$2")
+	cards := make([]ParsedCard, 0, len(numbers))
+	for _, number := range numbers {
+		front := clozePattern.ReplaceAllStringFunc(line, func(s string) string {
+			m := clozePattern.FindStringSubmatch(s)
+			if m[1] != number {
+				return m[2]
+			}
+			if m[3] != "" {
+				return "[" + m[3] + "]"
+			}
+			return "[...]"
+		})
+		back := clozePattern.ReplaceAllStringFunc(line, func(s string) string {
+			m := clozePattern.FindStringSubmatch(s)
+			if m[1] != number {
+				return m[2]
+			}
+			return "**" + m[2] + "**"
+		})
+		cards = append(cards, ParsedCard{Key: cardKey(CardCloze, "c"+number+":"+plain), Kind: CardCloze, Front: front, Back: back})
+	}
+	return cards
+}
+
+func cardKey(kind, text string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + text))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCards(t *testing.T) {
+	content := "# 単語\n- 日本の首都:: 東京\nuse std::vector here\n{{c1::富士山}}の高さは{{c2::3776::数字}}m\n```\nQ:: in code\n```\nno answer::"
+	cards := ParseCards(content)
+	if assert.Len(t, cards, 3) {
+		assert.Equal(t, CardBasic, cards[0].Kind)
+		assert.Equal(t, "日本の首都", cards[0].Front)
+		assert.Equal(t, "東京", cards[0].Back)
+		assert.Equal(t, 2, cards[0].Line)
+
+		assert.Equal(t, CardCloze, cards[1].Kind)
+		assert.Equal(t, "[...]の高さは3776m", cards[1].Front)
+		assert.Equal(t, "**富士山**の高さは3776m", cards[1].Back)
+		assert.Equal(t, "富士山の高さは[数字]m", cards[2].Front)
+		assert.Equal(t, 4, cards[2].Line)
+	}
+
+	// 答えの変更では基本カードのキーは変わらない
+	edited := ParseCards("- 日本の首都:: Tokyo")
+	assert.Equal(t, cards[0].Key, edited[0].Key)
+	assert.Len(t, ParseCards("A:: 1\nA:: 2"), 1)
+}
+
+func TestReviewSM2(t *testing.T) {
+	state := SM2State{}
+	var err error
+	state, err = ReviewSM2(state, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.IntervalDays)
+	state, _ = ReviewSM2(state, 4)
+	assert.Equal(t, 6, state.IntervalDays)
+	state, _ = ReviewSM2(state, 5)
+	assert.Equal(t, 15, state.IntervalDays) // 6 * 2.5
+	assert.InDelta(t, 2.6, state.EaseFactor, 0.001)
+
+	// 忘れたらやり直し
+	state, _ = ReviewSM2(state, 1)
+	assert.Equal(t, 1, state.IntervalDays)
+	assert.Equal(t, 0, state.Repetitions)
+	assert.Equal(t, 1, state.Lapses)
+	assert.GreaterOrEqual(t, state.EaseFactor, 1.3)
+
+	_, err = ReviewSM2(state, 6)
+	assert.ErrorIs(t, err, ErrInvalidGrade)
+}
@@ -0,0 +1,329 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// プロパティの型
+const (
+	PropertyString = "string"
+	PropertyNumber = "number"
+	PropertyDate   = "date"
+	PropertyBool   = "bool"
+	PropertyList   = "list"
+)
+
+// ErrInvalidFrontMatter は front matter が YAML のマッピングとして解釈できない場合のエラーです
+var ErrInvalidFrontMatter = errors.New("front matter is not a valid YAML mapping")
+
+// ErrInvalidPropertyKey はプロパティ名に使えない文字が含まれている場合のエラーです
+var ErrInvalidPropertyKey = errors.New("property key may only contain letters, digits, '_', '-' and '.'")
+
+// プロパティ名 (フィルターの演算子と区別できるように記号は _ - . のみ)
+var propertyKeyPattern = regexp.MustCompile(`^[\p{L}\p{N}_.\-]+$`)
+
+// Property は front matter の1項目を型付きで表したものです
+type Property struct {
+	Key    string
+	Type   string
+	Text   string // 文字列表現 (number は数値、date は YYYY-MM-DD か RFC3339、list は JSON 配列)
+	Number float64
+	Date   time.Time
+	Bool   bool
+	List   []string
+}
+
+// Value は JSON レスポンス用の値を返します (date は文字列表現)
+func (p Property) Value() interface{} {
+	switch p.Type {
+	case PropertyNumber:
+		return p.Number
+	case PropertyBool:
+		return p.Bool
+	case PropertyList:
+		return p.List
+	}
+	return p.Text
+}
+
+// ValidPropertyKey はプロパティ名として使えるかを返します
+func ValidPropertyKey(key string) bool {
+	return propertyKeyPattern.MatchString(key)
+}
+
+// SplitFrontMatter はメモ本文の先頭の "---" で囲まれた front matter と残りの本文を分けます。
+// front matter が無い場合は ok が false になり、body は content そのものです。
+func SplitFrontMatter(content string) (frontMatter, body string, ok bool) {
+	first, rest, found := strings.Cut(content, "\n")
+	if !found || strings.TrimRight(first, "\r") != "---" {
+		return "", content, false
+	}
+	offset := 0
+	for {
+		line, next, more := strings.Cut(rest[offset:], "\n")
+		trimmed := strings.TrimRight(line, "\r")
+		if trimmed == "---" || trimmed == "..." {
+			return rest[:offset], next, true
+		}
+		if !more {
+			return "", content, false
+		}
+		offset = len(rest) - len(next)
+	}
+}
+
+// ParseFrontMatter はメモ本文の front matter からプロパティを抽出します (出現順)。
+// front matter が無い場合は空のスライス、YAML として不正な場合は ErrInvalidFrontMatter を返します。
+// ネストしたマッピングや null の値は無視します。同じキーが複数ある場合は最後の値を使います。
+func ParseFrontMatter(content string) ([]Property, error) {
+	properties := []Property{}
+	mapping, err := frontMatterMapping(content)
+	if err != nil || mapping == nil {
+		return properties, err
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i].Value
+		if property, ok := propertyFromNode(key, mapping.Content[i+1]); ok {
+			properties = append(properties, property)
+		}
+	}
+	return properties, nil
+}
+
+// frontMatterMapping は front matter を YAML のマッピングノードとして返します。front matter が無い場合は nil です。
+// 同じキーが複数ある場合は最後のものだけを残します。
+func frontMatterMapping(content string) (*yaml.Node, error) {
+	frontMatter, _, ok := SplitFrontMatter(content)
+	if !ok {
+		return nil, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(frontMatter), &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFrontMatter, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, ErrInvalidFrontMatter
+	}
+	mapping := doc.Content[0]
+	last := map[string]int{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		last[mapping.Content[i].Value] = i
+	}
+	if len(last)*2 < len(mapping.Content) {
+		deduped := make([]*yaml.Node, 0, len(last)*2)
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if last[mapping.Content[i].Value] == i {
+				deduped = append(deduped, mapping.Content[i], mapping.Content[i+1])
+			}
+		}
+		mapping.Content = deduped
+	}
+	return mapping, nil
+}
+
+func propertyFromNode(key string, node *yaml.Node) (Property, bool) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return Property{}, false
+		case "!!int", "!!float":
+			var n float64
+			if err := node.Decode(&n); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+				return numberProperty(key, n), true
+			}
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err == nil {
+				return boolProperty(key, b), true
+			}
+		case "!!timestamp":
+			var t time.Time
+			if err := node.Decode(&t); err == nil {
+				return dateProperty(key, t), true
+			}
+		}
+		return Property{Key: key, Type: PropertyString, Text: node.Value}, true
+	case yaml.SequenceNode:
+		items := []string{}
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode && item.ShortTag() != "!!null" {
+				items = append(items, item.Value)
+			}
+		}
+		return listProperty(key, items), true
+	}
+	return Property{}, false
+}
+
+func numberProperty(key string, n float64) Property {
+	return Property{Key: key, Type: PropertyNumber, Text: strconv.FormatFloat(n, 'f', -1, 64), Number: n}
+}
+
+func boolProperty(key string, b bool) Property {
+	return Property{Key: key, Type: PropertyBool, Text: strconv.FormatBool(b), Bool: b}
+}
+
+func dateProperty(key string, t time.Time) Property {
+	t = t.UTC()
+	text := t.Format(time.RFC3339)
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		text = t.Format("2006-01-02")
+	}
+	return Property{Key: key, Type: PropertyDate, Text: text, Date: t}
+}
+
+func listProperty(key string, items []string) Property {
+	text, _ := json.Marshal(items)
+	return Property{Key: key, Type: PropertyList, Text: string(text), List: items}
+}
+
+// ParseDateValue は YYYY-MM-DD または RFC3339 形式の日付を解析します
+func ParseDateValue(value string) (time.Time, bool) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// PropertyFromValue は API (JSON) で指定された値からプロパティを作ります。
+// 文字列は日付として解釈できれば date、配列は list になります。
+func PropertyFromValue(key string, value interface{}) (Property, error) {
+	if !ValidPropertyKey(key) {
+		return Property{}, ErrInvalidPropertyKey
+	}
+	switch v := value.(type) {
+	case string:
+		if t, ok := ParseDateValue(v); ok {
+			return dateProperty(key, t), nil
+		}
+		return Property{Key: key, Type: PropertyString, Text: v}, nil
+	case float64:
+		return numberProperty(key, v), nil
+	case bool:
+		return boolProperty(key, v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case string, float64, bool:
+				items = append(items, fmt.Sprint(item))
+			default:
+				return Property{}, fmt.Errorf("property %q: list items must be strings, numbers or booleans", key)
+			}
+		}
+		return listProperty(key, items), nil
+	}
+	return Property{}, fmt.Errorf("property %q: unsupported value type %T", key, value)
+}
+
+// UpdateFrontMatter は front matter のプロパティを書き換えた本文を返します。
+// set のプロパティは上書き (無ければ末尾に追加)、remove のキーは削除し、他の項目やコメントはそのまま残します。
+// プロパティが無くなった場合は front matter ごと削除します。
+func UpdateFrontMatter(content string, set []Property, remove []string) (string, error) {
+	mapping, err := frontMatterMapping(content)
+	if err != nil {
+		return "", err
+	}
+	_, body, _ := SplitFrontMatter(content)
+	if mapping == nil {
+		mapping = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+
+	for _, key := range remove {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == key {
+				mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+				break
+			}
+		}
+	}
+	for _, property := range set {
+		replaced := false
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == property.Key {
+				mapping.Content[i+1] = property.node()
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: property.Key},
+				property.node())
+		}
+	}
+
+	if len(mapping.Content) == 0 {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(mapping); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	return "---\n" + buf.String() + "---\n" + body, nil
+}
+
+// node はプロパティを YAML のノードに変換します
+func (p Property) node() *yaml.Node {
+	switch p.Type {
+	case PropertyNumber:
+		tag := "!!float"
+		if p.Number == math.Trunc(p.Number) {
+			tag = "!!int"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: p.Text}
+	case PropertyBool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: p.Text}
+	case PropertyDate:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: p.Text}
+	case PropertyList:
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, item := range p.List {
+			seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return seq
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: p.Text}
+}
+
+// PropertyFilter はプロパティの絞り込み条件です (例: "priority>=2", "status=draft")
+type PropertyFilter struct {
+	Key   string
+	Op    string // = != > >= < <=
+	Value string
+}
+
+var propertyFilterPattern = regexp.MustCompile(`^([\p{L}\p{N}_.\-]+)\s*(!=|>=|<=|=|>|<|:)\s*(.*)$`)
+
+// ParsePropertyFilter は "キー 演算子 値" 形式の絞り込み条件を解析します。":" は "=" と同じ意味です。
+func ParsePropertyFilter(expr string) (PropertyFilter, error) {
+	m := propertyFilterPattern.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return PropertyFilter{}, fmt.Errorf("invalid property filter %q (expected e.g. status=draft or priority>=2)", expr)
+	}
+	op := m[2]
+	if op == ":" {
+		op = "="
+	}
+	return PropertyFilter{Key: m[1], Op: op, Value: m[3]}, nil
+}
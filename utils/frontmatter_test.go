@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	content := "---\nstatus: draft\npriority: 2\ndue: 2024-03-01\npublished: false\ntags: [go, fiber]\nempty:\n---\n# 本文\n"
+	properties, err := ParseFrontMatter(content)
+	assert.NoError(t, err)
+	if assert.Len(t, properties, 5) {
+		assert.Equal(t, Property{Key: "status", Type: PropertyString, Text: "draft"}, properties[0])
+		assert.Equal(t, PropertyNumber, properties[1].Type)
+		assert.Equal(t, 2.0, properties[1].Number)
+		assert.Equal(t, PropertyDate, properties[2].Type)
+		assert.Equal(t, "2024-03-01", properties[2].Text)
+		assert.Equal(t, PropertyBool, properties[3].Type)
+		assert.Equal(t, []string{"go", "fiber"}, properties[4].List)
+	}
+
+	_, body, ok := SplitFrontMatter(content)
+	assert.True(t, ok)
+	assert.Equal(t, "# 本文\n", body)
+
+	properties, err = ParseFrontMatter("--- not front matter\nstatus: draft")
+	assert.NoError(t, err)
+	assert.Empty(t, properties)
+	_, err = ParseFrontMatter("---\n- a\n- b\n---\n")
+	assert.ErrorIs(t, err, ErrInvalidFrontMatter)
+
+	// 同じキーが複数ある場合は最後の値を使う
+	properties, err = ParseFrontMatter("---\nstatus: draft\npriority: 1\nstatus: done\n---\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []Property{
+		{Key: "priority", Type: PropertyNumber, Text: "1", Number: 1},
+		{Key: "status", Type: PropertyString, Text: "done"},
+	}, properties)
+	updated, err := UpdateFrontMatter("---\nstatus: draft\nstatus: done\n---\nbody", []Property{{Key: "status", Type: PropertyString, Text: "archived"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "---\nstatus: archived\n---\nbody", updated)
+}
+
+func TestUpdateFrontMatter(t *testing.T) {
+	content := "---\n# コメント\nstatus: draft\nowner: me\n---\n本文"
+	priority, _ := PropertyFromValue("priority", 2.0)
+	status, _ := PropertyFromValue("status", "2024-01-01")
+	updated, err := UpdateFrontMatter(content, []Property{status, priority}, []string{"owner"})
+	assert.NoError(t, err)
+	assert.Equal(t, "---\n# コメント\nstatus: 2024-01-01\npriority: 2\n---\n本文", updated)
+
+	properties, _ := ParseFrontMatter(updated)
+	if assert.Len(t, properties, 2) {
+		assert.Equal(t, PropertyDate, properties[0].Type)
+	}
+
+	// 文字列として指定した値は型が変わらないようにクォートされる
+	text := Property{Key: "version", Type: PropertyString, Text: "1.0"}
+	updated, _ = UpdateFrontMatter("本文だけ", []Property{text}, nil)
+	assert.Equal(t, "---\nversion: \"1.0\"\n---\n本文だけ", updated)
+
+	// プロパティが無くなれば front matter ごと消える
+	updated, _ = UpdateFrontMatter(updated, nil, []string{"version"})
+	assert.Equal(t, "本文だけ", updated)
+
+	_, err = PropertyFromValue("bad key", "x")
+	assert.ErrorIs(t, err, ErrInvalidPropertyKey)
+}
+
+func TestParsePropertyFilter(t *testing.T) {
+	filter, err := ParsePropertyFilter("priority>=2")
+	assert.NoError(t, err)
+	assert.Equal(t, PropertyFilter{Key: "priority", Op: ">=", Value: "2"}, filter)
+	filter, _ = ParsePropertyFilter("status:draft")
+	assert.Equal(t, "=", filter.Op)
+	_, err = ParsePropertyFilter("=draft")
+	assert.Error(t, err)
+}
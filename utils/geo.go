@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKm は地球の平均半径 (km) です
+const earthRadiusKm = 6371.0
+
+// ErrInvalidCoordinates は緯度・経度の形式または範囲が不正な場合のエラーです
+var ErrInvalidCoordinates = errors.New("coordinates must be latitude (-90..90) and longitude (-180..180)")
+
+// ValidCoordinates は緯度・経度が範囲内かどうかを返します
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// ParseLatLng は "lat,lng" 形式の座標を解析します
+func ParseLatLng(value string) (float64, float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return 0, 0, ErrInvalidCoordinates
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || !ValidCoordinates(lat, lng) {
+		return 0, 0, ErrInvalidCoordinates
+	}
+	return lat, lng, nil
+}
+
+// BBox は緯度・経度の範囲です。MinLng > MaxLng の場合は経度180度の線をまたぐ範囲を表します。
+type BBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// ParseBBox は GeoJSON と同じ "minLng,minLat,maxLng,maxLat" 形式の範囲を解析します
+func ParseBBox(value string) (BBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BBox{}, ErrInvalidCoordinates
+	}
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BBox{}, ErrInvalidCoordinates
+		}
+		v[i] = f
+	}
+	box := BBox{MinLng: v[0], MinLat: v[1], MaxLng: v[2], MaxLat: v[3]}
+	if !ValidCoordinates(box.MinLat, box.MinLng) || !ValidCoordinates(box.MaxLat, box.MaxLng) || box.MinLat > box.MaxLat {
+		return BBox{}, ErrInvalidCoordinates
+	}
+	return box, nil
+}
+
+// BBoxAround は中心から radiusKm 以内の点をすべて含む範囲を返します (距離の判定前の絞り込み用)
+func BBoxAround(lat, lng, radiusKm float64) BBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	box := BBox{MinLat: lat - dLat, MaxLat: lat + dLat, MinLng: -180, MaxLng: 180}
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		// 極を含む場合はすべての経度が対象
+		box.MinLat, box.MaxLat = math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+		return box
+	}
+	// 範囲内で最も極に近い緯度で経度の幅が最大になる
+	maxAbsLat := math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat))
+	dLng := dLat / math.Cos(maxAbsLat*math.Pi/180)
+	if dLng >= 180 {
+		return box
+	}
+	box.MinLng, box.MaxLng = normalizeLng(lng-dLng), normalizeLng(lng+dLng)
+	return box
+}
+
+func normalizeLng(lng float64) float64 {
+	if lng < -180 {
+		return lng + 360
+	}
+	if lng > 180 {
+		return lng - 360
+	}
+	return lng
+}
+
+// DistanceKm は2点間の大円距離 (km) をハバーサイン公式で求めます
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
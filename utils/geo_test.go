@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLatLng(t *testing.T) {
+	lat, lng, err := ParseLatLng("35.6812, 139.7671")
+	assert.NoError(t, err)
+	assert.Equal(t, 35.6812, lat)
+	assert.Equal(t, 139.7671, lng)
+
+	for _, value := range []string{"", "35.6", "91,0", "0,181", "a,b", "1,2,3"} {
+		_, _, err := ParseLatLng(value)
+		assert.ErrorIs(t, err, ErrInvalidCoordinates, value)
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := ParseBBox("139,35,140,36")
+	assert.NoError(t, err)
+	assert.Equal(t, BBox{MinLng: 139, MinLat: 35, MaxLng: 140, MaxLat: 36}, box)
+
+	// 経度180度をまたぐ範囲は MinLng > MaxLng で表す
+	_, err = ParseBBox("170,-10,-170,10")
+	assert.NoError(t, err)
+
+	_, err = ParseBBox("139,36,140,35")
+	assert.ErrorIs(t, err, ErrInvalidCoordinates)
+}
+
+func TestDistanceKm(t *testing.T) {
+	// 東京駅から大阪駅まで約403km
+	assert.InDelta(t, 403, DistanceKm(35.6812, 139.7671, 34.7025, 135.4959), 2)
+	assert.Zero(t, DistanceKm(35, 139, 35, 139))
+}
+
+func TestBBoxAround(t *testing.T) {
+	box := BBoxAround(35.6812, 139.7671, 10)
+	assert.InDelta(t, 35.59, box.MinLat, 0.01)
+	assert.InDelta(t, 35.77, box.MaxLat, 0.01)
+	assert.Less(t, box.MinLng, 139.7671)
+	assert.Greater(t, box.MaxLng, 139.7671)
+
+	// 経度180度の近くでは範囲がまたがる
+	box = BBoxAround(0, 179.95, 20)
+	assert.Greater(t, box.MinLng, box.MaxLng)
+
+	// 極の近くではすべての経度を含む
+	box = BBoxAround(89.95, 0, 20)
+	assert.Equal(t, -180.0, box.MinLng)
+	assert.Equal(t, 90.0, box.MaxLat)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 )
 
@@ -13,3 +14,12 @@ func GenerateID() string {
 	}
 	return hex.EncodeToString(bytes)
 }
+
+// GenerateToken generates an unguessable URL-safe token (256 bits)
+func GenerateToken() string {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 検索クエリの構文 (GET /memos/search と Web UI の検索の q)。語は空白で区切り、すべての条件を満たすメモに一致します。
+//
+//	語             タイトル・本文 (Web UI ではカテゴリも) に含む (NormalizeSearchText で正規化した部分一致)
+//	"語 語"        フレーズ (空白を含めて一致)
+//	-条件          条件を満たさない (語・フレーズ・フィルタに付けられる)
+//	条件 OR 条件   どちらかを満たす (OR は大文字で、前後の条件と結びつく)
+//	category:値 tag:値 before:YYYY-MM-DD after:YYYY-MM-DD is:pinned is:archived has:attachment related:メモID
+//
+// フィルタの値は "..." で空白を含められます。知らない名前の "名前:値" は語として扱います (10:30 など)。
+
+// 検索クエリのフィルタの名前
+const (
+	SearchFieldCategory = "category"
+	SearchFieldTag      = "tag"
+	SearchFieldBefore   = "before"
+	SearchFieldAfter    = "after"
+	SearchFieldIs       = "is"
+	SearchFieldHas      = "has"
+	SearchFieldRelated  = "related"
+)
+
+// searchFieldValues はフィルタごとに指定できる値です (nil なら任意の値)
+var searchFieldValues = map[string][]string{
+	SearchFieldCategory: nil,
+	SearchFieldTag:      nil,
+	SearchFieldBefore:   nil,
+	SearchFieldAfter:    nil,
+	SearchFieldIs:       {"pinned", "archived"},
+	SearchFieldHas:      {"attachment"},
+	SearchFieldRelated:  nil,
+}
+
+// SearchDateLayout は before: / after: の日付の形式です
+const SearchDateLayout = "2006-01-02"
+
+// SearchTerm は検索クエリの1つの条件です
+type SearchTerm struct {
+	Field    string // 空なら語 (フレーズを含む)、それ以外は SearchField* のフィルタ
+	Value    string // tag: はタグを正規化した値、is: / has: は小文字にした値
+	Negated  bool   // -条件
+	Position int    // クエリ内の位置 (文字単位、0 から)
+}
+
+// SearchQuery はパースした検索クエリです。Clauses のそれぞれ (OR でつないだ条件) をすべて満たすメモに一致します。
+type SearchQuery struct {
+	Clauses [][]SearchTerm
+}
+
+// SearchQueryError は検索クエリの構文エラーです
+type SearchQueryError struct {
+	Position int // エラーの位置 (文字単位、0 から)
+	Message  string
+}
+
+func (e *SearchQueryError) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Message, e.Position)
+}
+
+// searchToken は検索クエリを空白で区切った1つの語、または OR です
+type searchToken struct {
+	term SearchTerm
+	or   bool
+}
+
+// ParseSearchQuery は検索クエリをパースします。構文が正しくなければ *SearchQueryError を返します。
+func ParseSearchQuery(query string) (*SearchQuery, error) {
+	tokens, err := tokenizeSearchQuery([]rune(query))
+	if err != nil {
+		return nil, err
+	}
+	parsed := &SearchQuery{}
+	pendingOr := -1
+	for _, token := range tokens {
+		if token.or {
+			if len(parsed.Clauses) == 0 || pendingOr >= 0 {
+				return nil, &SearchQueryError{Position: token.term.Position, Message: "OR must be placed between two conditions"}
+			}
+			pendingOr = token.term.Position
+			continue
+		}
+		if pendingOr >= 0 {
+			last := len(parsed.Clauses) - 1
+			parsed.Clauses[last] = append(parsed.Clauses[last], token.term)
+			pendingOr = -1
+			continue
+		}
+		parsed.Clauses = append(parsed.Clauses, []SearchTerm{token.term})
+	}
+	if pendingOr >= 0 {
+		return nil, &SearchQueryError{Position: pendingOr, Message: "OR must be placed between two conditions"}
+	}
+	if len(parsed.Clauses) == 0 {
+		return nil, &SearchQueryError{Position: 0, Message: "search query is empty"}
+	}
+	return parsed, nil
+}
+
+func tokenizeSearchQuery(runes []rune) ([]searchToken, error) {
+	var tokens []searchToken
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		term := SearchTerm{Position: i}
+		if runes[i] == '-' {
+			if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) {
+				return nil, &SearchQueryError{Position: i, Message: "'-' must be followed by a condition"}
+			}
+			term.Negated = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			value, end, err := readQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			term.Value, i = value, end
+			tokens = append(tokens, searchToken{term: term})
+			continue
+		}
+
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if runes[i] == ':' && term.Field == "" {
+				if _, ok := searchFieldValues[strings.ToLower(string(runes[start:i]))]; ok {
+					term.Field = strings.ToLower(string(runes[start:i]))
+					start = i + 1
+					if start < len(runes) && runes[start] == '"' {
+						value, end, err := readQuoted(runes, start)
+						if err != nil {
+							return nil, err
+						}
+						term.Value, i = value, end
+						break
+					}
+				}
+			}
+			i++
+		}
+		if term.Field == "" || term.Value == "" {
+			term.Value = string(runes[start:i])
+		}
+		if term.Field == "" && !term.Negated && term.Value == "OR" {
+			tokens = append(tokens, searchToken{term: term, or: true})
+			continue
+		}
+		if term.Field != "" {
+			if err := validateSearchField(&term); err != nil {
+				return nil, err
+			}
+		}
+		tokens = append(tokens, searchToken{term: term})
+	}
+	return tokens, nil
+}
+
+// readQuoted は runes[start] の " から閉じる " までの文字列と、閉じる " の次の位置を返します
+func readQuoted(runes []rune, start int) (string, int, error) {
+	for end := start + 1; end < len(runes); end++ {
+		if runes[end] == '"' {
+			if end == start+1 {
+				return "", 0, &SearchQueryError{Position: start, Message: "quoted phrase is empty"}
+			}
+			return string(runes[start+1 : end]), end + 1, nil
+		}
+	}
+	return "", 0, &SearchQueryError{Position: start, Message: "quoted phrase is not closed"}
+}
+
+// validateSearchField はフィルタの値を確認し、比較に使う形に揃えます
+func validateSearchField(term *SearchTerm) error {
+	if strings.TrimSpace(term.Value) == "" {
+		return &SearchQueryError{Position: term.Position, Message: fmt.Sprintf("%s: requires a value", term.Field)}
+	}
+	switch term.Field {
+	case SearchFieldTag:
+		term.Value = NormalizeTag(term.Value)
+		if term.Value == "" {
+			return &SearchQueryError{Position: term.Position, Message: "tag: requires a value"}
+		}
+	case SearchFieldBefore, SearchFieldAfter:
+		if _, err := time.Parse(SearchDateLayout, term.Value); err != nil {
+			return &SearchQueryError{Position: term.Position, Message: fmt.Sprintf("%s: expects a date like 2024-04-01, got %q", term.Field, term.Value)}
+		}
+	}
+	if allowed := searchFieldValues[term.Field]; allowed != nil {
+		value := strings.ToLower(term.Value)
+		for _, candidate := range allowed {
+			if value == candidate {
+				term.Value = value
+				return nil
+			}
+		}
+		return &SearchQueryError{Position: term.Position, Message: fmt.Sprintf("%s: expects one of %s, got %q", term.Field, strings.Join(allowed, ", "), term.Value)}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := ParseSearchQuery(`会議 "next week" -draft tag:#Work OR category:"仕事 メモ" before:2024-04-01 is:Pinned 10:30`)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]SearchTerm{
+		{{Value: "会議", Position: 0}},
+		{{Value: "next week", Position: 3}},
+		{{Value: "draft", Negated: true, Position: 15}},
+		{{Field: SearchFieldTag, Value: "work", Position: 22}, {Field: SearchFieldCategory, Value: "仕事 メモ", Position: 35}},
+		{{Field: SearchFieldBefore, Value: "2024-04-01", Position: 52}},
+		{{Field: SearchFieldIs, Value: "pinned", Position: 70}},
+		{{Value: "10:30", Position: 80}},
+	}, query.Clauses)
+
+	query, err = ParseSearchQuery(`a OR b OR -has:attachment related:m1`)
+	assert.NoError(t, err)
+	if assert.Len(t, query.Clauses, 2) {
+		assert.Len(t, query.Clauses[0], 3)
+		assert.Equal(t, SearchTerm{Field: SearchFieldHas, Value: "attachment", Negated: true, Position: 10}, query.Clauses[0][2])
+		assert.Equal(t, SearchTerm{Field: SearchFieldRelated, Value: "m1", Position: 26}, query.Clauses[1][0])
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	for query, want := range map[string]SearchQueryError{
+		`OR a`:              {Position: 0, Message: "OR must be placed between two conditions"},
+		`a OR`:              {Position: 2, Message: "OR must be placed between two conditions"},
+		`a OR OR b`:         {Position: 5, Message: "OR must be placed between two conditions"},
+		`a "unclosed`:       {Position: 2, Message: "quoted phrase is not closed"},
+		`""`:                {Position: 0, Message: "quoted phrase is empty"},
+		`a -`:               {Position: 2, Message: "'-' must be followed by a condition"},
+		`   `:               {Position: 0, Message: "search query is empty"},
+		`tag:`:              {Position: 0, Message: "tag: requires a value"},
+		`x after:yesterday`: {Position: 2, Message: `after: expects a date like 2024-04-01, got "yesterday"`},
+		`is:starred`:        {Position: 0, Message: `is: expects one of pinned, archived, got "starred"`},
+		`-has:"link"`:       {Position: 0, Message: `has: expects one of attachment, got "link"`},
+	} {
+		_, err := ParseSearchQuery(query)
+		var queryErr *SearchQueryError
+		if assert.ErrorAs(t, err, &queryErr, query) {
+			assert.Equal(t, want, *queryErr, query)
+		}
+	}
+}
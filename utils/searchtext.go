@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 検索では表記の揺れを吸収するため、索引する本文と検索キーワードの両方を NormalizeSearchText で正規化し、
+// 文字と数字の並び (語) ごとに2文字ずつの並び (bigram) に分割します。空白で区切らない日本語でも部分一致で検索できます。
+
+// NormalizeSearchText は検索用に文字列を正規化します。
+// NFKC で全角・半角を揃え (全角英数字・半角カナなど)、小文字にし、カタカナをひらがなにし、長音符 (ー) を除きます
+// (「サーバー」と「サーバ」、「コーヒー」と「こーひー」が一致する)。
+// 文字と数字以外 (記号・空白) の並びは1つの空白にします。
+func NormalizeSearchText(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(norm.NFKC.String(text)) {
+		switch {
+		case r == 'ー':
+			continue
+		case (r >= 'ァ' && r <= 'ヶ') || r == 'ヽ' || r == 'ヾ':
+			r -= 'ァ' - 'ぁ'
+		}
+		if !isSearchRune(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isSearchRune は検索で語を構成する文字 (文字と数字) かどうかを返します (SQLite FTS5 の unicode61 と同じ分類)
+func isSearchRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// searchWords は正規化した文字列を語 (文字と数字の並び) に分割します
+func searchWords(text string) [][]rune {
+	var words [][]rune
+	for _, word := range strings.Fields(NormalizeSearchText(text)) {
+		words = append(words, []rune(word))
+	}
+	return words
+}
+
+// wordGrams は語の bigram を返します。withLast なら語の最後の1文字も加えます。
+func wordGrams(word []rune, withLast bool) []string {
+	var grams []string
+	for i := 0; i+1 < len(word); i++ {
+		grams = append(grams, string(word[i:i+2]))
+	}
+	if withLast && len(word) > 0 {
+		grams = append(grams, string(word[len(word)-1:]))
+	}
+	return grams
+}
+
+// SearchGrams は索引する本文の検索用の並び (順序どおり、重複あり) を返します。
+// 語ごとの bigram と語の最後の1文字で、すべての文字がいずれかの並びの先頭になるため、1文字のキーワードも前方一致で検索できます。
+func SearchGrams(text string) []string {
+	var grams []string
+	for _, word := range searchWords(text) {
+		grams = append(grams, wordGrams(word, true)...)
+	}
+	return grams
+}
+
+// SearchQueryGrams はキーワードの検索用の並びを返します。本文の SearchGrams の中にこの並びが連続して現れれば一致します。
+// キーワードの最後の語は本文の語の途中で終わってもよいので最後の1文字を含めません。
+// 最後の語が1文字の場合はその文字を prefix として返します (その文字で始まる並びに前方一致させる)。
+func SearchQueryGrams(query string) (grams []string, prefix string) {
+	words := searchWords(query)
+	for i, word := range words {
+		last := i == len(words)-1
+		if last && len(word) == 1 {
+			return grams, string(word)
+		}
+		grams = append(grams, wordGrams(word, !last)...)
+	}
+	return grams, ""
+}
+
+// MatchSearchText は正規化した text がキーワード (正規化したもの) を含むかどうかを返します。
+// 記号・空白だけのキーワードはどれにも一致しません。
+func MatchSearchText(text, query string) bool {
+	query = NormalizeSearchText(query)
+	return query != "" && strings.Contains(NormalizeSearchText(text), query)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeSearchText(t *testing.T) {
+	// 全角・半角、大文字小文字、カタカナとひらがな、長音符の揺れを吸収する
+	assert.Equal(t, "go 1 24", NormalizeSearchText("Ｇｏ　１．２４"))
+	assert.Equal(t, "さば", NormalizeSearchText("ｻｰﾊﾞｰ"))
+	assert.Equal(t, NormalizeSearchText("サーバ"), NormalizeSearchText("さーばー"))
+	assert.Equal(t, "こひ", NormalizeSearchText("コーヒー"))
+	assert.Equal(t, "ゔぁいおりん", NormalizeSearchText("ヴァイオリン"))
+	assert.Equal(t, "東京 都", NormalizeSearchText("「東京」・都!"))
+	assert.Empty(t, NormalizeSearchText(" !? "))
+}
+
+func TestSearchGrams(t *testing.T) {
+	assert.Equal(t, []string{"東京", "京都", "都", "go", "o"}, SearchGrams("東京都 Go"))
+
+	grams, prefix := SearchQueryGrams("トウキョウ")
+	assert.Equal(t, []string{"とう", "うき", "きょ", "ょう"}, grams)
+	assert.Empty(t, prefix)
+	grams, prefix = SearchQueryGrams("milk A")
+	assert.Equal(t, []string{"mi", "il", "lk", "k"}, grams)
+	assert.Equal(t, "a", prefix)
+
+	// キーワードの並びは本文の並びの中に連続して現れる
+	text := " " + strings.Join(SearchGrams("Milk and Bread、コーヒー豆"), " ") + " "
+	for _, query := range []string{"milk", "ilk AND", "k and", "ＢＲＥＡＤ", "こひ", "ｺｰﾋｰ豆"} {
+		grams, _ := SearchQueryGrams(query)
+		assert.Contains(t, text, " "+strings.Join(grams, " ")+" ", query)
+		assert.True(t, MatchSearchText("Milk and Bread、コーヒー豆", query), query)
+	}
+	assert.False(t, MatchSearchText("Milk and Bread", "mil k"))
+	assert.False(t, MatchSearchText("Milk and Bread", "!!"))
+}
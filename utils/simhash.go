@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SimHash の計算に使う文字の並び (shingle) の長さ
+	shingleSize = 3
+	// これより shingle が少ない短い本文は指紋の比較対象にしない (短いと偶然似てしまうため)
+	MinSimHashShingles = 8
+)
+
+// normalizeForSimHash は表記の揺れで指紋が変わらないように、小文字化して文字と数字以外 (記号・空白) を除きます
+// (日本語は単語を空白で区切らないので、空白も区切りとして扱わない)
+func normalizeForSimHash(text string) []rune {
+	runes := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// SimHash は本文の 64bit の SimHash と、計算に使った shingle の数を返します。
+// 似た本文ほどハミング距離の近い値になります。shingle の数が MinSimHashShingles 未満なら比較には使わないでください。
+func SimHash(text string) (uint64, int) {
+	runes := normalizeForSimHash(text)
+	count := len(runes) - shingleSize + 1
+	if count <= 0 {
+		return 0, 0
+	}
+	var weights [64]int
+	for i := 0; i < count; i++ {
+		h := fnv.New64a()
+		h.Write([]byte(string(runes[i : i+shingleSize])))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << uint(bit)
+		}
+	}
+	return hash, count
+}
+
+// SimHashSimilarity は2つの SimHash の類似度 (0〜1、一致するビットの割合) を返します
+func SimHashSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// SimHashMaxDistance は類似度が threshold 以上になる SimHash 同士の最大のハミング距離を返します
+func SimHashMaxDistance(threshold float64) int {
+	distance := int((1-threshold)*64 + 1e-9)
+	if distance < 0 {
+		return 0
+	}
+	if distance > 63 {
+		return 63
+	}
+	return distance
+}
+
+// SimHashBands は SimHash を maxDistance+1 個のビットの帯 (band) に分けた値を返します。
+// ハミング距離が maxDistance 以下の SimHash 同士は鳩の巣原理で少なくとも1つの帯が一致するので、
+// 帯ごとにまとめると全件を比較せずに候補を絞り込めます。
+func SimHashBands(hash uint64, maxDistance int) []uint64 {
+	count := maxDistance + 1
+	bands := make([]uint64, count)
+	start := 0
+	for i := range bands {
+		width := 64 / count
+		if i < 64%count {
+			width++
+		}
+		bands[i] = hash >> uint(start) & (1<<uint(width) - 1)
+		start += width
+	}
+	return bands
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimHash(t *testing.T) {
+	base := "Buy milk, eggs and bread on the way home from the office tomorrow"
+	hash, shingles := SimHash(base)
+	assert.GreaterOrEqual(t, shingles, MinSimHashShingles)
+
+	// 大文字小文字・記号・空白の違いは無視する
+	same, _ := SimHash("buy milk eggs   and bread on the way home from the office tomorrow!")
+	assert.Equal(t, hash, same)
+
+	near, _ := SimHash("Buy milk, eggs and bread on the way home from the office tomorrow morning")
+	other, _ := SimHash("Quarterly planning notes: hiring, budget review and the roadmap for Q3")
+	assert.Greater(t, SimHashSimilarity(hash, near), 0.85)
+	assert.Less(t, SimHashSimilarity(hash, other), 0.8)
+
+	// 日本語も文字単位の shingle で比較できる
+	ja, _ := SimHash("明日の会議の資料を準備して、部長にメールで送る")
+	jaNear, _ := SimHash("明日の会議の資料を準備して部長にメールで送る。")
+	assert.Greater(t, SimHashSimilarity(ja, jaNear), 0.85)
+
+	_, shingles = SimHash("hi")
+	assert.Zero(t, shingles)
+}
+
+func TestSimHashBands(t *testing.T) {
+	assert.Equal(t, 6, SimHashMaxDistance(0.9))
+	assert.Equal(t, 32, SimHashMaxDistance(0.5))
+	assert.Equal(t, 0, SimHashMaxDistance(1))
+	assert.Equal(t, []uint64{0xdeadbeefcafef00d}, SimHashBands(0xdeadbeefcafef00d, 0))
+
+	// ハミング距離が maxDistance 以下なら少なくとも1つの帯が一致する
+	hash := uint64(0x0123456789abcdef)
+	near := hash ^ (1 | 1<<10 | 1<<20 | 1<<30 | 1<<40 | 1<<50)
+	bands, nearBands := SimHashBands(hash, 6), SimHashBands(near, 6)
+	assert.Len(t, bands, 7)
+	shared := 0
+	for i := range bands {
+		if bands[i] == nearBands[i] {
+			shared++
+		}
+	}
+	assert.Equal(t, 1, shared)
+}
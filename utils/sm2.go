@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrInvalidGrade は SM-2 の評価が 0〜5 の範囲外の場合のエラーです
+var ErrInvalidGrade = errors.New("grade must be between 0 and 5")
+
+// 新しいカードの容易度 (ease factor) と下限
+const (
+	InitialEaseFactor = 2.5
+	minEaseFactor     = 1.3
+)
+
+// SM2State は SM-2 アルゴリズムでのカードの復習状態です
+type SM2State struct {
+	EaseFactor   float64
+	IntervalDays int // 次の復習までの日数
+	Repetitions  int // 連続して正解した回数
+	Lapses       int // 忘れた (評価が3未満だった) 回数
+}
+
+// ReviewSM2 は評価 (0: 全く思い出せない 〜 5: 完璧) から次の復習状態を求めます。
+// 3未満は忘れたものとして1日後からやり直します。
+func ReviewSM2(state SM2State, grade int) (SM2State, error) {
+	if grade < 0 || grade > 5 {
+		return state, ErrInvalidGrade
+	}
+	if state.EaseFactor == 0 {
+		state.EaseFactor = InitialEaseFactor
+	}
+	if grade < 3 {
+		state.Repetitions = 0
+		state.IntervalDays = 1
+		state.Lapses++
+	} else {
+		switch state.Repetitions {
+		case 0:
+			state.IntervalDays = 1
+		case 1:
+			state.IntervalDays = 6
+		default:
+			state.IntervalDays = int(math.Round(float64(state.IntervalDays) * state.EaseFactor))
+		}
+		state.Repetitions++
+	}
+	q := float64(5 - grade)
+	state.EaseFactor = math.Max(minEaseFactor, state.EaseFactor+0.1-q*(0.08+q*0.02))
+	return state, nil
+}
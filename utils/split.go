@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrNothingToSplit      = errors.New("memo has no place to split")
+	ErrInvalidSplitOffsets = errors.New("offsets must be increasing and inside the content")
+	ErrEmptySplitPart      = errors.New("split would create an empty memo")
+)
+
+// 分割したメモのタイトルの最大文字数
+const maxPartTitleLength = 80
+
+// ATX 見出し ("## 見出し" や "## 見出し ##")
+var headingPattern = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// MemoPart はメモを分割した1つ分です
+type MemoPart struct {
+	Title   string // 見出し、なければ最初の行から求めたタイトル
+	Content string
+}
+
+// SplitAtHeadings はメモ本文を level の見出しの行で分割します (level が0なら本文で最も大きい見出し)。
+// 最初の見出しより前の本文は最初の部分になり、front matter も最初の部分に残します。コードブロック内は無視します。
+func SplitAtHeadings(content string, level int) ([]MemoPart, error) {
+	frontMatter, body, hasFrontMatter := SplitFrontMatter(content)
+	lines := strings.Split(body, "\n")
+
+	// 見出しの行番号と見出しのレベル
+	type heading struct {
+		line  int
+		level int
+		title string
+	}
+	var headings []heading
+	inCodeBlock := false
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r")
+		if strings.HasPrefix(strings.TrimSpace(trimmed), "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(trimmed); m != nil {
+			headings = append(headings, heading{line: i, level: len(m[1]), title: m[2]})
+		}
+	}
+	if level == 0 {
+		for _, h := range headings {
+			if level == 0 || h.level < level {
+				level = h.level
+			}
+		}
+	}
+
+	var parts []MemoPart
+	start, title := 0, ""
+	flush := func(end int) {
+		text := strings.Trim(strings.Join(lines[start:end], "\n"), "\r\n")
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		if title == "" {
+			title = partTitle(text)
+		}
+		parts = append(parts, MemoPart{Title: title, Content: text})
+	}
+	for _, h := range headings {
+		if h.level != level {
+			continue
+		}
+		flush(h.line)
+		start, title = h.line, h.title
+	}
+	flush(len(lines))
+	if len(parts) < 2 {
+		return nil, ErrNothingToSplit
+	}
+	if hasFrontMatter {
+		parts[0].Content = "---\n" + frontMatter + "---\n" + parts[0].Content
+	}
+	return parts, nil
+}
+
+// SplitAtOffsets はメモ本文を文字 (rune) 単位の位置で分割します。位置は増加順で、本文の内側である必要があります。
+func SplitAtOffsets(content string, offsets []int) ([]MemoPart, error) {
+	if len(offsets) == 0 {
+		return nil, ErrNothingToSplit
+	}
+	runes := []rune(content)
+	previous := 0
+	parts := make([]MemoPart, 0, len(offsets)+1)
+	for i := 0; i <= len(offsets); i++ {
+		end := len(runes)
+		if i < len(offsets) {
+			end = offsets[i]
+			if end <= previous || end >= len(runes) {
+				return nil, ErrInvalidSplitOffsets
+			}
+		}
+		text := strings.Trim(string(runes[previous:end]), "\r\n")
+		if strings.TrimSpace(text) == "" {
+			return nil, ErrEmptySplitPart
+		}
+		parts = append(parts, MemoPart{Title: partTitle(text), Content: text})
+		previous = end
+	}
+	return parts, nil
+}
+
+// partTitle は本文の最初の空でない行 (見出し記号やリスト記号を除く) をタイトルにします
+func partTitle(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#-*+> "))
+		if line == "" || line == "---" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxPartTitleLength {
+			line = string([]rune(line)[:maxPartTitleLength]) + "…"
+		}
+		return line
+	}
+	return ""
+}
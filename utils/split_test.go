@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAtHeadings(t *testing.T) {
+	content := "---\nstatus: draft\n---\nintro\n## First\nbody 1\n```\n## not a heading\n```\n### Sub\nsub body\n## Second ##\nbody 2\n"
+	parts, err := SplitAtHeadings(content, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, parts, 3) {
+		assert.Equal(t, "---\nstatus: draft\n---\nintro", parts[0].Content)
+		assert.Equal(t, "intro", parts[0].Title)
+		assert.Equal(t, "First", parts[1].Title)
+		assert.Equal(t, "## First\nbody 1\n```\n## not a heading\n```\n### Sub\nsub body", parts[1].Content)
+		assert.Equal(t, "Second", parts[2].Title)
+	}
+
+	// 見出しより前が空なら最初の見出しから始める
+	parts, err = SplitAtHeadings("# A\na\n# B\nb", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, parts, 2) {
+		assert.Equal(t, "A", parts[0].Title)
+	}
+
+	_, err = SplitAtHeadings("# Only\ntext", 0)
+	assert.ErrorIs(t, err, ErrNothingToSplit)
+	_, err = SplitAtHeadings("#tag is not a heading\nmore", 0)
+	assert.ErrorIs(t, err, ErrNothingToSplit)
+}
+
+func TestSplitAtOffsets(t *testing.T) {
+	parts, err := SplitAtOffsets("日本語のメモ\n- 次の部分\n最後", []int{7, 14})
+	assert.NoError(t, err)
+	if assert.Len(t, parts, 3) {
+		assert.Equal(t, "日本語のメモ", parts[0].Content)
+		assert.Equal(t, "次の部分", parts[1].Title)
+		assert.Equal(t, "最後", parts[2].Content)
+	}
+
+	_, err = SplitAtOffsets("abc", []int{2, 1})
+	assert.ErrorIs(t, err, ErrInvalidSplitOffsets)
+	_, err = SplitAtOffsets("abc", []int{3})
+	assert.ErrorIs(t, err, ErrInvalidSplitOffsets)
+	_, err = SplitAtOffsets("a\n\nb", []int{1, 2})
+	assert.ErrorIs(t, err, ErrEmptySplitPart)
+}
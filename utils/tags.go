@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ExtractTags はメモ本文から #タグ を抽出します (重複は除き、出現順)。
+// 見出しの "# " やURLのフラグメントはタグとして扱いません。
+func ExtractTags(content string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' {
+			continue
+		}
+		if i > 0 && !unicode.IsSpace(runes[i-1]) && !strings.ContainsRune("(（「、。", runes[i-1]) {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && isTagRune(runes[j]) {
+			j++
+		}
+		if j == i+1 {
+			continue
+		}
+		tag := NormalizeTag(string(runes[i+1 : j]))
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+		i = j - 1
+	}
+	return tags
+}
+
+// NormalizeTag はタグ比較用に先頭の # を除き小文字化します
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '/'
+}
@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTags(t *testing.T) {
+	tags := ExtractTags("# 見出し\n#Go と #日本語 のメモ #go (#fiber) https://example.com/#frag")
+	assert.Equal(t, []string{"go", "日本語", "fiber"}, tags)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// チェックボックス行 (例: "- [ ] やること", "  * [x] 完了")
+var taskLinePattern = regexp.MustCompile(`^(\s*[-*+]\s+\[)([ xX])(\]\s+)(.*)$`)
+
+// タスク本文中の期限指定 (例: "due:2024-01-31")
+var taskDuePattern = regexp.MustCompile(`(?:^|\s)due:(\d{4}-\d{2}-\d{2})(?:\s|$)`)
+
+// ParsedTask はMarkdownのチェックボックス1行分です
+type ParsedTask struct {
+	Line  int // 1始まりの行番号
+	Text  string
+	Done  bool
+	DueAt *time.Time
+}
+
+// ErrTaskLineMismatch は指定行がチェックボックスでない、または内容が変わっている場合のエラーです
+var ErrTaskLineMismatch = errors.New("line is not the expected task")
+
+// ParseTasks はメモ本文からチェックボックス項目を抽出します。コードブロック内は無視します。
+func ParseTasks(content string) []ParsedTask {
+	tasks := []ParsedTask{}
+	inCodeBlock := false
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+		m := taskLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		task := ParsedTask{
+			Line: i + 1,
+			Text: strings.TrimSpace(m[4]),
+			Done: m[2] != " ",
+		}
+		if d := taskDuePattern.FindStringSubmatch(task.Text); d != nil {
+			if due, err := time.Parse("2006-01-02", d[1]); err == nil {
+				task.DueAt = &due
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// SetTaskDone は指定行のチェックボックスを書き換えた本文を返します。
+// 行の内容が text と一致しない場合は ErrTaskLineMismatch を返します。
+func SetTaskDone(content string, line int, text string, done bool) (string, error) {
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return "", ErrTaskLineMismatch
+	}
+	current := lines[line-1]
+	cr := strings.HasSuffix(current, "\r")
+	m := taskLinePattern.FindStringSubmatch(strings.TrimRight(current, "\r"))
+	if m == nil || strings.TrimSpace(m[4]) != text {
+		return "", ErrTaskLineMismatch
+	}
+	mark := " "
+	if done {
+		mark = "x"
+	}
+	lines[line-1] = m[1] + mark + m[3] + m[4]
+	if cr {
+		lines[line-1] += "\r"
+	}
+	return strings.Join(lines, "\n"), nil
+}
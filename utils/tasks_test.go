@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTasks(t *testing.T) {
+	content := "# Todo\n- [ ] buy milk due:2024-02-01\n  * [x] done item\n```\n- [ ] in code\n```\n- [] not a task"
+	tasks := ParseTasks(content)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, 2, tasks[0].Line)
+	assert.Equal(t, "buy milk due:2024-02-01", tasks[0].Text)
+	assert.False(t, tasks[0].Done)
+	assert.NotNil(t, tasks[0].DueAt)
+	assert.Equal(t, 3, tasks[1].Line)
+	assert.True(t, tasks[1].Done)
+
+	updated, err := SetTaskDone(content, 2, "buy milk due:2024-02-01", true)
+	assert.NoError(t, err)
+	assert.Contains(t, updated, "- [x] buy milk")
+	_, err = SetTaskDone(content, 1, "buy milk due:2024-02-01", true)
+	assert.ErrorIs(t, err, ErrTaskLineMismatch)
+}
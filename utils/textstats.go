@@ -0,0 +1,38 @@
+package utils
+
+import "unicode"
+
+// isCJKWordRune は単語を空白で区切らない文字 (漢字・ひらがな・カタカナ) かどうかを返します。
+// これらの文字は1文字を1語として数えます。
+func isCJKWordRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー' || r == '々'
+}
+
+// CountText はメモ本文 (front matter を除く) の語数と文字数 (空白を除く) を返します。
+// 英語などは空白や記号で区切られた並びを1語、日本語・中国語は1文字を1語として数えます。
+func CountText(content string) (words, characters int) {
+	_, body, _ := SplitFrontMatter(content)
+	inWord := false
+	for _, r := range body {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		characters++
+		switch {
+		case isCJKWordRune(r):
+			words++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if !inWord {
+				words++
+				inWord = true
+			}
+		case inWord && (r == '\'' || r == '’' || r == '-'):
+			// don't や well-known は1語として数える
+		default:
+			inWord = false
+		}
+	}
+	return words, characters
+}
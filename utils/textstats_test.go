@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountText(t *testing.T) {
+	words, characters := CountText("Hello, world! It's a well-known fact.")
+	assert.Equal(t, 6, words)
+	assert.Equal(t, 32, characters)
+
+	// 日本語は1文字を1語として数え、英単語が混ざっていても数えられる
+	words, characters = CountText("今日はGoを書いた。コーヒー2杯")
+	assert.Equal(t, 14, words)
+	assert.Equal(t, 16, characters)
+
+	// front matter は数えない
+	words, characters = CountText("---\nstatus: draft\n---\nメモ")
+	assert.Equal(t, 2, words)
+	assert.Equal(t, 2, characters)
+
+	words, characters = CountText("")
+	assert.Zero(t, words)
+	assert.Zero(t, characters)
+}